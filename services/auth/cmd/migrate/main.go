@@ -0,0 +1,132 @@
+// Command migrate applies the migrations embedded in the auth service to the
+// database named by DATABASE_URL, authenticating with an RDS IAM auth token
+// when DATABASE_IAM_AUTH is set.
+//
+// Usage:
+//
+//	migrate up             apply every pending migration
+//	migrate down [N]       roll back the last N migrations (default 1)
+//	migrate status         print the applied and embedded versions
+//	migrate force VERSION  mark VERSION as applied and clear the dirty flag
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"services/auth/internal/config"
+	"services/auth/internal/database"
+	"services/auth/migrations"
+	"strconv"
+)
+
+const usage = `usage: migrate <command> [args]
+
+commands:
+  up             apply every pending migration
+  down [N]       roll back the last N migrations (default 1)
+  status         print the applied and embedded versions
+  force VERSION  mark VERSION as applied and clear the dirty flag`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadDatabase()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	databaseURL := cfg.DatabaseURL
+	if cfg.DatabaseIAMAuth {
+		// Authenticate as the service does, with a token in place of the
+		// password of DATABASE_URL
+		ctx := context.Background()
+		token, err := database.IAMAuthToken(ctx, cfg.AWSRegion)
+		if err != nil {
+			log.Fatalf("Failed to set up IAM authentication: %v", err)
+		}
+		if databaseURL, err = database.IAMAuthURL(ctx, databaseURL, token); err != nil {
+			log.Fatalf("Failed to authenticate with IAM: %v", err)
+		}
+	}
+
+	runner, err := migrations.NewRunner(databaseURL)
+	if err != nil {
+		log.Fatalf("Failed to create migration runner: %v", err)
+	}
+
+	err = run(runner, os.Args[1], os.Args[2:])
+	if closeErr := runner.Close(); closeErr != nil {
+		log.Printf("Failed to close migration runner: %v", closeErr)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(runner *migrations.Runner, command string, args []string) error {
+	switch command {
+	case "up":
+		if err := runner.Up(); err != nil {
+			return err
+		}
+		return printStatus(runner)
+
+	case "down":
+		steps := 1
+		if len(args) > 0 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[0])
+			}
+			steps = n
+		}
+		if err := runner.Down(steps); err != nil {
+			return err
+		}
+		return printStatus(runner)
+
+	case "status":
+		return printStatus(runner)
+
+	case "force":
+		if len(args) != 1 {
+			return fmt.Errorf("force requires a version\n\n%s", usage)
+		}
+		version, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[0])
+		}
+		if err := runner.Force(version); err != nil {
+			return err
+		}
+		return printStatus(runner)
+
+	default:
+		return fmt.Errorf("unknown command %q\n\n%s", command, usage)
+	}
+}
+
+func printStatus(runner *migrations.Runner) error {
+	status, err := runner.Status()
+	if err != nil {
+		return err
+	}
+
+	state := "up to date"
+	switch {
+	case status.Dirty:
+		state = "dirty, fix the failed migration and run force"
+	case status.Pending():
+		state = fmt.Sprintf("%d pending", status.Latest-status.Version)
+	case status.Version > status.Latest:
+		state = "ahead of this binary"
+	}
+
+	fmt.Printf("version %d of %d (%s)\n", status.Version, status.Latest, state)
+	return nil
+}
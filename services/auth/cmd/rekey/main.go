@@ -0,0 +1,159 @@
+// Command rekey re-encrypts every encrypted column under the active key of the
+// keyring configured by the ENCRYPTION_* settings, then recomputes every blind
+// index with the active BLIND_INDEX_* key, so retired keys can be removed
+// afterwards.
+//
+// Usage:
+//
+//	rekey [-batch-size N] [-dry-run]
+//
+// Rows are updated in batches, each in its own transaction, so the command can
+// run against a live database and be restarted at any point.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"services/auth/internal/config"
+	"services/auth/internal/database"
+	"services/auth/internal/encryption"
+	"services/auth/internal/repositories"
+)
+
+func main() {
+	batchSize := flag.Int("batch-size", 500, "rows re-encrypted per transaction")
+	dryRun := flag.Bool("dry-run", false, "count the values to re-encrypt without changing them")
+	flag.Parse()
+	if *batchSize < 1 {
+		fmt.Fprintln(os.Stderr, "batch-size must be positive")
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadRekey()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	ctx := context.Background()
+	keyring, err := encryption.KeyringFromConfig(ctx, cfg.EncryptionConfig, cfg.AWSRegion)
+	if err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+
+	blind, err := encryption.BlindIndexFromConfig(cfg.EncryptionConfig)
+	if err != nil && !(errors.Is(err, encryption.ErrNoBlindIndex) && len(repositories.BlindIndexColumns) == 0) {
+		log.Fatalf("Failed to load blind index keys: %v", err)
+	}
+
+	// The rekey rewrites the rows it reads, so it never uses the replica
+	poolCfg := cfg.PoolConfig
+	poolCfg.DatabaseReadURL = ""
+	pools, err := database.Connect(ctx, cfg.DatabaseURL, poolCfg, cfg.AWSRegion)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	db := pools.Primary
+	defer db.Close()
+
+	repo := repositories.NewRekeyRepository(db)
+	for _, col := range repositories.EncryptedColumns {
+		if err := rekeyColumn(ctx, repo, col, keyring, *batchSize, *dryRun); err != nil {
+			db.Close()
+			log.Fatal(err)
+		}
+	}
+	for _, col := range repositories.BlindIndexColumns {
+		if err := reindexColumn(ctx, repo, col, keyring, blind, *batchSize, *dryRun); err != nil {
+			db.Close()
+			log.Fatal(err)
+		}
+	}
+}
+
+// rekeyColumn walks col in batches until every value is sealed with the
+// active key and bound to its row.
+func rekeyColumn(ctx context.Context, repo *repositories.RekeyRepository, col repositories.EncryptedColumn, keyring *encryption.Keyring, batchSize int, dryRun bool) error {
+	rekey := keyring.Rekey
+	pending := 0
+	if dryRun {
+		rekey = func(ctx context.Context, ciphertext string, binding encryption.Binding) (string, bool, error) {
+			if !keyring.NeedsRekey(ciphertext) {
+				return ciphertext, false, nil
+			}
+			// Decrypt to report values no key can open
+			if _, err := keyring.Decrypt(ctx, ciphertext, binding); err != nil {
+				return "", false, err
+			}
+			pending++
+			return ciphertext, false, nil
+		}
+	}
+
+	var afterID int64
+	scanned, rekeyed := 0, 0
+	for {
+		batch, err := repo.RekeyBatch(ctx, col, afterID, batchSize, rekey)
+		if err != nil {
+			return fmt.Errorf("rekey %s after id %d: %w", col, afterID, err)
+		}
+		scanned += batch.Scanned
+		rekeyed += batch.Rekeyed
+		afterID = batch.LastID
+		if batch.Scanned < batchSize {
+			break
+		}
+	}
+
+	if dryRun {
+		fmt.Printf("%s: %d values, %d to re-encrypt under key %s\n", col, scanned, pending, keyring.ActiveKeyID())
+		return nil
+	}
+	fmt.Printf("%s: %d values, %d re-encrypted under key %s\n", col, scanned, rekeyed, keyring.ActiveKeyID())
+	return nil
+}
+
+// reindexColumn walks col in batches until every index is computed with the
+// active blind index key.
+func reindexColumn(ctx context.Context, repo *repositories.RekeyRepository, col repositories.BlindIndexColumn, keyring *encryption.Keyring, blind *encryption.BlindIndex, batchSize int, dryRun bool) error {
+	pending := 0
+	reindex := func(ctx context.Context, sealed string, binding encryption.Binding, index *string) (string, bool, error) {
+		if index != nil && !blind.NeedsReindex(*index) {
+			return *index, false, nil
+		}
+		plaintext, err := keyring.Decrypt(ctx, sealed, binding)
+		if err != nil {
+			return "", false, err
+		}
+		if dryRun {
+			pending++
+			return "", false, nil
+		}
+		return blind.Compute(col.Domain(), plaintext), true, nil
+	}
+
+	var afterID int64
+	scanned, reindexed := 0, 0
+	for {
+		batch, err := repo.ReindexBatch(ctx, col, afterID, batchSize, reindex)
+		if err != nil {
+			return fmt.Errorf("reindex %s after id %d: %w", col, afterID, err)
+		}
+		scanned += batch.Scanned
+		reindexed += batch.Rekeyed
+		afterID = batch.LastID
+		if batch.Scanned < batchSize {
+			break
+		}
+	}
+
+	if dryRun {
+		fmt.Printf("%s: %d indexes, %d to recompute with key %s\n", col, scanned, pending, blind.ActiveKeyID())
+		return nil
+	}
+	fmt.Printf("%s: %d indexes, %d recomputed with key %s\n", col, scanned, reindexed, blind.ActiveKeyID())
+	return nil
+}
@@ -0,0 +1,227 @@
+// Package apispec loads openapi.yaml and validates requests against it, so the
+// constraints published to the web client are the ones the API enforces.
+package apispec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strings"
+	"sync"
+
+	auth "services/auth"
+	"services/auth/internal/models"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Field error codes returned in ValidationError.Fields.
+const (
+	FieldRequired      = "required"
+	FieldTooShort      = "too_short"
+	FieldTooLong       = "too_long"
+	FieldInvalidFormat = "invalid_format"
+	FieldInvalidType   = "invalid_type"
+	FieldInvalidValue  = "invalid_value"
+	FieldInvalid       = "invalid"
+)
+
+// ErrInvalidJSON is returned when a request body is not valid JSON.
+var ErrInvalidJSON = errors.New("request body is not valid JSON")
+
+// ValidationError lists every field of a request body that violates the spec.
+type ValidationError struct {
+	Fields []models.FieldError
+}
+
+func (e *ValidationError) Error() string {
+	names := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		names[i] = field.Field + ": " + field.Code
+	}
+	return "request validation failed: " + strings.Join(names, ", ")
+}
+
+// Spec is a parsed and validated OpenAPI document.
+type Spec struct {
+	doc *openapi3.T
+}
+
+var registerFormats sync.Once
+
+// Load parses the OpenAPI document embedded in the binary.
+func Load() (*Spec, error) {
+	return Parse(auth.OpenAPISpec)
+}
+
+// Parse parses and validates an OpenAPI document.
+func Parse(data []byte) (*Spec, error) {
+	registerFormats.Do(func() {
+		openapi3.DefineStringFormatCallback("email", validateEmail)
+	})
+
+	doc, err := openapi3.NewLoader().LoadFromData(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI document: %w", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+	return &Spec{doc: doc}, nil
+}
+
+// validateEmail accepts a bare address with a dotted domain, such as
+// "joao@example.com", and rejects display names like "Joao <joao@example.com>".
+// Surrounding whitespace is allowed: sign-up trims it when normalizing.
+func validateEmail(value string) error {
+	value = strings.TrimSpace(value)
+	addr, err := mail.ParseAddress(value)
+	if err != nil || addr.Address != value {
+		return errors.New("not a valid email address")
+	}
+	domain := value[strings.LastIndex(value, "@")+1:]
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return errors.New("not a valid email address")
+	}
+	return nil
+}
+
+// Operation returns the operation documented for method and path, or nil.
+func (s *Spec) Operation(method, path string) *openapi3.Operation {
+	item := s.doc.Paths.Find(path)
+	if item == nil {
+		return nil
+	}
+	return item.GetOperation(strings.ToUpper(method))
+}
+
+// ValidateRequestBody checks body against the JSON request schema of the
+// operation. Operations that are not documented or take no body are accepted.
+// It returns ErrInvalidJSON or a *ValidationError.
+func (s *Spec) ValidateRequestBody(method, path string, body []byte) error {
+	op := s.Operation(method, path)
+	if op == nil || op.RequestBody == nil || op.RequestBody.Value == nil {
+		return nil
+	}
+
+	media := op.RequestBody.Value.Content.Get("application/json")
+	if media == nil || media.Schema == nil {
+		return nil
+	}
+
+	if len(body) == 0 && !op.RequestBody.Value.Required {
+		return nil
+	}
+
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return ErrInvalidJSON
+	}
+
+	err := media.Schema.Value.VisitJSON(value,
+		openapi3.MultiErrors(),
+		openapi3.VisitAsRequest(),
+	)
+	if err == nil {
+		return nil
+	}
+	return &ValidationError{Fields: fieldErrors(err)}
+}
+
+// fieldErrors flattens the schema errors reported by kin-openapi, keeping the
+// first problem of each field.
+func fieldErrors(err error) []models.FieldError {
+	var schemaErrs []*openapi3.SchemaError
+	collectSchemaErrors(err, &schemaErrs)
+
+	seen := make(map[string]bool)
+	fields := make([]models.FieldError, 0, len(schemaErrs))
+	for _, schemaErr := range schemaErrs {
+		field := fieldError(schemaErr)
+		if seen[field.Field] {
+			continue
+		}
+		seen[field.Field] = true
+		fields = append(fields, field)
+	}
+
+	if len(fields) == 0 {
+		fields = append(fields, models.FieldError{Field: "body", Code: FieldInvalid, Message: "is invalid"})
+	}
+
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].Field < fields[j].Field })
+	return fields
+}
+
+func collectSchemaErrors(err error, out *[]*openapi3.SchemaError) {
+	var multi openapi3.MultiError
+	if errors.As(err, &multi) {
+		for _, e := range multi {
+			collectSchemaErrors(e, out)
+		}
+		return
+	}
+
+	var schemaErr *openapi3.SchemaError
+	if errors.As(err, &schemaErr) {
+		*out = append(*out, schemaErr)
+	}
+}
+
+func fieldError(err *openapi3.SchemaError) models.FieldError {
+	field := strings.Join(err.JSONPointer(), ".")
+	if field == "" {
+		field = "body"
+	}
+
+	schema := err.Schema
+	switch err.SchemaField {
+	case "required":
+		return models.FieldError{Field: field, Code: FieldRequired, Message: "is required"}
+	case "minLength":
+		return models.FieldError{
+			Field:   field,
+			Code:    FieldTooShort,
+			Message: fmt.Sprintf("must be at least %d characters", schema.MinLength),
+			Params:  map[string]any{"min": schema.MinLength},
+		}
+	case "maxLength":
+		maxLength := uint64(0)
+		if schema.MaxLength != nil {
+			maxLength = *schema.MaxLength
+		}
+		return models.FieldError{
+			Field:   field,
+			Code:    FieldTooLong,
+			Message: fmt.Sprintf("must be at most %d characters", maxLength),
+			Params:  map[string]any{"max": maxLength},
+		}
+	case "format":
+		return models.FieldError{
+			Field:   field,
+			Code:    FieldInvalidFormat,
+			Message: fmt.Sprintf("must be a valid %s", schema.Format),
+			Params:  map[string]any{"format": schema.Format},
+		}
+	case "pattern":
+		return models.FieldError{
+			Field:   field,
+			Code:    FieldInvalidFormat,
+			Message: "does not match the expected format",
+			Params:  map[string]any{"pattern": schema.Pattern},
+		}
+	case "type":
+		return models.FieldError{
+			Field:   field,
+			Code:    FieldInvalidType,
+			Message: fmt.Sprintf("must be of type %s", strings.Join(schema.Type.Slice(), " or ")),
+		}
+	case "enum":
+		return models.FieldError{Field: field, Code: FieldInvalidValue, Message: "is not an allowed value"}
+	default:
+		return models.FieldError{Field: field, Code: FieldInvalid, Message: "is invalid"}
+	}
+}
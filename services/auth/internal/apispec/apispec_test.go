@@ -0,0 +1,129 @@
+package apispec
+
+import (
+	"testing"
+
+	"services/auth/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadSpec(t *testing.T) *Spec {
+	t.Helper()
+	spec, err := Load()
+	require.NoError(t, err)
+	return spec
+}
+
+func TestLoad(t *testing.T) {
+	spec := loadSpec(t)
+	assert.NotNil(t, spec.Operation("POST", "/auth/sign-up"))
+	assert.NotNil(t, spec.Operation("get", "/health"))
+	assert.Nil(t, spec.Operation("GET", "/auth/sign-up"))
+	assert.Nil(t, spec.Operation("GET", "/unknown"))
+}
+
+func TestParse_InvalidDocument(t *testing.T) {
+	_, err := Parse([]byte("openapi: 3.0.3\ninfo: {}\npaths: {}\n"))
+	assert.Error(t, err)
+}
+
+func TestValidateRequestBody_Valid(t *testing.T) {
+	spec := loadSpec(t)
+	err := spec.ValidateRequestBody("POST", "/auth/sign-up", []byte(`{"name":"João Silva","email":"joao@example.com"}`))
+	assert.NoError(t, err)
+}
+
+func TestValidateRequestBody_InvalidJSON(t *testing.T) {
+	spec := loadSpec(t)
+
+	err := spec.ValidateRequestBody("POST", "/auth/sign-up", []byte(`{invalid`))
+	assert.ErrorIs(t, err, ErrInvalidJSON)
+
+	err = spec.ValidateRequestBody("POST", "/auth/sign-up", nil)
+	assert.ErrorIs(t, err, ErrInvalidJSON)
+}
+
+func TestValidateRequestBody_FieldErrors(t *testing.T) {
+	spec := loadSpec(t)
+
+	tests := []struct {
+		name string
+		body string
+		want []models.FieldError
+	}{
+		{
+			name: "name too short and email malformed",
+			body: `{"name":"x","email":"not-an-email"}`,
+			want: []models.FieldError{
+				{Field: "email", Code: FieldInvalidFormat, Message: "must be a valid email", Params: map[string]any{"format": "email"}},
+				{Field: "name", Code: FieldTooShort, Message: "must be at least 2 characters", Params: map[string]any{"min": uint64(2)}},
+			},
+		},
+		{
+			name: "name of whitespace",
+			body: `{"name":"  ","email":"joao@example.com"}`,
+			want: []models.FieldError{
+				{Field: "name", Code: FieldInvalidFormat, Message: "does not match the expected format", Params: map[string]any{"pattern": `\S[\s\S]*\S`}},
+			},
+		},
+		{
+			name: "name of one character padded with whitespace",
+			body: `{"name":" x ","email":"joao@example.com"}`,
+			want: []models.FieldError{
+				{Field: "name", Code: FieldInvalidFormat, Message: "does not match the expected format", Params: map[string]any{"pattern": `\S[\s\S]*\S`}},
+			},
+		},
+		{
+			name: "missing fields",
+			body: `{}`,
+			want: []models.FieldError{
+				{Field: "email", Code: FieldRequired, Message: "is required"},
+				{Field: "name", Code: FieldRequired, Message: "is required"},
+			},
+		},
+		{
+			name: "wrong type",
+			body: `{"name":42,"email":"joao@example.com"}`,
+			want: []models.FieldError{
+				{Field: "name", Code: FieldInvalidType, Message: "must be of type string"},
+			},
+		},
+		{
+			name: "body is not an object",
+			body: `"joao@example.com"`,
+			want: []models.FieldError{
+				{Field: "body", Code: FieldInvalidType, Message: "must be of type object"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := spec.ValidateRequestBody("POST", "/auth/sign-up", []byte(tt.body))
+
+			var validationErr *ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			assert.Equal(t, tt.want, validationErr.Fields)
+		})
+	}
+}
+
+func TestValidateRequestBody_UndocumentedOperation(t *testing.T) {
+	spec := loadSpec(t)
+	assert.NoError(t, spec.ValidateRequestBody("GET", "/health", nil))
+	assert.NoError(t, spec.ValidateRequestBody("POST", "/unknown", []byte(`{invalid`)))
+}
+
+func TestValidateEmail(t *testing.T) {
+	valid := []string{"joao@example.com", "first.last+tag@sub.example.co", "joao@example.com ", " joao@example.com"}
+	for _, email := range valid {
+		assert.NoError(t, validateEmail(email), email)
+	}
+
+	invalid := []string{"not-an-email", "joao@localhost", "Joao <joao@example.com>", "joao@.com", "joao@example.", "@example.com", "", "  "}
+	for _, email := range invalid {
+		assert.Error(t, validateEmail(email), email)
+	}
+}
@@ -0,0 +1,144 @@
+package apispec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// OperationRef identifies a documented operation.
+type OperationRef struct {
+	Method string
+	Path   string
+}
+
+// Operations returns every documented operation sorted by path and method.
+func (s *Spec) Operations() []OperationRef {
+	var ops []OperationRef
+	for path, item := range s.doc.Paths.Map() {
+		for method := range item.Operations() {
+			ops = append(ops, OperationRef{Method: method, Path: path})
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i].Path != ops[j].Path {
+			return ops[i].Path < ops[j].Path
+		}
+		return ops[i].Method < ops[j].Method
+	})
+	return ops
+}
+
+// DocumentedStatuses returns the status codes documented for an operation.
+func (s *Spec) DocumentedStatuses(method, path string) []int {
+	op := s.Operation(method, path)
+	if op == nil || op.Responses == nil {
+		return nil
+	}
+
+	var statuses []int
+	for code := range op.Responses.Map() {
+		if status, err := strconv.Atoi(code); err == nil {
+			statuses = append(statuses, status)
+		}
+	}
+	sort.Ints(statuses)
+	return statuses
+}
+
+// ValidateResponse checks a response against the spec. It fails for
+// undocumented operations, status codes and content types, for bodies that
+// violate the schema (including enums such as error codes) and for fields the
+// schema does not declare.
+func (s *Spec) ValidateResponse(method, path string, status int, contentType string, body []byte) error {
+	op := s.Operation(method, path)
+	if op == nil {
+		return fmt.Errorf("%s %s is not documented", method, path)
+	}
+
+	ref := op.Responses.Status(status)
+	if ref == nil || ref.Value == nil {
+		return fmt.Errorf("status %d is not documented for %s %s", status, method, path)
+	}
+
+	if len(ref.Value.Content) == 0 {
+		if len(body) > 0 {
+			return fmt.Errorf("status %d of %s %s is documented without a body", status, method, path)
+		}
+		return nil
+	}
+
+	mediaType := strings.TrimSpace(strings.Split(contentType, ";")[0])
+	media := ref.Value.Content.Get(mediaType)
+	if media == nil || media.Schema == nil {
+		return fmt.Errorf("content type %q is not documented for status %d of %s %s", contentType, status, method, path)
+	}
+	return validateResponseBody(media.Schema.Value, body)
+}
+
+// ValidateComponent checks body against a named component schema. It covers
+// responses that are not tied to a documented operation, such as the
+// router's 404 and 405 errors.
+func (s *Spec) ValidateComponent(name string, body []byte) error {
+	ref, ok := s.doc.Components.Schemas[name]
+	if !ok || ref.Value == nil {
+		return fmt.Errorf("schema %q is not documented", name)
+	}
+	return validateResponseBody(ref.Value, body)
+}
+
+func validateResponseBody(schema *openapi3.Schema, body []byte) error {
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return fmt.Errorf("response body is not valid JSON: %w", err)
+	}
+
+	if err := schema.VisitJSON(value, openapi3.MultiErrors(), openapi3.VisitAsResponse()); err != nil {
+		return err
+	}
+	return errors.Join(undocumentedFields(schema, value, "")...)
+}
+
+// undocumentedFields reports object keys that are neither declared as
+// properties nor allowed through additionalProperties.
+func undocumentedFields(schema *openapi3.Schema, value any, path string) []error {
+	if schema == nil {
+		return nil
+	}
+
+	var errs []error
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+
+			if prop, ok := schema.Properties[key]; ok {
+				errs = append(errs, undocumentedFields(prop.Value, child, childPath)...)
+				continue
+			}
+			if additional := schema.AdditionalProperties; additional.Schema != nil {
+				errs = append(errs, undocumentedFields(additional.Schema.Value, child, childPath)...)
+				continue
+			}
+			if additional := schema.AdditionalProperties; additional.Has != nil && *additional.Has {
+				continue
+			}
+			errs = append(errs, fmt.Errorf("field %q is not documented", childPath))
+		}
+	case []any:
+		if schema.Items != nil {
+			for i, child := range v {
+				errs = append(errs, undocumentedFields(schema.Items.Value, child, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,119 @@
+package apispec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSpec = `
+openapi: 3.0.3
+info:
+  title: Test
+  version: 1.0.0
+paths:
+  /items:
+    get:
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: "#/components/schemas/Item"
+        "204":
+          description: No content
+    post:
+      responses:
+        "201":
+          description: Created
+components:
+  schemas:
+    Item:
+      type: object
+      required: [status]
+      properties:
+        status:
+          type: string
+          enum: [active]
+        tags:
+          type: array
+          items:
+            type: object
+            properties:
+              name:
+                type: string
+        labels:
+          type: object
+          additionalProperties:
+            type: object
+            properties:
+              value:
+                type: string
+        extra:
+          type: object
+          additionalProperties: true
+`
+
+func parseTestSpec(t *testing.T) *Spec {
+	t.Helper()
+	spec, err := Parse([]byte(testSpec))
+	require.NoError(t, err)
+	return spec
+}
+
+func TestSpec_Operations(t *testing.T) {
+	spec := parseTestSpec(t)
+	assert.Equal(t, []OperationRef{
+		{Method: "GET", Path: "/items"},
+		{Method: "POST", Path: "/items"},
+	}, spec.Operations())
+	assert.Equal(t, []int{200, 204}, spec.DocumentedStatuses("GET", "/items"))
+	assert.Nil(t, spec.DocumentedStatuses("DELETE", "/items"))
+}
+
+func TestSpec_ValidateResponse(t *testing.T) {
+	spec := parseTestSpec(t)
+	const jsonType = "application/json; charset=utf-8"
+
+	tests := []struct {
+		name        string
+		method      string
+		status      int
+		contentType string
+		body        string
+		wantErr     string
+	}{
+		{name: "valid", method: "GET", status: 200, contentType: jsonType, body: `{"status":"active","tags":[{"name":"a"}],"labels":{"x":{"value":"y"}},"extra":{"any":1}}`},
+		{name: "documented without body", method: "GET", status: 204},
+		{name: "undocumented operation", method: "DELETE", status: 200, wantErr: "not documented"},
+		{name: "undocumented status", method: "GET", status: 500, contentType: jsonType, body: `{}`, wantErr: "status 500 is not documented"},
+		{name: "unexpected body", method: "POST", status: 201, contentType: jsonType, body: `{}`, wantErr: "documented without a body"},
+		{name: "undocumented content type", method: "GET", status: 200, contentType: "text/plain", body: `ok`, wantErr: "content type"},
+		{name: "undocumented enum value", method: "GET", status: 200, contentType: jsonType, body: `{"status":"created"}`, wantErr: "status"},
+		{name: "undocumented field", method: "GET", status: 200, contentType: jsonType, body: `{"status":"active","secret":"x"}`, wantErr: `field "secret" is not documented`},
+		{name: "undocumented nested field", method: "GET", status: 200, contentType: jsonType, body: `{"status":"active","tags":[{"name":"a","id":1}]}`, wantErr: `field "tags[0].id" is not documented`},
+		{name: "undocumented map value field", method: "GET", status: 200, contentType: jsonType, body: `{"status":"active","labels":{"x":{"other":1}}}`, wantErr: `field "labels.x.other" is not documented`},
+		{name: "invalid JSON", method: "GET", status: 200, contentType: jsonType, body: `{`, wantErr: "not valid JSON"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := spec.ValidateResponse(tt.method, "/items", tt.status, tt.contentType, []byte(tt.body))
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestSpec_ValidateComponent(t *testing.T) {
+	spec := parseTestSpec(t)
+
+	assert.NoError(t, spec.ValidateComponent("Item", []byte(`{"status":"active"}`)))
+	assert.Error(t, spec.ValidateComponent("Item", []byte(`{"status":"active","secret":"x"}`)))
+	assert.ErrorContains(t, spec.ValidateComponent("Missing", []byte(`{}`)), "not documented")
+}
@@ -0,0 +1,129 @@
+// Package audit records security-relevant events, such as sign-ups and
+// logins, in an append-only log. Users review the events of their account
+// as its activity.
+package audit
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// Event types. Flows record the type of each security-relevant step they
+// take.
+const (
+	TypeSignup        = "signup"
+	TypeConfirmation  = "confirmation"
+	TypeLogin         = "login"
+	TypeTokenRefresh  = "token_refresh"
+	TypeProfileChange = "profile_change"
+	TypeEmailChange   = "email_change"
+	TypeAdminAction   = "admin_action"
+)
+
+// Outcomes of an event.
+const (
+	OutcomeSuccess = "success"
+	// OutcomeDenied is a refusal by policy, e.g. a blocked address or a
+	// failed bot check.
+	OutcomeDenied = "denied"
+	// OutcomeFailure is an error of the service or a dependency.
+	OutcomeFailure = "failure"
+)
+
+// Actors of events, and of the writes recorded by repositories.WithActor.
+// ActorSystem is the default of both.
+const (
+	// ActorSystem acts outside any request, e.g. the outbox dispatcher.
+	ActorSystem = "system"
+	// ActorAnonymous makes unauthenticated requests, such as sign-ups.
+	ActorAnonymous = "anonymous"
+)
+
+// ErrInvalidCursor is returned for a cursor that Store.ListByUser did not
+// return.
+var ErrInvalidCursor = errors.New("invalid activity cursor")
+
+// Event is one entry of the audit log.
+type Event struct {
+	ID         int64     `db:"id" json:"id"`
+	OccurredAt time.Time `db:"occurred_at" json:"occurred_at"`
+	Type       string    `db:"type" json:"type"`
+	Outcome    string    `db:"outcome" json:"outcome"`
+	// Reason details the outcome with a stable code, e.g. "user_exists".
+	Reason string `db:"reason" json:"reason,omitempty"`
+	// UserID is the account the event concerns, if known.
+	UserID *int `db:"user_id" json:"-"`
+	// Actor made the request, e.g. "anonymous" or "user:42".
+	Actor     string `db:"actor" json:"actor"`
+	IP        string `db:"ip_address" json:"ip_address,omitempty"`
+	UserAgent string `db:"user_agent" json:"user_agent,omitempty"`
+}
+
+// Store keeps audit events.
+type Store interface {
+	// Append stores event, setting its ID and, when zero, its time.
+	Append(ctx context.Context, event *Event) error
+	// ListByUser returns up to limit events of the user with userID, newest
+	// first, after the event cursor points at ("" for the newest). It also
+	// returns the cursor of the following events, or "" when there are none.
+	ListByUser(ctx context.Context, userID int, cursor string, limit int) ([]Event, string, error)
+}
+
+// Client describes who sent a request.
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+type clientKey struct{}
+
+// WithClient returns a context whose events are recorded as sent by client.
+func WithClient(ctx context.Context, client Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// ClientFrom returns the client set by WithClient.
+func ClientFrom(ctx context.Context) Client {
+	client, _ := ctx.Value(clientKey{}).(Client)
+	return client
+}
+
+// Recorder appends events to a Store. A nil Recorder records nothing, so
+// components can take one as an option.
+type Recorder struct {
+	store Store
+}
+
+func NewRecorder(store Store) *Recorder {
+	return &Recorder{store: store}
+}
+
+// Record appends event, filling in the client of the request carried by
+// ctx and ActorSystem when it has no actor. A failure is logged rather than
+// returned: losing an event must not fail the operation it describes.
+func (r *Recorder) Record(ctx context.Context, event Event) {
+	if r == nil {
+		return
+	}
+	client := ClientFrom(ctx)
+	if event.IP == "" {
+		event.IP = client.IP
+	}
+	if event.UserAgent == "" {
+		event.UserAgent = client.UserAgent
+	}
+	if event.Actor == "" {
+		event.Actor = ActorSystem
+	}
+	if err := r.store.Append(ctx, &event); err != nil {
+		log.Printf("Failed to record %s audit event (%s): %v", event.Type, event.Outcome, err)
+	}
+}
+
+// Activity returns a page of the events of the user with userID, newest
+// first, and the cursor of the next page (see Store.ListByUser).
+func (r *Recorder) Activity(ctx context.Context, userID int, cursor string, limit int) ([]Event, string, error) {
+	return r.store.ListByUser(ctx, userID, cursor, limit)
+}
@@ -0,0 +1,79 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingStore struct{ MemoryStore }
+
+func (*failingStore) Append(context.Context, *Event) error {
+	return errors.New("database down")
+}
+
+func TestRecorder_Record(t *testing.T) {
+	store := NewMemoryStore()
+	recorder := NewRecorder(store)
+	ctx := WithClient(context.Background(), Client{IP: "203.0.113.7", UserAgent: "curl/8.0"})
+
+	recorder.Record(ctx, Event{Type: TypeSignup, Outcome: OutcomeSuccess})
+	recorder.Record(ctx, Event{Type: TypeLogin, Outcome: OutcomeDenied, Actor: ActorAnonymous, IP: "198.51.100.1"})
+
+	events := store.Events()
+	require.Len(t, events, 2)
+	assert.Equal(t, int64(1), events[0].ID)
+	assert.WithinDuration(t, time.Now(), events[0].OccurredAt, time.Minute)
+	assert.Equal(t, ActorSystem, events[0].Actor)
+	assert.Equal(t, "203.0.113.7", events[0].IP)
+	assert.Equal(t, "curl/8.0", events[0].UserAgent)
+	assert.Equal(t, ActorAnonymous, events[1].Actor)
+	assert.Equal(t, "198.51.100.1", events[1].IP)
+}
+
+func TestRecorder_Record_IgnoresFailures(t *testing.T) {
+	assert.NotPanics(t, func() {
+		NewRecorder(&failingStore{}).Record(context.Background(), Event{Type: TypeSignup})
+	})
+}
+
+func TestRecorder_Nil(t *testing.T) {
+	var recorder *Recorder
+	assert.NotPanics(t, func() {
+		recorder.Record(context.Background(), Event{Type: TypeSignup})
+	})
+}
+
+func TestMemoryStore_ListByUser(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	userID, otherID := 1, 2
+	for _, id := range []*int{&userID, &otherID, &userID, &userID} {
+		require.NoError(t, store.Append(ctx, &Event{Type: TypeSignup, UserID: id}))
+	}
+
+	events, next, err := store.ListByUser(ctx, userID, "", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{4, 3}, ids(events))
+	require.NotEmpty(t, next)
+
+	events, next, err = store.ListByUser(ctx, userID, next, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1}, ids(events))
+	assert.Empty(t, next)
+
+	_, _, err = store.ListByUser(ctx, userID, "garbage", 2)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func ids(events []Event) []int64 {
+	ids := make([]int64, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+	}
+	return ids
+}
@@ -0,0 +1,67 @@
+package audit
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps events in process memory, so it is meant for tests and
+// local development.
+type MemoryStore struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Append implements Store.
+func (s *MemoryStore) Append(_ context.Context, event *Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event.ID = int64(len(s.events) + 1)
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+	s.events = append(s.events, *event)
+	return nil
+}
+
+// ListByUser implements Store. Cursors are event IDs.
+func (s *MemoryStore) ListByUser(_ context.Context, userID int, cursor string, limit int) ([]Event, string, error) {
+	before := int64(-1)
+	if cursor != "" {
+		id, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		before = id
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []Event
+	for _, event := range slices.Backward(s.events) {
+		if event.UserID == nil || *event.UserID != userID || (before >= 0 && event.ID >= before) {
+			continue
+		}
+		if len(events) == limit {
+			return events, strconv.FormatInt(events[limit-1].ID, 10), nil
+		}
+		events = append(events, event)
+	}
+	return events, "", nil
+}
+
+// Events returns every recorded event, oldest first.
+func (s *MemoryStore) Events() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.events)
+}
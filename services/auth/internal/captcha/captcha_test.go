@@ -0,0 +1,117 @@
+package captcha
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"services/auth/internal/config"
+	"services/auth/internal/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSiteVerifier_Verify(t *testing.T) {
+	fake := testhelpers.NewFakeSiteVerify(t)
+	verifier := NewSiteVerifier(fake.URL, fake.Secret, http.DefaultClient)
+	ctx := context.Background()
+
+	require.NoError(t, verifier.Verify(ctx, fake.ValidToken, "203.0.113.7"))
+	assert.Equal(t, []testhelpers.FakeSiteVerifyRequest{
+		{Secret: fake.Secret, Token: fake.ValidToken, RemoteIP: "203.0.113.7"},
+	}, fake.Requests())
+
+	assert.ErrorIs(t, verifier.Verify(ctx, "forged-token", ""), ErrRejected)
+	assert.ErrorIs(t, verifier.Verify(ctx, "", ""), ErrMissingToken)
+	assert.Len(t, fake.Requests(), 2, "a missing token is not sent to the provider")
+}
+
+func TestSiteVerifier_Verify_WrongSecret(t *testing.T) {
+	fake := testhelpers.NewFakeSiteVerify(t)
+	verifier := NewSiteVerifier(fake.URL, "wrong-secret", http.DefaultClient)
+
+	err := verifier.Verify(context.Background(), fake.ValidToken, "")
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.NotErrorIs(t, err, ErrRejected)
+}
+
+func TestSiteVerifier_Verify_FailsClosed(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"server error", func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}},
+		{"invalid body", func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte("<html>"))
+		}},
+		{"timeout", func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(200 * time.Millisecond):
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			verifier := NewSiteVerifier(server.URL, "secret", &http.Client{Timeout: 50 * time.Millisecond})
+			assert.ErrorIs(t, verifier.Verify(context.Background(), "token", ""), ErrUnavailable)
+		})
+	}
+
+	t.Run("unreachable", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+
+		verifier := NewSiteVerifier(server.URL, "secret", http.DefaultClient)
+		assert.ErrorIs(t, verifier.Verify(context.Background(), "token", ""), ErrUnavailable)
+	})
+}
+
+func TestNew(t *testing.T) {
+	verifier, err := New(&config.Config{BotCheckProvider: "none"})
+	require.NoError(t, err)
+	assert.IsType(t, NoOp{}, verifier)
+	assert.NoError(t, verifier.Verify(context.Background(), "", ""))
+
+	_, err = New(&config.Config{BotCheckProvider: "turnstile"})
+	assert.ErrorContains(t, err, "BOT_CHECK_SECRET")
+
+	_, err = New(&config.Config{BotCheckProvider: "friendly-captcha"})
+	assert.Error(t, err)
+
+	fake := testhelpers.NewFakeSiteVerify(t)
+	verifier, err = New(&config.Config{
+		BotCheckProvider: "hcaptcha",
+		BotCheckSecret:   fake.Secret,
+		BotCheckEndpoint: fake.URL,
+		BotCheckTimeout:  time.Second,
+	})
+	require.NoError(t, err)
+	assert.NoError(t, verifier.Verify(context.Background(), fake.ValidToken, ""))
+}
+
+func TestParseProvider(t *testing.T) {
+	for value, want := range map[string]Provider{
+		"":          ProviderNone,
+		"none":      ProviderNone,
+		"turnstile": ProviderTurnstile,
+		"hcaptcha":  ProviderHCaptcha,
+		"recaptcha": ProviderReCAPTCHA,
+	} {
+		got, err := ParseProvider(value)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+		if want != ProviderNone {
+			assert.NotEmpty(t, endpoints[want])
+		}
+	}
+}
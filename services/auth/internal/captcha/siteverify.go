@@ -0,0 +1,77 @@
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// secretErrorCodes are siteverify errors caused by our configuration rather
+// than by the client's token.
+var secretErrorCodes = []string{"missing-input-secret", "invalid-input-secret", "sitekey-secret-mismatch"}
+
+// SiteVerifier checks tokens against a siteverify endpoint, the protocol
+// shared by Turnstile, hCaptcha and reCAPTCHA.
+type SiteVerifier struct {
+	endpoint string
+	secret   string
+	client   *http.Client
+}
+
+func NewSiteVerifier(endpoint, secret string, client *http.Client) *SiteVerifier {
+	return &SiteVerifier{endpoint: endpoint, secret: secret, client: client}
+}
+
+type siteVerifyResponse struct {
+	Success    bool     `json:"success"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+// Verify implements BotVerifier. Transport failures, unexpected answers and
+// secret misconfiguration all return ErrUnavailable.
+func (v *SiteVerifier) Verify(ctx context.Context, token, remoteIP string) error {
+	if token == "" {
+		return ErrMissingToken
+	}
+
+	form := url.Values{"secret": {v.secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: siteverify answered %d", ErrUnavailable, resp.StatusCode)
+	}
+
+	var result siteVerifyResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&result); err != nil {
+		return fmt.Errorf("%w: invalid siteverify response: %v", ErrUnavailable, err)
+	}
+
+	if result.Success {
+		return nil
+	}
+	for _, code := range result.ErrorCodes {
+		if slices.Contains(secretErrorCodes, code) {
+			return fmt.Errorf("%w: %s", ErrUnavailable, code)
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrRejected, strings.Join(result.ErrorCodes, ", "))
+}
@@ -9,22 +9,103 @@ import (
 	"fmt"
 	"log"
 	"services/auth/internal/config"
+	"services/auth/internal/metrics"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
 	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
-	"github.com/google/uuid"
+	"github.com/aws/smithy-go"
 )
 
+// IdentityProvider is implemented by Client and FakeClient.
+type IdentityProvider interface {
+	// SignUp registers email for the user with userID, from which the
+	// username is derived, and returns the sub of the new account.
+	SignUp(ctx context.Context, userID int, email, password, name string) (string, error)
+	// IsUserConfirmed reports on the account registered for the user with
+	// userID under the username derived from it, never on an account of
+	// another user sharing the email.
+	IsUserConfirmed(ctx context.Context, userID int, email string) (bool, string, string, error)
+	ResendConfirmationCode(ctx context.Context, username string) error
+	Ping(ctx context.Context) error
+}
+
+// ErrUserNotFound is returned by IsUserConfirmed when no account is
+// registered for the user.
+var ErrUserNotFound = errors.New("user not found")
+
 type Client struct {
 	client       *cognitoidentityprovider.Client
 	clientID     string
 	clientSecret string
 	userPoolID   string
-	endpoint     string // Store endpoint to detect local vs AWS
+	endpoint     string
+	mode         Mode
+	profile      profile
+
+	policy  Policy
+	breaker *breaker
+	sleep   func(ctx context.Context, d time.Duration) error
+}
+
+// ClientOption configures a Client.
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	httpClient aws.HTTPClient
+	policy     *Policy
+}
+
+// WithHTTPClient sends the SDK requests through httpClient, e.g. a fake
+// transport in tests.
+func WithHTTPClient(httpClient aws.HTTPClient) ClientOption {
+	return func(o *clientOptions) {
+		o.httpClient = httpClient
+	}
+}
+
+// WithPolicy overrides the timeout, retry and circuit breaker policy read
+// from the configuration.
+func WithPolicy(policy Policy) ClientOption {
+	return func(o *clientOptions) {
+		o.policy = &policy
+	}
+}
+
+// New returns the identity provider selected by cfg.IdentityProvider.
+func New(cfg *config.Config) (IdentityProvider, error) {
+	mode, err := ParseMode(cfg.IdentityProvider)
+	if err != nil {
+		return nil, err
+	}
+	if mode == ModeFake {
+		if config.IsLambda() {
+			// A deploy must never accept sign-ups nobody can confirm
+			return nil, fmt.Errorf("identity provider mode %s is not allowed in Lambda", mode)
+		}
+		log.Printf("Using in-memory fake identity provider")
+		return NewFakeClient(), nil
+	}
+	return NewClient(cfg)
+}
+
+// checkAWSEndpoint rejects a COGNITO_ENDPOINT left over from cognito-local,
+// e.g. in a .env file written before IDENTITY_PROVIDER defaulted to aws:
+// Cognito only serves HTTPS, so a plain HTTP endpoint is an emulator. Other
+// overrides, such as FIPS endpoints, are allowed but logged.
+func checkAWSEndpoint(mode Mode, endpoint string) error {
+	if mode != ModeAWS || endpoint == "" {
+		return nil
+	}
+	if !strings.HasPrefix(endpoint, "https://") {
+		return fmt.Errorf("COGNITO_ENDPOINT %s is not a Cognito endpoint: set IDENTITY_PROVIDER=%s to use an emulator", endpoint, ModeCognitoLocal)
+	}
+	log.Printf("Warning: COGNITO_ENDPOINT %s overrides the AWS endpoint of identity provider mode %s", endpoint, mode)
+	return nil
 }
 
 // calculateSecretHash calculates the SECRET_HASH for Cognito API calls
@@ -36,13 +117,61 @@ func calculateSecretHash(username, clientID, clientSecret string) string {
 	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
 }
 
-func NewClient(cfg *config.Config) (*Client, error) {
-	opts := []func(*awsconfig.LoadOptions) error{
-		awsconfig.WithRegion("us-east-2"), // Default region, can be overridden by env
+// errorClass classifies a Cognito error for metrics: the API error code when
+// Cognito answered, otherwise a coarse transport-level class.
+func errorClass(err error) string {
+	if err == nil {
+		return ""
 	}
 
-	// Use dummy credentials for cognito-local/LocalStack
-	if cfg.CognitoEndpoint != "" {
+	var apiErr smithy.APIError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr.ErrorCode()
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		return "unknown"
+	}
+}
+
+// observe records the latency and error class of a Cognito operation.
+func observe(operation string, start time.Time, err error) {
+	metrics.Auth.ObserveCognitoCall(operation, time.Since(start), errorClass(err))
+}
+
+func NewClient(cfg *config.Config, options ...ClientOption) (*Client, error) {
+	var o clientOptions
+	for _, option := range options {
+		option(&o)
+	}
+	policy := PolicyFromConfig(cfg)
+	if o.policy != nil {
+		policy = *o.policy
+	}
+	policy = policy.withDefaults()
+
+	mode, err := ParseMode(cfg.IdentityProvider)
+	if err != nil {
+		return nil, err
+	}
+	prof := profileFor(mode)
+	if prof.requiresEndpoint && cfg.CognitoEndpoint == "" {
+		return nil, fmt.Errorf("identity provider mode %s requires COGNITO_ENDPOINT", mode)
+	}
+	if err := checkAWSEndpoint(mode, cfg.CognitoEndpoint); err != nil {
+		return nil, err
+	}
+
+	opts := []func(*awsconfig.LoadOptions) error{}
+	if cfg.AWSRegion != "" {
+		opts = append(opts, awsconfig.WithRegion(cfg.AWSRegion))
+	}
+
+	// Emulators accept any credentials, so don't depend on a real AWS profile
+	if prof.staticCredentials {
 		opts = append(opts, awsconfig.WithCredentialsProvider(
 			credentials.NewStaticCredentialsProvider("test", "test", ""),
 		))
@@ -54,7 +183,18 @@ func NewClient(cfg *config.Config) (*Client, error) {
 	}
 
 	// Configure custom endpoint using BaseEndpoint (modern approach, replaces deprecated WithEndpointResolverWithOptions)
-	clientOpts := []func(*cognitoidentityprovider.Options){}
+	clientOpts := []func(*cognitoidentityprovider.Options){
+		// Retries are driven by the policy in call, which knows which
+		// operations are safe to repeat
+		func(o *cognitoidentityprovider.Options) {
+			o.Retryer = aws.NopRetryer{}
+		},
+	}
+	if o.httpClient != nil {
+		clientOpts = append(clientOpts, func(co *cognitoidentityprovider.Options) {
+			co.HTTPClient = o.httpClient
+		})
+	}
 	if cfg.CognitoEndpoint != "" {
 		log.Printf("Configuring Cognito client with custom endpoint: %s", cfg.CognitoEndpoint)
 		clientOpts = append(clientOpts, func(o *cognitoidentityprovider.Options) {
@@ -64,8 +204,8 @@ func NewClient(cfg *config.Config) (*Client, error) {
 
 	client := cognitoidentityprovider.NewFromConfig(awsCfg, clientOpts...)
 
-	log.Printf("Cognito client initialized - UserPoolID: %s, ClientID: %s, Endpoint: %s",
-		cfg.CognitoUserPoolID, cfg.CognitoClientID, cfg.CognitoEndpoint)
+	log.Printf("Cognito client initialized - Mode: %s, Region: %s, UserPoolID: %s, ClientID: %s, Endpoint: %s",
+		mode, awsCfg.Region, cfg.CognitoUserPoolID, cfg.CognitoClientID, cfg.CognitoEndpoint)
 
 	return &Client{
 		client:       client,
@@ -73,25 +213,16 @@ func NewClient(cfg *config.Config) (*Client, error) {
 		clientSecret: cfg.CognitoClientSecret,
 		userPoolID:   cfg.CognitoUserPoolID,
 		endpoint:     cfg.CognitoEndpoint,
+		mode:         mode,
+		profile:      prof,
+		policy:       policy,
+		breaker:      newBreaker(policy.BreakerThreshold, policy.BreakerCooldown),
+		sleep:        sleep,
 	}, nil
 }
 
-func (c *Client) SignUp(ctx context.Context, email, password, name string) (string, error) {
-	// Determine username based on endpoint configuration
-	// - For cognito-local (endpoint contains localhost:9229): use email as username
-	// - For AWS Cognito with email alias: use UUID (AWS doesn't allow email format when email is alias)
-	var username string
-	isLocalEndpoint := c.endpoint != "" && strings.Contains(c.endpoint, "localhost:9229")
-
-	if isLocalEndpoint {
-		// cognito-local requires email as username
-		username = email
-		log.Printf("Using email as username for cognito-local")
-	} else {
-		// AWS Cognito with email alias requires UUID as username
-		username = uuid.New().String()
-		log.Printf("Using UUID as username for AWS Cognito")
-	}
+func (c *Client) SignUp(ctx context.Context, userID int, email, password, name string) (string, error) {
+	username := c.profile.usernameFor(userID, email)
 
 	input := &cognitoidentityprovider.SignUpInput{
 		ClientId: aws.String(c.clientID),
@@ -105,7 +236,7 @@ func (c *Client) SignUp(ctx context.Context, email, password, name string) (stri
 	}
 
 	// Add SECRET_HASH if client secret is configured
-	// SECRET_HASH uses the username (email for local, UUID for AWS)
+	// SECRET_HASH uses the username (email for local modes, UUID for AWS)
 	if c.clientSecret != "" {
 		secretHash := calculateSecretHash(username, c.clientID, c.clientSecret)
 		input.SecretHash = aws.String(secretHash)
@@ -115,7 +246,12 @@ func (c *Client) SignUp(ctx context.Context, email, password, name string) (stri
 	log.Printf("Calling Cognito SignUp - Email: %s, ClientID: %s, UserPoolID: %s",
 		email, c.clientID, c.userPoolID)
 
-	output, err := c.client.SignUp(ctx, input)
+	var output *cognitoidentityprovider.SignUpOutput
+	err := c.call(ctx, "SignUp", false, func(ctx context.Context) error {
+		var err error
+		output, err = c.client.SignUp(ctx, input)
+		return err
+	})
 	if err != nil {
 		log.Printf("Cognito SignUp error: %v", err)
 		return "", fmt.Errorf("cognito signup failed: %w", err)
@@ -130,37 +266,40 @@ func (c *Client) SignUp(ctx context.Context, email, password, name string) (stri
 	return *output.UserSub, nil
 }
 
-// IsUserConfirmed checks if a user is confirmed in Cognito
-// It tries to find the user by email and checks their status
+// IsUserConfirmed checks if the account of the user with userID, registered
+// under the username derived from userID and email, is confirmed in Cognito.
+// The account is looked up by that username rather than by email, which in
+// ModeAWS is only an alias that other accounts may share.
 // Returns: isConfirmed, username, userSub (CognitoID), error.
-func (c *Client) IsUserConfirmed(ctx context.Context, email string) (bool, string, string, error) {
-	// First, try to find the user by listing users with the email attribute
-	// We'll search for users with matching email
-	input := &cognitoidentityprovider.ListUsersInput{
+func (c *Client) IsUserConfirmed(ctx context.Context, userID int, email string) (bool, string, string, error) {
+	username := c.profile.usernameFor(userID, email)
+	input := &cognitoidentityprovider.AdminGetUserInput{
 		UserPoolId: aws.String(c.userPoolID),
-		Filter:     aws.String(fmt.Sprintf("email = \"%s\"", email)),
-		Limit:      aws.Int32(1),
+		Username:   aws.String(username),
 	}
 
-	output, err := c.client.ListUsers(ctx, input)
-	if err != nil {
-		log.Printf("Error listing users: %v", err)
-		return false, "", "", fmt.Errorf("failed to list users: %w", err)
+	var output *cognitoidentityprovider.AdminGetUserOutput
+	err := c.call(ctx, "AdminGetUser", true, func(ctx context.Context) error {
+		var err error
+		output, err = c.client.AdminGetUser(ctx, input)
+		return err
+	})
+	var notFound *types.UserNotFoundException
+	if errors.As(err, &notFound) {
+		return false, "", "", ErrUserNotFound
 	}
-
-	if len(output.Users) == 0 {
-		return false, "", "", errors.New("user not found")
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		return false, "", "", fmt.Errorf("failed to get user: %w", err)
 	}
 
-	user := output.Users[0]
-	username := ""
-	if user.Username != nil {
-		username = *user.Username
+	if output.Username != nil {
+		username = *output.Username
 	}
 
 	// Get UserSub - try to find it in user attributes first
 	userSub := username // fallback to username
-	for _, attr := range user.Attributes {
+	for _, attr := range output.UserAttributes {
 		if attr.Name != nil && *attr.Name == "sub" && attr.Value != nil {
 			userSub = *attr.Value
 			break
@@ -170,23 +309,38 @@ func (c *Client) IsUserConfirmed(ctx context.Context, email string) (bool, strin
 
 	// Check if user is confirmed
 	// UserStatus can be: UNCONFIRMED, CONFIRMED, ARCHIVED, COMPROMISED, UNKNOWN, RESET_REQUIRED, FORCE_CHANGE_PASSWORD
-	isConfirmed := user.UserStatus == types.UserStatusTypeConfirmed
+	isConfirmed := output.UserStatus == types.UserStatusTypeConfirmed
 
 	log.Printf("User status check - Email: %s, Username: %s, UserSub: %s, Status: %s, Confirmed: %v",
-		email, username, userSub, user.UserStatus, isConfirmed)
+		email, username, userSub, output.UserStatus, isConfirmed)
 
 	return isConfirmed, username, userSub, nil
 }
 
+// Ping verifies that the user pool client exists and is reachable with the
+// configured credentials. It is used by the readiness check.
+func (c *Client) Ping(ctx context.Context) error {
+	input := &cognitoidentityprovider.DescribeUserPoolClientInput{
+		UserPoolId: aws.String(c.userPoolID),
+		ClientId:   aws.String(c.clientID),
+	}
+
+	err := c.call(ctx, "DescribeUserPoolClient", true, func(ctx context.Context) error {
+		_, err := c.client.DescribeUserPoolClient(ctx, input)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe user pool client: %w", err)
+	}
+
+	return nil
+}
+
 // ResendConfirmationCode resends the confirmation code to the user.
 func (c *Client) ResendConfirmationCode(ctx context.Context, username string) error {
-	// Check if we're using cognito-local (which doesn't support ResendConfirmationCode)
-	isLocalEndpoint := c.endpoint != "" && strings.Contains(c.endpoint, "localhost:9229")
-
-	if isLocalEndpoint {
-		// cognito-local doesn't support ResendConfirmationCode operation
+	if !c.profile.resendSupported {
 		// In local development, we'll just log that the code would be resent
-		log.Printf("Local environment detected - ResendConfirmationCode not supported by cognito-local")
+		log.Printf("ResendConfirmationCode not supported in %s mode", c.mode)
 		log.Printf("In production, confirmation code would be resent to: %s", username)
 		return nil
 	}
@@ -206,7 +360,10 @@ func (c *Client) ResendConfirmationCode(ctx context.Context, username string) er
 	log.Printf("Resending confirmation code - Username: %s, ClientID: %s",
 		username, c.clientID)
 
-	_, err := c.client.ResendConfirmationCode(ctx, input)
+	err := c.call(ctx, "ResendConfirmationCode", false, func(ctx context.Context) error {
+		_, err := c.client.ResendConfirmationCode(ctx, input)
+		return err
+	})
 	if err != nil {
 		log.Printf("Error resending confirmation code: %v", err)
 		return fmt.Errorf("failed to resend confirmation code: %w", err)
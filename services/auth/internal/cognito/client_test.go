@@ -5,12 +5,14 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
-	"strings"
+	"errors"
+	"fmt"
 	"testing"
 
 	"services/auth/internal/config"
 
 	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -86,6 +88,7 @@ func TestNewClient(t *testing.T) {
 			CognitoClientID:     "test_client_id",
 			CognitoClientSecret: "test_secret",
 			CognitoEndpoint:     "http://localhost:9229",
+			IdentityProvider:    string(ModeCognitoLocal),
 		}
 
 		client, err := NewClient(cfg)
@@ -125,6 +128,7 @@ func TestSignUp_Integration(t *testing.T) {
 		CognitoClientID:     "test_client_id",
 		CognitoClientSecret: "",
 		CognitoEndpoint:     "http://localhost:9229",
+		IdentityProvider:    string(ModeCognitoLocal),
 	}
 
 	client, err := NewClient(cfg)
@@ -134,7 +138,7 @@ func TestSignUp_Integration(t *testing.T) {
 
 	// This test requires cognito-local to be running and configured
 	// Skip if not available
-	_, err = client.SignUp(ctx, "test@example.com", "TestPassword123!", "Test User")
+	_, err = client.SignUp(ctx, 1, "test@example.com", "TestPassword123!", "Test User")
 	if err != nil {
 		t.Skipf("Skipping integration test - cognito-local not available: %v", err)
 	}
@@ -151,6 +155,7 @@ func TestIsUserConfirmed_Integration(t *testing.T) {
 		CognitoClientID:     "test_client_id",
 		CognitoClientSecret: "",
 		CognitoEndpoint:     "http://localhost:9229",
+		IdentityProvider:    string(ModeCognitoLocal),
 	}
 
 	client, err := NewClient(cfg)
@@ -159,7 +164,7 @@ func TestIsUserConfirmed_Integration(t *testing.T) {
 	ctx := context.Background()
 
 	// Test with non-existent user
-	_, _, _, err = client.IsUserConfirmed(ctx, "nonexistent@example.com")
+	_, _, _, err = client.IsUserConfirmed(ctx, 1, "nonexistent@example.com")
 	assert.Error(t, err, "Should return error for non-existent user")
 }
 
@@ -171,6 +176,7 @@ func TestResendConfirmationCode_LocalEndpoint(t *testing.T) {
 		CognitoClientID:     "test_client_id",
 		CognitoClientSecret: "",
 		CognitoEndpoint:     "http://localhost:9229",
+		IdentityProvider:    string(ModeCognitoLocal),
 	}
 
 	client, err := NewClient(cfg)
@@ -183,35 +189,37 @@ func TestResendConfirmationCode_LocalEndpoint(t *testing.T) {
 	assert.NoError(t, err, "ResendConfirmationCode should not error for local endpoint")
 }
 
-// TestUsernameSelection tests the username selection logic based on endpoint.
+// TestUsernameSelection tests the username selection logic based on the mode.
 func TestUsernameSelection(t *testing.T) {
 	tests := []struct {
 		name        string
+		mode        Mode
 		endpoint    string
-		email       string
 		expectEmail bool
-		expectUUID  bool
 	}{
 		{
-			name:        "local endpoint uses email",
+			name:        "cognito-local uses email",
+			mode:        ModeCognitoLocal,
 			endpoint:    "http://localhost:9229",
-			email:       "test@example.com",
 			expectEmail: true,
-			expectUUID:  false,
 		},
 		{
-			name:        "AWS endpoint uses UUID",
+			name:        "cognito-local on a docker hostname uses email",
+			mode:        ModeCognitoLocal,
+			endpoint:    "http://cognito:9230",
+			expectEmail: true,
+		},
+		{
+			name:        "AWS uses UUID",
+			mode:        ModeAWS,
 			endpoint:    "",
-			email:       "test@example.com",
 			expectEmail: false,
-			expectUUID:  true,
 		},
 		{
-			name:        "non-local endpoint uses UUID",
+			name:        "AWS with custom endpoint uses UUID",
+			mode:        ModeAWS,
 			endpoint:    "https://cognito-idp.us-east-1.amazonaws.com",
-			email:       "test@example.com",
 			expectEmail: false,
-			expectUUID:  true,
 		},
 	}
 
@@ -222,21 +230,81 @@ func TestUsernameSelection(t *testing.T) {
 				CognitoClientID:     "test_client",
 				CognitoClientSecret: "",
 				CognitoEndpoint:     tt.endpoint,
+				IdentityProvider:    string(tt.mode),
 			}
 
 			client, err := NewClient(cfg)
 			require.NoError(t, err)
 
-			// We can't directly test the username selection without calling SignUp
-			// But we can verify the endpoint is stored correctly
-			isLocal := client.endpoint != "" && strings.Contains(client.endpoint, "localhost:9229")
+			username := client.profile.usernameFor(1, "test@example.com")
 			if tt.expectEmail {
-				assert.True(t, isLocal, "Should detect local endpoint")
+				assert.Equal(t, "test@example.com", username)
+				return
 			}
+			_, parseErr := uuid.Parse(username)
+			assert.NoError(t, parseErr, "Should use a UUID username")
 		})
 	}
 }
 
+func TestNewClient_Region(t *testing.T) {
+	cfg := &config.Config{
+		CognitoUserPoolID: "test_pool",
+		CognitoClientID:   "test_client",
+		AWSRegion:         "sa-east-1",
+	}
+
+	client, err := NewClient(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "sa-east-1", client.client.Options().Region)
+}
+
+func TestNewClient_CognitoLocalRequiresEndpoint(t *testing.T) {
+	cfg := &config.Config{
+		CognitoUserPoolID: "test_pool",
+		CognitoClientID:   "test_client",
+		IdentityProvider:  string(ModeCognitoLocal),
+	}
+
+	_, err := NewClient(cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "requires COGNITO_ENDPOINT")
+}
+
+func TestNew_SelectsImplementation(t *testing.T) {
+	fake, err := New(&config.Config{IdentityProvider: string(ModeFake)})
+	require.NoError(t, err)
+	assert.IsType(t, &FakeClient{}, fake)
+
+	client, err := New(&config.Config{CognitoUserPoolID: "pool", CognitoClientID: "client"})
+	require.NoError(t, err)
+	assert.IsType(t, &Client{}, client)
+
+	_, err = New(&config.Config{IdentityProvider: "ldap"})
+	assert.Error(t, err)
+}
+
+func TestParseMode(t *testing.T) {
+	mode, err := ParseMode("")
+	require.NoError(t, err)
+	assert.Equal(t, ModeAWS, mode)
+
+	for _, m := range []Mode{ModeAWS, ModeCognitoLocal, ModeFake} {
+		mode, err := ParseMode(string(m))
+		require.NoError(t, err)
+		assert.Equal(t, m, mode)
+	}
+
+	_, err = ParseMode("localhost:9229")
+	assert.Error(t, err)
+}
+
+func TestProfileFor(t *testing.T) {
+	assert.Equal(t, profile{resendSupported: true}, profileFor(ModeAWS))
+	assert.Equal(t, profile{emailAsUsername: true, staticCredentials: true, requiresEndpoint: true}, profileFor(ModeCognitoLocal))
+	assert.Equal(t, profile{emailAsUsername: true, staticCredentials: true}, profileFor(ModeFake))
+}
+
 // TestErrorHandling tests error handling for various Cognito errors.
 func TestErrorHandling_UsernameExistsException(t *testing.T) {
 	// Test that UsernameExistsException is properly handled
@@ -245,3 +313,44 @@ func TestErrorHandling_UsernameExistsException(t *testing.T) {
 	err := &types.UsernameExistsException{}
 	assert.NotNil(t, err)
 }
+
+func TestErrorClass(t *testing.T) {
+	assert.Equal(t, "", errorClass(nil))
+	assert.Equal(t, "UsernameExistsException", errorClass(fmt.Errorf("wrapped: %w", &types.UsernameExistsException{})))
+	assert.Equal(t, "TooManyRequestsException", errorClass(&types.TooManyRequestsException{}))
+	assert.Equal(t, "timeout", errorClass(context.DeadlineExceeded))
+	assert.Equal(t, "canceled", errorClass(context.Canceled))
+	assert.Equal(t, "unknown", errorClass(errors.New("boom")))
+}
+
+func TestNewClient_AWSRejectsEmulatorEndpoint(t *testing.T) {
+	cfg := &config.Config{
+		CognitoUserPoolID: "test_pool",
+		CognitoClientID:   "test_client",
+		CognitoEndpoint:   "http://localhost:9229",
+		IdentityProvider:  string(ModeAWS),
+	}
+
+	_, err := NewClient(cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "IDENTITY_PROVIDER=cognito-local")
+}
+
+func TestNew_RejectsFakeInLambda(t *testing.T) {
+	t.Setenv("AWS_LAMBDA_FUNCTION_NAME", "spendflix-auth-dev-api")
+
+	_, err := New(&config.Config{IdentityProvider: string(ModeFake)})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not allowed in Lambda")
+}
+
+func TestUsernameFor_AWSIsDerivedFromTheUser(t *testing.T) {
+	aws := profileFor(ModeAWS)
+
+	first := aws.usernameFor(1, "john@example.com")
+	assert.Equal(t, first, aws.usernameFor(1, "john@example.com"), "a redelivered sign-up reuses the username")
+	assert.NotEqual(t, first, aws.usernameFor(2, "john@example.com"))
+	assert.NotEqual(t, first, aws.usernameFor(1, "jane@example.com"))
+	_, err := uuid.Parse(first)
+	assert.NoError(t, err)
+}
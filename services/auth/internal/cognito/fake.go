@@ -0,0 +1,199 @@
+package cognito
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+	"github.com/google/uuid"
+)
+
+type fakeUser struct {
+	username string
+	email    string
+	sub      string
+	name     string
+	status   types.UserStatusType
+	// code is the confirmation code last sent, until the user is confirmed.
+	code string
+}
+
+// FakeClient is an in-memory identity provider used in ModeFake and in
+// tests. Accounts start UNCONFIRMED with a confirmation code, which
+// ConfirmationCode reads where Cognito would email it, and become CONFIRMED
+// through ConfirmSignUp. It mirrors the errors of the real client so the
+// sign-up flow behaves the same way.
+//
+// Like Cognito, it keys accounts by username, chosen by the profile of its
+// mode: where the email is only an alias, as in ModeAWS, nothing stops two
+// accounts from sharing an email.
+type FakeClient struct {
+	mu      sync.Mutex
+	profile profile
+	users   []*fakeUser // in sign-up order
+}
+
+// NewFakeClient returns a FakeClient using emails as usernames, as in
+// ModeFake and ModeCognitoLocal.
+func NewFakeClient() *FakeClient {
+	return NewFakeClientFor(ModeFake)
+}
+
+// NewFakeClientFor returns a FakeClient choosing usernames as the client of
+// mode does.
+func NewFakeClientFor(mode Mode) *FakeClient {
+	return &FakeClient{profile: profileFor(mode)}
+}
+
+func (f *FakeClient) SignUp(_ context.Context, userID int, email, _, name string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	username := f.profile.usernameFor(userID, email)
+	if _, err := f.byUsername(username); err == nil {
+		return "", &types.UsernameExistsException{Message: ptr("User already exists")}
+	}
+
+	user := &fakeUser{
+		username: username,
+		email:    email,
+		sub:      uuid.New().String(),
+		name:     name,
+		status:   types.UserStatusTypeUnconfirmed,
+		code:     newCode(),
+	}
+	f.users = append(f.users, user)
+
+	log.Printf("Fake identity provider: signed up %s (sub %s)", email, user.sub)
+	return user.sub, nil
+}
+
+// IsUserConfirmed reports on the account registered under the username
+// derived from userID and email, as the real client gets one user by name.
+func (f *FakeClient) IsUserConfirmed(_ context.Context, userID int, email string) (bool, string, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, err := f.byUsername(f.profile.usernameFor(userID, email))
+	if err != nil {
+		return false, "", "", ErrUserNotFound
+	}
+	return user.status == types.UserStatusTypeConfirmed, user.username, user.sub, nil
+}
+
+// ResendConfirmationCode replaces the code of an unconfirmed user, failing
+// like Cognito for unknown and confirmed users.
+func (f *FakeClient) ResendConfirmationCode(_ context.Context, username string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, err := f.byUsername(username)
+	if err != nil {
+		return err
+	}
+	if user.status == types.UserStatusTypeConfirmed {
+		return &types.InvalidParameterException{Message: ptr("User is already confirmed.")}
+	}
+	user.code = newCode()
+
+	log.Printf("Fake identity provider: confirmation code resent to %s", username)
+	return nil
+}
+
+// ConfirmSignUp confirms the user registered as username with the code last
+// sent to them, as the Cognito action of the same name.
+func (f *FakeClient) ConfirmSignUp(_ context.Context, username, code string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, err := f.byUsername(username)
+	if err != nil {
+		return err
+	}
+	if user.status == types.UserStatusTypeConfirmed {
+		return &types.NotAuthorizedException{Message: ptr("User cannot be confirmed. Current status is CONFIRMED")}
+	}
+	if code == "" || code != user.code {
+		return &types.CodeMismatchException{Message: ptr("Invalid verification code provided, please try again.")}
+	}
+	user.status = types.UserStatusTypeConfirmed
+	user.code = ""
+	return nil
+}
+
+func (f *FakeClient) Ping(context.Context) error {
+	return nil
+}
+
+// ConfirmationCode returns the code last sent to the first account
+// registered with email, and false once it is confirmed or when there is no
+// such account.
+func (f *FakeClient) ConfirmationCode(email string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, ok := f.byEmail(email)
+	if !ok || user.code == "" {
+		return "", false
+	}
+	return user.code, true
+}
+
+// Accounts returns the number of accounts registered with email.
+func (f *FakeClient) Accounts(email string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := 0
+	for _, user := range f.users {
+		if user.email == email {
+			n++
+		}
+	}
+	return n
+}
+
+// Confirm marks the first account registered with email as confirmed
+// without a code, as an administrator can.
+func (f *FakeClient) Confirm(email string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, ok := f.byEmail(email)
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.status = types.UserStatusTypeConfirmed
+	user.code = ""
+	return nil
+}
+
+func (f *FakeClient) byUsername(username string) (*fakeUser, error) {
+	for _, user := range f.users {
+		if user.username == username {
+			return user, nil
+		}
+	}
+	return nil, &types.UserNotFoundException{Message: ptr("Username/client id combination not found.")}
+}
+
+func (f *FakeClient) byEmail(email string) (*fakeUser, bool) {
+	for _, user := range f.users {
+		if user.email == email {
+			return user, true
+		}
+	}
+	return nil, false
+}
+
+// newCode returns a six digit confirmation code, as Cognito sends.
+func newCode() string {
+	return fmt.Sprintf("%06d", rand.IntN(1_000_000))
+}
+
+func ptr(s string) *string {
+	return &s
+}
@@ -0,0 +1,113 @@
+package cognito
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeClient_SignUpLifecycle(t *testing.T) {
+	fake := NewFakeClient()
+	ctx := context.Background()
+
+	sub, err := fake.SignUp(ctx, 1, "john@example.com", "TempPassword123!", "John Doe")
+	require.NoError(t, err)
+	assert.NotEmpty(t, sub)
+
+	confirmed, username, userSub, err := fake.IsUserConfirmed(ctx, 1, "john@example.com")
+	require.NoError(t, err)
+	assert.False(t, confirmed)
+	assert.Equal(t, "john@example.com", username)
+	assert.Equal(t, sub, userSub)
+
+	_, err = fake.SignUp(ctx, 1, "john@example.com", "TempPassword123!", "John Doe")
+	var existsErr *types.UsernameExistsException
+	assert.True(t, errors.As(err, &existsErr), "duplicate sign-up should match the real client error")
+
+	require.NoError(t, fake.ResendConfirmationCode(ctx, username))
+	require.NoError(t, fake.Confirm("john@example.com"))
+
+	confirmed, _, _, err = fake.IsUserConfirmed(ctx, 1, "john@example.com")
+	require.NoError(t, err)
+	assert.True(t, confirmed)
+}
+
+func TestFakeClient_UnknownUser(t *testing.T) {
+	fake := NewFakeClient()
+
+	_, _, _, err := fake.IsUserConfirmed(context.Background(), 1, "nobody@example.com")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	assert.Error(t, fake.Confirm("nobody@example.com"))
+
+	var notFound *types.UserNotFoundException
+	assert.ErrorAs(t, fake.ResendConfirmationCode(context.Background(), "nobody@example.com"), &notFound)
+	assert.ErrorAs(t, fake.ConfirmSignUp(context.Background(), "nobody@example.com", "123456"), &notFound)
+	assert.NoError(t, fake.Ping(context.Background()))
+}
+
+func TestFakeClient_ConfirmationCodes(t *testing.T) {
+	fake := NewFakeClient()
+	ctx := context.Background()
+
+	_, err := fake.SignUp(ctx, 1, "jane@example.com", "TempPassword123!", "Jane Doe")
+	require.NoError(t, err)
+
+	first, ok := fake.ConfirmationCode("jane@example.com")
+	require.True(t, ok)
+	assert.Len(t, first, 6)
+
+	var mismatch *types.CodeMismatchException
+	assert.ErrorAs(t, fake.ConfirmSignUp(ctx, "jane@example.com", "not-the-code"), &mismatch)
+
+	require.NoError(t, fake.ResendConfirmationCode(ctx, "jane@example.com"))
+	code, ok := fake.ConfirmationCode("jane@example.com")
+	require.True(t, ok)
+	if code != first {
+		assert.ErrorAs(t, fake.ConfirmSignUp(ctx, "jane@example.com", first), &mismatch, "resending replaces the code")
+	}
+
+	require.NoError(t, fake.ConfirmSignUp(ctx, "jane@example.com", code))
+	confirmed, _, _, err := fake.IsUserConfirmed(ctx, 1, "jane@example.com")
+	require.NoError(t, err)
+	assert.True(t, confirmed)
+	_, ok = fake.ConfirmationCode("jane@example.com")
+	assert.False(t, ok)
+
+	var notAuthorized *types.NotAuthorizedException
+	assert.ErrorAs(t, fake.ConfirmSignUp(ctx, "jane@example.com", code), &notAuthorized)
+	var invalid *types.InvalidParameterException
+	assert.ErrorAs(t, fake.ResendConfirmationCode(ctx, "jane@example.com"), &invalid)
+}
+
+func TestFakeClient_AWSUsesEmailAsAlias(t *testing.T) {
+	fake := NewFakeClientFor(ModeAWS)
+	ctx := context.Background()
+
+	first, err := fake.SignUp(ctx, 1, "john@example.com", "TempPassword123!", "John Doe")
+	require.NoError(t, err)
+
+	_, err = fake.SignUp(ctx, 1, "john@example.com", "TempPassword123!", "John Doe")
+	var existsErr *types.UsernameExistsException
+	require.ErrorAs(t, err, &existsErr, "the same user gets the same username")
+
+	// Another user may register the address, as Cognito allows for aliases
+	_, err = fake.SignUp(ctx, 2, "john@example.com", "TempPassword123!", "John Doe")
+	require.NoError(t, err)
+	assert.Equal(t, 2, fake.Accounts("john@example.com"))
+
+	_, username, sub, err := fake.IsUserConfirmed(ctx, 1, "john@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, first, sub)
+	assert.NotEqual(t, "john@example.com", username)
+
+	// Each user only ever sees their own account
+	_, _, second, err := fake.IsUserConfirmed(ctx, 2, "john@example.com")
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+	_, _, _, err = fake.IsUserConfirmed(ctx, 3, "john@example.com")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
@@ -0,0 +1,91 @@
+package cognito
+
+import (
+	"context"
+	"testing"
+
+	"services/auth/internal/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeClient_Conformance(t *testing.T) {
+	for _, mode := range []Mode{ModeFake, ModeCognitoLocal, ModeAWS} {
+		t.Run(string(mode), func(t *testing.T) {
+			fake := NewFakeClientFor(mode)
+			testIdentityProvider(t, fake, fake.Confirm)
+		})
+	}
+}
+
+func TestClient_Conformance(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	client, err := NewClient(&config.Config{
+		CognitoUserPoolID: "local_test_pool",
+		CognitoClientID:   "test_client_id",
+		CognitoEndpoint:   "http://localhost:9229",
+		IdentityProvider:  string(ModeCognitoLocal),
+	})
+	require.NoError(t, err)
+	if err := client.Ping(context.Background()); err != nil {
+		t.Skipf("Skipping integration test - cognito-local not available: %v", err)
+	}
+
+	testIdentityProvider(t, client, func(email string) error {
+		_, username, _, err := client.IsUserConfirmed(context.Background(), 1, email)
+		if err != nil {
+			return err
+		}
+		_, err = client.client.AdminConfirmSignUp(context.Background(), &cognitoidentityprovider.AdminConfirmSignUpInput{
+			UserPoolId: aws.String(client.userPoolID),
+			Username:   aws.String(username),
+		})
+		return err
+	})
+}
+
+// testIdentityProvider checks the behaviour the sign-up flow relies on, so
+// that tests using FakeClient hold against Cognito. confirm confirms the
+// account of an email as an administrator.
+func testIdentityProvider(t *testing.T, idp IdentityProvider, confirm func(email string) error) {
+	ctx := context.Background()
+	// Unique per run, since a real pool keeps its users
+	email := "conformance-" + uuid.NewString() + "@example.com"
+
+	_, _, _, err := idp.IsUserConfirmed(ctx, 1, email)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	sub, err := idp.SignUp(ctx, 1, email, "TempPassword123!", "Conformance")
+	require.NoError(t, err)
+	assert.NotEmpty(t, sub)
+
+	confirmed, username, userSub, err := idp.IsUserConfirmed(ctx, 1, email)
+	require.NoError(t, err)
+	assert.False(t, confirmed, "new accounts are unconfirmed")
+	assert.NotEmpty(t, username)
+	assert.Equal(t, sub, userSub)
+
+	t.Run("sign-up twice for one user", func(t *testing.T) {
+		// As when an outbox message is delivered again
+		_, err := idp.SignUp(ctx, 1, email, "TempPassword123!", "Conformance")
+		var exists *types.UsernameExistsException
+		assert.ErrorAs(t, err, &exists)
+
+		_, _, again, err := idp.IsUserConfirmed(ctx, 1, email)
+		require.NoError(t, err)
+		assert.Equal(t, sub, again, "the first account is kept")
+	})
+
+	require.NoError(t, confirm(email))
+	confirmed, _, _, err = idp.IsUserConfirmed(ctx, 1, email)
+	require.NoError(t, err)
+	assert.True(t, confirmed)
+}
@@ -0,0 +1,74 @@
+package cognito
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// Mode selects which identity provider implementation the service talks to.
+type Mode string
+
+const (
+	// ModeAWS talks to the real Amazon Cognito service.
+	ModeAWS Mode = "aws"
+	// ModeCognitoLocal talks to a cognito-local emulator at COGNITO_ENDPOINT.
+	ModeCognitoLocal Mode = "cognito-local"
+	// ModeFake keeps users in memory and never leaves the process.
+	ModeFake Mode = "fake"
+)
+
+// ParseMode validates a configured mode. An empty value means ModeAWS.
+func ParseMode(value string) (Mode, error) {
+	switch Mode(value) {
+	case "", ModeAWS:
+		return ModeAWS, nil
+	case ModeCognitoLocal, ModeFake:
+		return Mode(value), nil
+	default:
+		return "", fmt.Errorf("unknown identity provider mode %q", value)
+	}
+}
+
+// profile captures every behavior that differs between identity providers so
+// the client never has to guess from the endpoint.
+type profile struct {
+	// emailAsUsername is required by cognito-local; AWS pools that use email
+	// as an alias reject email-formatted usernames, so they get a UUID.
+	emailAsUsername bool
+	// staticCredentials replaces the AWS credential chain with dummy keys.
+	staticCredentials bool
+	// requiresEndpoint rejects configurations without COGNITO_ENDPOINT.
+	requiresEndpoint bool
+	// resendSupported is false where ResendConfirmationCode is not implemented;
+	// the client then logs instead of calling the provider.
+	resendSupported bool
+}
+
+func profileFor(mode Mode) profile {
+	switch mode {
+	case ModeCognitoLocal:
+		return profile{emailAsUsername: true, staticCredentials: true, requiresEndpoint: true}
+	case ModeFake:
+		return profile{emailAsUsername: true, staticCredentials: true}
+	default:
+		return profile{resendSupported: true}
+	}
+}
+
+// usernameNamespace is the UUIDv5 namespace of the usernames of AWS mode.
+var usernameNamespace = uuid.MustParse("6f1c2a0e-3b8d-4c57-9a7e-2d4f8b1e5c93")
+
+// usernameFor returns the Cognito username used to register email for the
+// user with userID. In AWS mode the email is only an alias, so the username
+// is derived from the user rather than random: a repeated sign-up of the
+// same user then fails with UsernameExistsException instead of creating a
+// second account. The email is part of the name so that a database reset
+// reusing IDs does not collide with the accounts of other addresses.
+func (p profile) usernameFor(userID int, email string) string {
+	if p.emailAsUsername {
+		return email
+	}
+	return uuid.NewSHA1(usernameNamespace, []byte(strconv.Itoa(userID)+":"+email)).String()
+}
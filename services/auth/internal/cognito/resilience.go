@@ -0,0 +1,232 @@
+package cognito
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"services/auth/internal/config"
+	"services/auth/internal/metrics"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+	"github.com/aws/smithy-go"
+)
+
+// ErrUnavailable reports that Cognito could not serve a call: it kept
+// answering with throttling or server errors, timed out, was unreachable, or
+// the circuit breaker is open after recent failures.
+var ErrUnavailable = errors.New("cognito unavailable")
+
+// Policy bounds every Cognito call. Zero values take the defaults below.
+type Policy struct {
+	// Timeout bounds each attempt. Defaults to 3s.
+	Timeout time.Duration
+	// MaxAttempts bounds the attempts of a call, including the first.
+	// Defaults to 3.
+	MaxAttempts int
+	// BaseDelay and MaxDelay bound the exponential backoff between attempts;
+	// the actual delay is drawn uniformly below it. Default to 100ms and 2s.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// BreakerThreshold is the number of consecutive unavailable attempts
+	// that opens the circuit breaker. Defaults to 5.
+	BreakerThreshold int
+	// BreakerCooldown is how long an open breaker fails calls before letting
+	// one probe through. Defaults to 30s.
+	BreakerCooldown time.Duration
+}
+
+// PolicyFromConfig returns the policy configured by the COGNITO_* settings.
+func PolicyFromConfig(cfg *config.Config) Policy {
+	return Policy{
+		Timeout:          cfg.CognitoTimeout,
+		MaxAttempts:      cfg.CognitoMaxAttempts,
+		BaseDelay:        cfg.CognitoRetryBaseDelay,
+		MaxDelay:         cfg.CognitoRetryMaxDelay,
+		BreakerThreshold: cfg.CognitoBreakerThreshold,
+		BreakerCooldown:  cfg.CognitoBreakerCooldown,
+	}
+}
+
+func (p Policy) withDefaults() Policy {
+	if p.Timeout <= 0 {
+		p.Timeout = 3 * time.Second
+	}
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = 100 * time.Millisecond
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = 2 * time.Second
+	}
+	if p.BreakerThreshold <= 0 {
+		p.BreakerThreshold = 5
+	}
+	if p.BreakerCooldown <= 0 {
+		p.BreakerCooldown = 30 * time.Second
+	}
+	return p
+}
+
+// backoffCeiling is the upper bound of the delay after the attempt-th failure.
+func (p Policy) backoffCeiling(attempt int) time.Duration {
+	ceiling := p.BaseDelay
+	for i := 1; i < attempt && ceiling < p.MaxDelay; i++ {
+		ceiling *= 2
+	}
+	return min(ceiling, p.MaxDelay)
+}
+
+// breaker is a consecutive-failure circuit breaker. Once open it rejects
+// calls for the cooldown, then lets a single probe through: its success
+// closes the breaker and its failure opens it again.
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	failures int
+	openedAt time.Time
+	open     bool
+	probing  bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// allow reports whether a call may proceed.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.open {
+		return true
+	}
+	if b.probing || b.now().Sub(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// record counts the result of an allowed call.
+func (b *breaker) record(available bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if available {
+		b.failures = 0
+		b.setOpen(false)
+		return
+	}
+
+	b.failures++
+	if b.open || b.failures >= b.threshold {
+		b.openedAt = b.now()
+		b.setOpen(true)
+	}
+}
+
+// release ends an allowed call that Cognito never answered because the
+// caller gave up, e.g. on a client disconnect or a Lambda deadline. It says
+// nothing about Cognito, so only a probe is given back: the failures and
+// the state of the breaker are left as they were.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+func (b *breaker) setOpen(open bool) {
+	if b.open != open {
+		metrics.Auth.SetCognitoCircuitOpen(open)
+	}
+	b.open = open
+}
+
+// unavailable reports whether err means Cognito could not serve the call, as
+// opposed to answering it with a client error such as UsernameExists. Errors
+// caused by the caller's own context are not Cognito's fault.
+func unavailable(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	if throttled(err) {
+		return true
+	}
+
+	var status interface{ HTTPStatusCode() int }
+	if errors.As(err, &status) && status.HTTPStatusCode() >= 500 {
+		return true
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorFault() == smithy.FaultServer
+	}
+
+	// No answer at all: a timeout of the attempt or a transport error.
+	return true
+}
+
+func throttled(err error) bool {
+	var tooMany *types.TooManyRequestsException
+	return errors.As(err, &tooMany)
+}
+
+// call runs fn under the client's policy. Throttled attempts are retried for
+// every operation, since Cognito refused them before doing anything; server
+// errors and timeouts are only retried for idempotent operations, as a
+// retried SignUp could register a second account.
+func (c *Client) call(ctx context.Context, operation string, idempotent bool, fn func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		if !c.breaker.allow() {
+			return fmt.Errorf("%w: circuit breaker open", ErrUnavailable)
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, c.policy.Timeout)
+		start := time.Now()
+		err := fn(attemptCtx)
+		cancel()
+		observe(operation, start, err)
+
+		if ctx.Err() != nil {
+			c.breaker.release()
+			return err
+		}
+		failed := unavailable(ctx, err)
+		c.breaker.record(!failed)
+		if !failed {
+			return err
+		}
+
+		if attempt >= c.policy.MaxAttempts || !(idempotent || throttled(err)) {
+			return fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+		metrics.Auth.RecordCognitoRetry(operation)
+		if sleepErr := c.sleep(ctx, rand.N(c.policy.backoffCeiling(attempt))+1); sleepErr != nil {
+			return fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+	}
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,344 @@
+package cognito
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"services/auth/internal/config"
+	"services/auth/internal/metrics"
+
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeResponse is a scripted answer of fakeTransport. A zero status blocks
+// until the request is canceled, as an unresponsive endpoint would.
+type fakeResponse struct {
+	status int
+	body   string
+}
+
+func ok(body string) fakeResponse { return fakeResponse{status: 200, body: body} }
+
+func apiError(status int, errorType string) fakeResponse {
+	return fakeResponse{status: status, body: fmt.Sprintf(`{"__type":%q,"message":"scripted"}`, errorType)}
+}
+
+var (
+	throttledResponse = apiError(400, "TooManyRequestsException")
+	internalError     = apiError(500, "InternalErrorException")
+	hang              = fakeResponse{}
+)
+
+// fakeTransport answers SDK requests with scripted responses, repeating the
+// last one once the script is exhausted.
+type fakeTransport struct {
+	mu        sync.Mutex
+	responses []fakeResponse
+	targets   []string
+}
+
+func (f *fakeTransport) Do(req *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	f.targets = append(f.targets, strings.TrimPrefix(req.Header.Get("X-Amz-Target"), "AWSCognitoIdentityProviderService."))
+	resp := f.responses[0]
+	if len(f.responses) > 1 {
+		f.responses = f.responses[1:]
+	}
+	f.mu.Unlock()
+
+	if resp.status == 0 {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	}
+
+	header := http.Header{"Content-Type": {"application/x-amz-json-1.1"}}
+	return &http.Response{
+		StatusCode: resp.status,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(resp.body)),
+		Request:    req,
+	}, nil
+}
+
+func (f *fakeTransport) calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.targets...)
+}
+
+var testPolicy = Policy{
+	Timeout:          time.Second,
+	MaxAttempts:      3,
+	BaseDelay:        10 * time.Millisecond,
+	MaxDelay:         40 * time.Millisecond,
+	BreakerThreshold: 3,
+	BreakerCooldown:  time.Minute,
+}
+
+// newFakeClient returns a client talking to transport, with a clock the test
+// controls and sleeps recorded instead of waited.
+func newFakeClient(t *testing.T, policy Policy, transport *fakeTransport) (*Client, *time.Time, *[]time.Duration) {
+	t.Helper()
+
+	cfg := &config.Config{
+		CognitoUserPoolID: "local_test_pool",
+		CognitoClientID:   "test_client_id",
+		CognitoEndpoint:   "http://cognito.test",
+		IdentityProvider:  string(ModeCognitoLocal),
+	}
+	client, err := NewClient(cfg, WithHTTPClient(transport), WithPolicy(policy))
+	require.NoError(t, err)
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	client.breaker.now = func() time.Time { return now }
+
+	var sleeps []time.Duration
+	client.sleep = func(_ context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return nil
+	}
+	return client, &now, &sleeps
+}
+
+func TestClient_RetriesThrottledSignUp(t *testing.T) {
+	transport := &fakeTransport{responses: []fakeResponse{
+		throttledResponse,
+		throttledResponse,
+		ok(`{"UserSub":"sub-1","UserConfirmed":false}`),
+	}}
+	client, _, sleeps := newFakeClient(t, testPolicy, transport)
+	retries := metrics.Auth.CognitoRetryCount("SignUp")
+
+	sub, err := client.SignUp(context.Background(), 1, "john@example.com", "Passw0rd!", "John")
+
+	require.NoError(t, err)
+	assert.Equal(t, "sub-1", sub)
+	assert.Equal(t, []string{"SignUp", "SignUp", "SignUp"}, transport.calls())
+	require.Len(t, *sleeps, 2)
+	assert.LessOrEqual(t, (*sleeps)[0], 10*time.Millisecond)
+	assert.LessOrEqual(t, (*sleeps)[1], 20*time.Millisecond)
+	assert.Equal(t, retries+2, metrics.Auth.CognitoRetryCount("SignUp"))
+}
+
+func TestClient_GivesUpAfterMaxAttempts(t *testing.T) {
+	transport := &fakeTransport{responses: []fakeResponse{throttledResponse}}
+	client, _, _ := newFakeClient(t, testPolicy, transport)
+
+	_, err := client.SignUp(context.Background(), 1, "john@example.com", "Passw0rd!", "John")
+
+	require.ErrorIs(t, err, ErrUnavailable)
+	var tooMany *types.TooManyRequestsException
+	assert.ErrorAs(t, err, &tooMany)
+	assert.Len(t, transport.calls(), testPolicy.MaxAttempts)
+}
+
+func TestClient_DoesNotRetryServerErrorsOfSignUp(t *testing.T) {
+	// Cognito may have created the account before failing, so a second
+	// SignUp could register it twice; the outbox retries it instead.
+	transport := &fakeTransport{responses: []fakeResponse{internalError, ok(`{"UserSub":"sub-1"}`)}}
+	client, _, _ := newFakeClient(t, testPolicy, transport)
+
+	_, err := client.SignUp(context.Background(), 1, "john@example.com", "Passw0rd!", "John")
+
+	require.ErrorIs(t, err, ErrUnavailable)
+	assert.Len(t, transport.calls(), 1)
+}
+
+func TestClient_RetriesServerErrorsOfReads(t *testing.T) {
+	transport := &fakeTransport{responses: []fakeResponse{
+		internalError,
+		apiError(503, "ServiceUnavailable"),
+		ok(`{"Username":"john@example.com","UserStatus":"CONFIRMED","UserAttributes":[{"Name":"sub","Value":"sub-1"}]}`),
+	}}
+	client, _, _ := newFakeClient(t, testPolicy, transport)
+
+	confirmed, username, sub, err := client.IsUserConfirmed(context.Background(), 1, "john@example.com")
+
+	require.NoError(t, err)
+	assert.True(t, confirmed)
+	assert.Equal(t, "john@example.com", username)
+	assert.Equal(t, "sub-1", sub)
+	assert.Equal(t, []string{"AdminGetUser", "AdminGetUser", "AdminGetUser"}, transport.calls())
+}
+
+func TestClient_UnknownUserIsNotFound(t *testing.T) {
+	transport := &fakeTransport{responses: []fakeResponse{apiError(400, "UserNotFoundException")}}
+	client, _, _ := newFakeClient(t, testPolicy, transport)
+
+	_, _, _, err := client.IsUserConfirmed(context.Background(), 1, "john@example.com")
+
+	require.ErrorIs(t, err, ErrUserNotFound)
+	assert.Equal(t, []string{"AdminGetUser"}, transport.calls())
+	assert.Zero(t, client.breaker.failures, "a missing user is an answer, not a failure")
+}
+
+func TestClient_DoesNotRetryClientErrors(t *testing.T) {
+	transport := &fakeTransport{responses: []fakeResponse{apiError(400, "UsernameExistsException")}}
+	client, _, sleeps := newFakeClient(t, testPolicy, transport)
+
+	_, err := client.SignUp(context.Background(), 1, "john@example.com", "Passw0rd!", "John")
+
+	var exists *types.UsernameExistsException
+	require.ErrorAs(t, err, &exists)
+	assert.NotErrorIs(t, err, ErrUnavailable)
+	assert.Len(t, transport.calls(), 1)
+	assert.Empty(t, *sleeps)
+}
+
+func TestClient_TimesOutAttempts(t *testing.T) {
+	policy := testPolicy
+	policy.Timeout = 20 * time.Millisecond
+	transport := &fakeTransport{responses: []fakeResponse{hang}}
+	client, _, _ := newFakeClient(t, policy, transport)
+
+	err := client.Ping(context.Background())
+
+	require.ErrorIs(t, err, ErrUnavailable)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Len(t, transport.calls(), policy.MaxAttempts)
+}
+
+func TestClient_CallerCancellationIsNotAnOutage(t *testing.T) {
+	transport := &fakeTransport{responses: []fakeResponse{hang}}
+	client, _, _ := newFakeClient(t, testPolicy, transport)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	err := client.Ping(ctx)
+
+	require.ErrorIs(t, err, context.Canceled)
+	assert.NotErrorIs(t, err, ErrUnavailable)
+	assert.Len(t, transport.calls(), 1)
+	assert.Zero(t, client.breaker.failures)
+}
+
+func TestClient_CircuitBreaker(t *testing.T) {
+	transport := &fakeTransport{responses: []fakeResponse{internalError}}
+	client, now, _ := newFakeClient(t, testPolicy, transport)
+	ctx := context.Background()
+
+	// Three failed attempts in a row open the breaker
+	require.ErrorIs(t, client.Ping(ctx), ErrUnavailable)
+	require.Len(t, transport.calls(), 3)
+	assert.True(t, metrics.Auth.CognitoCircuitOpen())
+
+	// While open, calls fail without reaching Cognito
+	_, err := client.SignUp(ctx, 1, "john@example.com", "Passw0rd!", "John")
+	require.ErrorIs(t, err, ErrUnavailable)
+	assert.Contains(t, err.Error(), "circuit breaker open")
+	assert.Len(t, transport.calls(), 3)
+
+	// After the cooldown a failed probe opens it again
+	*now = now.Add(testPolicy.BreakerCooldown)
+	transport.responses = []fakeResponse{internalError, ok(`{"UserPoolClient":{}}`)}
+	require.ErrorIs(t, client.Ping(ctx), ErrUnavailable)
+	assert.Len(t, transport.calls(), 4, "only the probe reaches Cognito")
+
+	// A successful probe closes it
+	*now = now.Add(testPolicy.BreakerCooldown)
+	require.NoError(t, client.Ping(ctx))
+	assert.False(t, metrics.Auth.CognitoCircuitOpen())
+	require.NoError(t, client.Ping(ctx))
+	assert.Len(t, transport.calls(), 6)
+}
+
+func TestClient_CancelledProbeLeavesBreakerOpen(t *testing.T) {
+	transport := &fakeTransport{responses: []fakeResponse{internalError}}
+	client, now, _ := newFakeClient(t, testPolicy, transport)
+	require.ErrorIs(t, client.Ping(context.Background()), ErrUnavailable)
+	require.True(t, metrics.Auth.CognitoCircuitOpen())
+	failures := client.breaker.failures
+
+	// The probe after the cooldown is cancelled by the caller
+	*now = now.Add(testPolicy.BreakerCooldown)
+	transport.responses = []fakeResponse{hang}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	require.ErrorIs(t, client.Ping(ctx), context.Canceled)
+
+	assert.True(t, metrics.Auth.CognitoCircuitOpen(), "Cognito never answered the probe")
+	assert.Equal(t, failures, client.breaker.failures)
+	assert.True(t, client.breaker.open)
+
+	// The next call probes again
+	transport.responses = []fakeResponse{ok(`{"UserPoolClient":{}}`)}
+	require.NoError(t, client.Ping(context.Background()))
+	assert.False(t, metrics.Auth.CognitoCircuitOpen())
+}
+
+func TestBreaker_CancelledProbe(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := newBreaker(1, time.Minute)
+	b.now = func() time.Time { return now }
+
+	require.True(t, b.allow())
+	b.record(false)
+	openedAt := b.openedAt
+
+	now = now.Add(time.Minute)
+	require.True(t, b.allow())
+	b.release()
+	assert.True(t, b.open)
+	assert.Equal(t, 1, b.failures)
+	assert.Equal(t, openedAt, b.openedAt)
+	assert.True(t, b.allow(), "another call may probe")
+}
+
+func TestBreaker_SingleProbe(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := newBreaker(1, time.Minute)
+	b.now = func() time.Time { return now }
+
+	require.True(t, b.allow())
+	b.record(false)
+	assert.False(t, b.allow())
+
+	now = now.Add(time.Minute)
+	assert.True(t, b.allow(), "the first call after the cooldown probes")
+	assert.False(t, b.allow(), "other calls wait for the probe")
+	b.record(true)
+	assert.True(t, b.allow())
+}
+
+func TestUnavailable(t *testing.T) {
+	ctx := context.Background()
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	assert.False(t, unavailable(ctx, nil))
+	assert.True(t, unavailable(ctx, &types.TooManyRequestsException{}))
+	assert.True(t, unavailable(ctx, &types.InternalErrorException{}))
+	assert.True(t, unavailable(ctx, context.DeadlineExceeded))
+	assert.True(t, unavailable(ctx, errors.New("connection refused")))
+	assert.False(t, unavailable(ctx, &types.UsernameExistsException{}))
+	assert.False(t, unavailable(ctx, &types.InvalidPasswordException{}))
+	assert.False(t, unavailable(canceled, context.Canceled))
+}
+
+func TestPolicy_BackoffCeiling(t *testing.T) {
+	p := Policy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}.withDefaults()
+
+	assert.Equal(t, 100*time.Millisecond, p.backoffCeiling(1))
+	assert.Equal(t, 200*time.Millisecond, p.backoffCeiling(2))
+	assert.Equal(t, 800*time.Millisecond, p.backoffCeiling(4))
+	assert.Equal(t, time.Second, p.backoffCeiling(5))
+	assert.Equal(t, time.Second, p.backoffCeiling(50))
+}
+
+func TestPolicyFromConfig_Defaults(t *testing.T) {
+	p := PolicyFromConfig(&config.Config{}).withDefaults()
+
+	assert.Equal(t, 3*time.Second, p.Timeout)
+	assert.Equal(t, 3, p.MaxAttempts)
+	assert.Equal(t, 5, p.BreakerThreshold)
+	assert.Equal(t, 30*time.Second, p.BreakerCooldown)
+}
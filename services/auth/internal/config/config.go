@@ -1,53 +1,246 @@
 package config
 
 import (
+	"context"
 	"os"
+	"time"
 )
 
+// Config is the typed service configuration. Each field is populated from the
+// environment variable named in its env tag; see loader.go for the supported
+// tags and types.
 type Config struct {
-	DatabaseURL      string
-	EncryptionSecret string
-	// Cognito
-	CognitoUserPoolID   string
-	CognitoClientID     string
-	CognitoClientSecret string // Optional: required if client has secret
-	CognitoEndpoint     string
+	Stage string `env:"STAGE" default:"local"`
+	Port  string `env:"PORT" default:"3000"`
+
+	DatabaseURL string `env:"DATABASE_URL" required:"true" secret:"url"`
+	PoolConfig
+	EncryptionConfig
+
+	// AWSRegion is the region of every AWS client; Lambda sets AWS_REGION itself.
+	AWSRegion string `env:"AWS_REGION" default:"us-east-2"`
+
+	// IdentityProvider selects the Cognito flavour: the real AWS service,
+	// cognito-local (requires COGNITO_ENDPOINT) or an in-memory fake.
+	IdentityProvider string `env:"IDENTITY_PROVIDER" default:"aws" oneof:"aws|cognito-local|fake"`
+
+	// Cognito; the fake identity provider needs no pool
+	CognitoUserPoolID   string `env:"COGNITO_USER_POOL_ID" required:"IDENTITY_PROVIDER=aws|cognito-local"`
+	CognitoClientID     string `env:"COGNITO_CLIENT_ID" required:"IDENTITY_PROVIDER=aws|cognito-local"`
+	CognitoClientSecret string `env:"COGNITO_CLIENT_SECRET" secret:"true"` // Optional: required if client has secret
+	// Empty means the AWS default endpoint; set to http://localhost:9229 for cognito-local.
+	CognitoEndpoint string `env:"COGNITO_ENDPOINT"`
+	// Every Cognito attempt is bounded by COGNITO_TIMEOUT. Throttled calls,
+	// and server errors of read-only calls, are retried up to
+	// COGNITO_MAX_ATTEMPTS with jittered backoff; after
+	// COGNITO_BREAKER_THRESHOLD consecutive failures calls fail fast for
+	// COGNITO_BREAKER_COOLDOWN.
+	CognitoTimeout          time.Duration `env:"COGNITO_TIMEOUT" default:"3s"`
+	CognitoMaxAttempts      int           `env:"COGNITO_MAX_ATTEMPTS" default:"3"`
+	CognitoRetryBaseDelay   time.Duration `env:"COGNITO_RETRY_BASE_DELAY" default:"100ms"`
+	CognitoRetryMaxDelay    time.Duration `env:"COGNITO_RETRY_MAX_DELAY" default:"2s"`
+	CognitoBreakerThreshold int           `env:"COGNITO_BREAKER_THRESHOLD" default:"5"`
+	CognitoBreakerCooldown  time.Duration `env:"COGNITO_BREAKER_COOLDOWN" default:"30s"`
+
+	// EmailFoldGmail treats Gmail addresses that differ only by dots or a
+	// "+tag" as the same account. Changing it does not rewrite existing rows.
+	EmailFoldGmail bool `env:"EMAIL_FOLD_GMAIL" default:"false"`
+
+	// Sign-up policy. The allowlist and blocklist live in the database.
+	SignupInviteOnly bool `env:"SIGNUP_INVITE_ONLY" default:"false"`
+	SignupCheckMX    bool `env:"SIGNUP_CHECK_MX" default:"true"`
+	// DisposableDomainsFile extends the bundled disposable domain list.
+	DisposableDomainsFile string `env:"DISPOSABLE_DOMAINS_FILE"`
+
+	// Sign-up rate limits: each bucket allows BURST attempts at once and
+	// regains one every INTERVAL. A burst of 0 disables the limit. The memory
+	// store only limits a single process and is meant for local development.
+	RateLimitStore            string        `env:"RATE_LIMIT_STORE" default:"postgres" oneof:"postgres|memory"`
+	SignupRateLimitIPBurst    int           `env:"SIGNUP_RATE_LIMIT_IP_BURST" default:"10"`
+	SignupRateLimitIPInterval time.Duration `env:"SIGNUP_RATE_LIMIT_IP_INTERVAL" default:"1m"`
+	SignupRateLimitEmailBurst int           `env:"SIGNUP_RATE_LIMIT_EMAIL_BURST" default:"3"`
+	// The default lets a mailbox receive at most one more email per 10 minutes.
+	SignupRateLimitEmailInterval time.Duration `env:"SIGNUP_RATE_LIMIT_EMAIL_INTERVAL" default:"10m"`
+
+	// Bot check of sign-ups, enabled per stage. Every provider but "none"
+	// requires BOT_CHECK_SECRET; an empty endpoint uses the provider's own.
+	BotCheckProvider string        `env:"BOT_CHECK_PROVIDER" default:"none" oneof:"none|turnstile|hcaptcha|recaptcha"`
+	BotCheckSecret   string        `env:"BOT_CHECK_SECRET" secret:"true"`
+	BotCheckEndpoint string        `env:"BOT_CHECK_ENDPOINT"`
+	BotCheckTimeout  time.Duration `env:"BOT_CHECK_TIMEOUT" default:"3s"`
+
+	// Outbox delivery of sign-up side effects. In Lambda, LAMBDA_HANDLER
+	// selects whether the binary serves the API, the scheduled dispatcher,
+	// the scheduled purge of soft deleted rows or the Cognito triggers
+	// recording logins in the audit log; locally the API polls every
+	// OUTBOX_POLL_INTERVAL (0 disables polling).
+	// Failed deliveries are retried after BASE_BACKOFF, doubling up to
+	// MAX_BACKOFF, until MAX_ATTEMPTS.
+	LambdaHandler      string        `env:"LAMBDA_HANDLER" default:"api" oneof:"api|outbox|purge|cognito-trigger"`
+	OutboxPollInterval time.Duration `env:"OUTBOX_POLL_INTERVAL" default:"5s"`
+	OutboxBatchSize    int           `env:"OUTBOX_BATCH_SIZE" default:"20"`
+	OutboxMaxAttempts  int           `env:"OUTBOX_MAX_ATTEMPTS" default:"10"`
+	OutboxBaseBackoff  time.Duration `env:"OUTBOX_BASE_BACKOFF" default:"5s"`
+	OutboxMaxBackoff   time.Duration `env:"OUTBOX_MAX_BACKOFF" default:"1h"`
+	// Processed and failed messages are kept for OUTBOX_RETENTION, after
+	// which the purge removes them.
+	OutboxRetention time.Duration `env:"OUTBOX_RETENTION" default:"720h"`
+
+	// Soft deleted rows can be restored for SOFT_DELETE_RETENTION, after
+	// which the purge removes them, PURGE_BATCH_SIZE rows per statement.
+	SoftDeleteRetention time.Duration `env:"SOFT_DELETE_RETENTION" default:"720h"`
+	PurgeBatchSize      int           `env:"PURGE_BATCH_SIZE" default:"500"`
+
+	// HTTP
+	CORSAllowedOrigins []string      `env:"CORS_ALLOWED_ORIGINS" default:"*"`
+	ReadyCheckTimeout  time.Duration `env:"READY_CHECK_TIMEOUT" default:"2s"`
 }
 
-func Load() (*Config, error) {
-	databaseURL := os.Getenv("DATABASE_URL")
-	if databaseURL == "" {
-		panic("Missing required environment variable: DATABASE_URL")
+// DatabaseConfig is the subset of Config needed by tools that only talk to
+// the database, such as cmd/migrate.
+type DatabaseConfig struct {
+	DatabaseURL string `env:"DATABASE_URL" required:"true" secret:"url"`
+	// DatabaseIAMAuth authenticates with an RDS IAM auth token instead of
+	// the password of DATABASE_URL, as the service does (see PoolConfig).
+	DatabaseIAMAuth bool   `env:"DATABASE_IAM_AUTH" default:"false"`
+	AWSRegion       string `env:"AWS_REGION" default:"us-east-2"`
+}
+
+// PoolConfig sizes the database connection pools and selects how they
+// authenticate. A Lambda container serves one request at a time, so its pool
+// needs few connections; many containers share the database's limit.
+type PoolConfig struct {
+	// DatabaseReadURL points at a read replica serving the reads that
+	// tolerate replication lag; empty sends every query to DATABASE_URL.
+	DatabaseReadURL string `env:"DATABASE_READ_URL" secret:"url"`
+
+	DatabaseMaxConns int `env:"DATABASE_MAX_CONNS" default:"4"`
+	DatabaseMinConns int `env:"DATABASE_MIN_CONNS" default:"0"`
+	// Connections are replaced after DATABASE_MAX_CONN_LIFETIME, closed
+	// after DATABASE_MAX_CONN_IDLE_TIME unused, and checked every
+	// DATABASE_HEALTH_CHECK_PERIOD.
+	DatabaseMaxConnLifetime   time.Duration `env:"DATABASE_MAX_CONN_LIFETIME" default:"30m"`
+	DatabaseMaxConnIdleTime   time.Duration `env:"DATABASE_MAX_CONN_IDLE_TIME" default:"5m"`
+	DatabaseHealthCheckPeriod time.Duration `env:"DATABASE_HEALTH_CHECK_PERIOD" default:"1m"`
+	// DatabaseConnectTimeout bounds each connection attempt and the ping
+	// made at startup, so a wrong URL fails the cold start.
+	DatabaseConnectTimeout time.Duration `env:"DATABASE_CONNECT_TIMEOUT" default:"5s"`
+
+	// DatabaseIAMAuth replaces the password of the database URLs with an RDS
+	// IAM auth token, generated for each new connection from the AWS
+	// credentials. It works for RDS, Aurora and RDS Proxy endpoints and
+	// requires TLS without a plaintext fallback (sslmode=require or
+	// stricter).
+	DatabaseIAMAuth bool `env:"DATABASE_IAM_AUTH" default:"false"`
+}
+
+// EncryptionConfig selects the key that seals encrypted columns, the retired
+// keys still needed to open older values, and the keys of blind indexes.
+type EncryptionConfig struct {
+	// EncryptionKeyProvider selects the active key: a key derived from
+	// ENCRYPTION_SECRET, data keys wrapped by the base64 256-bit
+	// ENCRYPTION_MASTER_KEY ("local"), or data keys from KMS ("kms").
+	EncryptionKeyProvider string `env:"ENCRYPTION_KEY_PROVIDER" default:"secret" oneof:"secret|local|kms"`
+	EncryptionSecret      string `env:"ENCRYPTION_SECRET" required:"ENCRYPTION_KEY_PROVIDER=secret" secret:"true"`
+	EncryptionMasterKey   string `env:"ENCRYPTION_MASTER_KEY" required:"ENCRYPTION_KEY_PROVIDER=local" secret:"true"`
+	EncryptionKMSKeyID    string `env:"ENCRYPTION_KMS_KEY_ID" required:"ENCRYPTION_KEY_PROVIDER=kms"`
+	// Empty means the AWS default endpoint, e.g. http://localhost:8081 for local-kms.
+	EncryptionKMSEndpoint string `env:"ENCRYPTION_KMS_ENDPOINT"`
+	// A KMS data key seals values for up to ENCRYPTION_DATA_KEY_TTL or
+	// ENCRYPTION_DATA_KEY_MAX_USES values before a new one is generated.
+	EncryptionDataKeyTTL     time.Duration `env:"ENCRYPTION_DATA_KEY_TTL" default:"5m"`
+	EncryptionDataKeyMaxUses int           `env:"ENCRYPTION_DATA_KEY_MAX_USES" default:"1000"`
+
+	// EncryptionKeyID names the active key in the values it seals. To
+	// rotate, move the old key to ENCRYPTION_RETIRED_KEYS (comma-separated
+	// "id:secret", "id:local:<master key>" or "id:kms:<key id>"), configure
+	// the new key under a new ID, then run cmd/rekey.
+	EncryptionKeyID       string   `env:"ENCRYPTION_KEY_ID" default:"k1"`
+	EncryptionRetiredKeys []string `env:"ENCRYPTION_RETIRED_KEYS" secret:"true"`
+	// EncryptionRequireBinding refuses values sealed before they were bound
+	// to their field. Turn it on once cmd/rekey has re-sealed them all.
+	EncryptionRequireBinding bool `env:"ENCRYPTION_REQUIRE_BINDING" default:"false"`
+
+	// BlindIndexKey keys the HMAC blind indexes that make encrypted columns
+	// searchable; it must differ from every encryption key. Rotated like
+	// ENCRYPTION_SECRET, with BLIND_INDEX_RETIRED_KEYS ("id:secret"). Indexes
+	// keep BLIND_INDEX_LENGTH bytes of the HMAC; shorter ones leak less but
+	// match more values.
+	BlindIndexKey         string   `env:"BLIND_INDEX_KEY" secret:"true"`
+	BlindIndexKeyID       string   `env:"BLIND_INDEX_KEY_ID" default:"b1"`
+	BlindIndexRetiredKeys []string `env:"BLIND_INDEX_RETIRED_KEYS" secret:"true"`
+	BlindIndexLength      int      `env:"BLIND_INDEX_LENGTH" default:"16"`
+}
+
+// RekeyConfig is the subset of Config needed by cmd/rekey.
+type RekeyConfig struct {
+	DatabaseURL string `env:"DATABASE_URL" required:"true" secret:"url"`
+	PoolConfig
+	AWSRegion string `env:"AWS_REGION" default:"us-east-2"`
+	EncryptionConfig
+}
+
+// LoadRekey reads the RekeyConfig using DefaultOptions.
+func LoadRekey() (*RekeyConfig, error) {
+	cfg := &RekeyConfig{}
+	if err := populate(context.Background(), cfg, DefaultOptions()); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadDatabase reads the DatabaseConfig using DefaultOptions.
+func LoadDatabase() (*DatabaseConfig, error) {
+	cfg := &DatabaseConfig{}
+	if err := populate(context.Background(), cfg, DefaultOptions()); err != nil {
+		return nil, err
 	}
+	return cfg, nil
+}
+
+// IsLambda reports whether the process is running inside AWS Lambda, which
+// sets both variables in every function.
+func IsLambda() bool {
+	return os.Getenv("AWS_LAMBDA_RUNTIME_API") != "" || os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != ""
+}
 
-	encryptionSecret := os.Getenv("ENCRYPTION_SECRET")
-	if encryptionSecret == "" {
-		panic("Missing required environment variable: ENCRYPTION_SECRET")
+// DefaultOptions reads the process environment and, outside Lambda, the .env
+// file named by ENV_FILE (default ".env"). Secret references are resolved
+// against AWS SSM Parameter Store and Secrets Manager.
+func DefaultOptions() Options {
+	sources := []Source{EnvSource{}}
+
+	if !IsLambda() {
+		path := os.Getenv("ENV_FILE")
+		if path == "" {
+			path = ".env"
+		}
+		sources = append(sources, DotEnvFile(path))
 	}
 
-	cognitoUserPoolID := os.Getenv("COGNITO_USER_POOL_ID")
-	if cognitoUserPoolID == "" {
-		panic("Missing required environment variable: COGNITO_USER_POOL_ID")
+	return Options{
+		Sources:  sources,
+		Resolver: NewAWSSecretResolver(),
 	}
+}
 
-	cognitoClientID := os.Getenv("COGNITO_CLIENT_ID")
-	if cognitoClientID == "" {
-		panic("Missing required environment variable: COGNITO_CLIENT_ID")
+// Load reads the configuration using DefaultOptions. All validation problems
+// are reported together in a *ValidationError.
+func Load() (*Config, error) {
+	return LoadWithOptions(context.Background(), DefaultOptions())
+}
+
+// LoadWithOptions reads the configuration from the given sources.
+func LoadWithOptions(ctx context.Context, opts Options) (*Config, error) {
+	cfg := &Config{}
+	if err := populate(ctx, cfg, opts); err != nil {
+		return nil, err
 	}
+	return cfg, nil
+}
 
-	// Cognito client secret - optional, only needed if client has secret configured
-	cognitoClientSecret := os.Getenv("COGNITO_CLIENT_SECRET")
-
-	// Cognito endpoint - empty means use AWS default endpoint (for production/Lambda)
-	// Set to http://localhost:9229 for local development with cognito-local
-	cognitoEndpoint := os.Getenv("COGNITO_ENDPOINT")
-
-	return &Config{
-		DatabaseURL:         databaseURL,
-		EncryptionSecret:    encryptionSecret,
-		CognitoUserPoolID:   cognitoUserPoolID,
-		CognitoClientID:     cognitoClientID,
-		CognitoClientSecret: cognitoClientSecret,
-		CognitoEndpoint:     cognitoEndpoint,
-	}, nil
+// Redacted renders the configuration as KEY=value lines for startup logs,
+// masking every field tagged as secret.
+func (c *Config) Redacted() string {
+	return redacted(c)
 }
@@ -0,0 +1,246 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported struct tags:
+//
+//	env:"NAME"        environment variable holding the value
+//	default:"value"   used when the variable is unset or empty
+//	required:"true"   reported as a problem when no value is available
+//	required:"K=v"    required only while the earlier setting K is v;
+//	                  required:"K=a|b" while it is any of the listed values
+//	oneof:"a|b|c"     restricts the value to the listed options
+//	secret:"true"     masked in Redacted; secret:"url" only masks the URL password
+//
+// Field types may be string, bool, int, time.Duration or []string (comma
+// separated). Embedded structs without an env tag are read field by field,
+// so a group of settings can be shared by several configurations.
+
+// Source provides raw configuration values.
+type Source interface {
+	Lookup(key string) (string, bool)
+}
+
+// Options controls where LoadWithOptions reads values from.
+type Options struct {
+	// Sources are consulted in order; the first one defining a key wins.
+	Sources []Source
+	// Resolver resolves secret references such as "ssm:/spendflix/dev/enc".
+	// References are rejected when it is nil.
+	Resolver SecretResolver
+}
+
+// ValidationError aggregates every problem found while loading the configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+func lookup(sources []Source, key string) (string, bool) {
+	for _, source := range sources {
+		if value, ok := source.Lookup(key); ok && value != "" {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func populate(ctx context.Context, target any, opts Options) error {
+	var problems []string
+	populateStruct(ctx, reflect.ValueOf(target).Elem(), opts, map[string]string{}, &problems)
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// populateStruct sets the fields of v in declaration order, descending into
+// embedded structs. values collects the raw value of every key seen so far,
+// for required conditions on earlier keys.
+func populateStruct(ctx context.Context, v reflect.Value, opts Options, values map[string]string, problems *[]string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("env")
+		if key == "" {
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				populateStruct(ctx, v.Field(i), opts, values, problems)
+			}
+			continue
+		}
+
+		raw, ok := lookup(opts.Sources, key)
+		if ok && IsSecretReference(raw) {
+			if opts.Resolver == nil {
+				*problems = append(*problems, fmt.Sprintf("%s: secret references are not supported here", key))
+				continue
+			}
+			resolved, err := opts.Resolver.Resolve(ctx, raw)
+			if err != nil {
+				*problems = append(*problems, fmt.Sprintf("%s: %v", key, err))
+				continue
+			}
+			raw = resolved
+		}
+		if !ok {
+			raw, ok = field.Tag.Lookup("default")
+		}
+		values[key] = raw
+		if !ok || raw == "" {
+			if required(field.Tag.Get("required"), values) {
+				*problems = append(*problems, fmt.Sprintf("%s is required", key))
+			}
+			continue
+		}
+
+		if oneof := field.Tag.Get("oneof"); oneof != "" && !containsOption(oneof, raw) {
+			*problems = append(*problems, fmt.Sprintf("%s must be one of %s, got %q", key, strings.ReplaceAll(oneof, "|", ", "), raw))
+			continue
+		}
+
+		if err := setField(v.Field(i), raw); err != nil {
+			*problems = append(*problems, fmt.Sprintf("%s: %v", key, err))
+		}
+	}
+}
+
+// required evaluates a required tag: "true", or "KEY=a|b" to require the
+// field only while the earlier setting KEY has one of those values.
+func required(tag string, values map[string]string) bool {
+	if tag == "true" {
+		return true
+	}
+	key, options, ok := strings.Cut(tag, "=")
+	return ok && containsOption(options, values[key])
+}
+
+func containsOption(oneof, value string) bool {
+	for _, option := range strings.Split(oneof, "|") {
+		if option == value {
+			return true
+		}
+	}
+	return false
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setField(field reflect.Value, raw string) error {
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		field.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		field.SetInt(int64(n))
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported list type %s", field.Type())
+		}
+		field.Set(reflect.ValueOf(splitList(raw)))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+func splitList(raw string) []string {
+	parts := strings.Split(raw, ",")
+	list := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			list = append(list, part)
+		}
+	}
+	return list
+}
+
+const mask = "****"
+
+func redacted(target any) string {
+	var b strings.Builder
+	writeRedacted(&b, reflect.ValueOf(target).Elem())
+	return b.String()
+}
+
+func writeRedacted(b *strings.Builder, v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("env")
+		if key == "" {
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				writeRedacted(b, v.Field(i))
+			}
+			continue
+		}
+
+		value := formatValue(v.Field(i))
+		switch field.Tag.Get("secret") {
+		case "true":
+			if value != "" {
+				value = mask
+			}
+		case "url":
+			value = redactURL(value)
+		}
+
+		fmt.Fprintf(b, "%s=%s\n", key, value)
+	}
+}
+
+func formatValue(field reflect.Value) string {
+	if field.Type() == durationType {
+		return time.Duration(field.Int()).String()
+	}
+	if field.Kind() == reflect.Slice {
+		items := make([]string, field.Len())
+		for i := range items {
+			items[i] = field.Index(i).String()
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(field.Interface())
+}
+
+// redactURL masks the password of a connection URL, or the whole value when it
+// cannot be parsed.
+func redactURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return mask
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// Secret reference prefixes. A value such as "ssm:/spendflix/dev/enc" is
+// replaced by the decrypted SSM parameter, and "secretsmanager:name#key" by
+// the key of a JSON secret (or the whole secret string when #key is omitted).
+const (
+	ssmPrefix            = "ssm:"
+	secretsManagerPrefix = "secretsmanager:"
+)
+
+// IsSecretReference reports whether value points to an external secret store.
+func IsSecretReference(value string) bool {
+	return strings.HasPrefix(value, ssmPrefix) || strings.HasPrefix(value, secretsManagerPrefix)
+}
+
+// SecretResolver resolves secret references to their values.
+type SecretResolver interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// SSMAPI is the subset of the SSM client used to resolve parameters.
+type SSMAPI interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
+// SecretsManagerAPI is the subset of the Secrets Manager client used to resolve secrets.
+type SecretsManagerAPI interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// AWSSecretResolver resolves references against SSM Parameter Store and
+// Secrets Manager. The AWS clients are created on first use, so processes
+// without references never load AWS credentials.
+type AWSSecretResolver struct {
+	once           sync.Once
+	initErr        error
+	ssm            SSMAPI
+	secretsManager SecretsManagerAPI
+}
+
+// NewAWSSecretResolver creates a resolver using the default AWS configuration.
+func NewAWSSecretResolver() *AWSSecretResolver {
+	return &AWSSecretResolver{}
+}
+
+// NewSecretResolverWithClients creates a resolver backed by the given clients.
+// This allows tests to stand in fakes for SSM and Secrets Manager.
+func NewSecretResolverWithClients(ssmClient SSMAPI, secretsManagerClient SecretsManagerAPI) *AWSSecretResolver {
+	r := &AWSSecretResolver{ssm: ssmClient, secretsManager: secretsManagerClient}
+	r.once.Do(func() {})
+	return r
+}
+
+func (r *AWSSecretResolver) init(ctx context.Context) error {
+	r.once.Do(func() {
+		awsCfg, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			r.initErr = fmt.Errorf("failed to load AWS config: %w", err)
+			return
+		}
+		r.ssm = ssm.NewFromConfig(awsCfg)
+		r.secretsManager = secretsmanager.NewFromConfig(awsCfg)
+	})
+	return r.initErr
+}
+
+func (r *AWSSecretResolver) Resolve(ctx context.Context, ref string) (string, error) {
+	if err := r.init(ctx); err != nil {
+		return "", err
+	}
+
+	switch {
+	case strings.HasPrefix(ref, ssmPrefix):
+		return r.resolveParameter(ctx, strings.TrimPrefix(ref, ssmPrefix))
+	case strings.HasPrefix(ref, secretsManagerPrefix):
+		return r.resolveSecret(ctx, strings.TrimPrefix(ref, secretsManagerPrefix))
+	default:
+		return "", fmt.Errorf("unsupported secret reference %q", ref)
+	}
+}
+
+func (r *AWSSecretResolver) resolveParameter(ctx context.Context, name string) (string, error) {
+	if r.ssm == nil {
+		return "", errors.New("SSM is not configured")
+	}
+
+	output, err := r.ssm.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read SSM parameter %s: %w", name, err)
+	}
+	if output.Parameter == nil || output.Parameter.Value == nil {
+		return "", fmt.Errorf("SSM parameter %s has no value", name)
+	}
+
+	return *output.Parameter.Value, nil
+}
+
+func (r *AWSSecretResolver) resolveSecret(ctx context.Context, ref string) (string, error) {
+	if r.secretsManager == nil {
+		return "", errors.New("secrets manager is not configured")
+	}
+
+	id, key, hasKey := strings.Cut(ref, "#")
+	output, err := r.secretsManager.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(id),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret %s: %w", id, err)
+	}
+	if output.SecretString == nil {
+		return "", fmt.Errorf("secret %s has no string value", id)
+	}
+	if !hasKey {
+		return *output.SecretString, nil
+	}
+
+	var values map[string]string
+	if err := json.Unmarshal([]byte(*output.SecretString), &values); err != nil {
+		return "", fmt.Errorf("secret %s is not a JSON object", id)
+	}
+	value, ok := values[key]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no key %q", id, key)
+	}
+	return value, nil
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSecretsManager struct {
+	secrets map[string]string
+}
+
+func (f *fakeSecretsManager) GetSecretValue(_ context.Context, params *secretsmanager.GetSecretValueInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	value, ok := f.secrets[aws.ToString(params.SecretId)]
+	if !ok {
+		return nil, &smtypes.ResourceNotFoundException{}
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(value)}, nil
+}
+
+func TestIsSecretReference(t *testing.T) {
+	assert.True(t, IsSecretReference("ssm:/spendflix/dev/enc"))
+	assert.True(t, IsSecretReference("secretsmanager:spendflix/dev/db"))
+	assert.False(t, IsSecretReference("postgresql://localhost/db"))
+	assert.False(t, IsSecretReference("plain-secret"))
+}
+
+func TestAWSSecretResolver_Resolve(t *testing.T) {
+	resolver := NewSecretResolverWithClients(
+		newFakeSSM(map[string]string{"/spendflix/dev/enc": "from-ssm"}),
+		&fakeSecretsManager{secrets: map[string]string{
+			"spendflix/dev/plain": "from-secrets-manager",
+			"spendflix/dev/db":    `{"url":"postgresql://db/spendflix","user":"app"}`,
+		}},
+	)
+	ctx := context.Background()
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr string
+	}{
+		{ref: "ssm:/spendflix/dev/enc", want: "from-ssm"},
+		{ref: "secretsmanager:spendflix/dev/plain", want: "from-secrets-manager"},
+		{ref: "secretsmanager:spendflix/dev/db#url", want: "postgresql://db/spendflix"},
+		{ref: "secretsmanager:spendflix/dev/db#password", wantErr: `has no key "password"`},
+		{ref: "secretsmanager:spendflix/dev/plain#url", wantErr: "is not a JSON object"},
+		{ref: "secretsmanager:spendflix/dev/missing", wantErr: "failed to read secret"},
+		{ref: "vault:secret/enc", wantErr: "unsupported secret reference"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			value, err := resolver.Resolve(ctx, tt.ref)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, value)
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"strings"
+)
+
+// EnvSource reads values from the process environment.
+type EnvSource struct{}
+
+func (EnvSource) Lookup(key string) (string, bool) {
+	return os.LookupEnv(key)
+}
+
+// MapSource serves values from a map. It is mostly useful in tests.
+type MapSource map[string]string
+
+func (m MapSource) Lookup(key string) (string, bool) {
+	value, ok := m[key]
+	return value, ok
+}
+
+// DotEnvFile reads a .env file, returning an empty source when it does not
+// exist. Parse errors are logged and the file is ignored.
+func DotEnvFile(path string) Source {
+	file, err := os.Open(path) // #nosec G304 -- path comes from the operator, not from requests
+	if errors.Is(err, fs.ErrNotExist) {
+		return MapSource{}
+	}
+	if err != nil {
+		log.Printf("Ignoring %s: %v", path, err)
+		return MapSource{}
+	}
+	defer file.Close()
+
+	values, err := ParseDotEnv(file)
+	if err != nil {
+		log.Printf("Ignoring %s: %v", path, err)
+		return MapSource{}
+	}
+	return values
+}
+
+// ParseDotEnv parses KEY=value lines. Blank lines and lines starting with #
+// are skipped, an optional "export " prefix is allowed and values may be
+// wrapped in single or double quotes.
+func ParseDotEnv(r io.Reader) (MapSource, error) {
+	values := MapSource{}
+	scanner := bufio.NewScanner(r)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("line %d: expected KEY=value", lineNumber)
+		}
+
+		values[key] = unquote(strings.TrimSpace(value))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 {
+		first, last := value[0], value[len(value)-1]
+		if (first == '"' || first == '\'') && first == last {
+			return value[1 : len(value)-1]
+		}
+	}
+	// Strip trailing comments from unquoted values.
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value
+}
@@ -0,0 +1,142 @@
+// Package database opens the Postgres connection pools of the service, sized
+// by config.PoolConfig and optionally authenticated with RDS IAM tokens.
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"services/auth/internal/config"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// errIAMWithoutTLS is returned when IAM auth tokens could be sent over a
+// plaintext connection.
+var errIAMWithoutTLS = errors.New("IAM authentication requires TLS: set sslmode=require or stricter in the database URL")
+
+// Pools are the connection pools of the service.
+type Pools struct {
+	// Primary serves writes and the reads that must see them.
+	Primary *pgxpool.Pool
+	// Replica serves the reads that tolerate replication lag. It is Primary
+	// when no read replica is configured.
+	Replica *pgxpool.Pool
+}
+
+// HasReplica reports whether reads can go to a separate replica.
+func (p *Pools) HasReplica() bool {
+	return p.Replica != p.Primary
+}
+
+// Close closes the pools.
+func (p *Pools) Close() {
+	if p.HasReplica() {
+		p.Replica.Close()
+	}
+	p.Primary.Close()
+}
+
+// Connect opens the primary pool on url and, when cfg names one, the read
+// replica pool, pinging each so a wrong URL or unreachable database fails
+// here rather than on the first request. region is the region of the IAM
+// auth tokens.
+func Connect(ctx context.Context, url string, cfg config.PoolConfig, region string) (*Pools, error) {
+	var token TokenFunc
+	if cfg.DatabaseIAMAuth {
+		var err error
+		if token, err = IAMAuthToken(ctx, region); err != nil {
+			return nil, err
+		}
+	}
+
+	primary, err := Open(ctx, url, cfg, token)
+	if err != nil {
+		return nil, err
+	}
+	pools := &Pools{Primary: primary, Replica: primary}
+	if cfg.DatabaseReadURL == "" {
+		return pools, nil
+	}
+
+	replica, err := Open(ctx, cfg.DatabaseReadURL, cfg, token)
+	if err != nil {
+		primary.Close()
+		return nil, fmt.Errorf("read replica: %w", err)
+	}
+	pools.Replica = replica
+	log.Printf("Reading from replica %s", replica.Config().ConnConfig.Host)
+	return pools, nil
+}
+
+// Open opens a pool on url sized by cfg, authenticating new connections with
+// token when it is not nil, and pings it within cfg.DatabaseConnectTimeout.
+func Open(ctx context.Context, url string, cfg config.PoolConfig, token TokenFunc) (*pgxpool.Pool, error) {
+	poolCfg, err := poolConfig(url, cfg, token)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database pool: %w", err)
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, cfg.DatabaseConnectTimeout)
+	defer cancel()
+	if err := pool.Ping(pingCtx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to reach database at %s: %w", poolCfg.ConnConfig.Host, err)
+	}
+	return pool, nil
+}
+
+func poolConfig(url string, cfg config.PoolConfig, token TokenFunc) (*pgxpool.Config, error) {
+	if cfg.DatabaseMaxConns < 1 || cfg.DatabaseMinConns < 0 || cfg.DatabaseMinConns > cfg.DatabaseMaxConns {
+		return nil, fmt.Errorf("invalid pool size: %d to %d connections", cfg.DatabaseMinConns, cfg.DatabaseMaxConns)
+	}
+	// The URL may hold credentials, so parse errors do not quote it
+	poolCfg, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database URL: %w", err)
+	}
+
+	poolCfg.MaxConns = int32(cfg.DatabaseMaxConns)
+	poolCfg.MinConns = int32(cfg.DatabaseMinConns)
+	poolCfg.MaxConnLifetime = cfg.DatabaseMaxConnLifetime
+	poolCfg.MaxConnIdleTime = cfg.DatabaseMaxConnIdleTime
+	poolCfg.HealthCheckPeriod = cfg.DatabaseHealthCheckPeriod
+	poolCfg.ConnConfig.ConnectTimeout = cfg.DatabaseConnectTimeout
+
+	if token != nil {
+		if err := requireTLS(&poolCfg.ConnConfig.Config); err != nil {
+			return nil, err
+		}
+		poolCfg.BeforeConnect = func(ctx context.Context, conn *pgx.ConnConfig) error {
+			password, err := token(ctx, conn.Host, conn.Port, conn.User)
+			if err != nil {
+				return fmt.Errorf("failed to generate IAM auth token: %w", err)
+			}
+			conn.Password = password
+			return nil
+		}
+	}
+	return poolCfg, nil
+}
+
+// requireTLS checks that every connection attempt of cfg uses TLS. With
+// sslmode=prefer or allow, pgx also tries a plaintext connection, which
+// would send the auth token in the clear.
+func requireTLS(cfg *pgconn.Config) error {
+	if cfg.TLSConfig == nil {
+		return errIAMWithoutTLS
+	}
+	for _, fallback := range cfg.Fallbacks {
+		if fallback.TLSConfig == nil {
+			return errIAMWithoutTLS
+		}
+	}
+	return nil
+}
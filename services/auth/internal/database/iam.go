@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// TokenFunc returns the password of a new connection to host:port as user.
+type TokenFunc func(ctx context.Context, host string, port uint16, user string) (string, error)
+
+// authTokenTTL is how long RDS accepts an IAM auth token for opening a
+// connection; open connections outlive it.
+const authTokenTTL = 15 * time.Minute
+
+// emptyPayloadHash is the SHA-256 of an empty body, which the presigned
+// connect request has.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// IAMAuthToken returns a TokenFunc generating RDS IAM auth tokens in region
+// from the default AWS credentials, e.g. the Lambda execution role, which
+// needs rds-db:connect on the database user.
+func IAMAuthToken(ctx context.Context, region string) (TokenFunc, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if region != "" {
+		opts = append(opts, awsconfig.WithRegion(region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS credentials for IAM auth: %w", err)
+	}
+	signer := v4.NewSigner()
+	return func(ctx context.Context, host string, port uint16, user string) (string, error) {
+		creds, err := awsCfg.Credentials.Retrieve(ctx)
+		if err != nil {
+			return "", err
+		}
+		return buildAuthToken(ctx, signer, creds, awsCfg.Region, host, port, user, time.Now())
+	}, nil
+}
+
+// IAMAuthURL returns databaseURL with an auth token from token as its
+// password, for tools that connect with a URL rather than a pool, such as
+// cmd/migrate. The token only opens connections for authTokenTTL, so get a
+// new URL for each run.
+func IAMAuthURL(ctx context.Context, databaseURL string, token TokenFunc) (string, error) {
+	// The URL may hold credentials, so parse errors do not quote it
+	connCfg, err := pgconn.ParseConfig(databaseURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid database URL: %w", err)
+	}
+	if err := requireTLS(connCfg); err != nil {
+		return "", err
+	}
+	u, err := url.Parse(databaseURL)
+	if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+		return "", errors.New("IAM authentication requires a postgres:// database URL")
+	}
+
+	password, err := token(ctx, connCfg.Host, connCfg.Port, connCfg.User)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate IAM auth token: %w", err)
+	}
+	u.User = url.UserPassword(connCfg.User, password)
+	return u.String(), nil
+}
+
+// buildAuthToken presigns the rds-db "connect" action for user, as the RDS
+// auth token helper of the AWS SDK does: the token is the presigned URL
+// without its scheme.
+func buildAuthToken(ctx context.Context, signer *v4.Signer, creds aws.Credentials, region, host string, port uint16, user string, now time.Time) (string, error) {
+	endpoint := net.JoinHostPort(host, strconv.Itoa(int(port)))
+	query := url.Values{
+		"Action":        {"connect"},
+		"DBUser":        {user},
+		"X-Amz-Expires": {strconv.Itoa(int(authTokenTTL.Seconds()))},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+endpoint+"/?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	signed, _, err := signer.PresignHTTP(ctx, creds, req, emptyPayloadHash, "rds-db", region, now.UTC())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(signed, "https://"), nil
+}
@@ -0,0 +1,87 @@
+// Package emailaddr normalizes email addresses so the same mailbox always maps
+// to the same account, however the user typed it.
+package emailaddr
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// ErrInvalid is returned for values that are not a local@domain address.
+var ErrInvalid = errors.New("invalid email address")
+
+// domainProfile converts internationalized domains to their ASCII (punycode)
+// form with the same rules browsers use for host names.
+var domainProfile = idna.Lookup
+
+// Normalize trims surrounding whitespace, lowercases the address and converts
+// an internationalized domain to punycode, e.g. " João@Exämple.com " becomes
+// "joão@xn--exmple-cua.com". The result is the address we store and send
+// mail to.
+func Normalize(raw string) (string, error) {
+	addr := strings.ToLower(strings.TrimSpace(raw))
+
+	at := strings.LastIndex(addr, "@")
+	if at <= 0 || at == len(addr)-1 {
+		return "", ErrInvalid
+	}
+	local, domain := addr[:at], addr[at+1:]
+	if strings.ContainsAny(local, " \t\r\n\"") {
+		return "", ErrInvalid
+	}
+
+	asciiDomain, err := domainProfile.ToASCII(strings.TrimSuffix(domain, "."))
+	if err != nil || asciiDomain == "" {
+		return "", ErrInvalid
+	}
+
+	return local + "@" + asciiDomain, nil
+}
+
+// gmailDomains are the domains served by Gmail, which ignores dots and
+// "+tag" suffixes in the local part.
+var gmailDomains = map[string]bool{
+	"gmail.com":      true,
+	"googlemail.com": true,
+}
+
+// Normalizer derives the canonical identity of an address, the key used to
+// detect that two sign-ups belong to the same mailbox.
+type Normalizer struct {
+	foldGmail bool
+}
+
+// NewNormalizer creates a Normalizer. With foldGmail, Gmail addresses are
+// folded to a single mailbox: "J.Doe+promo@googlemail.com" and
+// "jdoe@gmail.com" share the canonical form "jdoe@gmail.com".
+func NewNormalizer(foldGmail bool) *Normalizer {
+	return &Normalizer{foldGmail: foldGmail}
+}
+
+// Canonical returns the canonical identity of raw.
+func (n *Normalizer) Canonical(raw string) (string, error) {
+	addr, err := Normalize(raw)
+	if err != nil {
+		return "", err
+	}
+	if n == nil || !n.foldGmail {
+		return addr, nil
+	}
+
+	at := strings.LastIndex(addr, "@")
+	local, domain := addr[:at], addr[at+1:]
+	if !gmailDomains[domain] {
+		return addr, nil
+	}
+
+	if plus := strings.Index(local, "+"); plus >= 0 {
+		local = local[:plus]
+	}
+	local = strings.ReplaceAll(local, ".", "")
+	if local == "" {
+		return "", ErrInvalid
+	}
+	return local + "@gmail.com", nil
+}
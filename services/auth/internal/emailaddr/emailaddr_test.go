@@ -0,0 +1,84 @@
+package emailaddr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"john@example.com", "john@example.com"},
+		{"  John@Example.COM \n", "john@example.com"},
+		{"john@example.com.", "john@example.com"},
+		{"josé@exämple.com", "josé@xn--exmple-cua.com"},
+		{"user@МОСКВА.рф", "user@xn--80adxhks.xn--p1ai"},
+		{"first.last+tag@gmail.com", "first.last+tag@gmail.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := Normalize(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNormalize_Invalid(t *testing.T) {
+	invalid := []string{"", "   ", "john", "@example.com", "john@", "jo hn@example.com", `jo"hn@example.com`, "john@exa mple.com"}
+
+	for _, input := range invalid {
+		t.Run(input, func(t *testing.T) {
+			_, err := Normalize(input)
+			assert.ErrorIs(t, err, ErrInvalid)
+		})
+	}
+}
+
+func TestNormalizer_Canonical(t *testing.T) {
+	folding := NewNormalizer(true)
+	plain := NewNormalizer(false)
+
+	tests := []struct {
+		input       string
+		wantFolded  string
+		wantPlain   string
+		description string
+	}{
+		{"J.Doe+promo@Gmail.com", "jdoe@gmail.com", "j.doe+promo@gmail.com", "dots and tags"},
+		{"jdoe@googlemail.com", "jdoe@gmail.com", "jdoe@googlemail.com", "googlemail alias"},
+		{"j.doe+promo@example.com", "j.doe+promo@example.com", "j.doe+promo@example.com", "other domains untouched"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			got, err := folding.Canonical(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantFolded, got)
+
+			got, err = plain.Canonical(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantPlain, got)
+		})
+	}
+}
+
+func TestNormalizer_Canonical_Invalid(t *testing.T) {
+	_, err := NewNormalizer(true).Canonical("+tag@gmail.com")
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	_, err = NewNormalizer(true).Canonical("not-an-email")
+	assert.ErrorIs(t, err, ErrInvalid)
+}
+
+func TestNormalizer_Nil(t *testing.T) {
+	var n *Normalizer
+	got, err := n.Canonical("J.Doe@Gmail.com")
+	require.NoError(t, err)
+	assert.Equal(t, "j.doe@gmail.com", got)
+}
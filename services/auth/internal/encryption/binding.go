@@ -0,0 +1,30 @@
+package encryption
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Binding names the field a value is stored in. Keyring.Encrypt seals it as
+// associated data, so a value only opens with the binding it was sealed
+// with: one copied into another row or column fails to decrypt.
+type Binding struct {
+	Table  string
+	Column string
+	RowID  int64
+}
+
+func (b Binding) String() string {
+	return fmt.Sprintf("%s.%s of row %d", b.Table, b.Column, b.RowID)
+}
+
+// associatedData encodes the binding unambiguously, each name prefixed with
+// its length, so no two bindings share the same bytes.
+func (b Binding) associatedData() []byte {
+	aad := make([]byte, 0, 2+len(b.Table)+2+len(b.Column)+8)
+	aad = binary.BigEndian.AppendUint16(aad, uint16(len(b.Table)))
+	aad = append(aad, b.Table...)
+	aad = binary.BigEndian.AppendUint16(aad, uint16(len(b.Column)))
+	aad = append(aad, b.Column...)
+	return binary.BigEndian.AppendUint64(aad, uint64(b.RowID))
+}
@@ -0,0 +1,139 @@
+package encryption
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"services/auth/internal/config"
+	"strings"
+)
+
+// Blind indexes are stored as <key id>:base64url(HMAC-SHA256), truncated to
+// the configured length. The key ID tells which key computed an index, so
+// lookups during a rotation search every key and cmd/rekey recomputes the
+// stale ones.
+const (
+	// MinBlindIndexLength keeps truncated indexes from matching so many
+	// values that they stop being useful.
+	MinBlindIndexLength = 4
+	// DefaultBlindIndexLength makes collisions negligible, so a unique
+	// constraint on the index column enforces uniqueness of the values.
+	DefaultBlindIndexLength = 16
+
+	minIndexKeyLength = 32
+)
+
+// ErrNoBlindIndex is returned when a blind index is needed but
+// BLIND_INDEX_KEY is not configured.
+var ErrNoBlindIndex = errors.New("blind index key is not configured")
+
+// IndexKey is one key of a BlindIndex.
+type IndexKey struct {
+	ID     string
+	Secret string
+}
+
+// BlindIndex computes keyed hashes of values that are stored encrypted, so
+// rows can be found by the value (and the value kept unique) without
+// decrypting anything. Equal values have equal indexes, so only values that
+// are exactly equal match: normalize them first, e.g. with emailaddr.
+//
+// An index reveals which rows share a value to anyone reading the table, but
+// not the value itself as long as the key stays secret. Its key must
+// therefore differ from the encryption keys.
+type BlindIndex struct {
+	active IndexKey
+	keys   []IndexKey
+	length int
+}
+
+// NewBlindIndex returns a blind index computing indexes of length bytes with
+// active, and also matching indexes computed with the retired keys.
+func NewBlindIndex(length int, active IndexKey, retired ...IndexKey) (*BlindIndex, error) {
+	if length < MinBlindIndexLength || length > sha256.Size {
+		return nil, fmt.Errorf("invalid blind index length %d: want %d to %d bytes", length, MinBlindIndexLength, sha256.Size)
+	}
+	b := &BlindIndex{active: active, length: length}
+	seen := make(map[string]bool, len(retired)+1)
+	for _, key := range append([]IndexKey{active}, retired...) {
+		if !validKeyID(key.ID) {
+			return nil, fmt.Errorf("invalid blind index key id %q: use letters, digits, '-' and '_'", key.ID)
+		}
+		if seen[key.ID] {
+			return nil, fmt.Errorf("duplicate blind index key id %q", key.ID)
+		}
+		if len(key.Secret) < minIndexKeyLength {
+			return nil, fmt.Errorf("blind index key %s is too short: want at least %d bytes", key.ID, minIndexKeyLength)
+		}
+		seen[key.ID] = true
+		b.keys = append(b.keys, key)
+	}
+	return b, nil
+}
+
+// BlindIndexFromConfig builds the blind index configured by the
+// BLIND_INDEX_* settings. It returns ErrNoBlindIndex when BLIND_INDEX_KEY is
+// not set.
+func BlindIndexFromConfig(cfg config.EncryptionConfig) (*BlindIndex, error) {
+	if cfg.BlindIndexKey == "" {
+		return nil, ErrNoBlindIndex
+	}
+	if cfg.BlindIndexKey == cfg.EncryptionSecret {
+		return nil, errors.New("BLIND_INDEX_KEY must differ from ENCRYPTION_SECRET")
+	}
+	retired := make([]IndexKey, 0, len(cfg.BlindIndexRetiredKeys))
+	for _, spec := range cfg.BlindIndexRetiredKeys {
+		id, secret, ok := strings.Cut(spec, ":")
+		if !ok || secret == "" {
+			return nil, fmt.Errorf("invalid blind index key %q: want id:secret", redactKeySpec(spec))
+		}
+		retired = append(retired, IndexKey{ID: id, Secret: secret})
+	}
+	length := cfg.BlindIndexLength
+	if length == 0 {
+		length = DefaultBlindIndexLength
+	}
+	return NewBlindIndex(length, IndexKey{ID: cfg.BlindIndexKeyID, Secret: cfg.BlindIndexKey}, retired...)
+}
+
+// ActiveKeyID returns the ID of the key new indexes are computed with.
+func (b *BlindIndex) ActiveKeyID() string {
+	return b.active.ID
+}
+
+// Compute returns the index of value with the active key. Indexes of the
+// same value in different domains, e.g. "users.email" and "users.cpf", are
+// unrelated.
+func (b *BlindIndex) Compute(domain, value string) string {
+	return b.compute(b.active, domain, value)
+}
+
+// Candidates returns the indexes value may be stored under: one for every
+// key, the active one first. Look rows up with "index = ANY(candidates)".
+func (b *BlindIndex) Candidates(domain, value string) []string {
+	candidates := make([]string, 0, len(b.keys))
+	for _, key := range b.keys {
+		candidates = append(candidates, b.compute(key, domain, value))
+	}
+	return candidates
+}
+
+// NeedsReindex reports whether index was not computed with the active key
+// at the configured length.
+func (b *BlindIndex) NeedsReindex(index string) bool {
+	keyID, encoded, ok := strings.Cut(index, ":")
+	return !ok || keyID != b.active.ID || base64.RawURLEncoding.DecodedLen(len(encoded)) != b.length
+}
+
+func (b *BlindIndex) compute(key IndexKey, domain, value string) string {
+	mac := hmac.New(sha256.New, []byte(key.Secret))
+	// Prefix the domain with its length so no domain and value pair hashes
+	// like another
+	mac.Write(binary.BigEndian.AppendUint16(nil, uint16(len(domain))))
+	mac.Write([]byte(domain))
+	mac.Write([]byte(value))
+	return key.ID + ":" + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:b.length])
+}
@@ -0,0 +1,102 @@
+package encryption
+
+import (
+	"strings"
+	"testing"
+
+	"services/auth/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	oldIndexKey = IndexKey{ID: "b1", Secret: "old-blind-index-key-1234567890123"}
+	newIndexKey = IndexKey{ID: "b2", Secret: "new-blind-index-key-1234567890123"}
+)
+
+func TestBlindIndex_Compute(t *testing.T) {
+	blind, err := NewBlindIndex(DefaultBlindIndexLength, oldIndexKey)
+	require.NoError(t, err)
+
+	index := blind.Compute("users.cpf", "12345678909")
+	assert.Equal(t, index, blind.Compute("users.cpf", "12345678909"), "indexes are deterministic")
+	assert.True(t, strings.HasPrefix(index, "b1:"))
+	assert.NotContains(t, index, "12345678909")
+
+	assert.NotEqual(t, index, blind.Compute("users.cpf", "12345678900"))
+	assert.NotEqual(t, index, blind.Compute("users.email", "12345678909"), "domains are separated")
+	assert.NotEqual(t, blind.Compute("users.cp", "f12345678909"), index)
+
+	other, err := NewBlindIndex(DefaultBlindIndexLength, IndexKey{ID: "b1", Secret: newIndexKey.Secret})
+	require.NoError(t, err)
+	assert.NotEqual(t, index, other.Compute("users.cpf", "12345678909"), "indexes depend on the key")
+}
+
+func TestBlindIndex_Truncated(t *testing.T) {
+	full, err := NewBlindIndex(32, oldIndexKey)
+	require.NoError(t, err)
+	short, err := NewBlindIndex(MinBlindIndexLength, oldIndexKey)
+	require.NoError(t, err)
+
+	fullIndex := full.Compute("users.cpf", "12345678909")
+	shortIndex := short.Compute("users.cpf", "12345678909")
+	assert.Len(t, strings.TrimPrefix(shortIndex, "b1:"), 6)
+	assert.Len(t, strings.TrimPrefix(fullIndex, "b1:"), 43)
+	assert.True(t, short.NeedsReindex(fullIndex), "a new length needs new indexes")
+	assert.False(t, short.NeedsReindex(shortIndex))
+
+	for _, length := range []int{0, MinBlindIndexLength - 1, 33} {
+		_, err := NewBlindIndex(length, oldIndexKey)
+		assert.Error(t, err, length)
+	}
+}
+
+func TestBlindIndex_Rotation(t *testing.T) {
+	before, err := NewBlindIndex(DefaultBlindIndexLength, oldIndexKey)
+	require.NoError(t, err)
+	after, err := NewBlindIndex(DefaultBlindIndexLength, newIndexKey, oldIndexKey)
+	require.NoError(t, err)
+
+	stored := before.Compute("users.cpf", "12345678909")
+	candidates := after.Candidates("users.cpf", "12345678909")
+	require.Len(t, candidates, 2)
+	assert.Equal(t, after.Compute("users.cpf", "12345678909"), candidates[0], "the active key comes first")
+	assert.Contains(t, candidates, stored, "values indexed before the rotation are still found")
+
+	assert.True(t, after.NeedsReindex(stored))
+	assert.False(t, after.NeedsReindex(candidates[0]))
+	assert.True(t, after.NeedsReindex("not an index"))
+}
+
+func TestNewBlindIndex_Validation(t *testing.T) {
+	_, err := NewBlindIndex(DefaultBlindIndexLength, IndexKey{ID: "b1", Secret: "short"})
+	assert.ErrorContains(t, err, "too short")
+
+	_, err = NewBlindIndex(DefaultBlindIndexLength, IndexKey{ID: "b:1", Secret: oldIndexKey.Secret})
+	assert.Error(t, err)
+
+	_, err = NewBlindIndex(DefaultBlindIndexLength, oldIndexKey, IndexKey{ID: oldIndexKey.ID, Secret: newIndexKey.Secret})
+	assert.ErrorContains(t, err, "duplicate")
+}
+
+func TestBlindIndexFromConfig(t *testing.T) {
+	_, err := BlindIndexFromConfig(config.EncryptionConfig{})
+	assert.ErrorIs(t, err, ErrNoBlindIndex)
+
+	_, err = BlindIndexFromConfig(config.EncryptionConfig{EncryptionSecret: oldIndexKey.Secret, BlindIndexKey: oldIndexKey.Secret, BlindIndexKeyID: "b1"})
+	assert.ErrorContains(t, err, "must differ")
+
+	blind, err := BlindIndexFromConfig(config.EncryptionConfig{
+		BlindIndexKey:         newIndexKey.Secret,
+		BlindIndexKeyID:       "b2",
+		BlindIndexRetiredKeys: []string{"b1:" + oldIndexKey.Secret},
+		BlindIndexLength:      8,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "b2", blind.ActiveKeyID())
+	assert.Len(t, blind.Candidates("users.cpf", "12345678909"), 2)
+
+	_, err = BlindIndexFromConfig(config.EncryptionConfig{BlindIndexKey: newIndexKey.Secret, BlindIndexKeyID: "b2", BlindIndexRetiredKeys: []string{"b1"}})
+	assert.ErrorContains(t, err, "want id:secret")
+}
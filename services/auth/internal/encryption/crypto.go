@@ -20,57 +20,47 @@ const (
 	saltLength = 16
 )
 
+// Encrypt seals plaintext with a key derived from secret and returns it in
+// the legacy unversioned format, base64(salt|iv|tag|ciphertext). New values
+// should be sealed with Keyring.Encrypt, whose envelope names the key.
 func Encrypt(plaintext, secret string) (string, error) {
-	// Generate IV
-	iv := make([]byte, ivLength)
-	if _, err := rand.Read(iv); err != nil {
+	sealed, err := sealWithSecret(plaintext, secret, nil)
+	if err != nil {
 		return "", err
 	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
 
+// sealWithSecret encrypts plaintext under a key derived from secret and a
+// random salt, authenticating aad with it, and returns salt|iv|tag|ciphertext.
+func sealWithSecret(plaintext, secret string, aad []byte) ([]byte, error) {
 	// Generate random salt per encryption
 	salt := make([]byte, saltLength)
 	if _, err := rand.Read(salt); err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// Generate key using PBKDF2
-	key := deriveKey(secret, salt)
-
-	// Create cipher
-	block, err := aes.NewCipher(key)
+	sealed, err := sealWithKey(deriveKey(secret, salt), []byte(plaintext), aad)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	aesgcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", err
-	}
-
-	// Encrypt
-	ciphertext := aesgcm.Seal(nil, iv, []byte(plaintext), nil)
-
-	// Separate tag from ciphertext
-	tag := ciphertext[len(ciphertext)-tagLength:]
-	encrypted := ciphertext[:len(ciphertext)-tagLength]
-
-	// Combine salt + IV + tag + encrypted
-	result := make([]byte, 0, len(salt)+len(iv)+len(tag)+len(encrypted))
-	result = append(result, salt...)
-	result = append(result, iv...)
-	result = append(result, tag...)
-	result = append(result, encrypted...)
-
-	return base64.StdEncoding.EncodeToString(result), nil
+	return append(salt, sealed...), nil
 }
 
+// Decrypt opens a value in the legacy format produced by Encrypt.
 func Decrypt(encryptedText, secret string) (string, error) {
 	// Decode base64
 	data, err := base64.StdEncoding.DecodeString(encryptedText)
 	if err != nil {
 		return "", err
 	}
+	return openWithSecret(data, secret, nil)
+}
 
+// openWithSecret decrypts salt|iv|tag|ciphertext as built by sealWithSecret.
+func openWithSecret(data []byte, secret string, aad []byte) (string, error) {
 	if len(data) < saltLength+ivLength+tagLength {
 		return "", errors.New("invalid encrypted data length")
 	}
@@ -78,41 +68,82 @@ func Decrypt(encryptedText, secret string) (string, error) {
 	salt := data[:saltLength]
 	payload := data[saltLength:]
 
-	return decryptWithSalt(secret, salt, payload)
+	return decryptWithSalt(secret, salt, payload, aad)
 }
 
 func deriveKey(secret string, salt []byte) []byte {
 	return pbkdf2.Key([]byte(secret), salt, iterations, keyLength, sha256.New)
 }
 
-func decryptWithSalt(secret string, salt []byte, payload []byte) (string, error) {
+func decryptWithSalt(secret string, salt []byte, payload []byte, aad []byte) (string, error) {
 	if len(payload) < ivLength+tagLength {
 		return "", errors.New("invalid encrypted data length")
 	}
 
-	iv := payload[0:ivLength]
-	tag := payload[ivLength : ivLength+tagLength]
-	encrypted := payload[ivLength+tagLength:]
+	plaintext, err := openWithKey(deriveKey(secret, salt), payload, aad)
+	if err != nil {
+		return "", err
+	}
 
-	key := deriveKey(secret, salt)
+	return string(plaintext), nil
+}
 
-	block, err := aes.NewCipher(key)
+// sealWithKey encrypts plaintext under a 256-bit key and a random IV,
+// authenticating aad with it, and returns iv|tag|ciphertext. The same aad
+// must be passed to openWithKey.
+func sealWithKey(key, plaintext, aad []byte) ([]byte, error) {
+	// Generate IV
+	iv := make([]byte, ivLength)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	aesgcm, err := newGCM(key)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	// Encrypt
+	ciphertext := aesgcm.Seal(nil, iv, plaintext, aad)
+
+	// Separate tag from ciphertext
+	tag := ciphertext[len(ciphertext)-tagLength:]
+	encrypted := ciphertext[:len(ciphertext)-tagLength]
+
+	// Combine IV + tag + encrypted
+	result := make([]byte, 0, len(iv)+len(tag)+len(encrypted))
+	result = append(result, iv...)
+	result = append(result, tag...)
+	result = append(result, encrypted...)
+
+	return result, nil
+}
+
+// openWithKey decrypts iv|tag|ciphertext as built by sealWithKey.
+func openWithKey(key, payload, aad []byte) ([]byte, error) {
+	if len(payload) < ivLength+tagLength {
+		return nil, errors.New("invalid encrypted data length")
 	}
 
-	aesgcm, err := cipher.NewGCM(block)
+	iv := payload[0:ivLength]
+	tag := payload[ivLength : ivLength+tagLength]
+	encrypted := payload[ivLength+tagLength:]
+
+	aesgcm, err := newGCM(key)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	ciphertext := make([]byte, len(encrypted)+len(tag))
 	copy(ciphertext, encrypted)
 	copy(ciphertext[len(encrypted):], tag)
-	plaintext, err := aesgcm.Open(nil, iv, ciphertext, nil)
+	return aesgcm.Open(nil, iv, ciphertext, aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-
-	return string(plaintext), nil
+	return cipher.NewGCM(block)
 }
@@ -0,0 +1,104 @@
+package encryption
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// FakeKMS is an in-memory stand-in for KMS. Each key it knows has a random
+// master key; the blobs it returns name their key, as real KMS blobs do, and
+// only open with it. Like the SDK, it fails requests whose context is done.
+type FakeKMS struct {
+	mu               sync.Mutex
+	keys             map[string][]byte
+	generateRequests int
+	decryptRequests  int
+}
+
+// NewFakeKMS returns a fake KMS holding the given key IDs.
+func NewFakeKMS(keyIDs ...string) *FakeKMS {
+	f := &FakeKMS{keys: make(map[string][]byte, len(keyIDs))}
+	for _, id := range keyIDs {
+		key := make([]byte, keyLength)
+		if _, err := rand.Read(key); err != nil {
+			panic(err)
+		}
+		f.keys[id] = key
+	}
+	return f
+}
+
+// Requests returns the number of GenerateDataKey and Decrypt calls served.
+func (f *FakeKMS) Requests() (generate, decrypt int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.generateRequests, f.decryptRequests
+}
+
+func (f *FakeKMS) GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, _ ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.generateRequests++
+
+	keyID := aws.ToString(params.KeyId)
+	master, ok := f.keys[keyID]
+	if !ok {
+		return nil, &types.NotFoundException{Message: aws.String("key " + keyID + " does not exist")}
+	}
+	if params.KeySpec != types.DataKeySpecAes256 {
+		return nil, errors.New("only AES_256 data keys are supported")
+	}
+
+	dataKey := make([]byte, keyLength)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	sealed, err := sealWithKey(master, dataKey, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	blob := append([]byte{byte(len(keyID))}, keyID...)
+	return &kms.GenerateDataKeyOutput{
+		KeyId:          aws.String(keyID),
+		Plaintext:      dataKey,
+		CiphertextBlob: append(blob, sealed...),
+	}, nil
+}
+
+func (f *FakeKMS) Decrypt(ctx context.Context, params *kms.DecryptInput, _ ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.decryptRequests++
+
+	blob := params.CiphertextBlob
+	if len(blob) == 0 || len(blob) < 1+int(blob[0]) {
+		return nil, &types.InvalidCiphertextException{Message: aws.String("malformed ciphertext blob")}
+	}
+	keyID := string(blob[1 : 1+int(blob[0])])
+	if params.KeyId != nil && *params.KeyId != keyID {
+		return nil, &types.IncorrectKeyException{Message: aws.String("the ciphertext was not encrypted under " + *params.KeyId)}
+	}
+	master, ok := f.keys[keyID]
+	if !ok {
+		return nil, &types.NotFoundException{Message: aws.String("key " + keyID + " does not exist")}
+	}
+
+	dataKey, err := openWithKey(master, blob[1+int(blob[0]):], nil)
+	if err != nil {
+		return nil, &types.InvalidCiphertextException{Message: aws.String(err.Error())}
+	}
+	return &kms.DecryptOutput{KeyId: aws.String(keyID), Plaintext: dataKey}, nil
+}
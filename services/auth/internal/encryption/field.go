@@ -0,0 +1,104 @@
+package encryption
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var (
+	// ErrUnboundField is returned when a Field is written or scanned before
+	// Bind gave it a keyring and binding.
+	ErrUnboundField = errors.New("encrypted field is not bound to a keyring")
+	// ErrUnreadableField is returned when a scanned Field does not open, e.g.
+	// because its key is missing or it was copied from another row.
+	ErrUnreadableField = errors.New("encrypted field cannot be opened")
+)
+
+// Field is the value of an encrypted column. It holds the plaintext in
+// memory and is stored sealed: as a pgx query argument it is encrypted with
+// its keyring, and scanning a column into it decrypts the value. A Field is
+// NULL until it has a value.
+//
+// The keyring, the binding of the column and the context of the query come
+// from Bind, which repositories call for every Field they write or scan.
+// pgx encodes and scans without a context, so sealing and opening use the
+// bound one: a cancelled query does not wait on KMS.
+type Field struct {
+	plaintext string
+	valid     bool
+	ctx       context.Context
+	keyring   *Keyring
+	binding   Binding
+}
+
+// NewField returns a Field holding plaintext.
+func NewField(plaintext string) Field {
+	return Field{plaintext: plaintext, valid: true}
+}
+
+// Plaintext returns the value of the field, or "" when it is NULL.
+func (f Field) Plaintext() string {
+	return f.plaintext
+}
+
+// Valid reports whether the field has a value.
+func (f Field) Valid() bool {
+	return f.valid
+}
+
+// Bind returns the field sealed and opened with keyring under ctx, as the
+// value of the field named by binding.
+func (f Field) Bind(ctx context.Context, keyring *Keyring, binding Binding) Field {
+	f.ctx = ctx
+	f.keyring = keyring
+	f.binding = binding
+	return f
+}
+
+// String keeps the plaintext out of logs and error messages.
+func (f Field) String() string {
+	if !f.valid {
+		return "NULL"
+	}
+	return "****"
+}
+
+// GoString keeps the plaintext out of %#v, as used by test failure output.
+func (f Field) GoString() string {
+	return "encryption.Field(" + f.String() + ")"
+}
+
+// TextValue implements pgtype.TextValuer: it seals the plaintext.
+func (f Field) TextValue() (pgtype.Text, error) {
+	if !f.valid {
+		return pgtype.Text{}, nil
+	}
+	if f.keyring == nil || f.ctx == nil {
+		return pgtype.Text{}, ErrUnboundField
+	}
+	sealed, err := f.keyring.Encrypt(f.ctx, f.plaintext, f.binding)
+	if err != nil {
+		return pgtype.Text{}, fmt.Errorf("failed to seal %s: %w", f.binding, err)
+	}
+	return pgtype.Text{String: sealed, Valid: true}, nil
+}
+
+// ScanText implements pgtype.TextScanner: it opens the stored value.
+func (f *Field) ScanText(v pgtype.Text) error {
+	if !v.Valid {
+		f.plaintext, f.valid = "", false
+		return nil
+	}
+	if f.keyring == nil || f.ctx == nil {
+		return ErrUnboundField
+	}
+	plaintext, err := f.keyring.Decrypt(f.ctx, v.String, f.binding)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrUnreadableField, f.binding, err)
+	}
+	f.plaintext, f.valid = plaintext, true
+	return nil
+}
@@ -0,0 +1,76 @@
+package encryption
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestField_SealsAndOpens(t *testing.T) {
+	ring := SingleKey(oldKey.Secret)
+	field := NewField(testMessagePlaintext).Bind(ctx, ring, binding)
+
+	stored, err := field.TextValue()
+	require.NoError(t, err)
+	assert.True(t, stored.Valid)
+	assert.True(t, strings.HasPrefix(stored.String, "v3:k1:"))
+	assert.NotContains(t, stored.String, testMessagePlaintext)
+
+	scanned := Field{}.Bind(ctx, ring, binding)
+	require.NoError(t, scanned.ScanText(stored))
+	assert.True(t, scanned.Valid())
+	assert.Equal(t, testMessagePlaintext, scanned.Plaintext())
+
+	other := Field{}.Bind(ctx, ring, Binding{Table: binding.Table, Column: binding.Column, RowID: binding.RowID + 1})
+	assert.ErrorIs(t, other.ScanText(stored), ErrUnreadableField)
+}
+
+func TestField_UsesTheBoundContext(t *testing.T) {
+	ring, err := NewKeyring(Key{ID: "k1", Provider: NewKMSProvider(NewFakeKMS("alias/auth"), "alias/auth")})
+	require.NoError(t, err)
+	stored, err := NewField(testMessagePlaintext).Bind(ctx, ring, binding).TextValue()
+	require.NoError(t, err)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = NewField(testMessagePlaintext).Bind(cancelled, ring, binding).TextValue()
+	assert.ErrorIs(t, err, context.Canceled, "sealing stops with the query")
+
+	scanned := Field{}.Bind(cancelled, ring, binding)
+	err = scanned.ScanText(stored)
+	assert.ErrorIs(t, err, ErrUnreadableField)
+	assert.ErrorIs(t, err, context.Canceled, "opening stops with the query")
+}
+
+func TestField_Null(t *testing.T) {
+	var field Field
+	stored, err := field.TextValue()
+	require.NoError(t, err, "NULL needs no keyring")
+	assert.False(t, stored.Valid)
+
+	field = NewField(testMessagePlaintext)
+	require.NoError(t, field.ScanText(pgtype.Text{}))
+	assert.False(t, field.Valid())
+	assert.Empty(t, field.Plaintext())
+}
+
+func TestField_Unbound(t *testing.T) {
+	_, err := NewField(testMessagePlaintext).TextValue()
+	assert.ErrorIs(t, err, ErrUnboundField)
+
+	var field Field
+	assert.ErrorIs(t, field.ScanText(pgtype.Text{String: "v3:k1:AAAA", Valid: true}), ErrUnboundField)
+}
+
+func TestField_Redacted(t *testing.T) {
+	field := NewField(testMessagePlaintext)
+	for _, format := range []string{"%v", "%s", "%+v", "%#v"} {
+		assert.NotContains(t, fmt.Sprintf(format, field), testMessagePlaintext, format)
+	}
+	assert.Equal(t, "NULL", Field{}.String())
+}
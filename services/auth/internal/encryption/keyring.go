@@ -0,0 +1,369 @@
+package encryption
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"services/auth/internal/config"
+	"strings"
+)
+
+// Stored values are sealed in one of these envelopes:
+//
+//	v1:<key id>:base64(salt|iv|tag|ciphertext)
+//	v2:<key id>:base64(len(wrapped key)|wrapped key|iv|tag|ciphertext)
+//	v3, v4: as v1 and v2, with the Binding of the value as associated data
+//
+// v1 and v3 derive the key from a secret with PBKDF2; v2 and v4 use a data
+// key issued by a KeyProvider and store it wrapped. Only v3 and v4 are
+// written; the others are still read until cmd/rekey has re-sealed them. The
+// colon never occurs in standard base64, so values in the legacy unversioned
+// format of Encrypt are told apart by its absence.
+const (
+	envelopeV1 = "v1"
+	envelopeV2 = "v2"
+	envelopeV3 = "v3"
+	envelopeV4 = "v4"
+)
+
+// DefaultKeyID names the key of a keyring built from a single secret, and is
+// the default ENCRYPTION_KEY_ID.
+const DefaultKeyID = "k1"
+
+var (
+	// ErrUnknownKey is returned when a value names a key missing from the
+	// keyring, e.g. one removed before all its values were re-encrypted.
+	ErrUnknownKey = errors.New("unknown encryption key")
+	// ErrUnsupportedVersion is returned for envelopes of an unknown version.
+	ErrUnsupportedVersion = errors.New("unsupported ciphertext version")
+	// ErrUnboundValue is returned by keyrings requiring bindings for values
+	// sealed before bindings existed, until cmd/rekey re-seals them.
+	ErrUnboundValue = errors.New("ciphertext is not bound to its field")
+)
+
+// Key is the material behind one key ID of a keyring: a Secret to derive
+// keys from, or a Provider of data keys.
+type Key struct {
+	ID     string
+	Secret string
+	// Provider, when set, takes precedence over Secret: values are sealed
+	// with its data keys in the v2 envelope.
+	Provider KeyProvider
+}
+
+// Keyring seals values with its active key and opens values sealed with any
+// of its keys. Retired keys stay in the ring until cmd/rekey has moved every
+// value to the active one.
+type Keyring struct {
+	active Key
+	keys   []Key
+	byID   map[string]Key
+	// requireBinding refuses to open unbound values outside of Rekey.
+	requireBinding bool
+}
+
+// NewKeyring returns a keyring sealing with active and also opening values
+// sealed with the retired keys.
+func NewKeyring(active Key, retired ...Key) (*Keyring, error) {
+	k := &Keyring{active: active, byID: make(map[string]Key, len(retired)+1)}
+	for _, key := range append([]Key{active}, retired...) {
+		if !validKeyID(key.ID) {
+			return nil, fmt.Errorf("invalid encryption key id %q: use letters, digits, '-' and '_'", key.ID)
+		}
+		if _, ok := k.byID[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate encryption key id %q", key.ID)
+		}
+		k.byID[key.ID] = key
+		k.keys = append(k.keys, key)
+	}
+	return k, nil
+}
+
+// SingleKey returns a keyring holding only secret, under DefaultKeyID.
+func SingleKey(secret string) *Keyring {
+	k, _ := NewKeyring(Key{ID: DefaultKeyID, Secret: secret})
+	return k
+}
+
+// RequiringBinding returns a copy of the keyring that only opens values
+// bound to their field, refusing values sealed before bindings existed with
+// ErrUnboundValue. Rekey still opens them to re-seal them.
+func (k *Keyring) RequiringBinding() *Keyring {
+	strict := *k
+	strict.requireBinding = true
+	return &strict
+}
+
+// KeyringOption configures KeyringFromConfig.
+type KeyringOption func(*keyringOptions)
+
+type keyringOptions struct {
+	kms KMSAPI
+}
+
+// WithKMSClient uses client for the KMS keys of the configuration instead of
+// a client for the configured region and endpoint.
+func WithKMSClient(client KMSAPI) KeyringOption {
+	return func(o *keyringOptions) {
+		o.kms = client
+	}
+}
+
+// KeyringFromConfig builds the keyring configured by the ENCRYPTION_*
+// settings. KMS keys get a CachedProvider, and a KMS client for region is
+// only created when one is configured.
+func KeyringFromConfig(ctx context.Context, cfg config.EncryptionConfig, region string, options ...KeyringOption) (*Keyring, error) {
+	var o keyringOptions
+	for _, option := range options {
+		option(&o)
+	}
+	kmsProvider := func(keyID string) (KeyProvider, error) {
+		if o.kms == nil {
+			client, err := NewKMSClient(ctx, region, cfg.EncryptionKMSEndpoint)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create KMS client: %w", err)
+			}
+			o.kms = client
+		}
+		return NewCachedProvider(NewKMSProvider(o.kms, keyID), CacheOptions{
+			TTL:     cfg.EncryptionDataKeyTTL,
+			MaxUses: cfg.EncryptionDataKeyMaxUses,
+		}), nil
+	}
+
+	active := Key{ID: cfg.EncryptionKeyID}
+	switch cfg.EncryptionKeyProvider {
+	case "", "secret":
+		active.Secret = cfg.EncryptionSecret
+	case "local":
+		provider, err := NewLocalProvider(cfg.EncryptionMasterKey)
+		if err != nil {
+			return nil, err
+		}
+		active.Provider = provider
+	case "kms":
+		provider, err := kmsProvider(cfg.EncryptionKMSKeyID)
+		if err != nil {
+			return nil, err
+		}
+		active.Provider = provider
+	default:
+		return nil, fmt.Errorf("unknown encryption key provider %q", cfg.EncryptionKeyProvider)
+	}
+
+	retired := make([]Key, 0, len(cfg.EncryptionRetiredKeys))
+	for _, spec := range cfg.EncryptionRetiredKeys {
+		key, err := parseKey(spec, kmsProvider)
+		if err != nil {
+			return nil, err
+		}
+		retired = append(retired, key)
+	}
+	keyring, err := NewKeyring(active, retired...)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.EncryptionRequireBinding {
+		keyring = keyring.RequiringBinding()
+	}
+	return keyring, nil
+}
+
+// parseKey parses a retired key written as "id:secret", "id:local:<master
+// key>" or "id:kms:<KMS key id>", as in ENCRYPTION_RETIRED_KEYS.
+func parseKey(spec string, kmsProvider func(keyID string) (KeyProvider, error)) (Key, error) {
+	id, material, ok := strings.Cut(spec, ":")
+	if !ok || material == "" {
+		return Key{}, fmt.Errorf("invalid encryption key %q: want id:secret", redactKeySpec(spec))
+	}
+
+	kind, value, _ := strings.Cut(material, ":")
+	switch {
+	case kind == "local" && value != "":
+		provider, err := NewLocalProvider(value)
+		if err != nil {
+			return Key{}, fmt.Errorf("encryption key %s: %w", id, err)
+		}
+		return Key{ID: id, Provider: provider}, nil
+	case kind == "kms" && value != "":
+		provider, err := kmsProvider(value)
+		if err != nil {
+			return Key{}, err
+		}
+		return Key{ID: id, Provider: provider}, nil
+	default:
+		return Key{ID: id, Secret: material}, nil
+	}
+}
+
+// redactKeySpec keeps the ID of a key spec for error messages.
+func redactKeySpec(spec string) string {
+	id, _, _ := strings.Cut(spec, ":")
+	return id + ":****"
+}
+
+func validKeyID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ActiveKeyID returns the ID of the key new values are sealed with.
+func (k *Keyring) ActiveKeyID() string {
+	return k.active.ID
+}
+
+// Encrypt seals plaintext with the active key, bound to the field it is
+// stored in.
+func (k *Keyring) Encrypt(ctx context.Context, plaintext string, binding Binding) (string, error) {
+	aad := binding.associatedData()
+	if k.active.Provider == nil {
+		sealed, err := sealWithSecret(plaintext, k.active.Secret, aad)
+		if err != nil {
+			return "", err
+		}
+		return envelopeV3 + ":" + k.active.ID + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+	}
+
+	dataKey, wrapped, err := k.active.Provider.GenerateDataKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(wrapped) > 0xFFFF {
+		return "", errors.New("wrapped data key is too long")
+	}
+	sealed, err := sealWithKey(dataKey, []byte(plaintext), aad)
+	if err != nil {
+		return "", err
+	}
+
+	payload := make([]byte, 0, 2+len(wrapped)+len(sealed))
+	payload = binary.BigEndian.AppendUint16(payload, uint16(len(wrapped)))
+	payload = append(payload, wrapped...)
+	payload = append(payload, sealed...)
+	return envelopeV4 + ":" + k.active.ID + ":" + base64.StdEncoding.EncodeToString(payload), nil
+}
+
+// Decrypt opens a value sealed with any key of the ring for binding. Values
+// sealed before bindings existed open for any binding, unless the keyring
+// is RequiringBinding; values in the legacy unversioned format are tried
+// against every secret, the active one first.
+func (k *Keyring) Decrypt(ctx context.Context, ciphertext string, binding Binding) (string, error) {
+	return k.decrypt(ctx, ciphertext, binding, !k.requireBinding)
+}
+
+func (k *Keyring) decrypt(ctx context.Context, ciphertext string, binding Binding, allowUnbound bool) (string, error) {
+	version, keyID, payload, err := parseEnvelope(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	if !allowUnbound && version != envelopeV3 && version != envelopeV4 {
+		return "", ErrUnboundValue
+	}
+
+	if version == "" {
+		lastErr := errors.New("no secret key in the keyring")
+		for _, key := range k.keys {
+			if key.Provider != nil {
+				continue
+			}
+			plaintext, err := openWithSecret(payload, key.Secret, nil)
+			if err == nil {
+				return plaintext, nil
+			}
+			lastErr = err
+		}
+		return "", fmt.Errorf("legacy ciphertext matches no key: %w", lastErr)
+	}
+
+	key, ok := k.byID[keyID]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+
+	var aad []byte
+	if version == envelopeV3 || version == envelopeV4 {
+		aad = binding.associatedData()
+	}
+
+	switch {
+	case (version == envelopeV1 || version == envelopeV3) && key.Provider == nil:
+		return openWithSecret(payload, key.Secret, aad)
+	case (version == envelopeV2 || version == envelopeV4) && key.Provider != nil:
+		if len(payload) < 2 || len(payload) < 2+int(binary.BigEndian.Uint16(payload)) {
+			return "", errors.New("invalid encrypted data length")
+		}
+		end := 2 + int(binary.BigEndian.Uint16(payload))
+		dataKey, err := key.Provider.DecryptDataKey(ctx, payload[2:end])
+		if err != nil {
+			return "", err
+		}
+		plaintext, err := openWithKey(dataKey, payload[end:], aad)
+		if err != nil {
+			return "", err
+		}
+		return string(plaintext), nil
+	default:
+		return "", fmt.Errorf("%s envelope does not match the kind of key %q", version, keyID)
+	}
+}
+
+// NeedsRekey reports whether ciphertext is not sealed with the active key in
+// a bound envelope.
+func (k *Keyring) NeedsRekey(ciphertext string) bool {
+	version, keyID, _, err := parseEnvelope(ciphertext)
+	if err != nil || keyID != k.active.ID {
+		return true
+	}
+	return version != envelopeV3 && version != envelopeV4
+}
+
+// Rekey re-seals ciphertext with the active key for binding when NeedsRekey,
+// reporting whether it did. Unbound values are opened without the binding
+// and re-sealed with it, even by a keyring RequiringBinding.
+func (k *Keyring) Rekey(ctx context.Context, ciphertext string, binding Binding) (string, bool, error) {
+	if !k.NeedsRekey(ciphertext) {
+		return ciphertext, false, nil
+	}
+	plaintext, err := k.decrypt(ctx, ciphertext, binding, true)
+	if err != nil {
+		return "", false, err
+	}
+	sealed, err := k.Encrypt(ctx, plaintext, binding)
+	if err != nil {
+		return "", false, err
+	}
+	return sealed, true, nil
+}
+
+// parseEnvelope splits a stored value into its version, key ID and decoded
+// payload. The version is empty for values in the legacy format.
+func parseEnvelope(ciphertext string) (version, keyID string, payload []byte, err error) {
+	version, rest, versioned := strings.Cut(ciphertext, ":")
+	if !versioned {
+		payload, err = base64.StdEncoding.DecodeString(ciphertext)
+		return "", "", payload, err
+	}
+	switch version {
+	case envelopeV1, envelopeV2, envelopeV3, envelopeV4:
+	default:
+		return "", "", nil, fmt.Errorf("%w %q", ErrUnsupportedVersion, version)
+	}
+
+	keyID, encoded, ok := strings.Cut(rest, ":")
+	if !ok || keyID == "" {
+		return "", "", nil, errors.New("malformed ciphertext envelope")
+	}
+	payload, err = base64.StdEncoding.DecodeString(encoded)
+	return version, keyID, payload, err
+}
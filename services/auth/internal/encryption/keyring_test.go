@@ -0,0 +1,357 @@
+package encryption
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+
+	"services/auth/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	ctx     = context.Background()
+	oldKey  = Key{ID: "k1", Secret: "old-secret-key-123456789012345678"}
+	binding = Binding{Table: "users", Column: "temporary_password", RowID: 42}
+	newKey  = Key{ID: "k2", Secret: "new-secret-key-123456789012345678"}
+)
+
+func TestKeyring_EncryptDecrypt(t *testing.T) {
+	ring, err := NewKeyring(newKey, oldKey)
+	require.NoError(t, err)
+
+	sealed, err := ring.Encrypt(ctx, testMessagePlaintext, binding)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(sealed, "v3:k2:"), "the envelope names the version and the active key")
+
+	plaintext, err := ring.Decrypt(ctx, sealed, binding)
+	require.NoError(t, err)
+	assert.Equal(t, testMessagePlaintext, plaintext)
+}
+
+func TestKeyring_DecryptsRetiredKeys(t *testing.T) {
+	before, err := NewKeyring(oldKey)
+	require.NoError(t, err)
+	sealed, err := before.Encrypt(ctx, testMessagePlaintext, binding)
+	require.NoError(t, err)
+
+	after, err := NewKeyring(newKey, oldKey)
+	require.NoError(t, err)
+	plaintext, err := after.Decrypt(ctx, sealed, binding)
+	require.NoError(t, err)
+	assert.Equal(t, testMessagePlaintext, plaintext)
+
+	withoutOld, err := NewKeyring(newKey)
+	require.NoError(t, err)
+	_, err = withoutOld.Decrypt(ctx, sealed, binding)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestKeyring_DecryptsLegacyValues(t *testing.T) {
+	legacy, err := Encrypt(testMessagePlaintext, oldKey.Secret)
+	require.NoError(t, err)
+
+	ring, err := NewKeyring(newKey, oldKey)
+	require.NoError(t, err)
+	plaintext, err := ring.Decrypt(ctx, legacy, binding)
+	require.NoError(t, err)
+	assert.Equal(t, testMessagePlaintext, plaintext)
+
+	withoutOld, err := NewKeyring(newKey)
+	require.NoError(t, err)
+	_, err = withoutOld.Decrypt(ctx, legacy, binding)
+	assert.Error(t, err)
+}
+
+func TestKeyring_Rekey(t *testing.T) {
+	ring, err := NewKeyring(newKey, oldKey)
+	require.NoError(t, err)
+	oldRing, err := NewKeyring(oldKey)
+	require.NoError(t, err)
+
+	legacy, err := Encrypt(testMessagePlaintext, oldKey.Secret)
+	require.NoError(t, err)
+	underOld, err := oldRing.Encrypt(ctx, testMessagePlaintext, binding)
+	require.NoError(t, err)
+	current, err := ring.Encrypt(ctx, testMessagePlaintext, binding)
+	require.NoError(t, err)
+
+	for _, sealed := range []string{legacy, underOld} {
+		assert.True(t, ring.NeedsRekey(sealed))
+
+		rekeyed, changed, err := ring.Rekey(ctx, sealed, binding)
+		require.NoError(t, err)
+		assert.True(t, changed)
+		assert.True(t, strings.HasPrefix(rekeyed, "v3:k2:"))
+		assert.False(t, ring.NeedsRekey(rekeyed))
+
+		plaintext, err := ring.Decrypt(ctx, rekeyed, binding)
+		require.NoError(t, err)
+		assert.Equal(t, testMessagePlaintext, plaintext)
+	}
+
+	rekeyed, changed, err := ring.Rekey(ctx, current, binding)
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, current, rekeyed)
+}
+
+func TestKeyring_DecryptInvalidEnvelope(t *testing.T) {
+	ring := SingleKey("test-secret-key-1234567890123456")
+
+	_, err := ring.Decrypt(ctx, "v9:k1:AAAA", binding)
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+
+	for _, value := range []string{"", "v1:", "v1:k1", "v1::AAAA", "v1:k1:not base64!", "v1:k1:dGVzdA=="} {
+		_, err := ring.Decrypt(ctx, value, binding)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestNewKeyring_Validation(t *testing.T) {
+	_, err := NewKeyring(Key{ID: "", Secret: "s"})
+	assert.Error(t, err)
+
+	_, err = NewKeyring(Key{ID: "has:colon", Secret: "s"})
+	assert.Error(t, err)
+
+	_, err = NewKeyring(oldKey, Key{ID: oldKey.ID, Secret: "other"})
+	assert.ErrorContains(t, err, "duplicate")
+}
+
+func TestKeyring_DataKeys(t *testing.T) {
+	kms := NewFakeKMS("alias/auth")
+	provider := NewCachedProvider(NewKMSProvider(kms, "alias/auth"), CacheOptions{})
+	ring, err := NewKeyring(Key{ID: "kms1", Provider: provider}, oldKey)
+	require.NoError(t, err)
+
+	sealed, err := ring.Encrypt(ctx, testMessagePlaintext, binding)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(sealed, "v4:kms1:"))
+
+	plaintext, err := ring.Decrypt(ctx, sealed, binding)
+	require.NoError(t, err)
+	assert.Equal(t, testMessagePlaintext, plaintext)
+
+	// A fresh process opens the value through KMS
+	restarted, err := NewKeyring(Key{ID: "kms1", Provider: NewKMSProvider(kms, "alias/auth")})
+	require.NoError(t, err)
+	plaintext, err = restarted.Decrypt(ctx, sealed, binding)
+	require.NoError(t, err)
+	assert.Equal(t, testMessagePlaintext, plaintext)
+
+	// Values sealed with the retired secret are moved to the data key
+	underOld, err := SingleKey(oldKey.Secret).Encrypt(ctx, testMessagePlaintext, binding)
+	require.NoError(t, err)
+	rekeyed, changed, err := ring.Rekey(ctx, underOld, binding)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.True(t, strings.HasPrefix(rekeyed, "v4:kms1:"))
+}
+
+func TestKeyring_EnvelopeMustMatchKey(t *testing.T) {
+	provider, err := NewLocalProvider(testMasterKey)
+	require.NoError(t, err)
+	underSecret, err := NewKeyring(Key{ID: "k1", Secret: oldKey.Secret})
+	require.NoError(t, err)
+	underProvider, err := NewKeyring(Key{ID: "k1", Provider: provider})
+	require.NoError(t, err)
+
+	sealed, err := underSecret.Encrypt(ctx, testMessagePlaintext, binding)
+	require.NoError(t, err)
+	_, err = underProvider.Decrypt(ctx, sealed, binding)
+	assert.ErrorContains(t, err, "does not match")
+
+	sealed, err = underProvider.Encrypt(ctx, testMessagePlaintext, binding)
+	require.NoError(t, err)
+	_, err = underSecret.Decrypt(ctx, sealed, binding)
+	assert.ErrorContains(t, err, "does not match")
+
+	_, err = underProvider.Decrypt(ctx, "v4:k1:AA==", binding)
+	assert.Error(t, err)
+}
+
+func TestParseKey(t *testing.T) {
+	noKMS := func(string) (KeyProvider, error) { return nil, errors.New("no KMS") }
+
+	key, err := parseKey("k1:first", noKMS)
+	require.NoError(t, err)
+	assert.Equal(t, Key{ID: "k1", Secret: "first"}, key)
+
+	key, err = parseKey("k0:with:colon", noKMS)
+	require.NoError(t, err)
+	assert.Equal(t, Key{ID: "k0", Secret: "with:colon"}, key)
+
+	key, err = parseKey("k2:local:"+testMasterKey, noKMS)
+	require.NoError(t, err)
+	assert.IsType(t, &LocalProvider{}, key.Provider)
+
+	_, err = parseKey("k3:kms:alias/auth", noKMS)
+	assert.ErrorContains(t, err, "no KMS")
+
+	_, err = parseKey("k1", noKMS)
+	assert.Error(t, err)
+
+	_, err = parseKey("k1:", noKMS)
+	assert.Error(t, err)
+
+	_, err = parseKey("k2:local:c2hvcnQ=", noKMS)
+	assert.ErrorContains(t, err, "want 32 bytes")
+	assert.NotContains(t, err.Error(), "c2hvcnQ=")
+}
+
+func TestKeyringFromConfig(t *testing.T) {
+	kms := NewFakeKMS("alias/auth")
+
+	ring, err := KeyringFromConfig(ctx, config.EncryptionConfig{
+		EncryptionKeyProvider: "kms",
+		EncryptionKMSKeyID:    "alias/auth",
+		EncryptionKeyID:       "k2",
+		EncryptionRetiredKeys: []string{"k1:" + oldKey.Secret},
+	}, "us-east-2", WithKMSClient(kms))
+	require.NoError(t, err)
+	assert.Equal(t, "k2", ring.ActiveKeyID())
+
+	sealed, err := ring.Encrypt(ctx, testMessagePlaintext, binding)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(sealed, "v4:k2:"))
+
+	legacy, err := SingleKey(oldKey.Secret).Encrypt(ctx, testMessagePlaintext, binding)
+	require.NoError(t, err)
+	plaintext, err := ring.Decrypt(ctx, legacy, binding)
+	require.NoError(t, err)
+	assert.Equal(t, testMessagePlaintext, plaintext)
+
+	ring, err = KeyringFromConfig(ctx, config.EncryptionConfig{
+		EncryptionKeyProvider: "local",
+		EncryptionMasterKey:   testMasterKey,
+		EncryptionKeyID:       "local1",
+	}, "")
+	require.NoError(t, err)
+	sealed, err = ring.Encrypt(ctx, testMessagePlaintext, binding)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(sealed, "v4:local1:"))
+
+	_, err = KeyringFromConfig(ctx, config.EncryptionConfig{
+		EncryptionSecret:      oldKey.Secret,
+		EncryptionKeyID:       "k1",
+		EncryptionRetiredKeys: []string{"k1:" + newKey.Secret},
+	}, "")
+	assert.ErrorContains(t, err, "duplicate")
+}
+
+func TestKeyring_BindsValuesToTheirField(t *testing.T) {
+	provider, err := NewLocalProvider(testMasterKey)
+	require.NoError(t, err)
+	rings := map[string]*Keyring{"secret": SingleKey(oldKey.Secret)}
+	rings["data key"], err = NewKeyring(Key{ID: "k1", Provider: provider})
+	require.NoError(t, err)
+
+	for name, ring := range rings {
+		t.Run(name, func(t *testing.T) {
+			sealed, err := ring.Encrypt(ctx, testMessagePlaintext, binding)
+			require.NoError(t, err)
+
+			others := []Binding{
+				{Table: binding.Table, Column: binding.Column, RowID: binding.RowID + 1},
+				{Table: binding.Table, Column: "email", RowID: binding.RowID},
+				{Table: "accounts", Column: binding.Column, RowID: binding.RowID},
+				{Table: "userstemporary_", Column: "password", RowID: binding.RowID},
+			}
+			for _, other := range others {
+				_, err := ring.Decrypt(ctx, sealed, other)
+				assert.Error(t, err, other.String())
+			}
+
+			plaintext, err := ring.Decrypt(ctx, sealed, binding)
+			require.NoError(t, err)
+			assert.Equal(t, testMessagePlaintext, plaintext)
+		})
+	}
+}
+
+// unboundValues returns testMessagePlaintext sealed in each format written
+// before bindings existed, for a keyring of newKey, oldKey and a data key
+// provider k0.
+func unboundValues(t *testing.T, provider KeyProvider) []string {
+	t.Helper()
+	sealedV1, err := sealWithSecret(testMessagePlaintext, newKey.Secret, nil)
+	require.NoError(t, err)
+	dataKey, wrapped, err := provider.GenerateDataKey(ctx)
+	require.NoError(t, err)
+	sealedV2, err := sealWithKey(dataKey, []byte(testMessagePlaintext), nil)
+	require.NoError(t, err)
+	payloadV2 := append(binary.BigEndian.AppendUint16(nil, uint16(len(wrapped))), wrapped...)
+	legacy, err := Encrypt(testMessagePlaintext, oldKey.Secret)
+	require.NoError(t, err)
+
+	return []string{
+		"v1:k2:" + base64.StdEncoding.EncodeToString(sealedV1),
+		"v2:k0:" + base64.StdEncoding.EncodeToString(append(payloadV2, sealedV2...)),
+		legacy,
+	}
+}
+
+func TestKeyring_RekeyBindsUnboundValues(t *testing.T) {
+	provider, err := NewLocalProvider(testMasterKey)
+	require.NoError(t, err)
+	ring, err := NewKeyring(newKey, oldKey, Key{ID: "k0", Provider: provider})
+	require.NoError(t, err)
+
+	for _, sealed := range unboundValues(t, provider) {
+		plaintext, err := ring.Decrypt(ctx, sealed, Binding{})
+		require.NoError(t, err, "unbound values open for any binding")
+		assert.Equal(t, testMessagePlaintext, plaintext)
+		assert.True(t, ring.NeedsRekey(sealed), sealed)
+
+		rekeyed, changed, err := ring.Rekey(ctx, sealed, binding)
+		require.NoError(t, err)
+		assert.True(t, changed)
+		assert.True(t, strings.HasPrefix(rekeyed, "v3:k2:"))
+		assert.False(t, ring.NeedsRekey(rekeyed))
+
+		_, err = ring.Decrypt(ctx, rekeyed, Binding{})
+		assert.Error(t, err, "rekeyed values are bound")
+		plaintext, err = ring.Decrypt(ctx, rekeyed, binding)
+		require.NoError(t, err)
+		assert.Equal(t, testMessagePlaintext, plaintext)
+	}
+}
+
+func TestKeyring_RequiringBinding(t *testing.T) {
+	provider, err := NewLocalProvider(testMasterKey)
+	require.NoError(t, err)
+	lenient, err := NewKeyring(newKey, oldKey, Key{ID: "k0", Provider: provider})
+	require.NoError(t, err)
+	ring := lenient.RequiringBinding()
+
+	for _, sealed := range unboundValues(t, provider) {
+		_, err := ring.Decrypt(ctx, sealed, binding)
+		assert.ErrorIs(t, err, ErrUnboundValue, sealed)
+		_, err = lenient.Decrypt(ctx, sealed, binding)
+		assert.NoError(t, err, "the original keyring is unchanged")
+
+		rekeyed, changed, err := ring.Rekey(ctx, sealed, binding)
+		require.NoError(t, err, "rekey still opens unbound values")
+		assert.True(t, changed)
+		plaintext, err := ring.Decrypt(ctx, rekeyed, binding)
+		require.NoError(t, err)
+		assert.Equal(t, testMessagePlaintext, plaintext)
+	}
+
+	ring, err = KeyringFromConfig(ctx, config.EncryptionConfig{
+		EncryptionSecret:         oldKey.Secret,
+		EncryptionKeyID:          "k1",
+		EncryptionRequireBinding: true,
+	}, "")
+	require.NoError(t, err)
+	legacy, err := Encrypt(testMessagePlaintext, oldKey.Secret)
+	require.NoError(t, err)
+	_, err = ring.Decrypt(ctx, legacy, binding)
+	assert.ErrorIs(t, err, ErrUnboundValue)
+}
@@ -0,0 +1,77 @@
+package encryption
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// KMSAPI is the subset of the KMS client used by KMSProvider. FakeKMS
+// implements it for tests.
+type KMSAPI interface {
+	GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error)
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+// KMSProvider issues data keys under a KMS key. Wrap it in a CachedProvider:
+// every call is a KMS request.
+type KMSProvider struct {
+	client KMSAPI
+	keyID  string
+}
+
+// NewKMSProvider returns a provider generating data keys under keyID, a KMS
+// key ID, ARN or alias.
+func NewKMSProvider(client KMSAPI, keyID string) *KMSProvider {
+	return &KMSProvider{client: client, keyID: keyID}
+}
+
+// NewKMSClient returns a KMS client for region, sending requests to endpoint
+// when it is not empty (e.g. a local-kms container).
+func NewKMSClient(ctx context.Context, region, endpoint string) (*kms.Client, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if region != "" {
+		opts = append(opts, awsconfig.WithRegion(region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	var clientOpts []func(*kms.Options)
+	if endpoint != "" {
+		log.Printf("Configuring KMS client with custom endpoint: %s", endpoint)
+		clientOpts = append(clientOpts, func(o *kms.Options) {
+			o.BaseEndpoint = aws.String(endpoint)
+		})
+	}
+	return kms.NewFromConfig(awsCfg, clientOpts...), nil
+}
+
+func (p *KMSProvider) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	output, err := p.client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:   aws.String(p.keyID),
+		KeySpec: types.DataKeySpecAes256,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	return output.Plaintext, output.CiphertextBlob, nil
+}
+
+func (p *KMSProvider) DecryptDataKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	// Naming the key makes KMS refuse blobs wrapped by any other key
+	output, err := p.client.Decrypt(ctx, &kms.DecryptInput{
+		CiphertextBlob: wrapped,
+		KeyId:          aws.String(p.keyID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+	return output.Plaintext, nil
+}
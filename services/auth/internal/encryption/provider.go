@@ -0,0 +1,168 @@
+package encryption
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// KeyProvider issues the data keys that seal values in the v2 envelope. Each
+// value stores its data key wrapped, and only the provider can unwrap it, so
+// the secret material never leaves the provider (or KMS).
+type KeyProvider interface {
+	// GenerateDataKey returns a new 256-bit data key and its wrapped form.
+	GenerateDataKey(ctx context.Context) (plaintext, wrapped []byte, err error)
+	// DecryptDataKey unwraps a data key returned by GenerateDataKey.
+	DecryptDataKey(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// LocalProvider wraps data keys with a master key held in memory. It stands in
+// for KMS where none is available, e.g. in local development.
+type LocalProvider struct {
+	masterKey []byte
+}
+
+// NewLocalProvider returns a provider wrapping data keys with masterKey, a
+// base64-encoded 256-bit key such as the output of `openssl rand -base64 32`.
+func NewLocalProvider(masterKey string) (*LocalProvider, error) {
+	key, err := base64.StdEncoding.DecodeString(masterKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid master key: %w", err)
+	}
+	if len(key) != keyLength {
+		return nil, fmt.Errorf("invalid master key: want %d bytes, got %d", keyLength, len(key))
+	}
+	return &LocalProvider{masterKey: key}, nil
+}
+
+func (p *LocalProvider) GenerateDataKey(_ context.Context) ([]byte, []byte, error) {
+	dataKey := make([]byte, keyLength)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+	wrapped, err := sealWithKey(p.masterKey, dataKey, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dataKey, wrapped, nil
+}
+
+func (p *LocalProvider) DecryptDataKey(_ context.Context, wrapped []byte) ([]byte, error) {
+	dataKey, err := openWithKey(p.masterKey, wrapped, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+// CacheOptions bound how long a CachedProvider reuses data keys.
+type CacheOptions struct {
+	// TTL bounds how long a generated data key seals new values, and how
+	// long an unwrapped one is remembered. Defaults to 5m.
+	TTL time.Duration
+	// MaxUses bounds the values sealed with one generated data key.
+	// Defaults to 1000.
+	MaxUses int
+	// MaxEntries bounds the unwrapped data keys remembered. Defaults to 1000.
+	MaxEntries int
+}
+
+func (o CacheOptions) withDefaults() CacheOptions {
+	if o.TTL <= 0 {
+		o.TTL = 5 * time.Minute
+	}
+	if o.MaxUses <= 0 {
+		o.MaxUses = 1000
+	}
+	if o.MaxEntries <= 0 {
+		o.MaxEntries = 1000
+	}
+	return o
+}
+
+// CachedProvider reuses the data keys of a provider, so sealing and opening
+// values does not call KMS every time. A generated key seals values until it
+// expires or reaches MaxUses; unwrapped keys are remembered until they expire.
+type CachedProvider struct {
+	provider KeyProvider
+	opts     CacheOptions
+	now      func() time.Time
+
+	mu        sync.Mutex
+	current   *cachedDataKey
+	unwrapped map[string]cachedDataKey
+}
+
+type cachedDataKey struct {
+	plaintext []byte
+	wrapped   []byte
+	expiresAt time.Time
+	uses      int
+}
+
+// NewCachedProvider caches the data keys of provider.
+func NewCachedProvider(provider KeyProvider, opts CacheOptions) *CachedProvider {
+	return &CachedProvider{
+		provider:  provider,
+		opts:      opts.withDefaults(),
+		now:       time.Now,
+		unwrapped: make(map[string]cachedDataKey),
+	}
+}
+
+func (p *CachedProvider) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	if p.current == nil || !now.Before(p.current.expiresAt) || p.current.uses >= p.opts.MaxUses {
+		plaintext, wrapped, err := p.provider.GenerateDataKey(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		p.current = &cachedDataKey{plaintext: plaintext, wrapped: wrapped, expiresAt: now.Add(p.opts.TTL)}
+		p.remember(string(wrapped), *p.current)
+	}
+	p.current.uses++
+	return p.current.plaintext, p.current.wrapped, nil
+}
+
+func (p *CachedProvider) DecryptDataKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	p.mu.Lock()
+	cached, ok := p.unwrapped[string(wrapped)]
+	p.mu.Unlock()
+	if ok && p.now().Before(cached.expiresAt) {
+		return cached.plaintext, nil
+	}
+
+	// Unwrap outside the lock: KMS calls must not serialize each other
+	plaintext, err := p.provider.DecryptDataKey(ctx, wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.remember(string(wrapped), cachedDataKey{plaintext: plaintext, expiresAt: p.now().Add(p.opts.TTL)})
+	p.mu.Unlock()
+	return plaintext, nil
+}
+
+// remember stores an unwrapped key, dropping expired ones when the cache is
+// full and everything when that is not enough. Callers hold p.mu.
+func (p *CachedProvider) remember(wrapped string, key cachedDataKey) {
+	if len(p.unwrapped) >= p.opts.MaxEntries {
+		now := p.now()
+		for k, v := range p.unwrapped {
+			if !now.Before(v.expiresAt) {
+				delete(p.unwrapped, k)
+			}
+		}
+		if len(p.unwrapped) >= p.opts.MaxEntries {
+			clear(p.unwrapped)
+		}
+	}
+	p.unwrapped[wrapped] = key
+}
@@ -0,0 +1,203 @@
+package encryption
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testMasterKey is a base64 256-bit key for LocalProvider.
+const testMasterKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+
+func TestNewLocalProvider(t *testing.T) {
+	_, err := NewLocalProvider(testMasterKey)
+	require.NoError(t, err)
+
+	_, err = NewLocalProvider("not base64!")
+	assert.Error(t, err)
+
+	_, err = NewLocalProvider("c2hvcnQ=")
+	assert.ErrorContains(t, err, "want 32 bytes, got 5")
+}
+
+func TestLocalProvider_DataKeys(t *testing.T) {
+	ctx := context.Background()
+	provider, err := NewLocalProvider(testMasterKey)
+	require.NoError(t, err)
+
+	dataKey, wrapped, err := provider.GenerateDataKey(ctx)
+	require.NoError(t, err)
+	assert.Len(t, dataKey, keyLength)
+	assert.NotContains(t, string(wrapped), string(dataKey))
+
+	unwrapped, err := provider.DecryptDataKey(ctx, wrapped)
+	require.NoError(t, err)
+	assert.Equal(t, dataKey, unwrapped)
+
+	other, err := NewLocalProvider("ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA=")
+	require.NoError(t, err)
+	_, err = other.DecryptDataKey(ctx, wrapped)
+	assert.Error(t, err)
+}
+
+func TestKMSProvider(t *testing.T) {
+	ctx := context.Background()
+	kms := NewFakeKMS("alias/auth", "alias/other")
+	provider := NewKMSProvider(kms, "alias/auth")
+
+	dataKey, wrapped, err := provider.GenerateDataKey(ctx)
+	require.NoError(t, err)
+	assert.Len(t, dataKey, keyLength)
+
+	unwrapped, err := provider.DecryptDataKey(ctx, wrapped)
+	require.NoError(t, err)
+	assert.Equal(t, dataKey, unwrapped)
+
+	var incorrectKey *types.IncorrectKeyException
+	_, err = NewKMSProvider(kms, "alias/other").DecryptDataKey(ctx, wrapped)
+	assert.ErrorAs(t, err, &incorrectKey)
+
+	var notFound *types.NotFoundException
+	_, _, err = NewKMSProvider(kms, "alias/missing").GenerateDataKey(ctx)
+	assert.ErrorAs(t, err, &notFound)
+
+	var invalid *types.InvalidCiphertextException
+	_, err = provider.DecryptDataKey(ctx, append(wrapped[:len(wrapped)-1:len(wrapped)-1], 0))
+	assert.ErrorAs(t, err, &invalid)
+}
+
+// countingProvider counts the calls reaching the provider it wraps.
+type countingProvider struct {
+	KeyProvider
+	generated, decrypted int
+	err                  error
+}
+
+func (p *countingProvider) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	p.generated++
+	if p.err != nil {
+		return nil, nil, p.err
+	}
+	return p.KeyProvider.GenerateDataKey(ctx)
+}
+
+func (p *countingProvider) DecryptDataKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	p.decrypted++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.KeyProvider.DecryptDataKey(ctx, wrapped)
+}
+
+func newCountingProvider(t *testing.T) *countingProvider {
+	t.Helper()
+	local, err := NewLocalProvider(testMasterKey)
+	require.NoError(t, err)
+	return &countingProvider{KeyProvider: local}
+}
+
+func TestCachedProvider_ReusesDataKey(t *testing.T) {
+	ctx := context.Background()
+	inner := newCountingProvider(t)
+	cache := NewCachedProvider(inner, CacheOptions{TTL: time.Minute, MaxUses: 3})
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	first, wrapped, err := cache.GenerateDataKey(ctx)
+	require.NoError(t, err)
+	for range 2 {
+		key, again, err := cache.GenerateDataKey(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, first, key)
+		assert.Equal(t, wrapped, again)
+	}
+	assert.Equal(t, 1, inner.generated)
+
+	// MaxUses reached
+	key, _, err := cache.GenerateDataKey(ctx)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, key)
+	assert.Equal(t, 2, inner.generated)
+
+	// Keys the cache generated open without a call
+	unwrapped, err := cache.DecryptDataKey(ctx, wrapped)
+	require.NoError(t, err)
+	assert.Equal(t, first, unwrapped)
+	assert.Zero(t, inner.decrypted)
+
+	// TTL reached
+	now = now.Add(time.Minute)
+	_, _, err = cache.GenerateDataKey(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, inner.generated)
+}
+
+func TestCachedProvider_RemembersUnwrappedKeys(t *testing.T) {
+	ctx := context.Background()
+	inner := newCountingProvider(t)
+	dataKey, wrapped, err := inner.GenerateDataKey(ctx)
+	require.NoError(t, err)
+
+	cache := NewCachedProvider(inner, CacheOptions{TTL: time.Minute, MaxEntries: 1})
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	for range 3 {
+		unwrapped, err := cache.DecryptDataKey(ctx, wrapped)
+		require.NoError(t, err)
+		assert.Equal(t, dataKey, unwrapped)
+	}
+	assert.Equal(t, 1, inner.decrypted)
+
+	now = now.Add(time.Minute)
+	_, err = cache.DecryptDataKey(ctx, wrapped)
+	require.NoError(t, err)
+	assert.Equal(t, 2, inner.decrypted, "expired keys are unwrapped again")
+
+	// A full cache makes room
+	_, other, err := inner.GenerateDataKey(ctx)
+	require.NoError(t, err)
+	_, err = cache.DecryptDataKey(ctx, other)
+	require.NoError(t, err)
+	assert.Len(t, cache.unwrapped, 1)
+}
+
+func TestCachedProvider_DoesNotCacheErrors(t *testing.T) {
+	ctx := context.Background()
+	inner := newCountingProvider(t)
+	inner.err = errors.New("kms unavailable")
+	cache := NewCachedProvider(inner, CacheOptions{})
+
+	_, _, err := cache.GenerateDataKey(ctx)
+	require.Error(t, err)
+	_, _, err = cache.GenerateDataKey(ctx)
+	require.Error(t, err)
+	assert.Equal(t, 2, inner.generated)
+
+	_, err = cache.DecryptDataKey(ctx, []byte("wrapped"))
+	require.Error(t, err)
+	assert.Empty(t, cache.unwrapped)
+}
+
+func TestKeyring_CachedKMSCalls(t *testing.T) {
+	ctx := context.Background()
+	kms := NewFakeKMS("alias/auth")
+	ring, err := NewKeyring(Key{ID: "kms1", Provider: NewCachedProvider(NewKMSProvider(kms, "alias/auth"), CacheOptions{})})
+	require.NoError(t, err)
+
+	for range 10 {
+		sealed, err := ring.Encrypt(ctx, testMessagePlaintext, binding)
+		require.NoError(t, err)
+		_, err = ring.Decrypt(ctx, sealed, binding)
+		require.NoError(t, err)
+	}
+
+	generate, decrypt := kms.Requests()
+	assert.Equal(t, 1, generate)
+	assert.Zero(t, decrypt)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"services/auth/internal/audit"
+	"services/auth/internal/models"
+	"services/auth/internal/services"
+	"services/auth/internal/testhelpers"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// ActivityServiceInterface lists account activity (aliased for convenience).
+type ActivityServiceInterface = testhelpers.ActivityServiceInterface
+
+const (
+	defaultActivityLimit = 20
+	maxActivityLimit     = 100
+)
+
+// ActivityHandler serves the audit events of the signed-in user. It must
+// run behind Authenticated.
+type ActivityHandler struct {
+	activityService ActivityServiceInterface
+}
+
+func NewActivityHandler(activityService ActivityServiceInterface) *ActivityHandler {
+	return &ActivityHandler{activityService: activityService}
+}
+
+func (h *ActivityHandler) Handle(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	query, err := url.ParseQuery(req.RawQueryString)
+	if err != nil {
+		return errorResponse(400, "invalid_request", "Invalid query string"), nil
+	}
+
+	limit := defaultActivityLimit
+	if raw := query.Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxActivityLimit {
+			return validationFailed(models.FieldError{
+				Field:   "limit",
+				Code:    "invalid_value",
+				Message: "must be an integer from 1 to 100",
+				Params:  map[string]any{"min": 1, "max": maxActivityLimit},
+			}), nil
+		}
+	}
+
+	page, next, err := h.activityService.Activity(ctx, subjectFrom(ctx), query.Get("cursor"), limit)
+	switch {
+	case errors.Is(err, audit.ErrInvalidCursor):
+		return validationFailed(models.FieldError{Field: "cursor", Code: "invalid", Message: "must be a next_cursor returned by this endpoint"}), nil
+	case errors.Is(err, services.ErrUserNotFound):
+		return errorResponse(404, "user_not_found", "User not found"), nil
+	case err != nil:
+		log.Printf("❌ Activity service error: %v", err)
+		return errorResponse(500, "internal_error", "Internal server error"), nil
+	}
+
+	if page == nil {
+		page = []audit.Event{}
+	}
+	return jsonResponse(200, models.ActivityResponse{Events: page, NextCursor: next}), nil
+}
+
+func validationFailed(fields ...models.FieldError) events.APIGatewayV2HTTPResponse {
+	return jsonResponse(400, models.ErrorResponse{
+		Code:    "validation_failed",
+		Message: "Request validation failed",
+		Fields:  fields,
+	})
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"services/auth/internal/audit"
+	"services/auth/internal/models"
+	"services/auth/internal/services"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockActivityService is a mock implementation of ActivityServiceInterface.
+type MockActivityService struct {
+	mock.Mock
+}
+
+func (m *MockActivityService) Activity(ctx context.Context, cognitoID, cursor string, limit int) ([]audit.Event, string, error) {
+	args := m.Called(ctx, cognitoID, cursor, limit)
+	if args.Get(0) == nil {
+		return nil, args.String(1), args.Error(2)
+	}
+	return args.Get(0).([]audit.Event), args.String(1), args.Error(2)
+}
+
+// authorizedBy returns the authorizer context API Gateway passes on for a
+// verified access token of subject.
+func authorizedBy(subject string) *events.APIGatewayV2HTTPRequestContextAuthorizerDescription {
+	return &events.APIGatewayV2HTTPRequestContextAuthorizerDescription{
+		JWT: &events.APIGatewayV2HTTPRequestContextAuthorizerJWTDescription{
+			Claims: map[string]string{"sub": subject},
+		},
+	}
+}
+
+func activityRequest(query, subject string) events.APIGatewayV2HTTPRequest {
+	req := newRequest("GET", "/auth/me/activity", "")
+	req.RawQueryString = query
+	if subject != "" {
+		req.RequestContext.Authorizer = authorizedBy(subject)
+	}
+	return req
+}
+
+func serveActivity(t *testing.T, service *MockActivityService, req events.APIGatewayV2HTTPRequest) events.APIGatewayV2HTTPResponse {
+	t.Helper()
+	router := NewRouter()
+	router.Handle("GET", "/auth/me/activity", NewActivityHandler(service).Handle, Authenticated())
+	resp, err := router.Dispatch(context.Background(), req)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestActivityHandler_Handle_Success(t *testing.T) {
+	service := new(MockActivityService)
+	service.On("Activity", mock.Anything, "sub-1", "MTA", 5).Return([]audit.Event{
+		{ID: 9, Type: audit.TypeSignup, Outcome: audit.OutcomeSuccess, Actor: audit.ActorAnonymous},
+	}, "OQ", nil)
+
+	resp := serveActivity(t, service, activityRequest("limit=5&cursor=MTA", "sub-1"))
+
+	assert.Equal(t, 200, resp.StatusCode)
+	var body models.ActivityResponse
+	require.NoError(t, json.Unmarshal([]byte(resp.Body), &body))
+	assert.Equal(t, "OQ", body.NextCursor)
+	require.Len(t, body.Events, 1)
+	assert.Equal(t, int64(9), body.Events[0].ID)
+	assert.NotContains(t, resp.Body, "user_id")
+	service.AssertExpectations(t)
+}
+
+func TestActivityHandler_Handle_EmptyPage(t *testing.T) {
+	service := new(MockActivityService)
+	service.On("Activity", mock.Anything, "sub-1", "", defaultActivityLimit).Return(nil, "", nil)
+
+	resp := serveActivity(t, service, activityRequest("", "sub-1"))
+
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.JSONEq(t, `{"events":[]}`, resp.Body)
+}
+
+func TestActivityHandler_Handle_Unauthenticated(t *testing.T) {
+	service := new(MockActivityService)
+
+	resp := serveActivity(t, service, activityRequest("", ""))
+
+	assert.Equal(t, 401, resp.StatusCode)
+	assert.Contains(t, resp.Body, `"unauthorized"`)
+	service.AssertNotCalled(t, "Activity", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestActivityHandler_Handle_InvalidLimit(t *testing.T) {
+	for _, limit := range []string{"0", "101", "ten"} {
+		t.Run(limit, func(t *testing.T) {
+			resp := serveActivity(t, new(MockActivityService), activityRequest("limit="+limit, "sub-1"))
+
+			assert.Equal(t, 400, resp.StatusCode)
+			assert.Contains(t, resp.Body, `"field":"limit"`)
+		})
+	}
+}
+
+func TestActivityHandler_Handle_Errors(t *testing.T) {
+	tests := []struct {
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{fmt.Errorf("%w: bad", audit.ErrInvalidCursor), 400, "validation_failed"},
+		{services.ErrUserNotFound, 404, "user_not_found"},
+		{errors.New("database down"), 500, "internal_error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantCode, func(t *testing.T) {
+			service := new(MockActivityService)
+			service.On("Activity", mock.Anything, "sub-1", "x", defaultActivityLimit).Return(nil, "", tt.err)
+
+			resp := serveActivity(t, service, activityRequest("cursor=x", "sub-1"))
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Contains(t, resp.Body, `"code":"`+tt.wantCode+`"`)
+		})
+	}
+}
+
+func TestIdentifyClient(t *testing.T) {
+	var client audit.Client
+	handler := IdentifyClient()(func(ctx context.Context, _ events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+		client = audit.ClientFrom(ctx)
+		return events.APIGatewayV2HTTPResponse{StatusCode: 200}, nil
+	})
+	req := newRequest("GET", "/health", "")
+	req.RequestContext.HTTP.SourceIP = "203.0.113.7"
+	req.Headers = map[string]string{"user-agent": "curl/8.0"}
+
+	_, err := handler(context.Background(), req)
+
+	require.NoError(t, err)
+	assert.Equal(t, audit.Client{IP: "203.0.113.7", UserAgent: "curl/8.0"}, client)
+}
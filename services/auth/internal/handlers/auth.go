@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"context"
+	"services/auth/internal/audit"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// IdentifyClient records the IP address and user agent of each request in
+// its context, so the audit events it causes carry them.
+func IdentifyClient() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+			ctx = audit.WithClient(ctx, audit.Client{
+				IP:        req.RequestContext.HTTP.SourceIP,
+				UserAgent: header(req, "User-Agent"),
+			})
+			return next(ctx, req)
+		}
+	}
+}
+
+type subjectKey struct{}
+
+// Authenticated answers 401 to requests without a signed-in user. API
+// Gateway verifies the Cognito access token with its JWT authorizer and
+// passes the claims on; the route handler finds the identity provider ID of
+// the user with subjectFrom.
+func Authenticated() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+			var subject string
+			if authorizer := req.RequestContext.Authorizer; authorizer != nil && authorizer.JWT != nil {
+				subject = authorizer.JWT.Claims["sub"]
+			}
+			if subject == "" {
+				return errorResponse(401, "unauthorized", "Authentication required"), nil
+			}
+			return next(context.WithValue(ctx, subjectKey{}, subject), req)
+		}
+	}
+}
+
+// subjectFrom returns the identity provider ID of the user signed in to the
+// request, as set by Authenticated.
+func subjectFrom(ctx context.Context) string {
+	subject, _ := ctx.Value(subjectKey{}).(string)
+	return subject
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"services/auth/internal/audit"
+	"services/auth/internal/testhelpers"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// IdentityEventServiceInterface records identity provider events (aliased
+// for convenience).
+type IdentityEventServiceInterface = testhelpers.IdentityEventServiceInterface
+
+// triggerEventTypes maps the Cognito trigger sources that are recorded to
+// their audit event type. Cognito only runs triggers for successful steps,
+// so failed logins are not recorded.
+var triggerEventTypes = map[string]string{
+	"PostConfirmation_ConfirmSignUp":    audit.TypeConfirmation,
+	"PostAuthentication_Authentication": audit.TypeLogin,
+	"TokenGeneration_RefreshTokens":     audit.TypeTokenRefresh,
+}
+
+// cognitoTrigger is what the PostConfirmation, PostAuthentication and
+// PreTokenGeneration triggers have in common.
+type cognitoTrigger struct {
+	events.CognitoEventUserPoolsHeader
+	Request struct {
+		UserAttributes map[string]string `json:"userAttributes"`
+	} `json:"request"`
+}
+
+// CognitoTriggerHandler serves the Cognito user pool triggers attached to the
+// cognito-trigger function, recording confirmations, logins and token
+// refreshes in the audit log.
+type CognitoTriggerHandler struct {
+	identityEvents IdentityEventServiceInterface
+}
+
+func NewCognitoTriggerHandler(identityEvents IdentityEventServiceInterface) *CognitoTriggerHandler {
+	return &CognitoTriggerHandler{identityEvents: identityEvents}
+}
+
+// Handle records the step event reports and returns event unchanged, as
+// Cognito expects. It never fails: Cognito would fail the step with it, and
+// recording is best-effort.
+func (h *CognitoTriggerHandler) Handle(ctx context.Context, event json.RawMessage) (json.RawMessage, error) {
+	var trigger cognitoTrigger
+	if err := json.Unmarshal(event, &trigger); err != nil {
+		log.Printf("Failed to parse Cognito trigger event: %v", err)
+		return event, nil
+	}
+	eventType, ok := triggerEventTypes[trigger.TriggerSource]
+	if !ok {
+		return event, nil
+	}
+
+	sub := trigger.Request.UserAttributes["sub"]
+	if err := h.identityEvents.Record(ctx, eventType, sub); err != nil {
+		log.Printf("Failed to record %s of %s: %v", eventType, sub, err)
+	}
+	return event, nil
+}
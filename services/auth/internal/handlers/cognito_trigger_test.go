@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"services/auth/internal/audit"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockIdentityEventService is a mock implementation of
+// IdentityEventServiceInterface.
+type MockIdentityEventService struct {
+	mock.Mock
+}
+
+func (m *MockIdentityEventService) Record(ctx context.Context, eventType, cognitoID string) error {
+	return m.Called(ctx, eventType, cognitoID).Error(0)
+}
+
+// triggerEvent returns a Cognito trigger event of source for the account
+// with sub, as Cognito sends it.
+func triggerEvent(source, sub string) json.RawMessage {
+	return json.RawMessage(`{"version":"1","triggerSource":"` + source + `","region":"us-east-2",` +
+		`"userPoolId":"us-east-2_pool","userName":"` + sub + `","callerContext":{"clientId":"client"},` +
+		`"request":{"userAttributes":{"sub":"` + sub + `","email":"joao@example.com"}},"response":{}}`)
+}
+
+func TestCognitoTriggerHandler_Handle(t *testing.T) {
+	tests := map[string]string{
+		"PostConfirmation_ConfirmSignUp":    audit.TypeConfirmation,
+		"PostAuthentication_Authentication": audit.TypeLogin,
+		"TokenGeneration_RefreshTokens":     audit.TypeTokenRefresh,
+	}
+	for source, eventType := range tests {
+		t.Run(source, func(t *testing.T) {
+			service := new(MockIdentityEventService)
+			service.On("Record", mock.Anything, eventType, "sub-1").Return(nil)
+
+			event := triggerEvent(source, "sub-1")
+			resp, err := NewCognitoTriggerHandler(service).Handle(context.Background(), event)
+
+			require.NoError(t, err)
+			assert.JSONEq(t, string(event), string(resp), "the event is returned unchanged")
+			service.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCognitoTriggerHandler_Handle_IgnoresOtherTriggers(t *testing.T) {
+	service := new(MockIdentityEventService)
+
+	for _, source := range []string{"PostConfirmation_ConfirmForgotPassword", "TokenGeneration_Authentication"} {
+		event := triggerEvent(source, "sub-1")
+		resp, err := NewCognitoTriggerHandler(service).Handle(context.Background(), event)
+		require.NoError(t, err)
+		assert.JSONEq(t, string(event), string(resp))
+	}
+	service.AssertNotCalled(t, "Record", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCognitoTriggerHandler_Handle_NeverFails(t *testing.T) {
+	service := new(MockIdentityEventService)
+	service.On("Record", mock.Anything, audit.TypeLogin, "sub-1").Return(errors.New("database error"))
+	handler := NewCognitoTriggerHandler(service)
+
+	event := triggerEvent("PostAuthentication_Authentication", "sub-1")
+	resp, err := handler.Handle(context.Background(), event)
+	require.NoError(t, err, "a failure to record must not fail the login")
+	assert.JSONEq(t, string(event), string(resp))
+
+	_, err = handler.Handle(context.Background(), json.RawMessage(`not json`))
+	assert.NoError(t, err)
+}
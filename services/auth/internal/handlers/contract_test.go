@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"services/auth/internal/apispec"
+	"services/auth/internal/audit"
+	"services/auth/internal/captcha"
+	"services/auth/internal/health"
+	"services/auth/internal/idempotency"
+	"services/auth/internal/models"
+	"services/auth/internal/ratelimit"
+	"services/auth/internal/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// contractCase drives one request through the API router. The request and the
+// response are both checked against openapi.yaml.
+type contractCase struct {
+	name   string
+	method string
+	path   string
+	body   string
+	// invalidRequest marks requests that deliberately violate the spec.
+	invalidRequest bool
+	signup         func(m *MockSignupService)
+	activity       func(m *MockActivityService)
+	// query is the raw query string of the request.
+	query string
+	// subject is the user signed in by the JWT authorizer, if any.
+	subject string
+	// rateLimited makes the rate limiter refuse the request.
+	rateLimited bool
+	headers     map[string]string
+	// idempotency seeds the idempotency store before the request.
+	idempotency func(store *idempotency.MemoryStore)
+	// botCheck is returned by the bot verifier.
+	botCheck   error
+	readiness  health.Report
+	wantStatus int
+}
+
+var readyReport = health.Report{
+	Status: health.StatusOK,
+	Checks: map[string]health.CheckResult{
+		"postgres":   {Status: health.StatusOK, LatencyMs: 2},
+		"migrations": {Status: health.StatusOK, LatencyMs: 3},
+		"cognito":    {Status: health.StatusOK, LatencyMs: 41},
+	},
+}
+
+var notReadyReport = health.Report{
+	Status: health.StatusFail,
+	Checks: map[string]health.CheckResult{
+		"postgres":   {Status: health.StatusOK, LatencyMs: 2},
+		"migrations": {Status: health.StatusFail, LatencyMs: 3, Error: "schema at version 1, expected 2"},
+	},
+}
+
+func contractCases() []contractCase {
+	validSignup := `{"name":"João Silva","email":"joao@example.com"}`
+
+	return []contractCase{
+		{
+			name:   "sign-up succeeds",
+			method: "POST", path: "/auth/sign-up", body: validSignup,
+			signup: func(m *MockSignupService) {
+				m.On("Signup", mock.Anything, "João Silva", "joao@example.com").Return(&models.SignupOutcome{
+					User:   &models.User{ID: 1, Name: "João Silva", Email: "joao@example.com"},
+					Status: models.SignupStatusPendingConfirmation,
+				}, nil)
+			},
+			wantStatus: 200,
+		},
+		{
+			name:   "sign-up with malformed JSON",
+			method: "POST", path: "/auth/sign-up", body: `{invalid`,
+			invalidRequest: true,
+			wantStatus:     400,
+		},
+		{
+			name:   "sign-up with invalid fields",
+			method: "POST", path: "/auth/sign-up", body: `{"name":"x","email":"not-an-email"}`,
+			invalidRequest: true,
+			wantStatus:     400,
+		},
+		{
+			name:   "sign-up with a name of whitespace",
+			method: "POST", path: "/auth/sign-up", body: `{"name":"  ","email":"joao@example.com"}`,
+			invalidRequest: true,
+			wantStatus:     400,
+		},
+		{
+			name:   "sign-up with a padded email",
+			method: "POST", path: "/auth/sign-up", body: `{"name":"João Silva","email":" joao@example.com "}`,
+			signup: func(m *MockSignupService) {
+				m.On("Signup", mock.Anything, "João Silva", " joao@example.com ").Return(&models.SignupOutcome{
+					User:   &models.User{ID: 1, Name: "João Silva", Email: "joao@example.com"},
+					Status: models.SignupStatusPendingConfirmation,
+				}, nil)
+			},
+			wantStatus: 200,
+		},
+		{
+			name:   "sign-up with existing user",
+			method: "POST", path: "/auth/sign-up", body: validSignup,
+			signup: func(m *MockSignupService) {
+				m.On("Signup", mock.Anything, mock.Anything, mock.Anything).Return(nil, services.ErrUserAlreadyExists)
+			},
+			wantStatus: 409,
+		},
+		{
+			name:   "sign-up with email not allowed",
+			method: "POST", path: "/auth/sign-up", body: validSignup,
+			signup: func(m *MockSignupService) {
+				m.On("Signup", mock.Anything, mock.Anything, mock.Anything).Return(nil, services.ErrEmailNotAllowed)
+			},
+			wantStatus: 403,
+		},
+		{
+			name:   "sign-up reusing an idempotency key",
+			method: "POST", path: "/auth/sign-up", body: validSignup,
+			headers: map[string]string{IdempotencyKeyHeader: "key-1"},
+			idempotency: func(store *idempotency.MemoryStore) {
+				hash := idempotency.RequestHash("POST", "/auth/sign-up", []byte(`{"name":"Other","email":"other@example.com"}`))
+				_, _ = store.Claim(context.Background(), "key-1", hash, time.Now())
+			},
+			wantStatus: 422,
+		},
+		{
+			name:   "sign-up fails the bot check",
+			method: "POST", path: "/auth/sign-up", body: validSignup,
+			botCheck:   captcha.ErrRejected,
+			wantStatus: 403,
+		},
+		{
+			name:   "sign-up with bot check unavailable",
+			method: "POST", path: "/auth/sign-up", body: validSignup,
+			botCheck:   captcha.ErrUnavailable,
+			wantStatus: 503,
+		},
+		{
+			name:   "sign-up rate limited",
+			method: "POST", path: "/auth/sign-up", body: validSignup,
+			rateLimited: true,
+			wantStatus:  429,
+		},
+		{
+			name:   "sign-up fails",
+			method: "POST", path: "/auth/sign-up", body: validSignup,
+			signup: func(m *MockSignupService) {
+				m.On("Signup", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("database down"))
+			},
+			wantStatus: 500,
+		},
+		{
+			name:   "activity",
+			method: "GET", path: "/auth/me/activity", query: "limit=10",
+			subject: "cognito-sub",
+			activity: func(m *MockActivityService) {
+				userID := 1
+				m.On("Activity", mock.Anything, "cognito-sub", "", 10).Return([]audit.Event{{
+					ID: 2, OccurredAt: time.Date(2026, 1, 15, 10, 30, 0, 0, time.UTC), Type: audit.TypeSignup,
+					Outcome: audit.OutcomeSuccess, Reason: "pending_confirmation", UserID: &userID,
+					Actor: audit.ActorAnonymous, IP: "203.0.113.7", UserAgent: "Mozilla/5.0",
+				}}, "MQ", nil)
+			},
+			wantStatus: 200,
+		},
+		{
+			name:   "activity with invalid limit",
+			method: "GET", path: "/auth/me/activity", query: "limit=1000",
+			subject:    "cognito-sub",
+			wantStatus: 400,
+		},
+		{
+			name:   "activity without a token",
+			method: "GET", path: "/auth/me/activity",
+			wantStatus: 401,
+		},
+		{
+			name:   "activity of a deleted user",
+			method: "GET", path: "/auth/me/activity",
+			subject: "cognito-sub",
+			activity: func(m *MockActivityService) {
+				m.On("Activity", mock.Anything, "cognito-sub", "", 20).Return(nil, "", services.ErrUserNotFound)
+			},
+			wantStatus: 404,
+		},
+		{
+			name:   "activity fails",
+			method: "GET", path: "/auth/me/activity",
+			subject: "cognito-sub",
+			activity: func(m *MockActivityService) {
+				m.On("Activity", mock.Anything, "cognito-sub", "", 20).Return(nil, "", errors.New("database down"))
+			},
+			wantStatus: 500,
+		},
+		{
+			name:   "liveness",
+			method: "GET", path: "/health",
+			wantStatus: 200,
+		},
+		{
+			name:   "ready",
+			method: "GET", path: "/ready",
+			readiness:  readyReport,
+			wantStatus: 200,
+		},
+		{
+			name:   "not ready",
+			method: "GET", path: "/ready",
+			readiness:  notReadyReport,
+			wantStatus: 503,
+		},
+	}
+}
+
+func newContractRouter(t *testing.T, spec *apispec.Spec, tc contractCase) *Router {
+	t.Helper()
+
+	signupService := new(MockSignupService)
+	if tc.signup != nil {
+		tc.signup(signupService)
+	}
+	t.Cleanup(func() { signupService.AssertExpectations(t) })
+
+	activityService := new(MockActivityService)
+	if tc.activity != nil {
+		tc.activity(activityService)
+	}
+	t.Cleanup(func() { activityService.AssertExpectations(t) })
+
+	limiter := &stubLimiter{decision: ratelimit.Decision{Allowed: true}}
+	if tc.rateLimited {
+		limiter.decision = ratelimit.Decision{RetryAfter: time.Minute, Key: RuleSignupIP}
+	}
+
+	store := idempotency.NewMemoryStore()
+	if tc.idempotency != nil {
+		tc.idempotency(store)
+	}
+
+	return NewAPIRouter(API{
+		Validator:       spec,
+		Signup:          NewSignupHandlerWithInterface(signupService, WithBotVerifier(&stubBotVerifier{err: tc.botCheck})),
+		Activity:        NewActivityHandler(activityService),
+		Health:          NewHealthHandler(stubReadiness{report: tc.readiness}),
+		SignupRateLimit: RateLimit(limiter, noKeys),
+		Idempotency:     store,
+	})
+}
+
+// TestContract checks every case against the spec and then that the cases
+// cover every documented operation and status code, so new routes or
+// responses cannot be added without documenting and testing them.
+func TestContract(t *testing.T) {
+	spec, err := apispec.Load()
+	require.NoError(t, err)
+
+	seen := make(map[string]bool)
+	for _, tc := range contractCases() {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.body != "" {
+				err := spec.ValidateRequestBody(tc.method, tc.path, []byte(tc.body))
+				if tc.invalidRequest {
+					require.Error(t, err, "request should violate the spec")
+				} else {
+					require.NoError(t, err, "request should match the spec")
+				}
+			}
+
+			router := newContractRouter(t, spec, tc)
+			req := newRequest(tc.method, tc.path, tc.body)
+			req.Headers = tc.headers
+			req.RawQueryString = tc.query
+			if tc.subject != "" {
+				req.RequestContext.Authorizer = authorizedBy(tc.subject)
+			}
+			resp, err := router.Dispatch(context.Background(), req)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantStatus, resp.StatusCode)
+
+			err = spec.ValidateResponse(tc.method, tc.path, resp.StatusCode, resp.Headers["Content-Type"], []byte(resp.Body))
+			assert.NoError(t, err, "response should match the spec: %s", resp.Body)
+		})
+		seen[contractKey(tc.method, tc.path, tc.wantStatus)] = true
+	}
+
+	t.Run("every route is documented", func(t *testing.T) {
+		router := newContractRouter(t, spec, contractCase{})
+
+		routes := make(map[apispec.OperationRef]bool)
+		for _, route := range router.Routes() {
+			ref := apispec.OperationRef{Method: route.Method, Path: route.Path}
+			routes[ref] = true
+			assert.NotNil(t, spec.Operation(route.Method, route.Path), "%s %s is served but not documented", route.Method, route.Path)
+		}
+		for _, op := range spec.Operations() {
+			assert.True(t, routes[op], "%s %s is documented but not served", op.Method, op.Path)
+		}
+	})
+
+	t.Run("every documented response is exercised", func(t *testing.T) {
+		for _, op := range spec.Operations() {
+			for _, status := range spec.DocumentedStatuses(op.Method, op.Path) {
+				assert.True(t, seen[contractKey(op.Method, op.Path, status)],
+					"no contract case covers %d for %s %s", status, op.Method, op.Path)
+			}
+		}
+	})
+}
+
+// TestContract_RouterErrors checks the responses the router answers on its
+// own, which are not tied to a documented operation.
+func TestContract_RouterErrors(t *testing.T) {
+	spec, err := apispec.Load()
+	require.NoError(t, err)
+	router := newContractRouter(t, spec, contractCase{})
+
+	tests := []struct {
+		method, path string
+		wantStatus   int
+	}{
+		{"GET", "/unknown", 404},
+		{"GET", "/auth/sign-up", 405},
+		{"DELETE", "/health", 405},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %s", tt.method, tt.path), func(t *testing.T) {
+			resp, err := router.Dispatch(context.Background(), newRequest(tt.method, tt.path, ""))
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.NoError(t, spec.ValidateComponent("ErrorResponse", []byte(resp.Body)))
+		})
+	}
+}
+
+func contractKey(method, path string, status int) string {
+	return fmt.Sprintf("%s %s %d", method, path, status)
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"services/auth/internal/health"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// ReadinessChecker runs the dependency checks behind GET /ready.
+type ReadinessChecker interface {
+	Ready(ctx context.Context) health.Report
+}
+
+type HealthHandler struct {
+	readiness ReadinessChecker
+}
+
+func NewHealthHandler(readiness ReadinessChecker) *HealthHandler {
+	return &HealthHandler{readiness: readiness}
+}
+
+// Live reports that the process is up without touching any dependency.
+func (h *HealthHandler) Live(_ context.Context, _ events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	return jsonResponse(200, map[string]health.Status{"status": health.StatusOK}), nil
+}
+
+// Ready reports the state of every dependency, answering 503 if any check fails.
+func (h *HealthHandler) Ready(ctx context.Context, _ events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	report := h.readiness.Ready(ctx)
+
+	statusCode := 200
+	if report.Status != health.StatusOK {
+		log.Printf("Readiness check failed: %+v", report.Checks)
+		statusCode = 503
+	}
+
+	return jsonResponse(statusCode, report), nil
+}
+
+func jsonResponse(statusCode int, payload any) events.APIGatewayV2HTTPResponse {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Failed to marshal response: %v", err)
+		return errorResponse(500, "internal_error", "Failed to marshal response")
+	}
+
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+		Body: string(body),
+	}
+}
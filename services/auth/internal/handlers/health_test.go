@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"services/auth/internal/health"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubReadiness struct {
+	report health.Report
+}
+
+func (s stubReadiness) Ready(context.Context) health.Report { return s.report }
+
+func TestHealthHandler_Live(t *testing.T) {
+	handler := NewHealthHandler(stubReadiness{})
+
+	resp, err := handler.Live(context.Background(), newRequest("GET", "/health", ""))
+
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.JSONEq(t, `{"status":"ok"}`, resp.Body)
+}
+
+func TestHealthHandler_Ready(t *testing.T) {
+	t.Run("all dependencies ready", func(t *testing.T) {
+		handler := NewHealthHandler(stubReadiness{report: health.Report{
+			Status: health.StatusOK,
+			Checks: map[string]health.CheckResult{
+				"postgres": {Status: health.StatusOK, LatencyMs: 3},
+			},
+		}})
+
+		resp, err := handler.Ready(context.Background(), newRequest("GET", "/ready", ""))
+
+		require.NoError(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.Equal(t, "application/json", resp.Headers["Content-Type"])
+		assert.JSONEq(t, `{"status":"ok","checks":{"postgres":{"status":"ok","latency_ms":3}}}`, resp.Body)
+	})
+
+	t.Run("dependency failing", func(t *testing.T) {
+		handler := NewHealthHandler(stubReadiness{report: health.Report{
+			Status: health.StatusFail,
+			Checks: map[string]health.CheckResult{
+				"postgres": {Status: health.StatusOK},
+				"cognito":  {Status: health.StatusFail, Error: "describe user pool client failed"},
+			},
+		}})
+
+		resp, err := handler.Ready(context.Background(), newRequest("GET", "/ready", ""))
+
+		require.NoError(t, err)
+		assert.Equal(t, 503, resp.StatusCode)
+
+		var report health.Report
+		require.NoError(t, json.Unmarshal([]byte(resp.Body), &report))
+		assert.Equal(t, health.StatusFail, report.Status)
+		assert.Equal(t, "describe user pool client failed", report.Checks["cognito"].Error)
+	})
+}
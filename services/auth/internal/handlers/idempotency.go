@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"services/auth/internal/idempotency"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const (
+	// IdempotencyKeyHeader carries the client-chosen key of a mutating request.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader marks responses replayed from the store.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// Idempotent makes a route honor the Idempotency-Key header: the first
+// response to a key is stored and replayed to retries carrying the same key
+// and body. A key reused with a different request is rejected with 422, and
+// a retry arriving while the first request runs gets 409. Requests without
+// the header are not deduplicated.
+//
+// Server errors are not stored, so a retry after a 5xx runs the request
+// again.
+func Idempotent(store idempotency.Store) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+			key := header(req, IdempotencyKeyHeader)
+			if key == "" {
+				return next(ctx, req)
+			}
+			if !idempotency.ValidKey(key) {
+				return errorResponse(400, "invalid_request", "Invalid Idempotency-Key header"), nil
+			}
+
+			hash := idempotency.RequestHash(req.RequestContext.HTTP.Method, req.RawPath, []byte(req.Body))
+			record, err := store.Claim(ctx, key, hash, time.Now())
+			if err != nil {
+				log.Printf("❌ Failed to claim idempotency key: %v", err)
+				return errorResponse(500, "internal_error", "Internal server error"), nil
+			}
+
+			if record != nil {
+				return replay(record, hash), nil
+			}
+
+			resp, err := next(ctx, req)
+			if err != nil || resp.StatusCode >= 500 {
+				if releaseErr := store.Release(ctx, key); releaseErr != nil {
+					log.Printf("⚠️ Failed to release idempotency key: %v", releaseErr)
+				}
+				return resp, err
+			}
+
+			stored := idempotency.Response{StatusCode: resp.StatusCode, Headers: resp.Headers, Body: resp.Body}
+			if err := store.Complete(ctx, key, stored); err != nil {
+				log.Printf("⚠️ Failed to store idempotent response: %v", err)
+			}
+			return resp, nil
+		}
+	}
+}
+
+// replay answers a request whose key was already claimed.
+func replay(record *idempotency.Record, hash string) events.APIGatewayV2HTTPResponse {
+	if record.RequestHash != hash {
+		return errorResponse(422, "idempotency_key_reused", "Idempotency-Key was already used for a different request")
+	}
+	if record.Response == nil {
+		resp := errorResponse(409, "idempotency_in_progress", "A request with this Idempotency-Key is still in progress")
+		resp.Headers["Retry-After"] = "1"
+		return resp
+	}
+
+	headers := make(map[string]string, len(record.Response.Headers)+1)
+	for k, v := range record.Response.Headers {
+		headers[k] = v
+	}
+	headers[IdempotentReplayedHeader] = "true"
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: record.Response.StatusCode,
+		Headers:    headers,
+		Body:       record.Response.Body,
+	}
+}
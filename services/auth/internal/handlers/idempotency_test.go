@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"services/auth/internal/idempotency"
+	"services/auth/internal/models"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingHandler answers with status and counts its calls.
+func countingHandler(status int, calls *int) HandlerFunc {
+	return func(context.Context, events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+		*calls++
+		return jsonResponse(status, map[string]int{"call": *calls}), nil
+	}
+}
+
+func idempotentRequest(key, body string) events.APIGatewayV2HTTPRequest {
+	req := newRequest("POST", "/auth/sign-up", body)
+	req.Headers = map[string]string{"idempotency-key": key}
+	return req
+}
+
+func errorCode(t *testing.T, resp events.APIGatewayV2HTTPResponse) string {
+	t.Helper()
+	var errorResp models.ErrorResponse
+	require.NoError(t, json.Unmarshal([]byte(resp.Body), &errorResp))
+	return errorResp.Code
+}
+
+func TestIdempotent_ReplaysResponse(t *testing.T) {
+	calls := 0
+	h := Idempotent(idempotency.NewMemoryStore())(countingHandler(200, &calls))
+	ctx := context.Background()
+
+	first, err := h(ctx, idempotentRequest("key-1", `{"email":"a@example.com"}`))
+	require.NoError(t, err)
+	second, err := h(ctx, idempotentRequest("key-1", `{"email":"a@example.com"}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, calls, "the retry must not run the handler")
+	assert.Equal(t, first.StatusCode, second.StatusCode)
+	assert.Equal(t, first.Body, second.Body)
+	assert.Equal(t, "application/json", second.Headers["Content-Type"])
+	assert.Equal(t, "true", second.Headers[IdempotentReplayedHeader])
+	assert.Empty(t, first.Headers[IdempotentReplayedHeader])
+}
+
+func TestIdempotent_RejectsReuseWithDifferentBody(t *testing.T) {
+	calls := 0
+	h := Idempotent(idempotency.NewMemoryStore())(countingHandler(200, &calls))
+	ctx := context.Background()
+
+	_, err := h(ctx, idempotentRequest("key-1", `{"email":"a@example.com"}`))
+	require.NoError(t, err)
+	resp, err := h(ctx, idempotentRequest("key-1", `{"email":"b@example.com"}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, 422, resp.StatusCode)
+	assert.Equal(t, "idempotency_key_reused", errorCode(t, resp))
+	assert.Equal(t, 1, calls)
+}
+
+func TestIdempotent_InProgress(t *testing.T) {
+	store := idempotency.NewMemoryStore()
+	body := `{"email":"a@example.com"}`
+	_, err := store.Claim(context.Background(), "key-1", idempotency.RequestHash("POST", "/auth/sign-up", []byte(body)), time.Now())
+	require.NoError(t, err)
+
+	calls := 0
+	resp, err := Idempotent(store)(countingHandler(200, &calls))(context.Background(), idempotentRequest("key-1", body))
+	require.NoError(t, err)
+
+	assert.Equal(t, 409, resp.StatusCode)
+	assert.Equal(t, "idempotency_in_progress", errorCode(t, resp))
+	assert.Equal(t, "1", resp.Headers["Retry-After"])
+	assert.Zero(t, calls)
+}
+
+func TestIdempotent_ServerErrorsAreRetried(t *testing.T) {
+	calls := 0
+	h := Idempotent(idempotency.NewMemoryStore())(countingHandler(500, &calls))
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		resp, err := h(ctx, idempotentRequest("key-1", `{}`))
+		require.NoError(t, err)
+		assert.Equal(t, 500, resp.StatusCode)
+	}
+	assert.Equal(t, 2, calls)
+}
+
+func TestIdempotent_ClientErrorsAreReplayed(t *testing.T) {
+	calls := 0
+	h := Idempotent(idempotency.NewMemoryStore())(countingHandler(409, &calls))
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		resp, err := h(ctx, idempotentRequest("key-1", `{}`))
+		require.NoError(t, err)
+		assert.Equal(t, 409, resp.StatusCode)
+	}
+	assert.Equal(t, 1, calls)
+}
+
+func TestIdempotent_WithoutKey(t *testing.T) {
+	calls := 0
+	h := Idempotent(idempotency.NewMemoryStore())(countingHandler(200, &calls))
+
+	for i := 0; i < 2; i++ {
+		_, err := h(context.Background(), newRequest("POST", "/auth/sign-up", `{}`))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, calls)
+}
+
+func TestIdempotent_InvalidKey(t *testing.T) {
+	calls := 0
+	h := Idempotent(idempotency.NewMemoryStore())(countingHandler(200, &calls))
+
+	resp, err := h(context.Background(), idempotentRequest(strings.Repeat("k", idempotency.MaxKeyLength+1), `{}`))
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.Equal(t, "invalid_request", errorCode(t, resp))
+	assert.Zero(t, calls)
+}
+
+type failingIdempotencyStore struct{ idempotency.MemoryStore }
+
+func (*failingIdempotencyStore) Claim(context.Context, string, string, time.Time) (*idempotency.Record, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestIdempotent_StoreError(t *testing.T) {
+	calls := 0
+	h := Idempotent(&failingIdempotencyStore{})(countingHandler(200, &calls))
+
+	resp, err := h(context.Background(), idempotentRequest("key-1", `{}`))
+	require.NoError(t, err)
+	assert.Equal(t, 500, resp.StatusCode)
+	assert.Zero(t, calls, "the request must not run without its idempotency guarantee")
+}
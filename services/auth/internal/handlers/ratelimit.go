@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"services/auth/internal/emailaddr"
+	"services/auth/internal/metrics"
+	"services/auth/internal/models"
+	"services/auth/internal/ratelimit"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// RateLimiter charges a request to its token buckets.
+type RateLimiter interface {
+	Allow(ctx context.Context, keys ...ratelimit.Key) (ratelimit.Decision, error)
+}
+
+// RateLimitKeys returns the buckets a request is charged to.
+type RateLimitKeys func(req events.APIGatewayV2HTTPRequest) []ratelimit.Key
+
+// RateLimit answers 429 rate_limited with a Retry-After header once one of
+// the request's buckets is spent. When the store fails the request is let
+// through: the limiter protects Cognito, it must not take sign-ups down.
+func RateLimit(limiter RateLimiter, keys RateLimitKeys) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+			decision, err := limiter.Allow(ctx, keys(req)...)
+			if err != nil {
+				log.Printf("⚠️ Rate limiter unavailable, allowing request: %v", err)
+				return next(ctx, req)
+			}
+			if decision.Allowed {
+				return next(ctx, req)
+			}
+
+			metrics.Auth.RecordRateLimited(decision.Key)
+			resp := errorResponse(429, "rate_limited", "Too many requests, please try again later")
+			resp.Headers["Retry-After"] = retryAfterSeconds(decision.RetryAfter)
+			return resp, nil
+		}
+	}
+}
+
+// retryAfterSeconds formats d as the whole number of seconds, at least one,
+// expected by the Retry-After header.
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.FormatFloat(math.Max(1, math.Ceil(d.Seconds())), 'f', 0, 64)
+}
+
+// Rate limit rule names, also used as the "rule" metric label.
+const (
+	RuleSignupIP    = "signup_ip"
+	RuleSignupEmail = "signup_email"
+)
+
+// SignupRateLimits throttles sign-ups by client IP and by email, so neither
+// one client nor one mailbox can make Cognito send unbounded emails.
+type SignupRateLimits struct {
+	PerIP    ratelimit.Limit
+	PerEmail ratelimit.Limit
+	// Normalizer maps the email to the identity accounts are matched on, so
+	// variants of one address share a bucket.
+	Normalizer *emailaddr.Normalizer
+}
+
+// RefillTime returns the longest time a bucket of either limit takes to be
+// full again, and false when one of them never refills.
+func (l SignupRateLimits) RefillTime() (time.Duration, bool) {
+	longest := time.Duration(0)
+	for _, limit := range []ratelimit.Limit{l.PerIP, l.PerEmail} {
+		refill, ok := limit.RefillTime()
+		if !ok {
+			return 0, false
+		}
+		longest = max(longest, refill)
+	}
+	return longest, true
+}
+
+// Keys implements RateLimitKeys. Requests without a source IP or a valid
+// email are only charged to the buckets that apply.
+func (l SignupRateLimits) Keys(req events.APIGatewayV2HTTPRequest) []ratelimit.Key {
+	var keys []ratelimit.Key
+	if ip := req.RequestContext.HTTP.SourceIP; ip != "" {
+		keys = append(keys, ratelimit.Key{Name: RuleSignupIP, Value: ip, Limit: l.PerIP})
+	}
+
+	var body models.SignupRequest
+	if err := json.Unmarshal([]byte(req.Body), &body); err == nil {
+		if email, err := l.Normalizer.Canonical(body.Email); err == nil {
+			keys = append(keys, ratelimit.Key{Name: RuleSignupEmail, Value: email, Limit: l.PerEmail})
+		}
+	}
+	return keys
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"services/auth/internal/emailaddr"
+	"services/auth/internal/metrics"
+	"services/auth/internal/models"
+	"services/auth/internal/ratelimit"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubLimiter returns a fixed decision and records the keys it was asked about.
+type stubLimiter struct {
+	decision ratelimit.Decision
+	err      error
+	keys     []ratelimit.Key
+}
+
+func (s *stubLimiter) Allow(_ context.Context, keys ...ratelimit.Key) (ratelimit.Decision, error) {
+	s.keys = keys
+	return s.decision, s.err
+}
+
+func noKeys(events.APIGatewayV2HTTPRequest) []ratelimit.Key { return nil }
+
+func TestRateLimit_Allowed(t *testing.T) {
+	limiter := &stubLimiter{decision: ratelimit.Decision{Allowed: true}}
+	h := RateLimit(limiter, noKeys)(staticHandler(200))
+
+	resp, err := h(context.Background(), newRequest("POST", "/auth/sign-up", ""))
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+}
+
+func TestRateLimit_Refused(t *testing.T) {
+	limiter := &stubLimiter{decision: ratelimit.Decision{RetryAfter: 1500 * time.Millisecond, Key: RuleSignupEmail}}
+	h := RateLimit(limiter, noKeys)(staticHandler(200))
+	before := metrics.Auth.RateLimitedCount(RuleSignupEmail)
+
+	resp, err := h(context.Background(), newRequest("POST", "/auth/sign-up", ""))
+	require.NoError(t, err)
+	assert.Equal(t, 429, resp.StatusCode)
+	assert.Equal(t, "2", resp.Headers["Retry-After"])
+	assert.Equal(t, before+1, metrics.Auth.RateLimitedCount(RuleSignupEmail))
+
+	var errorResp models.ErrorResponse
+	require.NoError(t, json.Unmarshal([]byte(resp.Body), &errorResp))
+	assert.Equal(t, "rate_limited", errorResp.Code)
+}
+
+func TestRateLimit_StoreErrorAllows(t *testing.T) {
+	limiter := &stubLimiter{err: errors.New("connection refused")}
+	h := RateLimit(limiter, noKeys)(staticHandler(200))
+
+	resp, err := h(context.Background(), newRequest("POST", "/auth/sign-up", ""))
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	assert.Equal(t, "1", retryAfterSeconds(0))
+	assert.Equal(t, "1", retryAfterSeconds(200*time.Millisecond))
+	assert.Equal(t, "60", retryAfterSeconds(time.Minute))
+	assert.Equal(t, "61", retryAfterSeconds(time.Minute+time.Millisecond))
+}
+
+func TestSignupRateLimits_Keys(t *testing.T) {
+	limits := SignupRateLimits{
+		PerIP:      ratelimit.Limit{Burst: 10, Interval: time.Minute},
+		PerEmail:   ratelimit.Limit{Burst: 3, Interval: time.Hour},
+		Normalizer: emailaddr.NewNormalizer(true),
+	}
+
+	req := newRequest("POST", "/auth/sign-up", `{"name":"John","email":" J.Doe+promo@GoogleMail.com "}`)
+	req.RequestContext.HTTP.SourceIP = "203.0.113.7"
+
+	assert.Equal(t, []ratelimit.Key{
+		{Name: RuleSignupIP, Value: "203.0.113.7", Limit: limits.PerIP},
+		{Name: RuleSignupEmail, Value: "jdoe@gmail.com", Limit: limits.PerEmail},
+	}, limits.Keys(req))
+}
+
+func TestSignupRateLimits_Keys_PartialRequest(t *testing.T) {
+	limits := SignupRateLimits{PerIP: ratelimit.Limit{Burst: 10, Interval: time.Minute}}
+
+	req := newRequest("POST", "/auth/sign-up", `{"email":"not an email"}`)
+	req.RequestContext.HTTP.SourceIP = "203.0.113.7"
+	keys := limits.Keys(req)
+	require.Len(t, keys, 1)
+	assert.Equal(t, RuleSignupIP, keys[0].Name)
+
+	assert.Empty(t, limits.Keys(newRequest("POST", "/auth/sign-up", `{invalid`)))
+}
+
+func TestSignupRateLimits_RefillTime(t *testing.T) {
+	limits := SignupRateLimits{
+		PerIP:    ratelimit.Limit{Burst: 10, Interval: time.Minute},
+		PerEmail: ratelimit.Limit{Burst: 3, Interval: 10 * time.Minute},
+	}
+	refill, ok := limits.RefillTime()
+	require.True(t, ok)
+	assert.Equal(t, 30*time.Minute, refill, "the slowest limit decides")
+
+	limits.PerIP.Interval = 0
+	_, ok = limits.RefillTime()
+	assert.False(t, ok)
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// HandlerFunc handles a single API Gateway HTTP request.
+type HandlerFunc func(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error)
+
+// Middleware wraps a HandlerFunc, e.g. to validate or throttle requests before
+// they reach the route handler.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Route identifies a method and path served by the Router.
+type Route struct {
+	Method string
+	Path   string
+}
+
+// Router dispatches requests by exact path and method.
+type Router struct {
+	routes     map[string]map[string]HandlerFunc
+	middleware []Middleware
+}
+
+func NewRouter() *Router {
+	return &Router{routes: make(map[string]map[string]HandlerFunc)}
+}
+
+// Handle registers h for method and path. Route middleware runs, in order,
+// inside the middleware installed with Use, so routes can opt into behavior
+// such as rate limiting or idempotency.
+func (r *Router) Handle(method, path string, h HandlerFunc, mw ...Middleware) {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+
+	methods, ok := r.routes[path]
+	if !ok {
+		methods = make(map[string]HandlerFunc)
+		r.routes[path] = methods
+	}
+	methods[strings.ToUpper(method)] = h
+}
+
+// Use appends middleware run, in registration order, around every matched
+// route. Unknown paths and methods are answered without running it.
+func (r *Router) Use(mw ...Middleware) {
+	r.middleware = append(r.middleware, mw...)
+}
+
+// Routes returns the registered routes sorted by path and method.
+func (r *Router) Routes() []Route {
+	routes := make([]Route, 0, len(r.routes))
+	for path, methods := range r.routes {
+		for method := range methods {
+			routes = append(routes, Route{Method: method, Path: path})
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// Dispatch routes req to the matching handler, answering 404 for unknown paths
+// and 405 for unsupported methods.
+func (r *Router) Dispatch(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	methods, ok := r.routes[req.RawPath]
+	if !ok {
+		return errorResponse(404, "not_found", "Not found"), nil
+	}
+
+	h, ok := methods[strings.ToUpper(req.RequestContext.HTTP.Method)]
+	if !ok {
+		allowed := make([]string, 0, len(methods))
+		for method := range methods {
+			allowed = append(allowed, method)
+		}
+		sort.Strings(allowed)
+
+		resp := errorResponse(405, "method_not_allowed", "Method not allowed")
+		resp.Headers["Allow"] = strings.Join(allowed, ", ")
+		return resp, nil
+	}
+
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		h = r.middleware[i](h)
+	}
+	return h(ctx, req)
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"services/auth/internal/models"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRequest(method, path, body string) events.APIGatewayV2HTTPRequest {
+	return events.APIGatewayV2HTTPRequest{
+		RawPath: path,
+		Body:    body,
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+				Method: method,
+				Path:   path,
+			},
+		},
+	}
+}
+
+func staticHandler(statusCode int) HandlerFunc {
+	return func(context.Context, events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+		return events.APIGatewayV2HTTPResponse{StatusCode: statusCode}, nil
+	}
+}
+
+func TestRouter_Dispatch(t *testing.T) {
+	router := NewRouter()
+	router.Handle("POST", "/auth/sign-up", staticHandler(200))
+	router.Handle("get", "/health", staticHandler(204))
+
+	ctx := context.Background()
+
+	t.Run("matches method and path", func(t *testing.T) {
+		resp, err := router.Dispatch(ctx, newRequest("POST", "/auth/sign-up", ""))
+		require.NoError(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+
+		resp, err = router.Dispatch(ctx, newRequest("GET", "/health", ""))
+		require.NoError(t, err)
+		assert.Equal(t, 204, resp.StatusCode)
+	})
+
+	t.Run("unknown path", func(t *testing.T) {
+		resp, err := router.Dispatch(ctx, newRequest("GET", "/", ""))
+		require.NoError(t, err)
+		assert.Equal(t, 404, resp.StatusCode)
+
+		var errorResp models.ErrorResponse
+		require.NoError(t, json.Unmarshal([]byte(resp.Body), &errorResp))
+		assert.Equal(t, "not_found", errorResp.Code)
+	})
+
+	t.Run("unsupported method", func(t *testing.T) {
+		resp, err := router.Dispatch(ctx, newRequest("GET", "/auth/sign-up", ""))
+		require.NoError(t, err)
+		assert.Equal(t, 405, resp.StatusCode)
+		assert.Equal(t, "POST", resp.Headers["Allow"])
+
+		var errorResp models.ErrorResponse
+		require.NoError(t, json.Unmarshal([]byte(resp.Body), &errorResp))
+		assert.Equal(t, "method_not_allowed", errorResp.Code)
+	})
+}
+
+func TestRouter_Routes(t *testing.T) {
+	router := NewRouter()
+	router.Handle("POST", "/auth/sign-up", staticHandler(200))
+	router.Handle("GET", "/ready", staticHandler(200))
+	router.Handle("GET", "/health", staticHandler(200))
+
+	assert.Equal(t, []Route{
+		{Method: "POST", Path: "/auth/sign-up"},
+		{Method: "GET", Path: "/health"},
+		{Method: "GET", Path: "/ready"},
+	}, router.Routes())
+}
+
+func TestRouter_Use(t *testing.T) {
+	var calls []string
+	tag := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+				calls = append(calls, name)
+				return next(ctx, req)
+			}
+		}
+	}
+
+	router := NewRouter()
+	router.Use(tag("first"), tag("second"))
+	router.Handle("GET", "/health", staticHandler(200))
+
+	resp, err := router.Dispatch(context.Background(), newRequest("GET", "/health", ""))
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, []string{"first", "second"}, calls)
+
+	calls = nil
+	resp, err = router.Dispatch(context.Background(), newRequest("GET", "/unknown", ""))
+	require.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+	assert.Empty(t, calls, "middleware should not run for unknown routes")
+}
+
+func TestRouter_HandleWithRouteMiddleware(t *testing.T) {
+	var calls []string
+	tag := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+				calls = append(calls, name)
+				return next(ctx, req)
+			}
+		}
+	}
+
+	router := NewRouter()
+	router.Use(tag("global"))
+	router.Handle("POST", "/auth/sign-up", staticHandler(200), tag("route-1"), tag("route-2"))
+	router.Handle("GET", "/health", staticHandler(200))
+
+	_, err := router.Dispatch(context.Background(), newRequest("POST", "/auth/sign-up", ""))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"global", "route-1", "route-2"}, calls)
+
+	calls = nil
+	_, err = router.Dispatch(context.Background(), newRequest("GET", "/health", ""))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"global"}, calls, "route middleware only wraps its route")
+}
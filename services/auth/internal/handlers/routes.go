@@ -0,0 +1,39 @@
+package handlers
+
+import "services/auth/internal/idempotency"
+
+// API bundles the handlers served by the auth API.
+type API struct {
+	Validator RequestValidator
+	Signup    *SignupHandler
+	Activity  *ActivityHandler
+	Health    *HealthHandler
+	// SignupRateLimit throttles sign-ups; nil disables it.
+	SignupRateLimit Middleware
+	// Idempotency stores the responses of mutating routes by
+	// Idempotency-Key; nil disables the header.
+	Idempotency idempotency.Store
+}
+
+// NewAPIRouter registers every route of the auth API. It is shared by main and
+// the contract tests so both serve exactly the same routes and middleware.
+func NewAPIRouter(api API) *Router {
+	router := NewRouter()
+	router.Use(ValidateRequests(api.Validator), IdentifyClient())
+
+	// Mutating routes are rate limited first, so replays also count
+	// against the limits, then deduplicated by Idempotency-Key.
+	var mutating []Middleware
+	if api.SignupRateLimit != nil {
+		mutating = append(mutating, api.SignupRateLimit)
+	}
+	if api.Idempotency != nil {
+		mutating = append(mutating, Idempotent(api.Idempotency))
+	}
+
+	router.Handle("POST", "/auth/sign-up", api.Signup.Handle, mutating...)
+	router.Handle("GET", "/auth/me/activity", api.Activity.Handle, Authenticated())
+	router.Handle("GET", "/health", api.Health.Live)
+	router.Handle("GET", "/ready", api.Health.Ready)
+	return router
+}
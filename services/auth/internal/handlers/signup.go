@@ -5,9 +5,13 @@ import (
 	"encoding/json"
 	"errors"
 	"log"
+	"services/auth/internal/audit"
+	"services/auth/internal/captcha"
+	"services/auth/internal/metrics"
 	"services/auth/internal/models"
 	"services/auth/internal/services"
 	"services/auth/internal/testhelpers"
+	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 )
@@ -15,20 +19,48 @@ import (
 // SignupServiceInterface defines the interface for signup service (aliased for convenience).
 type SignupServiceInterface = testhelpers.SignupServiceInterface
 
+// BotCheckTokenHeader carries the Turnstile, hCaptcha or reCAPTCHA token
+// obtained by the web client.
+const BotCheckTokenHeader = "X-Captcha-Token"
+
 type SignupHandler struct {
 	signupService SignupServiceInterface
+	botVerifier   captcha.BotVerifier
+	recorder      *audit.Recorder
+}
+
+// SignupHandlerOption customizes a SignupHandler.
+type SignupHandlerOption func(*SignupHandler)
+
+// WithBotVerifier checks the request's bot-check token before signing up.
+func WithBotVerifier(verifier captcha.BotVerifier) SignupHandlerOption {
+	return func(h *SignupHandler) {
+		h.botVerifier = verifier
+	}
 }
 
-func NewSignupHandler(signupService *services.SignupService) *SignupHandler {
-	return NewSignupHandlerWithInterface(signupService)
+// WithAuditRecorder records sign-ups refused by the bot check, which never
+// reach the service.
+func WithAuditRecorder(recorder *audit.Recorder) SignupHandlerOption {
+	return func(h *SignupHandler) {
+		h.recorder = recorder
+	}
+}
+
+func NewSignupHandler(signupService *services.SignupService, opts ...SignupHandlerOption) *SignupHandler {
+	return NewSignupHandlerWithInterface(signupService, opts...)
 }
 
 // NewSignupHandlerWithInterface creates a handler with an interface-based service
 // This allows for easier testing with mocks.
-func NewSignupHandlerWithInterface(signupService SignupServiceInterface) *SignupHandler {
-	return &SignupHandler{
+func NewSignupHandlerWithInterface(signupService SignupServiceInterface, opts ...SignupHandlerOption) *SignupHandler {
+	h := &SignupHandler{
 		signupService: signupService,
 	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 func (h *SignupHandler) Handle(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
@@ -40,17 +72,33 @@ func (h *SignupHandler) Handle(ctx context.Context, req events.APIGatewayV2HTTPR
 		return errorResponse(400, "invalid_request", "Invalid request body"), nil
 	}
 
-	// Validate fields
+	// Validate fields; the schema already refused names of only whitespace
+	signupReq.Name = strings.TrimSpace(signupReq.Name)
 	if signupReq.Name == "" || signupReq.Email == "" {
 		return errorResponse(400, "missing_fields", "Name and email are required"), nil
 	}
 
+	// Refuse bots before the service can trigger a confirmation email
+	if resp, ok := h.checkBot(ctx, req); !ok {
+		return resp, nil
+	}
+
 	// Call service
 	result, err := h.signupService.Signup(ctx, signupReq.Name, signupReq.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, services.ErrUserAlreadyExists):
 			return errorResponse(409, "user_exists", "User with this email already exists"), nil
+		case errors.Is(err, services.ErrEmailNotAllowed):
+			return errorResponse(403, "email_not_allowed", "This email address cannot be used to sign up"), nil
+		case errors.Is(err, services.ErrInvalidEmail):
+			return jsonResponse(400, models.ErrorResponse{
+				Code:    "validation_failed",
+				Message: "Request validation failed",
+				Fields: []models.FieldError{
+					{Field: "email", Code: "invalid_format", Message: "must be a valid email", Params: map[string]any{"format": "email"}},
+				},
+			}), nil
 		default:
 			// Log the actual error for debugging but return generic message to client
 			log.Printf("❌ Signup service error: %v", err)
@@ -84,6 +132,50 @@ func (h *SignupHandler) Handle(ctx context.Context, req events.APIGatewayV2HTTPR
 	}, nil
 }
 
+// checkBot verifies the request's bot-check token, returning the response to
+// send when the request must be refused. The check fails closed: when the
+// provider cannot be reached the sign-up is refused with 503.
+func (h *SignupHandler) checkBot(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, bool) {
+	if h.botVerifier == nil {
+		return events.APIGatewayV2HTTPResponse{}, true
+	}
+
+	err := h.botVerifier.Verify(ctx, header(req, BotCheckTokenHeader), req.RequestContext.HTTP.SourceIP)
+	switch {
+	case err == nil:
+		metrics.Auth.RecordBotCheck(metrics.BotCheckPassed)
+		return events.APIGatewayV2HTTPResponse{}, true
+	case errors.Is(err, captcha.ErrMissingToken):
+		metrics.Auth.RecordBotCheck(metrics.BotCheckMissing)
+		h.recorder.Record(ctx, audit.Event{Type: audit.TypeSignup, Actor: audit.ActorAnonymous, Outcome: audit.OutcomeDenied, Reason: "bot_check_failed"})
+		return errorResponse(403, "bot_check_failed", "Bot verification failed"), false
+	case errors.Is(err, captcha.ErrRejected):
+		metrics.Auth.RecordBotCheck(metrics.BotCheckRejected)
+		h.recorder.Record(ctx, audit.Event{Type: audit.TypeSignup, Actor: audit.ActorAnonymous, Outcome: audit.OutcomeDenied, Reason: "bot_check_failed"})
+		return errorResponse(403, "bot_check_failed", "Bot verification failed"), false
+	default:
+		log.Printf("❌ Bot check unavailable: %v", err)
+		metrics.Auth.RecordBotCheck(metrics.BotCheckUnavailable)
+		h.recorder.Record(ctx, audit.Event{Type: audit.TypeSignup, Actor: audit.ActorAnonymous, Outcome: audit.OutcomeFailure, Reason: "bot_check_unavailable"})
+		return errorResponse(503, "bot_check_unavailable", "Bot verification is temporarily unavailable"), false
+	}
+}
+
+// header returns the value of the named request header. API Gateway
+// lowercases header names while the local server keeps Go's canonical form,
+// so the lookup ignores case.
+func header(req events.APIGatewayV2HTTPRequest, name string) string {
+	if v, ok := req.Headers[name]; ok {
+		return v
+	}
+	for k, v := range req.Headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
 func errorResponse(statusCode int, code, message string) events.APIGatewayV2HTTPResponse {
 	payload := models.ErrorResponse{
 		Code:    code,
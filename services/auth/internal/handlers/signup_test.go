@@ -4,8 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"testing"
 
+	"services/auth/internal/audit"
+	"services/auth/internal/captcha"
+	"services/auth/internal/metrics"
 	"services/auth/internal/models"
 	"services/auth/internal/services"
 	"services/auth/internal/testhelpers"
@@ -233,6 +237,56 @@ func TestSignupHandler_Handle_DuplicateEmail(t *testing.T) {
 	mockService.AssertExpectations(t)
 }
 
+func TestSignupHandler_Handle_InvalidEmail(t *testing.T) {
+	mockService := new(MockSignupService)
+	handler := NewSignupHandlerWithService(mockService)
+
+	ctx := context.Background()
+	req := newRequest("POST", "/auth/sign-up", `{"name": "John Doe", "email": "john@exa mple.com"}`)
+
+	mockService.On("Signup", ctx, "John Doe", "john@exa mple.com").
+		Return(nil, services.ErrInvalidEmail)
+
+	resp, err := handler.Handle(ctx, req)
+
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+
+	var errorResp models.ErrorResponse
+	err = json.Unmarshal([]byte(resp.Body), &errorResp)
+	require.NoError(t, err)
+	assert.Equal(t, "validation_failed", errorResp.Code)
+	require.Len(t, errorResp.Fields, 1)
+	assert.Equal(t, "email", errorResp.Fields[0].Field)
+	assert.Equal(t, "invalid_format", errorResp.Fields[0].Code)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestSignupHandler_Handle_EmailNotAllowed(t *testing.T) {
+	mockService := new(MockSignupService)
+	handler := NewSignupHandlerWithService(mockService)
+
+	ctx := context.Background()
+	req := newRequest("POST", "/auth/sign-up", `{"name": "John Doe", "email": "john@mailinator.com"}`)
+
+	mockService.On("Signup", ctx, "John Doe", "john@mailinator.com").
+		Return(nil, fmt.Errorf("%w: disposable", services.ErrEmailNotAllowed))
+
+	resp, err := handler.Handle(ctx, req)
+
+	require.NoError(t, err)
+	assert.Equal(t, 403, resp.StatusCode)
+
+	var errorResp models.ErrorResponse
+	err = json.Unmarshal([]byte(resp.Body), &errorResp)
+	require.NoError(t, err)
+	assert.Equal(t, "email_not_allowed", errorResp.Code)
+	assert.NotContains(t, errorResp.Message, "disposable", "the rejection reason is not exposed")
+
+	mockService.AssertExpectations(t)
+}
+
 func TestSignupHandler_Handle_ServiceError(t *testing.T) {
 	mockService := new(MockSignupService)
 	handler := NewSignupHandlerWithService(mockService)
@@ -265,6 +319,108 @@ func TestSignupHandler_Handle_ServiceError(t *testing.T) {
 	mockService.AssertExpectations(t)
 }
 
+// stubBotVerifier returns err and records the token and IP it was given.
+type stubBotVerifier struct {
+	err           error
+	token, remote string
+}
+
+func (s *stubBotVerifier) Verify(_ context.Context, token, remoteIP string) error {
+	s.token, s.remote = token, remoteIP
+	return s.err
+}
+
+func TestSignupHandler_Handle_BotCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		verifyErr  error
+		wantStatus int
+		wantCode   string
+		wantResult string
+	}{
+		{"passed", nil, 200, "", metrics.BotCheckPassed},
+		{"missing token", captcha.ErrMissingToken, 403, "bot_check_failed", metrics.BotCheckMissing},
+		{"rejected token", fmt.Errorf("%w: invalid-input-response", captcha.ErrRejected), 403, "bot_check_failed", metrics.BotCheckRejected},
+		{"verifier unreachable", fmt.Errorf("%w: connection refused", captcha.ErrUnavailable), 503, "bot_check_unavailable", metrics.BotCheckUnavailable},
+		{"unexpected error", errors.New("boom"), 503, "bot_check_unavailable", metrics.BotCheckUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockSignupService)
+			verifier := &stubBotVerifier{err: tt.verifyErr}
+			handler := NewSignupHandlerWithInterface(mockService, WithBotVerifier(verifier))
+
+			ctx := context.Background()
+			if tt.verifyErr == nil {
+				mockService.On("Signup", ctx, "John Doe", "john@example.com").Return(&models.SignupOutcome{
+					User:   testhelpers.UserFixture(),
+					Status: models.SignupStatusPendingConfirmation,
+				}, nil)
+			}
+
+			req := newRequest("POST", "/auth/sign-up", `{"name": "John Doe", "email": "john@example.com"}`)
+			req.Headers = map[string]string{"x-captcha-token": "token-123"}
+			req.RequestContext.HTTP.SourceIP = "203.0.113.7"
+			before := metrics.Auth.BotCheckCount(tt.wantResult)
+
+			resp, err := handler.Handle(ctx, req)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Equal(t, "token-123", verifier.token)
+			assert.Equal(t, "203.0.113.7", verifier.remote)
+			assert.Equal(t, before+1, metrics.Auth.BotCheckCount(tt.wantResult))
+			if tt.wantCode != "" {
+				var errorResp models.ErrorResponse
+				require.NoError(t, json.Unmarshal([]byte(resp.Body), &errorResp))
+				assert.Equal(t, tt.wantCode, errorResp.Code)
+			}
+
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSignupHandler_Handle_BotCheckAudited(t *testing.T) {
+	tests := []struct {
+		verifyErr   error
+		wantOutcome string
+		wantReason  string
+	}{
+		{captcha.ErrRejected, audit.OutcomeDenied, "bot_check_failed"},
+		{captcha.ErrUnavailable, audit.OutcomeFailure, "bot_check_unavailable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantReason, func(t *testing.T) {
+			store := audit.NewMemoryStore()
+			handler := NewSignupHandlerWithInterface(new(MockSignupService),
+				WithBotVerifier(&stubBotVerifier{err: tt.verifyErr}),
+				WithAuditRecorder(audit.NewRecorder(store)))
+			ctx := audit.WithClient(context.Background(), audit.Client{IP: "203.0.113.7", UserAgent: "curl/8.0"})
+
+			_, err := handler.Handle(ctx, newRequest("POST", "/auth/sign-up", `{"name": "John Doe", "email": "john@example.com"}`))
+
+			require.NoError(t, err)
+			recorded := store.Events()
+			require.Len(t, recorded, 1)
+			assert.Equal(t, audit.TypeSignup, recorded[0].Type)
+			assert.Equal(t, tt.wantOutcome, recorded[0].Outcome)
+			assert.Equal(t, tt.wantReason, recorded[0].Reason)
+			assert.Equal(t, audit.ActorAnonymous, recorded[0].Actor)
+			assert.Equal(t, "203.0.113.7", recorded[0].IP)
+			assert.Nil(t, recorded[0].UserID)
+		})
+	}
+}
+
+func TestHeader(t *testing.T) {
+	req := events.APIGatewayV2HTTPRequest{Headers: map[string]string{"X-Captcha-Token": "a"}}
+	assert.Equal(t, "a", header(req, "x-captcha-token"))
+	assert.Equal(t, "", header(req, "Authorization"))
+}
+
 func TestSignupHandler_Handle_EmptyBody(t *testing.T) {
 	mockService := new(MockSignupService)
 	handler := NewSignupHandlerWithService(mockService)
@@ -310,3 +466,22 @@ func TestErrorResponse(t *testing.T) {
 func NewSignupHandlerWithService(service testhelpers.SignupServiceInterface) *SignupHandler {
 	return NewSignupHandlerWithInterface(service)
 }
+
+func TestSignupHandler_Handle_TrimsName(t *testing.T) {
+	mockService := new(MockSignupService)
+	handler := NewSignupHandlerWithService(mockService)
+
+	ctx := context.Background()
+	req := newRequest("POST", "/auth/sign-up", `{"name": "  John Doe ", "email": "john@example.com"}`)
+
+	mockService.On("Signup", ctx, "John Doe", "john@example.com").Return(&models.SignupOutcome{
+		User:   &models.User{ID: 1, Name: "John Doe", Email: "john@example.com"},
+		Status: models.SignupStatusPendingConfirmation,
+	}, nil)
+
+	resp, err := handler.Handle(ctx, req)
+
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	mockService.AssertExpectations(t)
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"services/auth/internal/apispec"
+	"services/auth/internal/models"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// RequestValidator checks request bodies against the OpenAPI document.
+type RequestValidator interface {
+	ValidateRequestBody(method, path string, body []byte) error
+}
+
+// ValidateRequests rejects request bodies that do not match the OpenAPI
+// document before they reach the route handler: malformed JSON is answered
+// with invalid_request and schema violations with validation_failed.
+func ValidateRequests(validator RequestValidator) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+			err := validator.ValidateRequestBody(req.RequestContext.HTTP.Method, req.RawPath, []byte(req.Body))
+			if err == nil {
+				return next(ctx, req)
+			}
+
+			var validationErr *apispec.ValidationError
+			switch {
+			case errors.As(err, &validationErr):
+				return jsonResponse(400, models.ErrorResponse{
+					Code:    "validation_failed",
+					Message: "Request validation failed",
+					Fields:  validationErr.Fields,
+				}), nil
+			case errors.Is(err, apispec.ErrInvalidJSON):
+				return errorResponse(400, "invalid_request", "Invalid request body"), nil
+			default:
+				log.Printf("❌ Request validation error: %v", err)
+				return errorResponse(500, "internal_error", "Internal server error"), nil
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"services/auth/internal/apispec"
+	"services/auth/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newValidatingRouter(t *testing.T, status int) *Router {
+	t.Helper()
+	spec, err := apispec.Load()
+	require.NoError(t, err)
+
+	router := NewRouter()
+	router.Use(ValidateRequests(spec))
+	router.Handle("POST", "/auth/sign-up", staticHandler(status))
+	return router
+}
+
+func TestValidateRequests_ValidBody(t *testing.T) {
+	router := newValidatingRouter(t, 200)
+
+	resp, err := router.Dispatch(context.Background(), newRequest("POST", "/auth/sign-up", `{"name":"João Silva","email":"joao@example.com"}`))
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+}
+
+func TestValidateRequests_FieldErrors(t *testing.T) {
+	router := newValidatingRouter(t, 200)
+
+	resp, err := router.Dispatch(context.Background(), newRequest("POST", "/auth/sign-up", `{"name":"x","email":"not-an-email"}`))
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+
+	var errorResp models.ErrorResponse
+	require.NoError(t, json.Unmarshal([]byte(resp.Body), &errorResp))
+	assert.Equal(t, "validation_failed", errorResp.Code)
+	require.Len(t, errorResp.Fields, 2)
+	assert.Equal(t, "email", errorResp.Fields[0].Field)
+	assert.Equal(t, apispec.FieldInvalidFormat, errorResp.Fields[0].Code)
+	assert.Equal(t, "name", errorResp.Fields[1].Field)
+	assert.Equal(t, apispec.FieldTooShort, errorResp.Fields[1].Code)
+	assert.Equal(t, float64(2), errorResp.Fields[1].Params["min"])
+}
+
+func TestValidateRequests_InvalidJSON(t *testing.T) {
+	router := newValidatingRouter(t, 200)
+
+	resp, err := router.Dispatch(context.Background(), newRequest("POST", "/auth/sign-up", `{invalid`))
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+
+	var errorResp models.ErrorResponse
+	require.NoError(t, json.Unmarshal([]byte(resp.Body), &errorResp))
+	assert.Equal(t, "invalid_request", errorResp.Code)
+	assert.Empty(t, errorResp.Fields)
+}
+
+type validatorFunc func(method, path string, body []byte) error
+
+func (f validatorFunc) ValidateRequestBody(method, path string, body []byte) error {
+	return f(method, path, body)
+}
+
+func TestValidateRequests_UnexpectedError(t *testing.T) {
+	router := NewRouter()
+	router.Use(ValidateRequests(validatorFunc(func(string, string, []byte) error {
+		return errors.New("boom")
+	})))
+	router.Handle("POST", "/auth/sign-up", staticHandler(200))
+
+	resp, err := router.Dispatch(context.Background(), newRequest("POST", "/auth/sign-up", `{}`))
+	require.NoError(t, err)
+	assert.Equal(t, 500, resp.StatusCode)
+}
@@ -0,0 +1,183 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"services/auth/migrations"
+)
+
+// DefaultTimeout bounds each dependency check.
+const DefaultTimeout = 2 * time.Second
+
+// Status is the state of the service or of a single dependency.
+type Status string
+
+const (
+	StatusOK   Status = "ok"
+	StatusFail Status = "fail"
+)
+
+// Check is a named dependency check. Run must return an error that is safe to
+// expose to clients; detailed causes should be logged by the check itself.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// CheckResult is the outcome of a single dependency check.
+type CheckResult struct {
+	Status    Status `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Report is the aggregated readiness state of the service.
+type Report struct {
+	Status Status                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// Service runs the readiness checks.
+type Service struct {
+	checks  []Check
+	timeout time.Duration
+}
+
+// NewService creates a Service that runs checks concurrently, each bounded by timeout.
+func NewService(timeout time.Duration, checks ...Check) *Service {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Service{checks: checks, timeout: timeout}
+}
+
+// Ready runs every check and reports StatusOK only when all of them pass.
+func (s *Service) Ready(ctx context.Context) Report {
+	report := Report{
+		Status: StatusOK,
+		Checks: make(map[string]CheckResult, len(s.checks)),
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, check := range s.checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+			result := s.run(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[check.Name] = result
+			if result.Status != StatusOK {
+				report.Status = StatusFail
+			}
+		}(check)
+	}
+	wg.Wait()
+
+	return report
+}
+
+func (s *Service) run(ctx context.Context, check Check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Run(ctx)
+	result := CheckResult{
+		Status:    StatusOK,
+		LatencyMs: time.Since(start).Milliseconds(),
+	}
+
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+		if errors.Is(err, context.DeadlineExceeded) {
+			result.Error = fmt.Sprintf("timed out after %s", s.timeout)
+		}
+	}
+	return result
+}
+
+// Pinger is implemented by dependencies that support a cheap liveness call.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// PostgresCheck pings the database connection pool.
+func PostgresCheck(db Pinger) Check {
+	return pingCheck("postgres", db)
+}
+
+// PostgresReplicaCheck pings the read replica connection pool.
+func PostgresReplicaCheck(db Pinger) Check {
+	return pingCheck("postgres_replica", db)
+}
+
+func pingCheck(name string, db Pinger) Check {
+	return Check{
+		Name: name,
+		Run: func(ctx context.Context) error {
+			if err := db.Ping(ctx); err != nil {
+				log.Printf("Readiness: %s ping failed: %v", name, err)
+				if errors.Is(err, context.DeadlineExceeded) {
+					return err
+				}
+				return errors.New("ping failed")
+			}
+			return nil
+		},
+	}
+}
+
+// MigrationsCheck verifies that the schema is at the expected migration version.
+func MigrationsCheck(db migrations.Querier, expected uint) Check {
+	return Check{
+		Name: "migrations",
+		Run: func(ctx context.Context) error {
+			version, dirty, err := migrations.CurrentVersion(ctx, db)
+			if err != nil {
+				log.Printf("Readiness: failed to read schema version: %v", err)
+				if errors.Is(err, migrations.ErrNoSchemaVersion) {
+					return err
+				}
+				return errors.New("failed to read schema version")
+			}
+			if dirty {
+				return fmt.Errorf("schema version %d is dirty", version)
+			}
+			if version != expected {
+				return fmt.Errorf("schema at version %d, expected %d", version, expected)
+			}
+			return nil
+		},
+	}
+}
+
+// CognitoCheck performs a cheap call against the identity provider.
+func CognitoCheck(client Pinger) Check {
+	return Check{
+		Name: "cognito",
+		Run: func(ctx context.Context) error {
+			if err := client.Ping(ctx); err != nil {
+				log.Printf("Readiness: cognito check failed: %v", err)
+				if errors.Is(err, context.DeadlineExceeded) {
+					return err
+				}
+				return errors.New("describe user pool client failed")
+			}
+			return nil
+		},
+	}
+}
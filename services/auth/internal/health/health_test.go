@@ -0,0 +1,115 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type pingFunc func(ctx context.Context) error
+
+func (f pingFunc) Ping(ctx context.Context) error { return f(ctx) }
+
+type fakeRow struct {
+	version int64
+	dirty   bool
+	err     error
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	*dest[0].(*int64) = r.version
+	*dest[1].(*bool) = r.dirty
+	return nil
+}
+
+type fakeQuerier struct{ row fakeRow }
+
+func (q fakeQuerier) QueryRow(_ context.Context, _ string, _ ...any) pgx.Row { return q.row }
+
+func TestService_Ready_AllPass(t *testing.T) {
+	ok := pingFunc(func(context.Context) error { return nil })
+	service := NewService(time.Second, PostgresCheck(ok), CognitoCheck(ok))
+
+	report := service.Ready(context.Background())
+
+	assert.Equal(t, StatusOK, report.Status)
+	require.Len(t, report.Checks, 2)
+	assert.Equal(t, StatusOK, report.Checks["postgres"].Status)
+	assert.Equal(t, StatusOK, report.Checks["cognito"].Status)
+	assert.Empty(t, report.Checks["cognito"].Error)
+}
+
+func TestService_Ready_FailureHidesCause(t *testing.T) {
+	failing := pingFunc(func(context.Context) error {
+		return errors.New("failed to connect to user=admin host=10.0.0.1")
+	})
+	service := NewService(time.Second, PostgresCheck(failing))
+
+	report := service.Ready(context.Background())
+
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, StatusFail, report.Checks["postgres"].Status)
+	assert.Equal(t, "ping failed", report.Checks["postgres"].Error)
+}
+
+func TestService_Ready_Replica(t *testing.T) {
+	ok := pingFunc(func(context.Context) error { return nil })
+	failing := pingFunc(func(context.Context) error { return errors.New("connection refused") })
+	service := NewService(time.Second, PostgresCheck(ok), PostgresReplicaCheck(failing))
+
+	report := service.Ready(context.Background())
+
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, StatusOK, report.Checks["postgres"].Status)
+	assert.Equal(t, "ping failed", report.Checks["postgres_replica"].Error)
+}
+
+func TestService_Ready_Timeout(t *testing.T) {
+	slow := pingFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	service := NewService(20*time.Millisecond, CognitoCheck(slow))
+
+	start := time.Now()
+	report := service.Ready(context.Background())
+
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, "timed out after 20ms", report.Checks["cognito"].Error)
+}
+
+func TestMigrationsCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		row     fakeRow
+		wantErr string
+	}{
+		{name: "up to date", row: fakeRow{version: 3}},
+		{name: "behind", row: fakeRow{version: 2}, wantErr: "schema at version 2, expected 3"},
+		{name: "dirty", row: fakeRow{version: 3, dirty: true}, wantErr: "schema version 3 is dirty"},
+		{name: "never migrated", row: fakeRow{err: pgx.ErrNoRows}, wantErr: "no migration has been applied"},
+		{name: "query error", row: fakeRow{err: errors.New("relation does not exist")}, wantErr: "failed to read schema version"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := MigrationsCheck(fakeQuerier{row: tt.row}, 3)
+			err := check.Run(context.Background())
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, tt.wantErr, err.Error())
+		})
+	}
+}
@@ -0,0 +1,73 @@
+// Package idempotency stores the responses of mutating requests by their
+// Idempotency-Key so retries replay the first response instead of running
+// the operation again.
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+const (
+	// RecordTTL is how long a completed response is replayed for its key.
+	RecordTTL = 24 * time.Hour
+	// LockTimeout is how long a claimed key stays in progress before another
+	// request may take it over, e.g. after a Lambda was killed mid-request.
+	LockTimeout = time.Minute
+	// MaxKeyLength bounds the accepted Idempotency-Key header.
+	MaxKeyLength = 255
+)
+
+// Response is the stored answer to a request.
+type Response struct {
+	StatusCode int
+	Headers    map[string]string
+	Body       string
+}
+
+// Record is the state of a key claimed by an earlier request.
+type Record struct {
+	RequestHash string
+	// Response is nil while the request that claimed the key is in progress.
+	Response *Response
+}
+
+// Store keeps idempotency records by key.
+type Store interface {
+	// Claim reserves key for a request with requestHash. It returns nil when
+	// the caller now owns the key, or the record of the request that holds
+	// it. Expired records and stale locks are taken over.
+	Claim(ctx context.Context, key, requestHash string, now time.Time) (*Record, error)
+	// Complete stores the response of the request that claimed key.
+	Complete(ctx context.Context, key string, resp Response) error
+	// Release forgets key so the request can be retried from scratch.
+	Release(ctx context.Context, key string) error
+}
+
+// RequestHash fingerprints a request so a key cannot be reused for a
+// different operation or body.
+func RequestHash(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ValidKey reports whether key is a usable Idempotency-Key: 1 to
+// MaxKeyLength printable ASCII characters.
+func ValidKey(key string) bool {
+	if key == "" || len(key) > MaxKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
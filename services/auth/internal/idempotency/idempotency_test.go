@@ -0,0 +1,84 @@
+package idempotency
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestRequestHash(t *testing.T) {
+	hash := RequestHash("POST", "/auth/sign-up", []byte(`{"a":1}`))
+
+	assert.Len(t, hash, 64)
+	assert.Equal(t, hash, RequestHash("POST", "/auth/sign-up", []byte(`{"a":1}`)))
+	assert.NotEqual(t, hash, RequestHash("POST", "/auth/sign-up", []byte(`{"a":2}`)))
+	assert.NotEqual(t, hash, RequestHash("PUT", "/auth/sign-up", []byte(`{"a":1}`)))
+	assert.NotEqual(t, RequestHash("POST", "/a", []byte("b")), RequestHash("POST", "/ab", nil))
+}
+
+func TestValidKey(t *testing.T) {
+	assert.True(t, ValidKey("6f1c2a9e-3b1d-4c7e-9f5a-0d8b7e6c5a4f"))
+	assert.True(t, ValidKey(strings.Repeat("k", MaxKeyLength)))
+	assert.False(t, ValidKey(""))
+	assert.False(t, ValidKey(strings.Repeat("k", MaxKeyLength+1)))
+	assert.False(t, ValidKey("line\nbreak"))
+	assert.False(t, ValidKey("clé"))
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	record, err := store.Claim(ctx, "key-1", "hash-a", start)
+	require.NoError(t, err)
+	assert.Nil(t, record, "the first request owns the key")
+
+	record, err = store.Claim(ctx, "key-1", "hash-a", start.Add(time.Second))
+	require.NoError(t, err)
+	require.NotNil(t, record)
+	assert.Nil(t, record.Response, "the first request is still in progress")
+
+	resp := Response{StatusCode: 200, Headers: map[string]string{"Content-Type": "application/json"}, Body: `{"id":1}`}
+	require.NoError(t, store.Complete(ctx, "key-1", resp))
+
+	record, err = store.Claim(ctx, "key-1", "hash-b", start.Add(time.Hour))
+	require.NoError(t, err)
+	require.NotNil(t, record)
+	assert.Equal(t, "hash-a", record.RequestHash)
+	assert.Equal(t, &resp, record.Response)
+
+	record, err = store.Claim(ctx, "key-1", "hash-b", start.Add(RecordTTL))
+	require.NoError(t, err)
+	assert.Nil(t, record, "expired records are taken over")
+}
+
+func TestMemoryStore_StaleLock(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	_, err := store.Claim(ctx, "key-1", "hash-a", start)
+	require.NoError(t, err)
+
+	record, err := store.Claim(ctx, "key-1", "hash-a", start.Add(LockTimeout))
+	require.NoError(t, err)
+	assert.Nil(t, record)
+}
+
+func TestMemoryStore_Release(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	_, err := store.Claim(ctx, "key-1", "hash-a", start)
+	require.NoError(t, err)
+	require.NoError(t, store.Release(ctx, "key-1"))
+
+	record, err := store.Claim(ctx, "key-1", "hash-a", start)
+	require.NoError(t, err)
+	assert.Nil(t, record)
+}
@@ -0,0 +1,69 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps records in process memory. It only deduplicates retries
+// reaching the same process, so it is meant for tests.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]memoryRecord
+}
+
+type memoryRecord struct {
+	Record
+	lockedAt  time.Time
+	expiresAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]memoryRecord)}
+}
+
+// Claim implements Store.
+func (s *MemoryStore) Claim(_ context.Context, key, requestHash string, now time.Time) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.records[key]; ok {
+		expired := !now.Before(stored.expiresAt)
+		stale := stored.Response == nil && !now.Before(stored.lockedAt.Add(LockTimeout))
+		if !expired && !stale {
+			record := stored.Record
+			return &record, nil
+		}
+	}
+
+	s.records[key] = memoryRecord{
+		Record:    Record{RequestHash: requestHash},
+		lockedAt:  now,
+		expiresAt: now.Add(RecordTTL),
+	}
+	return nil, nil
+}
+
+// Complete implements Store.
+func (s *MemoryStore) Complete(_ context.Context, key string, resp Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.records[key]
+	if !ok {
+		return nil
+	}
+	stored.Response = &resp
+	s.records[key] = stored
+	return nil
+}
+
+// Release implements Store.
+func (s *MemoryStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
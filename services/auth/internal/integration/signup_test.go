@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -11,10 +12,12 @@ import (
 	"services/auth/internal/config"
 	"services/auth/internal/encryption"
 	"services/auth/internal/models"
+	"services/auth/internal/outbox"
 	"services/auth/internal/repositories"
 	"services/auth/internal/services"
 	"services/auth/internal/testhelpers"
 
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -28,7 +31,7 @@ func TestSignup_Integration_NewUser(t *testing.T) {
 	pool, cleanup := testhelpers.SetupTestDB(t)
 	defer cleanup()
 
-	testhelpers.CreateUsersTable(t, pool)
+	testhelpers.ApplyMigrations(t, pool)
 
 	// Setup Cognito client (using cognito-local if available)
 	cfg := &config.Config{
@@ -36,7 +39,8 @@ func TestSignup_Integration_NewUser(t *testing.T) {
 		CognitoClientID:     "test_client_id",
 		CognitoClientSecret: "",
 		CognitoEndpoint:     "http://localhost:9229",
-		EncryptionSecret:    "test-secret-key-1234567890123456",
+		IdentityProvider:    "cognito-local",
+		EncryptionConfig:    config.EncryptionConfig{EncryptionSecret: "test-secret-key-1234567890123456"},
 	}
 
 	cognitoClient, err := cognito.NewClient(cfg)
@@ -45,8 +49,12 @@ func TestSignup_Integration_NewUser(t *testing.T) {
 	}
 
 	// Initialize dependencies
-	userRepo := repositories.NewUserRepository(pool)
-	signupService := services.NewSignupService(userRepo, cognitoClient, cfg.EncryptionSecret)
+	userRepo := repositories.NewUserRepository(pool, encryption.SingleKey(cfg.EncryptionSecret))
+	outboxRepo := repositories.NewOutboxRepository(pool)
+	dispatcher := outbox.NewDispatcher(outboxRepo, outbox.Options{})
+	signupService := services.NewSignupService(userRepo, outboxRepo, cognitoClient,
+		services.WithDispatcher(dispatcher))
+	signupService.RegisterOutboxHandlers(dispatcher)
 
 	ctx := context.Background()
 	name := "Integration Test User"
@@ -71,14 +79,16 @@ func TestSignup_Integration_NewUser(t *testing.T) {
 	assert.Equal(t, name, result.User.Name)
 	assert.Equal(t, email, result.User.Email)
 	assert.NotNil(t, result.User.CognitoID)
-	assert.NotNil(t, result.User.TemporaryPassword)
+	assert.True(t, result.User.TemporaryPassword.Valid())
 	assert.NotZero(t, result.User.ID)
 	assert.False(t, result.User.CreatedAt.IsZero())
 
-	// Verify password can be decrypted
-	decryptedPassword, err := encryption.Decrypt(*result.User.TemporaryPassword, cfg.EncryptionSecret)
+	// Verify the stored password opens with the configured key
+	var sealed string
+	require.NoError(t, pool.QueryRow(ctx, `SELECT temporary_password FROM users WHERE id = $1`, result.User.ID).Scan(&sealed))
+	decryptedPassword, err := encryption.SingleKey(cfg.EncryptionSecret).Decrypt(ctx, sealed, repositories.UsersTemporaryPassword.Binding(int64(result.User.ID)))
 	require.NoError(t, err)
-	assert.NotEmpty(t, decryptedPassword)
+	assert.Equal(t, result.User.TemporaryPassword.Plaintext(), decryptedPassword)
 	assert.GreaterOrEqual(t, len(decryptedPassword), 32, "Password should be at least 32 characters")
 }
 
@@ -91,7 +101,7 @@ func TestSignup_Integration_DuplicateEmail(t *testing.T) {
 	pool, cleanup := testhelpers.SetupTestDB(t)
 	defer cleanup()
 
-	testhelpers.CreateUsersTable(t, pool)
+	testhelpers.ApplyMigrations(t, pool)
 
 	// Setup Cognito client
 	cfg := &config.Config{
@@ -99,7 +109,8 @@ func TestSignup_Integration_DuplicateEmail(t *testing.T) {
 		CognitoClientID:     "test_client_id",
 		CognitoClientSecret: "",
 		CognitoEndpoint:     "http://localhost:9229",
-		EncryptionSecret:    "test-secret-key-1234567890123456",
+		IdentityProvider:    "cognito-local",
+		EncryptionConfig:    config.EncryptionConfig{EncryptionSecret: "test-secret-key-1234567890123456"},
 	}
 
 	cognitoClient, err := cognito.NewClient(cfg)
@@ -107,8 +118,12 @@ func TestSignup_Integration_DuplicateEmail(t *testing.T) {
 		t.Skipf("Skipping integration test - Cognito client setup failed: %v", err)
 	}
 
-	userRepo := repositories.NewUserRepository(pool)
-	signupService := services.NewSignupService(userRepo, cognitoClient, cfg.EncryptionSecret)
+	userRepo := repositories.NewUserRepository(pool, encryption.SingleKey(cfg.EncryptionSecret))
+	outboxRepo := repositories.NewOutboxRepository(pool)
+	dispatcher := outbox.NewDispatcher(outboxRepo, outbox.Options{})
+	signupService := services.NewSignupService(userRepo, outboxRepo, cognitoClient,
+		services.WithDispatcher(dispatcher))
+	signupService.RegisterOutboxHandlers(dispatcher)
 
 	ctx := context.Background()
 	name := "Duplicate Test User"
@@ -155,7 +170,7 @@ func TestSignup_Integration_ConcurrentSignups(t *testing.T) {
 	pool, cleanup := testhelpers.SetupTestDB(t)
 	defer cleanup()
 
-	testhelpers.CreateUsersTable(t, pool)
+	testhelpers.ApplyMigrations(t, pool)
 
 	// Setup Cognito client
 	cfg := &config.Config{
@@ -163,7 +178,8 @@ func TestSignup_Integration_ConcurrentSignups(t *testing.T) {
 		CognitoClientID:     "test_client_id",
 		CognitoClientSecret: "",
 		CognitoEndpoint:     "http://localhost:9229",
-		EncryptionSecret:    "test-secret-key-1234567890123456",
+		IdentityProvider:    "cognito-local",
+		EncryptionConfig:    config.EncryptionConfig{EncryptionSecret: "test-secret-key-1234567890123456"},
 	}
 
 	cognitoClient, err := cognito.NewClient(cfg)
@@ -171,8 +187,12 @@ func TestSignup_Integration_ConcurrentSignups(t *testing.T) {
 		t.Skipf("Skipping integration test - Cognito client setup failed: %v", err)
 	}
 
-	userRepo := repositories.NewUserRepository(pool)
-	signupService := services.NewSignupService(userRepo, cognitoClient, cfg.EncryptionSecret)
+	userRepo := repositories.NewUserRepository(pool, encryption.SingleKey(cfg.EncryptionSecret))
+	outboxRepo := repositories.NewOutboxRepository(pool)
+	dispatcher := outbox.NewDispatcher(outboxRepo, outbox.Options{})
+	signupService := services.NewSignupService(userRepo, outboxRepo, cognitoClient,
+		services.WithDispatcher(dispatcher))
+	signupService.RegisterOutboxHandlers(dispatcher)
 
 	ctx := context.Background()
 	numUsers := 5
@@ -206,6 +226,129 @@ func TestSignup_Integration_ConcurrentSignups(t *testing.T) {
 	assert.LessOrEqual(t, len(errs), numUsers, "Some signups may fail due to concurrency")
 }
 
+// countingCognito is an in-process identity provider that counts the
+// accounts it creates, for asserting that concurrent sign-ups converge.
+type countingCognito struct {
+	mu      sync.Mutex
+	users   map[string]string
+	signUps int
+}
+
+func (c *countingCognito) SignUp(_ context.Context, _ int, email, _, _ string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.signUps++
+	if _, ok := c.users[email]; ok {
+		return "", &types.UsernameExistsException{}
+	}
+	sub := fmt.Sprintf("sub-%d", len(c.users)+1)
+	c.users[email] = sub
+	return sub, nil
+}
+
+func (c *countingCognito) IsUserConfirmed(_ context.Context, _ int, email string) (bool, string, string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return false, email, c.users[email], nil
+}
+
+func (c *countingCognito) ResendConfirmationCode(context.Context, string) error {
+	return nil
+}
+
+func TestSignup_Integration_ConcurrentSameEmail(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	pool, cleanup := testhelpers.SetupTestDB(t)
+	defer cleanup()
+
+	testhelpers.ApplyMigrations(t, pool)
+
+	idp := &countingCognito{users: make(map[string]string)}
+	userRepo := repositories.NewUserRepository(pool, encryption.SingleKey("test-secret-key-1234567890123456"))
+	outboxRepo := repositories.NewOutboxRepository(pool)
+	dispatcher := outbox.NewDispatcher(outboxRepo, outbox.Options{})
+	signupService := services.NewSignupServiceWithInterfaces(userRepo, outboxRepo, idp,
+		services.WithDispatcher(dispatcher))
+	signupService.RegisterOutboxHandlers(dispatcher)
+
+	ctx := context.Background()
+	const attempts = 10
+	emails := []string{"race@example.com", "Race@Example.com", " RACE@example.com "}
+
+	var wg sync.WaitGroup
+	results := make([]*services.SignupResult, attempts)
+	errs := make([]error, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = signupService.Signup(ctx, "Race User", emails[i%len(emails)])
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < attempts; i++ {
+		require.NoError(t, errs[i])
+		assert.Equal(t, models.SignupStatusPendingConfirmation, results[i].Status)
+		assert.Equal(t, results[0].User.ID, results[i].User.ID, "every request converges on one user")
+	}
+
+	// Deliver whatever the eager dispatch left behind.
+	_, err := dispatcher.RunOnce(ctx)
+	require.NoError(t, err)
+
+	var rows int
+	require.NoError(t, pool.QueryRow(ctx, `SELECT COUNT(*) FROM users WHERE normalized_email = 'race@example.com' AND cognito_id IS NOT NULL`).Scan(&rows))
+	assert.Equal(t, 1, rows)
+	assert.GreaterOrEqual(t, idp.signUps, 1)
+	assert.Len(t, idp.users, 1, "every request converges on one identity provider account")
+
+	var pending int
+	require.NoError(t, pool.QueryRow(ctx, `SELECT COUNT(*) FROM outbox WHERE processed_at IS NULL`).Scan(&pending))
+	assert.Zero(t, pending)
+}
+
+func TestSignup_Integration_OutboxRetriesLostUpdate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	pool, cleanup := testhelpers.SetupTestDB(t)
+	defer cleanup()
+
+	testhelpers.ApplyMigrations(t, pool)
+
+	idp := &countingCognito{users: make(map[string]string)}
+	userRepo := repositories.NewUserRepository(pool, encryption.SingleKey("test-secret-key-1234567890123456"))
+	outboxRepo := repositories.NewOutboxRepository(pool)
+	signupService := services.NewSignupServiceWithInterfaces(userRepo, outboxRepo, idp)
+	ctx := context.Background()
+
+	result, err := signupService.Signup(ctx, "Outbox User", "outbox@example.com")
+	require.NoError(t, err)
+	assert.Nil(t, result.User.CognitoID, "without a dispatcher the account is created later")
+
+	// The account exists but linking it to the row was lost, as when the
+	// process dies between the Cognito call and the update.
+	_, err = idp.SignUp(ctx, result.User.ID, "outbox@example.com", "password", "Outbox User")
+	require.NoError(t, err)
+
+	dispatcher := outbox.NewDispatcher(outboxRepo, outbox.Options{})
+	signupService.RegisterOutboxHandlers(dispatcher)
+	_, err = dispatcher.RunOnce(ctx)
+	require.NoError(t, err)
+
+	user, err := userRepo.FindByID(ctx, result.User.ID)
+	require.NoError(t, err)
+	require.NotNil(t, user.CognitoID)
+	assert.Equal(t, idp.users["outbox@example.com"], *user.CognitoID, "the existing account is adopted")
+	assert.Len(t, idp.users, 1)
+}
+
 func TestSignup_Integration_DatabaseConstraints(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping integration test in short mode")
@@ -215,15 +358,16 @@ func TestSignup_Integration_DatabaseConstraints(t *testing.T) {
 	pool, cleanup := testhelpers.SetupTestDB(t)
 	defer cleanup()
 
-	testhelpers.CreateUsersTable(t, pool)
+	testhelpers.ApplyMigrations(t, pool)
 
-	userRepo := repositories.NewUserRepository(pool)
+	userRepo := repositories.NewUserRepository(pool, encryption.SingleKey("test-secret-key-1234567890123456"))
 	ctx := context.Background()
 
 	// Test unique email constraint
 	user1 := &models.User{
-		Name:  "User One",
-		Email: "unique@example.com",
+		Name:            "User One",
+		Email:           "unique@example.com",
+		NormalizedEmail: "unique@example.com",
 	}
 
 	err := userRepo.Create(ctx, user1)
@@ -231,8 +375,9 @@ func TestSignup_Integration_DatabaseConstraints(t *testing.T) {
 
 	// Try to create another user with same email
 	user2 := &models.User{
-		Name:  "User Two",
-		Email: "unique@example.com",
+		Name:            "User Two",
+		Email:           "unique@example.com",
+		NormalizedEmail: "unique@example.com",
 	}
 
 	err = userRepo.Create(ctx, user2)
@@ -0,0 +1,212 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Sign-up outcomes recorded by AuthMetrics.RecordSignup.
+const (
+	SignupOutcomePendingConfirmation = "pending_confirmation"
+	SignupOutcomeUserExists          = "user_exists"
+	SignupOutcomeProviderUnavailable = "provider_unavailable"
+	SignupOutcomeEmailNotAllowed     = "email_not_allowed"
+	SignupOutcomeError               = "error"
+)
+
+// Bot check results recorded by AuthMetrics.RecordBotCheck.
+const (
+	BotCheckPassed      = "passed"
+	BotCheckMissing     = "missing"
+	BotCheckRejected    = "rejected"
+	BotCheckUnavailable = "unavailable"
+)
+
+// Outbox delivery results recorded by AuthMetrics.RecordOutboxDelivery.
+const (
+	OutboxDelivered = "delivered"
+	OutboxRetried   = "retried"
+	OutboxFailed    = "failed"
+)
+
+// AuthMetrics groups the metric families recorded by the auth service.
+type AuthMetrics struct {
+	signups          *Counter
+	signupRejections *Counter
+	rateLimited      *Counter
+	botChecks        *Counter
+	cognitoDuration  *Histogram
+	cognitoErrors    *Counter
+	cognitoRetries   *Counter
+	cognitoCircuit   *Gauge
+	outboxDeliveries *Counter
+
+	poolTotalConns      *Gauge
+	poolAcquiredConns   *Gauge
+	poolIdleConns       *Gauge
+	poolMaxConns        *Gauge
+	poolAcquires        *Counter
+	poolEmptyAcquires   *Counter
+	poolAcquireDuration *Counter
+
+	// lastPool is the pool snapshot the acquire counters were last fed
+	// from; the pool only reports cumulative totals.
+	poolMu   sync.Mutex
+	lastPool poolSnapshot
+}
+
+// poolSnapshot holds the cumulative acquire statistics of a pool.
+type poolSnapshot struct {
+	acquires        int64
+	emptyAcquires   int64
+	acquireDuration time.Duration
+}
+
+// NewAuthMetrics registers the auth service metric families in r.
+func NewAuthMetrics(r *Registry) *AuthMetrics {
+	return &AuthMetrics{
+		signups:          r.NewCounter("auth_signups_total", "Sign-up requests by outcome."),
+		signupRejections: r.NewCounter("auth_signup_rejections_total", "Sign-ups refused by the sign-up policy, by reason."),
+		rateLimited:      r.NewCounter("auth_rate_limited_total", "Requests refused by the rate limiter, by rule."),
+		botChecks:        r.NewCounter("auth_bot_checks_total", "Sign-up bot checks by result."),
+		cognitoDuration:  r.NewHistogram("auth_cognito_request_duration_ms", "Latency of Cognito API calls by operation.", UnitMilliseconds, nil),
+		cognitoErrors:    r.NewCounter("auth_cognito_errors_total", "Failed Cognito API calls by operation and error class."),
+		cognitoRetries:   r.NewCounter("auth_cognito_retries_total", "Retried Cognito API calls by operation."),
+		cognitoCircuit:   r.NewGauge("auth_cognito_circuit_open", "1 while the Cognito circuit breaker is open.", UnitCount),
+		outboxDeliveries: r.NewCounter("auth_outbox_deliveries_total", "Outbox delivery attempts by message kind and result."),
+
+		poolTotalConns:      r.NewGauge("auth_db_pool_total_conns", "Connections currently in the pool.", UnitCount),
+		poolAcquiredConns:   r.NewGauge("auth_db_pool_acquired_conns", "Connections currently checked out.", UnitCount),
+		poolIdleConns:       r.NewGauge("auth_db_pool_idle_conns", "Idle connections in the pool.", UnitCount),
+		poolMaxConns:        r.NewGauge("auth_db_pool_max_conns", "Maximum size of the pool.", UnitCount),
+		poolAcquires:        r.NewCounter("auth_db_pool_acquires_total", "Successful connection acquires."),
+		poolEmptyAcquires:   r.NewCounter("auth_db_pool_empty_acquires_total", "Acquires that had to wait for a connection."),
+		poolAcquireDuration: r.NewCounterWithUnit("auth_db_pool_acquire_duration_ms_total", "Time spent acquiring connections.", UnitMilliseconds),
+	}
+}
+
+// Auth records the auth service metrics in the Default registry.
+var Auth = NewAuthMetrics(Default)
+
+// RecordSignup counts a sign-up request with the given outcome.
+func (m *AuthMetrics) RecordSignup(outcome string) {
+	m.signups.Inc(Labels{"outcome": outcome})
+}
+
+// SignupCount returns the number of sign-ups recorded with outcome.
+func (m *AuthMetrics) SignupCount(outcome string) float64 {
+	return m.signups.Value(Labels{"outcome": outcome})
+}
+
+// RecordSignupRejection counts a sign-up refused by the sign-up policy.
+func (m *AuthMetrics) RecordSignupRejection(reason string) {
+	m.signupRejections.Inc(Labels{"reason": reason})
+}
+
+// SignupRejectionCount returns the number of rejections recorded with reason.
+func (m *AuthMetrics) SignupRejectionCount(reason string) float64 {
+	return m.signupRejections.Value(Labels{"reason": reason})
+}
+
+// RecordRateLimited counts a request refused by the rate limit rule.
+func (m *AuthMetrics) RecordRateLimited(rule string) {
+	m.rateLimited.Inc(Labels{"rule": rule})
+}
+
+// RateLimitedCount returns the number of requests refused by rule.
+func (m *AuthMetrics) RateLimitedCount(rule string) float64 {
+	return m.rateLimited.Value(Labels{"rule": rule})
+}
+
+// RecordBotCheck counts a sign-up bot check with the given result.
+func (m *AuthMetrics) RecordBotCheck(result string) {
+	m.botChecks.Inc(Labels{"result": result})
+}
+
+// BotCheckCount returns the number of bot checks recorded with result.
+func (m *AuthMetrics) BotCheckCount(result string) float64 {
+	return m.botChecks.Value(Labels{"result": result})
+}
+
+// ObserveCognitoCall records the latency of a Cognito operation and, when
+// errorClass is not empty, counts it as a failure of that class.
+func (m *AuthMetrics) ObserveCognitoCall(operation string, duration time.Duration, errorClass string) {
+	m.cognitoDuration.Observe(Labels{"operation": operation}, float64(duration.Milliseconds()))
+	if errorClass != "" {
+		m.cognitoErrors.Inc(Labels{"operation": operation, "error_class": errorClass})
+	}
+}
+
+// CognitoErrorCount returns the number of failed calls recorded for operation and errorClass.
+func (m *AuthMetrics) CognitoErrorCount(operation, errorClass string) float64 {
+	return m.cognitoErrors.Value(Labels{"operation": operation, "error_class": errorClass})
+}
+
+// RecordCognitoRetry counts a retry of a Cognito operation.
+func (m *AuthMetrics) RecordCognitoRetry(operation string) {
+	m.cognitoRetries.Inc(Labels{"operation": operation})
+}
+
+// CognitoRetryCount returns the number of retries recorded for operation.
+func (m *AuthMetrics) CognitoRetryCount(operation string) float64 {
+	return m.cognitoRetries.Value(Labels{"operation": operation})
+}
+
+// SetCognitoCircuitOpen records whether the Cognito circuit breaker is open.
+func (m *AuthMetrics) SetCognitoCircuitOpen(open bool) {
+	value := 0.0
+	if open {
+		value = 1
+	}
+	m.cognitoCircuit.Set(nil, value)
+}
+
+// CognitoCircuitOpen reports whether the circuit breaker was last recorded open.
+func (m *AuthMetrics) CognitoCircuitOpen() bool {
+	return m.cognitoCircuit.Value(nil) == 1
+}
+
+// RecordOutboxDelivery counts a delivery attempt of an outbox message.
+func (m *AuthMetrics) RecordOutboxDelivery(kind, result string) {
+	m.outboxDeliveries.Inc(Labels{"kind": kind, "result": result})
+}
+
+// OutboxDeliveryCount returns the number of deliveries recorded for kind and result.
+func (m *AuthMetrics) OutboxDeliveryCount(kind, result string) float64 {
+	return m.outboxDeliveries.Value(Labels{"kind": kind, "result": result})
+}
+
+// RecordPoolStats samples the database connection pool statistics.
+func (m *AuthMetrics) RecordPoolStats(stat *pgxpool.Stat) {
+	if stat == nil {
+		return
+	}
+	m.poolTotalConns.Set(nil, float64(stat.TotalConns()))
+	m.poolAcquiredConns.Set(nil, float64(stat.AcquiredConns()))
+	m.poolIdleConns.Set(nil, float64(stat.IdleConns()))
+	m.poolMaxConns.Set(nil, float64(stat.MaxConns()))
+	m.recordPoolAcquires(poolSnapshot{
+		acquires:        stat.AcquireCount(),
+		emptyAcquires:   stat.EmptyAcquireCount(),
+		acquireDuration: stat.AcquireDuration(),
+	})
+}
+
+// recordPoolAcquires adds the acquires since the previous snapshot to the
+// counters. A total below the previous one means the pool was replaced, so
+// the whole of it is new.
+func (m *AuthMetrics) recordPoolAcquires(current poolSnapshot) {
+	m.poolMu.Lock()
+	defer m.poolMu.Unlock()
+
+	last := m.lastPool
+	if current.acquires < last.acquires {
+		last = poolSnapshot{}
+	}
+	m.poolAcquires.Add(nil, float64(current.acquires-last.acquires))
+	m.poolEmptyAcquires.Add(nil, float64(current.emptyAcquires-last.emptyAcquires))
+	m.poolAcquireDuration.Add(nil, float64(current.acquireDuration-last.acquireDuration)/float64(time.Millisecond))
+	m.lastPool = current
+}
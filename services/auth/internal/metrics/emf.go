@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// DefaultNamespace is the CloudWatch namespace used for the auth service.
+const DefaultNamespace = "Spendflix/Auth"
+
+type emfMetric struct {
+	Name string `json:"Name"`
+	Unit Unit   `json:"Unit"`
+}
+
+type emfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+// emfSamples is the EMF form of a histogram: each distinct value with the
+// number of times it was observed.
+type emfSamples struct {
+	Values []float64 `json:"Values"`
+	Counts []float64 `json:"Counts"`
+}
+
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+// WriteEMF writes the metrics recorded since the previous flush as CloudWatch
+// Embedded Metric Format documents, one JSON line per series. Counters are
+// emitted as deltas and histograms as their distinct samples with counts, so
+// both are reset after being written; gauges are emitted with their current
+// value. See maxPendingSamples for the samples a histogram keeps.
+func (r *Registry) WriteEMF(w io.Writer, namespace string) error {
+	r.collect()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UnixMilli()
+	enc := json.NewEncoder(w)
+
+	for _, f := range r.families {
+		for _, s := range f.sortedSeries() {
+			var value any
+			switch f.kind {
+			case kindCounter:
+				if s.pending == 0 {
+					continue
+				}
+				value = s.pending
+				s.pending = 0
+			case kindGauge:
+				value = s.value
+			case kindHistogram:
+				if len(s.samples) == 0 {
+					continue
+				}
+				value = emfSamples{Values: s.samples, Counts: s.sampleCounts}
+				s.samples, s.sampleCounts = nil, nil
+			}
+
+			doc := make(map[string]any, len(s.labels)+2)
+			for k, v := range s.labels {
+				doc[k] = v
+			}
+			doc[f.name] = value
+			doc["_aws"] = emfMetadata{
+				Timestamp: now,
+				CloudWatchMetrics: []emfDirective{{
+					Namespace:  namespace,
+					Dimensions: [][]string{sortedKeys(s.labels)},
+					Metrics:    []emfMetric{{Name: f.name, Unit: f.unit}},
+				}},
+			}
+
+			if err := enc.Encode(doc); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
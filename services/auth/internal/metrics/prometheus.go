@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// prometheusContentType is the content type of the text exposition format.
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// WritePrometheus writes every family in the Prometheus text exposition format.
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	r.collect()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, f := range r.families {
+		if len(f.series) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(bw, "# HELP %s %s\n", f.name, f.help)
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.name, prometheusType(f.kind))
+
+		for _, s := range f.sortedSeries() {
+			switch f.kind {
+			case kindCounter, kindGauge:
+				fmt.Fprintf(bw, "%s%s %s\n", f.name, formatLabels(s.labels, "", ""), formatFloat(s.value))
+			case kindHistogram:
+				for i, upper := range f.buckets {
+					fmt.Fprintf(bw, "%s_bucket%s %d\n", f.name, formatLabels(s.labels, "le", formatFloat(upper)), s.bucketCounts[i])
+				}
+				fmt.Fprintf(bw, "%s_bucket%s %d\n", f.name, formatLabels(s.labels, "le", "+Inf"), s.count)
+				fmt.Fprintf(bw, "%s_sum%s %s\n", f.name, formatLabels(s.labels, "", ""), formatFloat(s.sum))
+				fmt.Fprintf(bw, "%s_count%s %d\n", f.name, formatLabels(s.labels, "", ""), s.count)
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+// Handler serves the registry in the Prometheus text format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", prometheusContentType)
+		if err := r.WritePrometheus(w); err != nil {
+			log.Printf("Failed to write metrics: %v", err)
+		}
+	})
+}
+
+func prometheusType(k kind) string {
+	switch k {
+	case kindCounter:
+		return "counter"
+	case kindGauge:
+		return "gauge"
+	default:
+		return "histogram"
+	}
+}
+
+// formatLabels renders labels as {k="v",...}, optionally appending an extra label.
+func formatLabels(labels Labels, extraKey, extraValue string) string {
+	if len(labels) == 0 && extraKey == "" {
+		return ""
+	}
+
+	parts := make([]string, 0, len(labels)+1)
+	for _, k := range sortedKeys(labels) {
+		parts = append(parts, fmt.Sprintf("%s=%q", k, escapeLabelValue(labels[k])))
+	}
+	if extraKey != "" {
+		parts = append(parts, fmt.Sprintf("%s=%q", extraKey, extraValue))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// escapeLabelValue strips characters that %q would escape differently from Prometheus.
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer("\n", " ", "\r", " ").Replace(v)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,308 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Unit is the CloudWatch unit attached to a metric when it is emitted as EMF.
+type Unit string
+
+const (
+	UnitCount        Unit = "Count"
+	UnitMilliseconds Unit = "Milliseconds"
+	UnitNone         Unit = "None"
+)
+
+// maxPendingSamples is the maximum number of distinct values CloudWatch
+// accepts for a single metric in one EMF document. Histograms keep up to that
+// many distinct values between flushes, each with the number of times it was
+// observed; observations of further values are left out of the next EMF
+// document and counted in droppedSamplesName, though the Prometheus buckets,
+// sum and count still include them.
+const maxPendingSamples = 100
+
+// droppedSamplesName counts, by histogram, the samples left out of EMF.
+const droppedSamplesName = "metrics_emf_dropped_samples_total"
+
+// DefaultBuckets are the histogram upper bounds (in milliseconds) used for latencies.
+var DefaultBuckets = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// Labels are the dimensions of a single series.
+type Labels map[string]string
+
+type kind int
+
+const (
+	kindCounter kind = iota
+	kindGauge
+	kindHistogram
+)
+
+type family struct {
+	name    string
+	help    string
+	kind    kind
+	unit    Unit
+	buckets []float64
+	series  map[string]*series
+}
+
+type series struct {
+	labels Labels
+	// value holds the cumulative counter total or the current gauge value.
+	value float64
+	// pending holds the counter delta since the last EMF flush.
+	pending float64
+	// Histogram state.
+	bucketCounts []uint64
+	sum          float64
+	count        uint64
+	// samples and sampleCounts hold the distinct values observed since the
+	// last EMF flush and how often each was seen.
+	samples      []float64
+	sampleCounts []float64
+}
+
+// Registry stores metric families and the series recorded for them.
+type Registry struct {
+	mu         sync.Mutex
+	families   []*family
+	byName     map[string]*family
+	collectors []func()
+	dropped    *family
+}
+
+// NewRegistry creates a registry holding only the count of dropped samples.
+func NewRegistry() *Registry {
+	r := &Registry{byName: make(map[string]*family)}
+	r.dropped = r.register(droppedSamplesName, "Histogram samples left out of EMF documents, by metric.", kindCounter, UnitCount, nil)
+	return r
+}
+
+// Default is the process-wide registry used by the service.
+var Default = NewRegistry()
+
+// OnCollect registers a function that is run before every scrape or flush,
+// typically to sample gauges such as connection pool statistics.
+func (r *Registry) OnCollect(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, fn)
+}
+
+func (r *Registry) collect() {
+	r.mu.Lock()
+	collectors := append([]func(){}, r.collectors...)
+	r.mu.Unlock()
+
+	for _, fn := range collectors {
+		fn()
+	}
+}
+
+func (r *Registry) register(name, help string, k kind, unit Unit, buckets []float64) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if f, ok := r.byName[name]; ok {
+		return f
+	}
+
+	f := &family{
+		name:    name,
+		help:    help,
+		kind:    k,
+		unit:    unit,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	r.families = append(r.families, f)
+	r.byName[name] = f
+	return f
+}
+
+// seriesFor returns the series for labels, creating it if needed. Callers must hold r.mu.
+func (f *family) seriesFor(labels Labels) *series {
+	key := labelKey(labels)
+	s, ok := f.series[key]
+	if !ok {
+		copied := make(Labels, len(labels))
+		for k, v := range labels {
+			copied[k] = v
+		}
+		s = &series{labels: copied}
+		if f.kind == kindHistogram {
+			s.bucketCounts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Counter is a monotonically increasing metric.
+type Counter struct {
+	registry *Registry
+	family   *family
+}
+
+// NewCounter registers a counter family.
+func (r *Registry) NewCounter(name, help string) *Counter {
+	return r.NewCounterWithUnit(name, help, UnitCount)
+}
+
+// NewCounterWithUnit registers a counter family of a quantity other than a
+// count, such as cumulative time.
+func (r *Registry) NewCounterWithUnit(name, help string, unit Unit) *Counter {
+	return &Counter{registry: r, family: r.register(name, help, kindCounter, unit, nil)}
+}
+
+// Inc increments the counter for labels by one.
+func (c *Counter) Inc(labels Labels) {
+	c.Add(labels, 1)
+}
+
+// Add increments the counter for labels by v. Negative values are ignored.
+func (c *Counter) Add(labels Labels, v float64) {
+	if v < 0 {
+		return
+	}
+	c.registry.mu.Lock()
+	defer c.registry.mu.Unlock()
+
+	s := c.family.seriesFor(labels)
+	s.value += v
+	s.pending += v
+}
+
+// Value returns the cumulative value recorded for labels.
+func (c *Counter) Value(labels Labels) float64 {
+	c.registry.mu.Lock()
+	defer c.registry.mu.Unlock()
+
+	if s, ok := c.family.series[labelKey(labels)]; ok {
+		return s.value
+	}
+	return 0
+}
+
+// Gauge is a metric that can go up and down.
+type Gauge struct {
+	registry *Registry
+	family   *family
+}
+
+// NewGauge registers a gauge family.
+func (r *Registry) NewGauge(name, help string, unit Unit) *Gauge {
+	return &Gauge{registry: r, family: r.register(name, help, kindGauge, unit, nil)}
+}
+
+// Set sets the gauge for labels to v.
+func (g *Gauge) Set(labels Labels, v float64) {
+	g.registry.mu.Lock()
+	defer g.registry.mu.Unlock()
+
+	g.family.seriesFor(labels).value = v
+}
+
+// Value returns the current value recorded for labels.
+func (g *Gauge) Value(labels Labels) float64 {
+	g.registry.mu.Lock()
+	defer g.registry.mu.Unlock()
+
+	if s, ok := g.family.series[labelKey(labels)]; ok {
+		return s.value
+	}
+	return 0
+}
+
+// Histogram samples observations into buckets.
+type Histogram struct {
+	registry *Registry
+	family   *family
+}
+
+// NewHistogram registers a histogram family. Nil buckets fall back to DefaultBuckets.
+func (r *Registry) NewHistogram(name, help string, unit Unit, buckets []float64) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	return &Histogram{registry: r, family: r.register(name, help, kindHistogram, unit, buckets)}
+}
+
+// Observe records v for labels.
+func (h *Histogram) Observe(labels Labels, v float64) {
+	h.registry.mu.Lock()
+	defer h.registry.mu.Unlock()
+
+	s := h.family.seriesFor(labels)
+	for i, upper := range h.family.buckets {
+		if v <= upper {
+			s.bucketCounts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+
+	for i, sample := range s.samples {
+		if sample == v {
+			s.sampleCounts[i]++
+			return
+		}
+	}
+	if len(s.samples) < maxPendingSamples {
+		s.samples = append(s.samples, v)
+		s.sampleCounts = append(s.sampleCounts, 1)
+		return
+	}
+	dropped := h.registry.dropped.seriesFor(Labels{"metric": h.family.name})
+	dropped.value++
+	dropped.pending++
+}
+
+// Count returns the number of observations recorded for labels.
+func (h *Histogram) Count(labels Labels) uint64 {
+	h.registry.mu.Lock()
+	defer h.registry.mu.Unlock()
+
+	if s, ok := h.family.series[labelKey(labels)]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func sortedKeys(labels Labels) []string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func labelKey(labels Labels) string {
+	var b strings.Builder
+	for _, k := range sortedKeys(labels) {
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(labels[k])
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// sortedSeries returns the series of a family in a stable order. Callers must hold r.mu.
+func (f *family) sortedSeries() []*series {
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make([]*series, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, f.series[k])
+	}
+	return out
+}
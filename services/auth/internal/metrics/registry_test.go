@@ -0,0 +1,187 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	reg := NewRegistry()
+	counter := reg.NewCounter("test_requests_total", "Requests.")
+	gauge := reg.NewGauge("test_conns", "Connections.", UnitCount)
+	histogram := reg.NewHistogram("test_latency_ms", "Latency.", UnitMilliseconds, []float64{10, 100})
+
+	counter.Inc(Labels{"outcome": "ok"})
+	counter.Add(Labels{"outcome": "ok"}, 2)
+	gauge.Set(nil, 4)
+	histogram.Observe(Labels{"operation": "SignUp"}, 5)
+	histogram.Observe(Labels{"operation": "SignUp"}, 50)
+	histogram.Observe(Labels{"operation": "SignUp"}, 500)
+
+	var buf bytes.Buffer
+	require.NoError(t, reg.WritePrometheus(&buf))
+	out := buf.String()
+
+	assert.Contains(t, out, "# TYPE test_requests_total counter\n")
+	assert.Contains(t, out, `test_requests_total{outcome="ok"} 3`)
+	assert.Contains(t, out, "test_conns 4\n")
+	assert.Contains(t, out, "# TYPE test_latency_ms histogram\n")
+	assert.Contains(t, out, `test_latency_ms_bucket{operation="SignUp",le="10"} 1`)
+	assert.Contains(t, out, `test_latency_ms_bucket{operation="SignUp",le="100"} 2`)
+	assert.Contains(t, out, `test_latency_ms_bucket{operation="SignUp",le="+Inf"} 3`)
+	assert.Contains(t, out, `test_latency_ms_sum{operation="SignUp"} 555`)
+	assert.Contains(t, out, `test_latency_ms_count{operation="SignUp"} 3`)
+}
+
+func TestWritePrometheus_RunsCollectors(t *testing.T) {
+	reg := NewRegistry()
+	gauge := reg.NewGauge("test_sampled", "Sampled on collect.", UnitCount)
+	reg.OnCollect(func() { gauge.Set(nil, 7) })
+
+	var buf bytes.Buffer
+	require.NoError(t, reg.WritePrometheus(&buf))
+	assert.Contains(t, buf.String(), "test_sampled 7\n")
+}
+
+func TestHandler(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounter("test_total", "Total.").Inc(nil)
+
+	rec := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, rec.Body.String(), "test_total 1\n")
+}
+
+func decodeEMF(t *testing.T, data []byte) []map[string]any {
+	t.Helper()
+
+	var docs []map[string]any
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var doc map[string]any
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &doc))
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+func TestWriteEMF(t *testing.T) {
+	reg := NewRegistry()
+	counter := reg.NewCounter("test_signups_total", "Sign-ups.")
+	histogram := reg.NewHistogram("test_latency_ms", "Latency.", UnitMilliseconds, nil)
+
+	counter.Add(Labels{"outcome": "user_exists"}, 2)
+	histogram.Observe(Labels{"operation": "SignUp"}, 12)
+	histogram.Observe(Labels{"operation": "SignUp"}, 30)
+
+	var buf bytes.Buffer
+	require.NoError(t, reg.WriteEMF(&buf, "Test/Namespace"))
+
+	docs := decodeEMF(t, buf.Bytes())
+	require.Len(t, docs, 2)
+
+	signups := docs[0]
+	assert.Equal(t, "user_exists", signups["outcome"])
+	assert.InDelta(t, 2, signups["test_signups_total"], 0)
+
+	meta := signups["_aws"].(map[string]any)
+	assert.InDelta(t, time.Now().UnixMilli(), meta["Timestamp"], 60000)
+	directive := meta["CloudWatchMetrics"].([]any)[0].(map[string]any)
+	assert.Equal(t, "Test/Namespace", directive["Namespace"])
+	assert.Equal(t, []any{[]any{"outcome"}}, directive["Dimensions"])
+	assert.Equal(t, []any{map[string]any{"Name": "test_signups_total", "Unit": "Count"}}, directive["Metrics"])
+
+	latency := docs[1]
+	assert.Equal(t, map[string]any{"Values": []any{12.0, 30.0}, "Counts": []any{1.0, 1.0}}, latency["test_latency_ms"])
+}
+
+func TestWriteEMF_AggregatesSamples(t *testing.T) {
+	reg := NewRegistry()
+	histogram := reg.NewHistogram("test_latency_ms", "Latency.", UnitMilliseconds, nil)
+
+	for i := range maxPendingSamples + 5 {
+		histogram.Observe(nil, float64(i))
+		histogram.Observe(nil, float64(i))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, reg.WriteEMF(&buf, DefaultNamespace))
+	docs := decodeEMF(t, buf.Bytes())
+	require.Len(t, docs, 2)
+
+	dropped := docs[0]
+	assert.Equal(t, "test_latency_ms", dropped["metric"])
+	assert.InDelta(t, 10, dropped[droppedSamplesName], 0, "values beyond the cap are counted")
+
+	samples := docs[1]["test_latency_ms"].(map[string]any)
+	assert.Len(t, samples["Values"], maxPendingSamples)
+	assert.Equal(t, 2.0, samples["Counts"].([]any)[0], "repeated values are aggregated")
+
+	// Prometheus still sees every observation.
+	assert.Equal(t, uint64(2*(maxPendingSamples+5)), histogram.Count(nil))
+}
+
+func TestWriteEMF_ResetsDeltasBetweenFlushes(t *testing.T) {
+	reg := NewRegistry()
+	counter := reg.NewCounter("test_total", "Total.")
+	counter.Inc(nil)
+
+	var first bytes.Buffer
+	require.NoError(t, reg.WriteEMF(&first, DefaultNamespace))
+	assert.Len(t, decodeEMF(t, first.Bytes()), 1)
+
+	var second bytes.Buffer
+	require.NoError(t, reg.WriteEMF(&second, DefaultNamespace))
+	assert.Empty(t, second.String(), "no new observations should emit nothing")
+
+	// Prometheus totals remain cumulative.
+	assert.InDelta(t, 1, counter.Value(nil), 0)
+}
+
+func TestAuthMetrics(t *testing.T) {
+	m := NewAuthMetrics(NewRegistry())
+
+	m.RecordSignup(SignupOutcomePendingConfirmation)
+	m.RecordSignup(SignupOutcomePendingConfirmation)
+	m.RecordSignup(SignupOutcomeUserExists)
+	m.ObserveCognitoCall("SignUp", 20*time.Millisecond, "")
+	m.ObserveCognitoCall("SignUp", 40*time.Millisecond, "TooManyRequestsException")
+
+	assert.InDelta(t, 2, m.SignupCount(SignupOutcomePendingConfirmation), 0)
+	assert.InDelta(t, 1, m.SignupCount(SignupOutcomeUserExists), 0)
+	assert.InDelta(t, 0, m.SignupCount(SignupOutcomeProviderUnavailable), 0)
+	assert.Equal(t, uint64(2), m.cognitoDuration.Count(Labels{"operation": "SignUp"}))
+	assert.InDelta(t, 1, m.CognitoErrorCount("SignUp", "TooManyRequestsException"), 0)
+}
+
+func TestAuthMetrics_RecordPoolAcquires(t *testing.T) {
+	m := NewAuthMetrics(NewRegistry())
+
+	m.recordPoolAcquires(poolSnapshot{acquires: 10, emptyAcquires: 2, acquireDuration: 30 * time.Millisecond})
+	m.recordPoolAcquires(poolSnapshot{acquires: 15, emptyAcquires: 2, acquireDuration: 45 * time.Millisecond})
+	assert.InDelta(t, 15, m.poolAcquires.Value(nil), 0)
+	assert.InDelta(t, 2, m.poolEmptyAcquires.Value(nil), 0)
+	assert.InDelta(t, 45, m.poolAcquireDuration.Value(nil), 1e-9)
+
+	// A new pool starts its totals over
+	m.recordPoolAcquires(poolSnapshot{acquires: 3, emptyAcquires: 1, acquireDuration: 5 * time.Millisecond})
+	assert.InDelta(t, 18, m.poolAcquires.Value(nil), 0)
+	assert.InDelta(t, 3, m.poolEmptyAcquires.Value(nil), 0)
+	assert.InDelta(t, 50, m.poolAcquireDuration.Value(nil), 1e-9)
+}
+
+func TestAuthMetrics_RecordPoolStats_Nil(t *testing.T) {
+	m := NewAuthMetrics(NewRegistry())
+	assert.NotPanics(t, func() { m.RecordPoolStats(nil) })
+}
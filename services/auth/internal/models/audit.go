@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Audit holds the columns every entity table has. Repositories fill them on
+// every write and hide soft deleted rows from lookups.
+type Audit struct {
+	// CreatedBy and UpdatedBy are the actors of the first and latest write
+	// (see repositories.WithActor).
+	CreatedBy string `db:"created_by"`
+	UpdatedBy string `db:"updated_by"`
+	// DeletedAt is set while the row is soft deleted, until it is restored
+	// or purged.
+	DeletedAt *time.Time `db:"deleted_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// EmailListEntry is a pattern of the email allowlist or blocklist: a full
+// address (user@example.com) in its canonical form (see emailaddr.Normalizer)
+// or a domain (example.com), which also covers its subdomains, lowercase with
+// punycode domains.
+type EmailListEntry struct {
+	ID        int       `db:"id"`
+	Pattern   string    `db:"pattern"`
+	Note      *string   `db:"note"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+	Audit
+}
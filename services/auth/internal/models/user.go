@@ -1,15 +1,23 @@
 package models
 
-import "time"
+import (
+	"services/auth/internal/audit"
+	"services/auth/internal/encryption"
+	"time"
+)
 
 type User struct {
-	ID                int       `db:"id"`
-	Name              string    `db:"name"`
-	Email             string    `db:"email"`
-	TemporaryPassword *string   `db:"temporary_password"`
-	CognitoID         *string   `db:"cognito_id"`
-	CreatedAt         time.Time `db:"created_at"`
-	UpdatedAt         time.Time `db:"updated_at"`
+	ID    int    `db:"id"`
+	Name  string `db:"name"`
+	Email string `db:"email"`
+	// NormalizedEmail is the canonical identity of Email (see internal/emailaddr).
+	NormalizedEmail string `db:"normalized_email"`
+	// TemporaryPassword is stored encrypted (see repositories.EncryptedColumns).
+	TemporaryPassword encryption.Field `db:"temporary_password"`
+	CognitoID         *string          `db:"cognito_id"`
+	CreatedAt         time.Time        `db:"created_at"`
+	UpdatedAt         time.Time        `db:"updated_at"`
+	Audit
 }
 
 type SignupRequest struct {
@@ -19,10 +27,9 @@ type SignupRequest struct {
 
 type SignupStatus string
 
-const (
-	SignupStatusCreated             SignupStatus = "created"
-	SignupStatusPendingConfirmation SignupStatus = "pending_confirmation"
-)
+// SignupStatusPendingConfirmation is the only status returned by sign-up: every
+// new account must confirm its email before logging in.
+const SignupStatusPendingConfirmation SignupStatus = "pending_confirmation"
 
 type SignupOutcome struct {
 	User   *User        `json:"user"`
@@ -36,7 +43,24 @@ type SignupResponse struct {
 	Status SignupStatus `json:"status"`
 }
 
+// ActivityResponse is a page of the audit events of the signed-in user.
+type ActivityResponse struct {
+	Events []audit.Event `json:"events"`
+	// NextCursor fetches the following page; it is omitted on the last one.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
 type ErrorResponse struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
+	// Fields lists the invalid request fields of a validation_failed error.
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError describes why a single request field was rejected.
+type FieldError struct {
+	Field   string         `json:"field"`
+	Code    string         `json:"code"`
+	Message string         `json:"message"`
+	Params  map[string]any `json:"params,omitempty"`
 }
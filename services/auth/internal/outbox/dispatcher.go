@@ -0,0 +1,153 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"services/auth/internal/metrics"
+	"time"
+)
+
+// Options tune a Dispatcher. Zero values take the defaults below.
+type Options struct {
+	// BatchSize bounds the messages claimed per poll. Defaults to 20.
+	BatchSize int
+	// MaxAttempts is the number of deliveries before a message fails.
+	// Defaults to 10.
+	MaxAttempts int
+	// BaseBackoff is the delay before the first retry, doubled for each
+	// further attempt. Defaults to 5s.
+	BaseBackoff time.Duration
+	// MaxBackoff caps the retry delay. Defaults to 1h.
+	MaxBackoff time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.BatchSize <= 0 {
+		o.BatchSize = 20
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 10
+	}
+	if o.BaseBackoff <= 0 {
+		o.BaseBackoff = 5 * time.Second
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = time.Hour
+	}
+	return o
+}
+
+// Backoff returns the delay before retrying a message that failed its
+// attempts-th delivery.
+func (o Options) Backoff(attempts int) time.Duration {
+	delay := o.BaseBackoff
+	for i := 1; i < attempts && delay < o.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, o.MaxBackoff)
+}
+
+// Dispatcher delivers outbox messages to the handlers registered by kind.
+type Dispatcher struct {
+	store    Store
+	opts     Options
+	handlers map[string]Handler
+	now      func() time.Time
+}
+
+// NewDispatcher creates a Dispatcher reading from store.
+func NewDispatcher(store Store, opts Options) *Dispatcher {
+	return &Dispatcher{
+		store:    store,
+		opts:     opts.withDefaults(),
+		handlers: make(map[string]Handler),
+		now:      time.Now,
+	}
+}
+
+// Handle registers the handler of kind. Handlers must be idempotent: a
+// message is delivered at least once.
+func (d *Dispatcher) Handle(kind string, h Handler) {
+	d.handlers[kind] = h
+}
+
+// RunOnce delivers one batch of due messages and returns how many it claimed.
+func (d *Dispatcher) RunOnce(ctx context.Context) (int, error) {
+	messages, err := d.store.Claim(ctx, d.now(), d.opts.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim outbox messages: %w", err)
+	}
+	return len(messages), d.deliver(ctx, messages)
+}
+
+// Dispatch delivers the messages with ids right away, e.g. after the
+// transaction that enqueued them commits. Messages that fail stay in the
+// outbox for Run or RunOnce to retry.
+func (d *Dispatcher) Dispatch(ctx context.Context, ids ...int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	messages, err := d.store.Claim(ctx, d.now(), len(ids), ids...)
+	if err != nil {
+		return fmt.Errorf("failed to claim outbox messages: %w", err)
+	}
+	return d.deliver(ctx, messages)
+}
+
+// Run polls the outbox every interval until ctx is done. A full batch is
+// followed by another poll without waiting.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		claimed, err := d.RunOnce(ctx)
+		if err != nil {
+			log.Printf("Outbox dispatch failed: %v", err)
+		}
+		if err == nil && claimed == d.opts.BatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, messages []Message) error {
+	for _, msg := range messages {
+		if err := d.deliverOne(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliverOne runs the handler of msg and records the result. It only
+// returns store errors; handler errors are recorded on the message.
+func (d *Dispatcher) deliverOne(ctx context.Context, msg Message) error {
+	handler, ok := d.handlers[msg.Kind]
+	var err error
+	if ok {
+		err = handler(ctx, msg)
+	} else {
+		err = Permanent(fmt.Errorf("no handler for outbox message kind %q", msg.Kind))
+	}
+
+	now := d.now()
+	switch {
+	case err == nil:
+		metrics.Auth.RecordOutboxDelivery(msg.Kind, metrics.OutboxDelivered)
+		return d.store.Complete(ctx, msg.ID, now)
+	case IsPermanent(err) || msg.Attempts >= d.opts.MaxAttempts:
+		log.Printf("Outbox message %d (%s) failed after %d attempts: %v", msg.ID, msg.Kind, msg.Attempts, err)
+		metrics.Auth.RecordOutboxDelivery(msg.Kind, metrics.OutboxFailed)
+		return d.store.Fail(ctx, msg.ID, now, err.Error())
+	default:
+		metrics.Auth.RecordOutboxDelivery(msg.Kind, metrics.OutboxRetried)
+		return d.store.Retry(ctx, msg.ID, now.Add(d.opts.Backoff(msg.Attempts)), err.Error())
+	}
+}
@@ -0,0 +1,186 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"services/auth/internal/metrics"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestDispatcher(store Store, opts Options) (*Dispatcher, *time.Time) {
+	now := start
+	d := NewDispatcher(store, opts)
+	d.now = func() time.Time { return now }
+	return d, &now
+}
+
+func TestOptions_Backoff(t *testing.T) {
+	opts := Options{BaseBackoff: time.Second, MaxBackoff: 10 * time.Second}.withDefaults()
+
+	assert.Equal(t, time.Second, opts.Backoff(1))
+	assert.Equal(t, 2*time.Second, opts.Backoff(2))
+	assert.Equal(t, 8*time.Second, opts.Backoff(4))
+	assert.Equal(t, 10*time.Second, opts.Backoff(5))
+	assert.Equal(t, 10*time.Second, opts.Backoff(100))
+}
+
+func TestDispatcher_RunOnce(t *testing.T) {
+	store := NewMemoryStore()
+	d, _ := newTestDispatcher(store, Options{})
+	ctx := context.Background()
+
+	type payload struct {
+		UserID int `json:"user_id"`
+	}
+	var delivered []int
+	d.Handle("test.deliver", func(_ context.Context, msg Message) error {
+		var p payload
+		require.NoError(t, msg.Decode(&p))
+		delivered = append(delivered, p.UserID)
+		return nil
+	})
+
+	_, err := store.Enqueue(ctx, "test.deliver", payload{UserID: 1})
+	require.NoError(t, err)
+	_, err = store.Enqueue(ctx, "test.deliver", payload{UserID: 2})
+	require.NoError(t, err)
+
+	before := metrics.Auth.OutboxDeliveryCount("test.deliver", metrics.OutboxDelivered)
+	claimed, err := d.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, claimed)
+	assert.Equal(t, []int{1, 2}, delivered)
+	assert.Equal(t, before+2, metrics.Auth.OutboxDeliveryCount("test.deliver", metrics.OutboxDelivered))
+
+	claimed, err = d.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, claimed, "delivered messages are not claimed again")
+}
+
+func TestDispatcher_RetriesWithBackoff(t *testing.T) {
+	store := NewMemoryStore()
+	d, now := newTestDispatcher(store, Options{MaxAttempts: 3, BaseBackoff: time.Second})
+	ctx := context.Background()
+
+	calls := 0
+	d.Handle("test.flaky", func(context.Context, Message) error {
+		calls++
+		return errors.New("provider unavailable")
+	})
+	id, err := store.Enqueue(ctx, "test.flaky", nil)
+	require.NoError(t, err)
+
+	_, err = d.RunOnce(ctx)
+	require.NoError(t, err)
+	msg := store.Messages()[0]
+	assert.Equal(t, start.Add(time.Second), msg.AvailableAt)
+	assert.Equal(t, "provider unavailable", msg.LastError)
+
+	claimed, err := d.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, claimed, "the retry is not due yet")
+
+	*now = start.Add(time.Second)
+	_, err = d.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, start.Add(3*time.Second), store.Messages()[0].AvailableAt, "the delay doubles")
+
+	*now = start.Add(3 * time.Second)
+	_, err = d.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	msg = store.Messages()[0]
+	assert.Equal(t, id, msg.ID)
+	require.NotNil(t, msg.FailedAt, "the message fails after MaxAttempts")
+	assert.Nil(t, msg.ProcessedAt)
+}
+
+func TestDispatcher_PermanentErrors(t *testing.T) {
+	store := NewMemoryStore()
+	d, _ := newTestDispatcher(store, Options{})
+	ctx := context.Background()
+
+	d.Handle("test.permanent", func(context.Context, Message) error {
+		return Permanent(errors.New("user not found"))
+	})
+	_, err := store.Enqueue(ctx, "test.permanent", nil)
+	require.NoError(t, err)
+	_, err = store.Enqueue(ctx, "test.unknown", nil)
+	require.NoError(t, err)
+
+	_, err = d.RunOnce(ctx)
+	require.NoError(t, err)
+
+	messages := store.Messages()
+	require.Len(t, messages, 2)
+	for _, msg := range messages {
+		assert.NotNil(t, msg.FailedAt, msg.Kind)
+		assert.Equal(t, 1, msg.Attempts)
+	}
+	assert.Contains(t, messages[1].LastError, "no handler")
+}
+
+func TestDispatcher_Dispatch(t *testing.T) {
+	store := NewMemoryStore()
+	d, _ := newTestDispatcher(store, Options{})
+	ctx := context.Background()
+
+	var delivered []int64
+	d.Handle("test.eager", func(_ context.Context, msg Message) error {
+		delivered = append(delivered, msg.ID)
+		return nil
+	})
+	other, err := store.Enqueue(ctx, "test.eager", nil)
+	require.NoError(t, err)
+	id, err := store.Enqueue(ctx, "test.eager", nil)
+	require.NoError(t, err)
+
+	require.NoError(t, d.Dispatch(ctx, id))
+	assert.Equal(t, []int64{id}, delivered, "only the given messages are delivered")
+
+	require.NoError(t, d.Dispatch(ctx))
+	_, err = d.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{id, other}, delivered)
+}
+
+func TestDispatcher_Run(t *testing.T) {
+	store := NewMemoryStore()
+	d := NewDispatcher(store, Options{BatchSize: 2})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	delivered := make(chan int64, 5)
+	d.Handle("test.run", func(_ context.Context, msg Message) error {
+		delivered <- msg.ID
+		return nil
+	})
+	for range 5 {
+		_, err := store.Enqueue(ctx, "test.run", nil)
+		require.NoError(t, err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx, time.Hour)
+		close(done)
+	}()
+
+	for i := range 5 {
+		select {
+		case id := <-delivered:
+			assert.Equal(t, int64(i+1), id)
+		case <-time.After(time.Second):
+			t.Fatal("full batches are followed by another poll without waiting")
+		}
+	}
+	cancel()
+	<-done
+}
@@ -0,0 +1,126 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps messages in process memory without transactions, so it
+// is meant for tests.
+type MemoryStore struct {
+	mu       sync.Mutex
+	nextID   int64
+	messages map[int64]*MemoryMessage
+}
+
+// MemoryMessage is a message held by MemoryStore with its delivery state.
+type MemoryMessage struct {
+	Message
+	AvailableAt time.Time
+	LastError   string
+	ProcessedAt *time.Time
+	FailedAt    *time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{messages: make(map[int64]*MemoryMessage)}
+}
+
+// Enqueue implements Store. The message is due immediately.
+func (s *MemoryStore) Enqueue(_ context.Context, kind string, payload any) (int64, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	s.messages[s.nextID] = &MemoryMessage{Message: Message{ID: s.nextID, Kind: kind, Payload: data}}
+	return s.nextID, nil
+}
+
+// Claim implements Store.
+func (s *MemoryStore) Claim(_ context.Context, now time.Time, limit int, ids ...int64) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var claimed []Message
+	for _, id := range s.sortedIDs() {
+		if len(claimed) == limit {
+			break
+		}
+		msg := s.messages[id]
+		if msg.ProcessedAt != nil || msg.FailedAt != nil || msg.AvailableAt.After(now) {
+			continue
+		}
+		if len(ids) > 0 && !slices.Contains(ids, id) {
+			continue
+		}
+		msg.Attempts++
+		msg.AvailableAt = now.Add(LeaseTimeout)
+		claimed = append(claimed, msg.Message)
+	}
+	return claimed, nil
+}
+
+// Complete implements Store.
+func (s *MemoryStore) Complete(_ context.Context, id int64, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if msg, ok := s.messages[id]; ok {
+		msg.ProcessedAt = &now
+		msg.LastError = ""
+	}
+	return nil
+}
+
+// Retry implements Store.
+func (s *MemoryStore) Retry(_ context.Context, id int64, availableAt time.Time, cause string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if msg, ok := s.messages[id]; ok {
+		msg.AvailableAt = availableAt
+		msg.LastError = cause
+	}
+	return nil
+}
+
+// Fail implements Store.
+func (s *MemoryStore) Fail(_ context.Context, id int64, now time.Time, cause string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if msg, ok := s.messages[id]; ok {
+		msg.FailedAt = &now
+		msg.LastError = cause
+	}
+	return nil
+}
+
+// Messages returns a copy of every stored message in enqueue order.
+func (s *MemoryStore) Messages() []MemoryMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := make([]MemoryMessage, 0, len(s.messages))
+	for _, id := range s.sortedIDs() {
+		messages = append(messages, *s.messages[id])
+	}
+	return messages
+}
+
+func (s *MemoryStore) sortedIDs() []int64 {
+	ids := make([]int64, 0, len(s.messages))
+	for id := range s.messages {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
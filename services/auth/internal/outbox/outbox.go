@@ -0,0 +1,68 @@
+// Package outbox delivers side effects recorded in the database in the same
+// transaction as the change that caused them. A Dispatcher claims pending
+// messages, runs the handler registered for their kind and retries failures
+// with exponential backoff, so an external call is never lost when the
+// process dies between the commit and the call, nor made without a commit.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// LeaseTimeout is how long a claimed message is hidden from other
+// dispatchers. A dispatcher that dies mid-delivery frees it after that.
+const LeaseTimeout = time.Minute
+
+// Message is a pending side effect.
+type Message struct {
+	ID      int64
+	Kind    string
+	Payload json.RawMessage
+	// Attempts counts deliveries including the current one.
+	Attempts int
+}
+
+// Decode unmarshals the payload into v.
+func (m Message) Decode(v any) error {
+	return json.Unmarshal(m.Payload, v)
+}
+
+// Store keeps outbox messages.
+type Store interface {
+	// Enqueue stores a message with payload encoded as JSON. Stores backed by
+	// the database join the transaction carried by ctx.
+	Enqueue(ctx context.Context, kind string, payload any) (int64, error)
+	// Claim leases up to limit messages due at now, oldest first, for
+	// LeaseTimeout and counts the attempt. With ids, only those messages
+	// are considered.
+	Claim(ctx context.Context, now time.Time, limit int, ids ...int64) ([]Message, error)
+	// Complete marks a message delivered.
+	Complete(ctx context.Context, id int64, now time.Time) error
+	// Retry makes a message due again at availableAt.
+	Retry(ctx context.Context, id int64, availableAt time.Time, cause string) error
+	// Fail gives up on a message; it is kept for inspection.
+	Fail(ctx context.Context, id int64, now time.Time, cause string) error
+}
+
+// Handler delivers a message. Returning an error schedules a retry unless
+// it is wrapped with Permanent.
+type Handler func(ctx context.Context, msg Message) error
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying: the message fails at once.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether err was wrapped with Permanent.
+func IsPermanent(err error) bool {
+	var permanent permanentError
+	return errors.As(err, &permanent)
+}
@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memorySweepSize is the number of buckets above which full buckets, which
+// are equivalent to missing ones, are dropped.
+const memorySweepSize = 10000
+
+// MemoryStore keeps buckets in process memory. Limits only hold within one
+// process, so it is meant for local development and tests.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]memoryBucket
+}
+
+type memoryBucket struct {
+	Bucket
+	limit Limit
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]memoryBucket)}
+}
+
+// Take implements Store.
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit, now time.Time) (Decision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.buckets) >= memorySweepSize {
+		s.sweep(now)
+	}
+
+	stored, ok := s.buckets[key]
+	if !ok {
+		stored.Bucket = limit.Full(now)
+	}
+	bucket, decision := limit.Take(stored.Bucket, now)
+	s.buckets[key] = memoryBucket{Bucket: bucket, limit: limit}
+	return decision, nil
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, stored := range s.buckets {
+		if stored.limit.refill(stored.Bucket, now) >= float64(stored.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Package ratelimit throttles requests with token buckets kept in a shared
+// Store, so limits hold across Lambda instances.
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Limit describes a token bucket: up to Burst requests at once, with one
+// token regained every Interval. Limiter skips limits with Burst <= 0.
+type Limit struct {
+	Burst    int
+	Interval time.Duration
+}
+
+// Bucket is the stored state of one token bucket.
+type Bucket struct {
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+// Decision is the outcome of charging a request to its buckets.
+type Decision struct {
+	Allowed bool
+	// RetryAfter is how long until the request would be allowed.
+	RetryAfter time.Duration
+	// Key names the bucket that refused the request.
+	Key string
+}
+
+// Full returns a bucket holding Burst tokens at now.
+func (l Limit) Full(now time.Time) Bucket {
+	return Bucket{Tokens: float64(l.Burst), UpdatedAt: now}
+}
+
+// RefillTime returns how long an empty bucket takes to be full again. A
+// bucket untouched for that long is the same as a missing one, which starts
+// full, so stores may forget it. It is false when buckets never refill.
+func (l Limit) RefillTime() (time.Duration, bool) {
+	if l.Burst <= 0 {
+		return 0, true
+	}
+	if l.Interval <= 0 {
+		return 0, false
+	}
+	return time.Duration(l.Burst) * l.Interval, true
+}
+
+// Take refills b for the time elapsed until now and spends one token when
+// available. The returned bucket must be stored whether or not the request
+// is allowed.
+func (l Limit) Take(b Bucket, now time.Time) (Bucket, Decision) {
+	tokens := l.refill(b, now)
+	if tokens >= 1 {
+		return Bucket{Tokens: tokens - 1, UpdatedAt: now}, Decision{Allowed: true}
+	}
+
+	retryAfter := time.Duration((1 - tokens) * float64(l.Interval))
+	if l.Burst < 1 || l.Interval <= 0 {
+		// The bucket never regains a whole token.
+		retryAfter = math.MaxInt64
+	}
+	return Bucket{Tokens: tokens, UpdatedAt: now}, Decision{RetryAfter: retryAfter}
+}
+
+// refill returns the tokens b holds at now.
+func (l Limit) refill(b Bucket, now time.Time) float64 {
+	tokens := b.Tokens
+	if elapsed := now.Sub(b.UpdatedAt); elapsed > 0 && l.Interval > 0 {
+		tokens += float64(elapsed) / float64(l.Interval)
+	}
+	return math.Min(tokens, float64(l.Burst))
+}
+
+// Store keeps token buckets by key.
+type Store interface {
+	// Take atomically applies limit.Take to the bucket stored under key,
+	// starting from a full bucket when none exists.
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Decision, error)
+}
+
+// Key is one bucket a request is charged to, such as the client IP.
+type Key struct {
+	// Name identifies the rule, e.g. "signup_ip".
+	Name  string
+	Value string
+	Limit Limit
+}
+
+// storeKey returns the key under which the bucket is stored. The value is
+// hashed so emails and IP addresses are not kept in clear.
+func (k Key) storeKey() string {
+	sum := sha256.Sum256([]byte(k.Value))
+	return k.Name + ":" + hex.EncodeToString(sum[:16])
+}
+
+// Limiter charges requests to their buckets in a Store.
+type Limiter struct {
+	store Store
+	now   func() time.Time
+}
+
+func New(store Store) *Limiter {
+	return &Limiter{store: store, now: time.Now}
+}
+
+// Allow charges the request to each key in order and stops at the first
+// bucket that refuses it.
+func (l *Limiter) Allow(ctx context.Context, keys ...Key) (Decision, error) {
+	now := l.now()
+	for _, key := range keys {
+		if key.Limit.Burst <= 0 {
+			continue
+		}
+		decision, err := l.store.Take(ctx, key.storeKey(), key.Limit, now)
+		if err != nil {
+			return Decision{}, fmt.Errorf("failed to take %s token: %w", key.Name, err)
+		}
+		if !decision.Allowed {
+			decision.Key = key.Name
+			return decision, nil
+		}
+	}
+	return Decision{Allowed: true}, nil
+}
@@ -0,0 +1,162 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestLimit_Take(t *testing.T) {
+	limit := Limit{Burst: 2, Interval: time.Minute}
+	bucket := limit.Full(start)
+
+	bucket, decision := limit.Take(bucket, start)
+	assert.True(t, decision.Allowed)
+	bucket, decision = limit.Take(bucket, start)
+	assert.True(t, decision.Allowed)
+
+	bucket, decision = limit.Take(bucket, start.Add(15*time.Second))
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, 45*time.Second, decision.RetryAfter)
+
+	bucket, decision = limit.Take(bucket, start.Add(time.Minute))
+	assert.True(t, decision.Allowed)
+	assert.InDelta(t, 0, bucket.Tokens, 1e-9)
+}
+
+func TestLimit_Take_RefillCapsAtBurst(t *testing.T) {
+	limit := Limit{Burst: 3, Interval: time.Second}
+
+	bucket, decision := limit.Take(Bucket{Tokens: 0, UpdatedAt: start}, start.Add(time.Hour))
+	assert.True(t, decision.Allowed)
+	assert.InDelta(t, 2, bucket.Tokens, 1e-9)
+}
+
+func TestLimit_Take_NeverRefills(t *testing.T) {
+	limit := Limit{Burst: 1}
+
+	bucket, decision := limit.Take(limit.Full(start), start)
+	assert.True(t, decision.Allowed)
+
+	_, decision = limit.Take(bucket, start.Add(time.Hour))
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, time.Duration(math.MaxInt64), decision.RetryAfter)
+}
+
+func TestLimit_RefillTime(t *testing.T) {
+	limit := Limit{Burst: 3, Interval: time.Minute}
+	refill, ok := limit.RefillTime()
+	require.True(t, ok)
+	assert.Equal(t, 3*time.Minute, refill)
+
+	// An empty bucket is full again after RefillTime
+	_, decision := limit.Take(Bucket{Tokens: 0, UpdatedAt: start}, start.Add(refill))
+	assert.True(t, decision.Allowed)
+
+	_, ok = Limit{Burst: 1}.RefillTime()
+	assert.False(t, ok, "buckets that never refill cannot be forgotten")
+
+	refill, ok = Limit{}.RefillTime()
+	assert.True(t, ok)
+	assert.Zero(t, refill, "disabled limits keep no buckets")
+}
+
+func TestMemoryStore_Take(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	limit := Limit{Burst: 1, Interval: time.Minute}
+
+	decision, err := store.Take(ctx, "a", limit, start)
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed)
+
+	decision, err = store.Take(ctx, "a", limit, start.Add(time.Second))
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed)
+
+	decision, err = store.Take(ctx, "b", limit, start.Add(time.Second))
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed, "buckets are independent")
+}
+
+func TestMemoryStore_SweepsFullBuckets(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	limit := Limit{Burst: 1, Interval: time.Minute}
+
+	for i := 0; i < memorySweepSize; i++ {
+		_, err := store.Take(ctx, strings.Repeat("k", i+1), limit, start)
+		require.NoError(t, err)
+	}
+	_, err := store.Take(ctx, "late", limit, start.Add(time.Minute))
+	require.NoError(t, err)
+
+	assert.Len(t, store.buckets, 1)
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, Limit, time.Time) (Decision, error) {
+	return Decision{}, errors.New("connection refused")
+}
+
+func TestLimiter_Allow(t *testing.T) {
+	limiter := New(NewMemoryStore())
+	limiter.now = func() time.Time { return start }
+	ctx := context.Background()
+
+	ip := Key{Name: "ip", Value: "203.0.113.7", Limit: Limit{Burst: 3, Interval: time.Minute}}
+	email := func(v string) Key {
+		return Key{Name: "email", Value: v, Limit: Limit{Burst: 1, Interval: time.Hour}}
+	}
+
+	decision, err := limiter.Allow(ctx, ip, email("john@example.com"))
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed)
+
+	decision, err = limiter.Allow(ctx, ip, email("john@example.com"))
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, "email", decision.Key)
+	assert.Equal(t, time.Hour, decision.RetryAfter)
+
+	decision, err = limiter.Allow(ctx, ip, email("jane@example.com"))
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed)
+
+	decision, err = limiter.Allow(ctx, ip, email("mary@example.com"))
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed, "the IP bucket is spent by every attempt")
+	assert.Equal(t, "ip", decision.Key)
+}
+
+func TestLimiter_Allow_SkipsDisabledLimits(t *testing.T) {
+	limiter := New(failingStore{})
+
+	decision, err := limiter.Allow(context.Background(), Key{Name: "ip", Value: "203.0.113.7"})
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed)
+}
+
+func TestLimiter_Allow_StoreError(t *testing.T) {
+	limiter := New(failingStore{})
+
+	_, err := limiter.Allow(context.Background(), Key{Name: "ip", Value: "203.0.113.7", Limit: Limit{Burst: 1, Interval: time.Second}})
+	assert.Error(t, err)
+}
+
+func TestKey_StoreKeyHidesValue(t *testing.T) {
+	key := Key{Name: "signup_email", Value: "john@example.com"}
+
+	assert.True(t, strings.HasPrefix(key.storeKey(), "signup_email:"))
+	assert.NotContains(t, key.storeKey(), "john")
+	assert.Equal(t, key.storeKey(), Key{Name: "signup_email", Value: "john@example.com"}.storeKey())
+}
@@ -0,0 +1,25 @@
+package repositories
+
+import (
+	"context"
+
+	"services/auth/internal/audit"
+)
+
+type actorKey struct{}
+
+// WithActor returns a context whose writes are recorded as made by actor in
+// the created_by and updated_by columns, e.g. audit.ActorAnonymous for
+// unauthenticated requests such as sign-ups.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor set by WithActor, or audit.ActorSystem for
+// writes made outside any request, e.g. by the outbox dispatcher.
+func ActorFrom(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return audit.ActorSystem
+}
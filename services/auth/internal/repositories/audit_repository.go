@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"services/auth/internal/audit"
+	"time"
+)
+
+// AuditRepository stores audit events in audit_events, which rejects
+// updates and deletes.
+type AuditRepository struct {
+	db     DB
+	events *table[audit.Event]
+}
+
+func NewAuditRepository(db DB, opts ...Option) *AuditRepository {
+	events := newTable[audit.Event](db, nil, "audit_events")
+	events.replica = applyOptions(opts).replica
+	return &AuditRepository{db: db, events: events}
+}
+
+// Append implements audit.Store. Inside a transaction the event is only
+// kept when the transaction commits.
+func (r *AuditRepository) Append(ctx context.Context, event *audit.Event) error {
+	query := `
+		INSERT INTO audit_events (occurred_at, type, outcome, reason, user_id, actor, ip_address, user_agent)
+		VALUES (COALESCE($1, NOW()), $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, occurred_at
+	`
+
+	var occurredAt *time.Time
+	if !event.OccurredAt.IsZero() {
+		occurredAt = &event.OccurredAt
+	}
+	return conn(ctx, r.db).QueryRow(
+		ctx,
+		query,
+		occurredAt,
+		event.Type,
+		event.Outcome,
+		event.Reason,
+		event.UserID,
+		event.Actor,
+		event.IP,
+		event.UserAgent,
+	).Scan(&event.ID, &event.OccurredAt)
+}
+
+// ListByUser implements audit.Store. It reads from the replica, if any, so
+// the newest events may be missing for as long as it lags.
+func (r *AuditRepository) ListByUser(ctx context.Context, userID int, cursor string, limit int) ([]audit.Event, string, error) {
+	q := r.events.selectQuery().allowStale()
+	page, err := r.events.page(ctx, q.where("user_id = "+q.arg(userID)), PageRequest{Cursor: cursor, Limit: limit}, true)
+	if errors.Is(err, ErrInvalidCursor) {
+		return nil, "", fmt.Errorf("%w: %w", audit.ErrInvalidCursor, err)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return page.Items, page.Next, nil
+}
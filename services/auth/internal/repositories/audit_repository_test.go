@@ -0,0 +1,64 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"services/auth/internal/audit"
+	"services/auth/internal/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditRepository(t *testing.T) {
+	pool, cleanup := testhelpers.SetupTestDB(t)
+	defer cleanup()
+
+	testhelpers.ApplyMigrations(t, pool)
+
+	repo := NewAuditRepository(pool)
+	ctx := context.Background()
+	userID, otherID := 1, 2
+
+	t.Run("append sets the id and time", func(t *testing.T) {
+		event := &audit.Event{Type: audit.TypeSignup, Outcome: audit.OutcomeSuccess, UserID: &userID, Actor: audit.ActorAnonymous, IP: "203.0.113.7", UserAgent: "curl/8.0"}
+		require.NoError(t, repo.Append(ctx, event))
+
+		assert.NotZero(t, event.ID)
+		assert.WithinDuration(t, time.Now(), event.OccurredAt, time.Minute)
+	})
+
+	t.Run("events are listed per user, newest first", func(t *testing.T) {
+		for _, id := range []*int{&otherID, &userID, nil} {
+			require.NoError(t, repo.Append(ctx, &audit.Event{Type: audit.TypeLogin, Outcome: audit.OutcomeDenied, UserID: id, Actor: audit.ActorSystem}))
+		}
+
+		first, next, err := repo.ListByUser(ctx, userID, "", 1)
+		require.NoError(t, err)
+		require.Len(t, first, 1)
+		assert.Equal(t, audit.TypeLogin, first[0].Type)
+		require.NotEmpty(t, next)
+
+		second, next, err := repo.ListByUser(ctx, userID, next, 1)
+		require.NoError(t, err)
+		require.Len(t, second, 1)
+		assert.Equal(t, audit.TypeSignup, second[0].Type)
+		assert.Equal(t, "203.0.113.7", second[0].IP)
+		assert.Empty(t, next)
+	})
+
+	t.Run("invalid cursors are reported", func(t *testing.T) {
+		_, _, err := repo.ListByUser(ctx, userID, "not a cursor", 1)
+		assert.ErrorIs(t, err, audit.ErrInvalidCursor)
+	})
+
+	t.Run("events cannot be changed or deleted", func(t *testing.T) {
+		_, err := pool.Exec(ctx, `UPDATE audit_events SET outcome = 'success'`)
+		assert.ErrorContains(t, err, "append-only")
+
+		_, err = pool.Exec(ctx, `DELETE FROM audit_events`)
+		assert.ErrorContains(t, err, "append-only")
+	})
+}
@@ -0,0 +1,53 @@
+package repositories
+
+import (
+	"services/auth/internal/encryption"
+)
+
+// BlindIndexColumn names a column holding the blind indexes of an encrypted
+// column of the same table, so rows can be looked up by the encrypted value.
+// A unique constraint on it keeps the values unique, as long as every index
+// is computed with the same key (see cmd/rekey).
+type BlindIndexColumn struct {
+	Column string
+	Source EncryptedColumn
+}
+
+func (c BlindIndexColumn) String() string {
+	return c.Source.Table + "." + c.Column
+}
+
+// BlindIndexColumns lists every blind index column; cmd/rekey recomputes
+// them after a key rotation. None exists yet: add a column here with its
+// migration and the repository methods that write it with index and look
+// it up with candidates, e.g. a "cpf_index" for an encrypted "cpf".
+var BlindIndexColumns = []BlindIndexColumn{}
+
+// Domain separates the indexes of the column from those of other columns;
+// indexes are computed with encryption.BlindIndex for it.
+func (c BlindIndexColumn) Domain() string {
+	return c.Source.String()
+}
+
+// index returns the value to store in the column for field, or nil when the
+// field is NULL.
+func (c BlindIndexColumn) index(blind *encryption.BlindIndex, field encryption.Field) (*string, error) {
+	if !field.Valid() {
+		return nil, nil
+	}
+	if blind == nil {
+		return nil, encryption.ErrNoBlindIndex
+	}
+	index := blind.Compute(c.Domain(), field.Plaintext())
+	return &index, nil
+}
+
+// candidates returns the indexes a row holding value may be stored under,
+// to query with "<column> = ANY($n)". With a short BLIND_INDEX_LENGTH other
+// values match too, so compare the opened fields of the rows found.
+func (c BlindIndexColumn) candidates(blind *encryption.BlindIndex, value string) ([]string, error) {
+	if blind == nil {
+		return nil, encryption.ErrNoBlindIndex
+	}
+	return blind.Candidates(c.Domain(), value), nil
+}
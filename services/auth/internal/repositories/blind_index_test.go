@@ -0,0 +1,115 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"services/auth/internal/encryption"
+	"services/auth/internal/testhelpers"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlindIndexColumn(t *testing.T) {
+	pool, cleanup := testhelpers.SetupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	_, err := pool.Exec(ctx, `CREATE TABLE people (id SERIAL PRIMARY KEY, cpf TEXT, cpf_index TEXT UNIQUE)`)
+	require.NoError(t, err)
+
+	col := BlindIndexColumn{Column: "cpf_index", Source: EncryptedColumn{Table: "people", Column: "cpf"}}
+	oldKey := encryption.IndexKey{ID: "b1", Secret: "old-blind-index-key-1234567890123"}
+	newKey := encryption.IndexKey{ID: "b2", Secret: "new-blind-index-key-1234567890123"}
+	before, err := encryption.NewBlindIndex(encryption.DefaultBlindIndexLength, oldKey)
+	require.NoError(t, err)
+	after, err := encryption.NewBlindIndex(encryption.DefaultBlindIndexLength, newKey, oldKey)
+	require.NoError(t, err)
+
+	insert := func(blind *encryption.BlindIndex, cpf string) error {
+		var id int
+		if err := pool.QueryRow(ctx, `SELECT nextval(pg_get_serial_sequence('people', 'id'))`).Scan(&id); err != nil {
+			return err
+		}
+		field := encryption.NewField(cpf)
+		index, err := col.index(blind, field)
+		if err != nil {
+			return err
+		}
+		_, err = pool.Exec(ctx, `INSERT INTO people (id, cpf, cpf_index) VALUES ($1, $2, $3)`,
+			id, col.Source.bind(ctx, testKeyring, &field, &id), index)
+		return err
+	}
+	find := func(blind *encryption.BlindIndex, cpf string) (string, error) {
+		candidates, err := col.candidates(blind, cpf)
+		if err != nil {
+			return "", err
+		}
+		var id int
+		var field encryption.Field
+		err = pool.QueryRow(ctx, `SELECT id, cpf FROM people WHERE cpf_index = ANY($1)`, candidates).
+			Scan(&id, col.Source.bind(ctx, testKeyring, &field, &id))
+		return field.Plaintext(), err
+	}
+
+	require.NoError(t, insert(before, "12345678909"))
+	require.NoError(t, insert(before, "98765432100"))
+
+	t.Run("lookup", func(t *testing.T) {
+		cpf, err := find(before, "12345678909")
+		require.NoError(t, err)
+		assert.Equal(t, "12345678909", cpf)
+	})
+
+	t.Run("unique", func(t *testing.T) {
+		err := insert(before, "12345678909")
+		var pgErr *pgconn.PgError
+		require.True(t, errors.As(err, &pgErr), err)
+		assert.Equal(t, "23505", pgErr.Code)
+	})
+
+	t.Run("no key", func(t *testing.T) {
+		_, err := find(nil, "12345678909")
+		assert.ErrorIs(t, err, encryption.ErrNoBlindIndex)
+		assert.ErrorIs(t, insert(nil, "11144477735"), encryption.ErrNoBlindIndex)
+	})
+
+	t.Run("rotation", func(t *testing.T) {
+		cpf, err := find(after, "98765432100")
+		require.NoError(t, err, "indexes of the retired key are still found")
+		assert.Equal(t, "98765432100", cpf)
+
+		reindex := func(ctx context.Context, sealed string, binding encryption.Binding, index *string) (string, bool, error) {
+			if index != nil && !after.NeedsReindex(*index) {
+				return *index, false, nil
+			}
+			plaintext, err := testKeyring.Decrypt(ctx, sealed, binding)
+			if err != nil {
+				return "", false, err
+			}
+			return after.Compute(col.Domain(), plaintext), true, nil
+		}
+		batch, err := NewRekeyRepository(pool).ReindexBatch(ctx, col, 0, 10, reindex)
+		require.NoError(t, err)
+		assert.Equal(t, RekeyBatch{LastID: 2, Scanned: 2, Rekeyed: 2}, batch)
+
+		rows, err := pool.Query(ctx, `SELECT cpf_index FROM people ORDER BY id`)
+		require.NoError(t, err)
+		for rows.Next() {
+			var index string
+			require.NoError(t, rows.Scan(&index))
+			assert.True(t, strings.HasPrefix(index, "b2:"), index)
+		}
+		require.NoError(t, rows.Err())
+
+		newOnly, err := encryption.NewBlindIndex(encryption.DefaultBlindIndexLength, newKey)
+		require.NoError(t, err)
+		cpf, err = find(newOnly, "12345678909")
+		require.NoError(t, err, "the retired key can be removed")
+		assert.Equal(t, "12345678909", cpf)
+	})
+}
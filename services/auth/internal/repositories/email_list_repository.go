@@ -0,0 +1,110 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"services/auth/internal/emailaddr"
+	"services/auth/internal/models"
+)
+
+// EmailList names one of the admin-managed email lists.
+type EmailList string
+
+const (
+	// EmailAllowlist holds patterns that are always admitted.
+	EmailAllowlist EmailList = "email_allowlist"
+	// EmailBlocklist holds patterns that are rejected.
+	EmailBlocklist EmailList = "email_blocklist"
+)
+
+// EmailListRepository reads and writes the admin-managed email_allowlist
+// and email_blocklist tables used by the sign-up policy. Entries are soft
+// deleted, and writes record the actor of their context. Address entries are
+// stored in the canonical form of normalizer, which the policy matches
+// sign-ups on, so an entry covers every variant of its mailbox.
+type EmailListRepository struct {
+	db         DB
+	normalizer *emailaddr.Normalizer
+	lists      map[EmailList]*table[models.EmailListEntry]
+}
+
+func NewEmailListRepository(db DB, normalizer *emailaddr.Normalizer) *EmailListRepository {
+	return &EmailListRepository{db: db, normalizer: normalizer, lists: map[EmailList]*table[models.EmailListEntry]{
+		EmailAllowlist: newTable[models.EmailListEntry](db, nil, string(EmailAllowlist)),
+		EmailBlocklist: newTable[models.EmailListEntry](db, nil, string(EmailBlocklist)),
+	}}
+}
+
+// Match reports whether email or one of domains is on the allowlist and
+// whether one of them is on the blocklist. Deleted entries do not match.
+func (r *EmailListRepository) Match(ctx context.Context, email string, domains []string) (bool, bool, error) {
+	query := `
+		SELECT
+			EXISTS (SELECT 1 FROM email_allowlist WHERE pattern = ANY($1) AND deleted_at IS NULL),
+			EXISTS (SELECT 1 FROM email_blocklist WHERE pattern = ANY($1) AND deleted_at IS NULL)
+	`
+
+	patterns := append([]string{email}, domains...)
+
+	var allowed, blocked bool
+	if err := conn(ctx, r.db).QueryRow(ctx, query, patterns).Scan(&allowed, &blocked); err != nil {
+		return false, false, err
+	}
+	return allowed, blocked, nil
+}
+
+// Add inserts entry into list, replacing an address pattern by its
+// canonical form. It returns a DuplicateError when the pattern is already
+// listed, including by a deleted entry, which can be restored.
+func (r *EmailListRepository) Add(ctx context.Context, list EmailList, entry *models.EmailListEntry) error {
+	t, err := r.table(list)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(entry.Pattern, "@") {
+		canonical, err := r.normalizer.Canonical(entry.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", entry.Pattern, err)
+		}
+		entry.Pattern = canonical
+	}
+	return t.insert(ctx, entry)
+}
+
+// Find returns the live entry of list with id.
+func (r *EmailListRepository) Find(ctx context.Context, list EmailList, id int) (*models.EmailListEntry, error) {
+	t, err := r.table(list)
+	if err != nil {
+		return nil, err
+	}
+	q := t.selectQuery()
+	return t.get(ctx, q.where("id = "+q.arg(id)), "id")
+}
+
+// Delete soft deletes the entry of list with id, which then stops matching.
+func (r *EmailListRepository) Delete(ctx context.Context, list EmailList, id int) error {
+	t, err := r.table(list)
+	if err != nil {
+		return err
+	}
+	return t.softDelete(ctx, id)
+}
+
+// Restore brings back the deleted entry of list with id.
+func (r *EmailListRepository) Restore(ctx context.Context, list EmailList, id int) error {
+	t, err := r.table(list)
+	if err != nil {
+		return err
+	}
+	return t.restore(ctx, id)
+}
+
+func (r *EmailListRepository) table(list EmailList) (*table[models.EmailListEntry], error) {
+	t, ok := r.lists[list]
+	if !ok {
+		return nil, fmt.Errorf("unknown email list %q", list)
+	}
+	return t, nil
+}
@@ -0,0 +1,87 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+
+	"services/auth/internal/emailaddr"
+	"services/auth/internal/models"
+	"services/auth/internal/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmailListRepository_Match(t *testing.T) {
+	pool, cleanup := testhelpers.SetupTestDB(t)
+	defer cleanup()
+
+	testhelpers.ApplyMigrations(t, pool)
+
+	ctx := WithActor(context.Background(), "admin")
+	repo := NewEmailListRepository(pool, emailaddr.NewNormalizer(true))
+	for list, patterns := range map[EmailList][]string{
+		EmailAllowlist: {"partner.com", "vip@mailinator.com"},
+		EmailBlocklist: {"spammer.com", "bad@example.com", "J.Doe+spam@googlemail.com"},
+	} {
+		for _, pattern := range patterns {
+			require.NoError(t, repo.Add(ctx, list, &models.EmailListEntry{Pattern: pattern}))
+		}
+	}
+
+	tests := []struct {
+		name        string
+		email       string
+		domains     []string
+		wantAllowed bool
+		wantBlocked bool
+	}{
+		{"unlisted", "john@example.com", []string{"example.com"}, false, false},
+		{"allowlisted domain", "anyone@eu.partner.com", []string{"eu.partner.com", "partner.com"}, true, false},
+		{"allowlisted address", "vip@mailinator.com", []string{"mailinator.com"}, true, false},
+		{"blocklisted domain", "anyone@spammer.com", []string{"spammer.com"}, false, true},
+		{"blocklisted address", "bad@example.com", []string{"example.com"}, false, true},
+		{"blocklisted mailbox", "jdoe@gmail.com", []string{"gmail.com"}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, blocked, err := repo.Match(ctx, tt.email, tt.domains)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantAllowed, allowed)
+			assert.Equal(t, tt.wantBlocked, blocked)
+		})
+	}
+
+	t.Run("patterns must be lowercase", func(t *testing.T) {
+		err := repo.Add(ctx, EmailBlocklist, &models.EmailListEntry{Pattern: "Spammer.org"})
+		assert.Error(t, err)
+	})
+
+	t.Run("audit columns and soft delete", func(t *testing.T) {
+		entry := &models.EmailListEntry{Pattern: "abuse.example"}
+		require.NoError(t, repo.Add(ctx, EmailBlocklist, entry))
+		assert.NotZero(t, entry.ID)
+		assert.Equal(t, "admin", entry.CreatedBy)
+		assert.Equal(t, "admin", entry.UpdatedBy)
+
+		var dup *DuplicateError
+		require.ErrorAs(t, repo.Add(ctx, EmailBlocklist, &models.EmailListEntry{Pattern: "abuse.example"}), &dup)
+		assert.Equal(t, "email_blocklist_pattern_key", dup.Index)
+
+		require.NoError(t, repo.Delete(WithActor(ctx, "moderator"), EmailBlocklist, entry.ID))
+		_, blocked, err := repo.Match(ctx, "anyone@abuse.example", []string{"abuse.example"})
+		require.NoError(t, err)
+		assert.False(t, blocked, "deleted entries do not match")
+		_, err = repo.Find(ctx, EmailBlocklist, entry.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		require.NoError(t, repo.Restore(ctx, EmailBlocklist, entry.ID))
+		found, err := repo.Find(ctx, EmailBlocklist, entry.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "admin", found.UpdatedBy)
+		_, blocked, err = repo.Match(ctx, "anyone@abuse.example", []string{"abuse.example"})
+		require.NoError(t, err)
+		assert.True(t, blocked)
+	})
+}
@@ -0,0 +1,74 @@
+package repositories
+
+import (
+	"context"
+
+	"services/auth/internal/encryption"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// EncryptedColumn names a column holding values sealed by encryption.Keyring,
+// in a table keyed by an integer "id".
+type EncryptedColumn struct {
+	Table  string
+	Column string
+}
+
+func (c EncryptedColumn) String() string {
+	return c.Table + "." + c.Column
+}
+
+// Binding returns the binding values of the column are sealed with in the
+// row with the given ID.
+func (c EncryptedColumn) Binding(rowID int64) encryption.Binding {
+	return encryption.Binding{Table: c.Table, Column: c.Column, RowID: rowID}
+}
+
+// UsersTemporaryPassword holds the temporary password of a user until its
+// identity provider account is created.
+var UsersTemporaryPassword = EncryptedColumn{Table: "users", Column: "temporary_password"}
+
+// EncryptedColumns lists every encrypted column; cmd/rekey re-encrypts them
+// all after a key rotation.
+var EncryptedColumns = []EncryptedColumn{
+	UsersTemporaryPassword,
+}
+
+// bind returns a query argument and scan target for field as the value of
+// the column in the row whose ID is id, sealed and opened under ctx, the
+// context of the query. The ID is read when the field is written or
+// scanned, so a query must scan the id column before the field; it may be
+// nil when writing a NULL field.
+func (c EncryptedColumn) bind(ctx context.Context, keyring *encryption.Keyring, field *encryption.Field, id *int) *boundField {
+	return &boundField{ctx: ctx, column: c, keyring: keyring, field: field, id: id}
+}
+
+type boundField struct {
+	ctx     context.Context
+	column  EncryptedColumn
+	keyring *encryption.Keyring
+	field   *encryption.Field
+	id      *int
+}
+
+func (b *boundField) bound() encryption.Field {
+	return b.field.Bind(b.ctx, b.keyring, b.column.Binding(int64(*b.id)))
+}
+
+func (b *boundField) TextValue() (pgtype.Text, error) {
+	if !b.field.Valid() {
+		// NULL needs no binding, so id may be nil
+		return pgtype.Text{}, nil
+	}
+	return b.bound().TextValue()
+}
+
+func (b *boundField) ScanText(v pgtype.Text) error {
+	field := b.bound()
+	if err := field.ScanText(v); err != nil {
+		return err
+	}
+	*b.field = field
+	return nil
+}
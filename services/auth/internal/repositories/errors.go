@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrNotFound matches every NotFoundError, for callers that do not care
+// which lookup failed.
+var ErrNotFound = errors.New("not found")
+
+// ErrDeleted is returned when a write conflicts with a soft deleted row,
+// which keeps its unique values until it is purged.
+var ErrDeleted = errors.New("row is soft deleted")
+
+// ErrDuplicate matches every DuplicateError.
+var ErrDuplicate = errors.New("duplicate")
+
+// NotFoundError is returned when a lookup matches no row. It names the
+// table and the column looked up, but not the value, which may be personal
+// data such as an email address.
+type NotFoundError struct {
+	Table  string
+	Column string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s: no row with that %s", e.Table, e.Column)
+}
+
+// Is makes errors.Is(err, ErrNotFound) hold for every NotFoundError.
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// DuplicateError is returned when a write would repeat the value of a unique
+// index. Like NotFoundError, it leaves the value out.
+type DuplicateError struct {
+	Table string
+	// Index is the unique index that rejected the write.
+	Index string
+	err   error
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("%s: value already taken (%s)", e.Table, e.Index)
+}
+
+// Is makes errors.Is(err, ErrDuplicate) hold for every DuplicateError.
+func (e *DuplicateError) Is(target error) bool {
+	return target == ErrDuplicate
+}
+
+func (e *DuplicateError) Unwrap() error {
+	return e.err
+}
+
+// uniqueViolation is the SQLSTATE of a write rejected by a unique index.
+const uniqueViolation = "23505"
+
+// duplicateError returns a DuplicateError for err when it is a unique
+// violation on table, and err otherwise.
+func duplicateError(table string, err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return &DuplicateError{Table: table, Index: pgErr.ConstraintName, err: err}
+	}
+	return err
+}
@@ -0,0 +1,100 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"services/auth/internal/idempotency"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// claimAttempts bounds Claim when the conflicting row disappears between the
+// insert and the read, e.g. because its request released it.
+const claimAttempts = 3
+
+// IdempotencyRepository stores idempotency records in idempotency_keys.
+type IdempotencyRepository struct {
+	db DB
+}
+
+func NewIdempotencyRepository(db DB) *IdempotencyRepository {
+	return &IdempotencyRepository{db: db}
+}
+
+// Claim implements idempotency.Store. The insert takes over expired rows and
+// stale locks in the same statement, so only one request can own a key.
+func (r *IdempotencyRepository) Claim(ctx context.Context, key, requestHash string, now time.Time) (*idempotency.Record, error) {
+	claim := `
+		INSERT INTO idempotency_keys (key, request_hash, locked_at, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (key) DO UPDATE SET
+			request_hash = EXCLUDED.request_hash,
+			status_code = NULL,
+			response_headers = NULL,
+			response_body = NULL,
+			locked_at = EXCLUDED.locked_at,
+			expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= $3
+			OR (idempotency_keys.status_code IS NULL AND idempotency_keys.locked_at <= $5)
+		RETURNING key
+	`
+	lookup := `
+		SELECT request_hash, status_code, response_headers, response_body
+		FROM idempotency_keys
+		WHERE key = $1
+	`
+
+	for range claimAttempts {
+		var claimed string
+		err := r.db.QueryRow(ctx, claim, key, requestHash, now, now.Add(idempotency.RecordTTL), now.Add(-idempotency.LockTimeout)).Scan(&claimed)
+		if err == nil {
+			return nil, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+
+		var (
+			record     idempotency.Record
+			statusCode *int
+			headers    map[string]string
+			body       *string
+		)
+		err = r.db.QueryRow(ctx, lookup, key).Scan(&record.RequestHash, &statusCode, &headers, &body)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if statusCode != nil {
+			record.Response = &idempotency.Response{StatusCode: *statusCode, Headers: headers}
+			if body != nil {
+				record.Response.Body = *body
+			}
+		}
+		return &record, nil
+	}
+	return nil, fmt.Errorf("failed to claim idempotency key after %d attempts", claimAttempts)
+}
+
+// Complete implements idempotency.Store.
+func (r *IdempotencyRepository) Complete(ctx context.Context, key string, resp idempotency.Response) error {
+	query := `
+		UPDATE idempotency_keys
+		SET status_code = $2, response_headers = $3, response_body = $4
+		WHERE key = $1
+	`
+
+	_, err := r.db.Exec(ctx, query, key, resp.StatusCode, resp.Headers, resp.Body)
+	return err
+}
+
+// Release implements idempotency.Store.
+func (r *IdempotencyRepository) Release(ctx context.Context, key string) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM idempotency_keys WHERE key = $1`, key)
+	return err
+}
@@ -0,0 +1,100 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"services/auth/internal/idempotency"
+	"services/auth/internal/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyRepository(t *testing.T) {
+	pool, cleanup := testhelpers.SetupTestDB(t)
+	defer cleanup()
+
+	testhelpers.ApplyMigrations(t, pool)
+
+	repo := NewIdempotencyRepository(pool)
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Millisecond)
+	hash := idempotency.RequestHash("POST", "/auth/sign-up", []byte(`{}`))
+
+	record, err := repo.Claim(ctx, "key-1", hash, now)
+	require.NoError(t, err)
+	assert.Nil(t, record, "the first request owns the key")
+
+	record, err = repo.Claim(ctx, "key-1", hash, now.Add(time.Second))
+	require.NoError(t, err)
+	require.NotNil(t, record)
+	assert.Nil(t, record.Response, "the first request is still in progress")
+
+	resp := idempotency.Response{StatusCode: 200, Headers: map[string]string{"Content-Type": "application/json"}, Body: `{"id":1}`}
+	require.NoError(t, repo.Complete(ctx, "key-1", resp))
+
+	record, err = repo.Claim(ctx, "key-1", hash, now.Add(time.Minute))
+	require.NoError(t, err)
+	require.NotNil(t, record)
+	assert.Equal(t, hash, record.RequestHash)
+	assert.Equal(t, &resp, record.Response)
+
+	t.Run("expired records are taken over", func(t *testing.T) {
+		record, err := repo.Claim(ctx, "key-1", hash, now.Add(idempotency.RecordTTL))
+		require.NoError(t, err)
+		assert.Nil(t, record)
+	})
+
+	t.Run("stale locks are taken over", func(t *testing.T) {
+		_, err := repo.Claim(ctx, "key-2", hash, now)
+		require.NoError(t, err)
+
+		record, err := repo.Claim(ctx, "key-2", hash, now.Add(idempotency.LockTimeout))
+		require.NoError(t, err)
+		assert.Nil(t, record)
+	})
+
+	t.Run("released keys can be claimed again", func(t *testing.T) {
+		_, err := repo.Claim(ctx, "key-3", hash, now)
+		require.NoError(t, err)
+		require.NoError(t, repo.Release(ctx, "key-3"))
+
+		record, err := repo.Claim(ctx, "key-3", hash, now)
+		require.NoError(t, err)
+		assert.Nil(t, record)
+	})
+}
+
+func TestIdempotencyRepository_Claim_Concurrent(t *testing.T) {
+	pool, cleanup := testhelpers.SetupTestDB(t)
+	defer cleanup()
+
+	testhelpers.ApplyMigrations(t, pool)
+
+	repo := NewIdempotencyRepository(pool)
+	ctx := context.Background()
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	owners := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			record, err := repo.Claim(ctx, "race", "hash", now)
+			assert.NoError(t, err)
+			if err == nil && record == nil {
+				mu.Lock()
+				owners++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, owners)
+}
@@ -0,0 +1,219 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"services/auth/internal/encryption"
+	"services/auth/internal/models"
+	"sync"
+	"time"
+)
+
+// MemoryUserRepository keeps users in process memory with the behaviour of
+// UserRepository, so flows can be tested without a database or scripted
+// mocks: emails and normalized emails are unique, deletes are soft and
+// writes record the actor of their context. It is checked against
+// UserRepository by the same conformance tests.
+//
+// Transactions are serialized: WithTx holds the store until fn returns and
+// rolls back by restoring the rows it started with. Other stores, such as
+// outbox.MemoryStore, do not take part in the transaction.
+type MemoryUserRepository struct {
+	mu     sync.Mutex
+	nextID int
+	users  map[int]models.User
+}
+
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{nextID: 1, users: make(map[int]models.User)}
+}
+
+type memoryTxKey struct {
+	repo *MemoryUserRepository
+}
+
+// lock takes the store for one call, unless ctx is in a transaction of
+// WithTx, which already holds it.
+func (r *MemoryUserRepository) lock(ctx context.Context) func() {
+	if ctx.Value(memoryTxKey{r}) != nil {
+		return func() {}
+	}
+	r.mu.Lock()
+	return r.mu.Unlock
+}
+
+// WithTx implements UserRepositoryInterface.
+func (r *MemoryUserRepository) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(memoryTxKey{r}) != nil {
+		return fn(ctx)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	nextID, users := r.nextID, maps.Clone(r.users)
+	if err := fn(context.WithValue(ctx, memoryTxKey{r}, true)); err != nil {
+		r.nextID, r.users = nextID, users
+		return err
+	}
+	return nil
+}
+
+// FindByEmail implements UserRepositoryInterface.
+func (r *MemoryUserRepository) FindByEmail(ctx context.Context, normalizedEmail string) (*models.User, error) {
+	defer r.lock(ctx)()
+	return r.find("normalized_email", func(u *models.User) bool { return u.NormalizedEmail == normalizedEmail })
+}
+
+// FindByID implements UserRepositoryInterface.
+func (r *MemoryUserRepository) FindByID(ctx context.Context, id int) (*models.User, error) {
+	defer r.lock(ctx)()
+	return r.find("id", func(u *models.User) bool { return u.ID == id })
+}
+
+// FindByCognitoID implements UserRepositoryInterface.
+func (r *MemoryUserRepository) FindByCognitoID(ctx context.Context, cognitoID string) (*models.User, error) {
+	defer r.lock(ctx)()
+	return r.find("cognito_id", func(u *models.User) bool { return u.CognitoID != nil && *u.CognitoID == cognitoID })
+}
+
+// Create implements UserRepositoryInterface.
+func (r *MemoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	defer r.lock(ctx)()
+	if index := r.taken(user); index != "" {
+		return &DuplicateError{Table: "users", Index: index}
+	}
+	r.insert(ctx, user)
+	return nil
+}
+
+// LockOrCreate implements UserRepositoryInterface. Every call holds the
+// whole store, so it needs no row lock.
+func (r *MemoryUserRepository) LockOrCreate(ctx context.Context, user *models.User) (*models.User, bool, error) {
+	defer r.lock(ctx)()
+	for _, existing := range r.users {
+		if existing.NormalizedEmail != user.NormalizedEmail {
+			continue
+		}
+		if existing.DeletedAt != nil {
+			return nil, false, ErrDeleted
+		}
+		return clone(existing), false, nil
+	}
+	if r.taken(user) != "" {
+		return nil, false, fmt.Errorf("email %s conflicts with a user stored under another identity", user.Email)
+	}
+
+	created := *user
+	r.insert(ctx, &created)
+	return &created, true, nil
+}
+
+// Update implements UserRepositoryInterface.
+func (r *MemoryUserRepository) Update(ctx context.Context, user *models.User) error {
+	defer r.lock(ctx)()
+	stored, ok := r.users[user.ID]
+	if !ok || stored.DeletedAt != nil {
+		return &NotFoundError{Table: "users", Column: "id"}
+	}
+	stored.Name = user.Name
+	stored.TemporaryPassword = opened(user.TemporaryPassword)
+	stored.CognitoID = user.CognitoID
+	stored.UpdatedAt = now()
+	stored.UpdatedBy = ActorFrom(ctx)
+	r.users[user.ID] = *clone(stored)
+
+	user.UpdatedAt, user.UpdatedBy = stored.UpdatedAt, stored.UpdatedBy
+	return nil
+}
+
+// Delete soft deletes the user with id, as UserRepository.Delete.
+func (r *MemoryUserRepository) Delete(ctx context.Context, id int) error {
+	return r.setDeleted(ctx, id, true)
+}
+
+// Restore undoes Delete, as UserRepository.Restore.
+func (r *MemoryUserRepository) Restore(ctx context.Context, id int) error {
+	return r.setDeleted(ctx, id, false)
+}
+
+func (r *MemoryUserRepository) setDeleted(ctx context.Context, id int, deleted bool) error {
+	defer r.lock(ctx)()
+	stored, ok := r.users[id]
+	if !ok || (stored.DeletedAt != nil) == deleted {
+		return &NotFoundError{Table: "users", Column: "id"}
+	}
+	stored.DeletedAt = nil
+	if deleted {
+		at := now()
+		stored.DeletedAt = &at
+	}
+	stored.UpdatedAt = now()
+	stored.UpdatedBy = ActorFrom(ctx)
+	r.users[id] = stored
+	return nil
+}
+
+// find returns a copy of the live user matching match, or a NotFoundError
+// naming by.
+func (r *MemoryUserRepository) find(by string, match func(*models.User) bool) (*models.User, error) {
+	for _, user := range r.users {
+		if user.DeletedAt == nil && match(&user) {
+			return clone(user), nil
+		}
+	}
+	return nil, &NotFoundError{Table: "users", Column: by}
+}
+
+// taken returns the unique index user would violate, if any. Soft deleted
+// users keep their addresses until they are purged.
+func (r *MemoryUserRepository) taken(user *models.User) string {
+	for _, existing := range r.users {
+		switch {
+		case existing.Email == user.Email:
+			return "users_email_key"
+		case existing.NormalizedEmail == user.NormalizedEmail:
+			return "users_normalized_email_key"
+		}
+	}
+	return ""
+}
+
+// insert stores user under the next ID, filling in what the database would.
+func (r *MemoryUserRepository) insert(ctx context.Context, user *models.User) {
+	user.ID = r.nextID
+	r.nextID++
+	user.CreatedAt = now()
+	user.UpdatedAt = user.CreatedAt
+	user.CreatedBy = ActorFrom(ctx)
+	user.UpdatedBy = user.CreatedBy
+	r.users[user.ID] = *clone(*user)
+}
+
+// clone copies user without sharing pointers with it, and with its
+// encrypted fields as a repository reads them.
+func clone(user models.User) *models.User {
+	user.TemporaryPassword = opened(user.TemporaryPassword)
+	if user.CognitoID != nil {
+		id := *user.CognitoID
+		user.CognitoID = &id
+	}
+	if user.DeletedAt != nil {
+		at := *user.DeletedAt
+		user.DeletedAt = &at
+	}
+	return &user
+}
+
+// opened returns f as scanned from the database: unbound from any keyring.
+func opened(f encryption.Field) encryption.Field {
+	if !f.Valid() {
+		return encryption.Field{}
+	}
+	return encryption.NewField(f.Plaintext())
+}
+
+// now returns the current time at the precision of TIMESTAMPTZ(3).
+func now() time.Time {
+	return time.Now().Truncate(time.Millisecond)
+}
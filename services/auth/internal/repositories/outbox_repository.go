@@ -0,0 +1,103 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"services/auth/internal/outbox"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// OutboxRepository stores outbox messages in the outbox table.
+type OutboxRepository struct {
+	db DB
+}
+
+func NewOutboxRepository(db DB) *OutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+// Enqueue implements outbox.Store. It joins the transaction carried by ctx
+// (see WithTx), so the message only exists if that transaction commits.
+func (r *OutboxRepository) Enqueue(ctx context.Context, kind string, payload any) (int64, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode %s payload: %w", kind, err)
+	}
+
+	query := `
+		INSERT INTO outbox (kind, payload)
+		VALUES ($1, $2)
+		RETURNING id
+	`
+
+	var id int64
+	if err := conn(ctx, r.db).QueryRow(ctx, query, kind, data).Scan(&id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// Claim implements outbox.Store. SKIP LOCKED lets concurrent dispatchers
+// claim disjoint batches without waiting on each other.
+func (r *OutboxRepository) Claim(ctx context.Context, now time.Time, limit int, ids ...int64) ([]outbox.Message, error) {
+	query := `
+		UPDATE outbox SET
+			attempts = attempts + 1,
+			available_at = $2
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE processed_at IS NULL
+				AND failed_at IS NULL
+				AND available_at <= $1
+				AND ($4::BIGINT[] IS NULL OR id = ANY($4))
+			ORDER BY available_at, id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, kind, payload, attempts
+	`
+
+	rows, err := conn(ctx, r.db).Query(ctx, query, now, now.Add(outbox.LeaseTimeout), limit, ids)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (outbox.Message, error) {
+		var msg outbox.Message
+		err := row.Scan(&msg.ID, &msg.Kind, &msg.Payload, &msg.Attempts)
+		return msg, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// RETURNING does not keep the order of the subquery.
+	slices.SortFunc(messages, func(a, b outbox.Message) int {
+		return int(a.ID - b.ID)
+	})
+	return messages, nil
+}
+
+// Complete implements outbox.Store.
+func (r *OutboxRepository) Complete(ctx context.Context, id int64, now time.Time) error {
+	query := `UPDATE outbox SET processed_at = $2, last_error = NULL WHERE id = $1`
+	_, err := conn(ctx, r.db).Exec(ctx, query, id, now)
+	return err
+}
+
+// Retry implements outbox.Store.
+func (r *OutboxRepository) Retry(ctx context.Context, id int64, availableAt time.Time, cause string) error {
+	query := `UPDATE outbox SET available_at = $2, last_error = $3 WHERE id = $1`
+	_, err := conn(ctx, r.db).Exec(ctx, query, id, availableAt, cause)
+	return err
+}
+
+// Fail implements outbox.Store.
+func (r *OutboxRepository) Fail(ctx context.Context, id int64, now time.Time, cause string) error {
+	query := `UPDATE outbox SET failed_at = $2, last_error = $3 WHERE id = $1`
+	_, err := conn(ctx, r.db).Exec(ctx, query, id, now, cause)
+	return err
+}
@@ -0,0 +1,156 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"services/auth/internal/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutboxRepository(t *testing.T) {
+	pool, cleanup := testhelpers.SetupTestDB(t)
+	defer cleanup()
+
+	testhelpers.ApplyMigrations(t, pool)
+
+	repo := NewOutboxRepository(pool)
+	ctx := context.Background()
+	// Messages are due from the database clock; claim a little later.
+	now := time.Now().Add(time.Second).Truncate(time.Millisecond)
+
+	first, err := repo.Enqueue(ctx, "test.first", map[string]int{"user_id": 1})
+	require.NoError(t, err)
+	second, err := repo.Enqueue(ctx, "test.second", nil)
+	require.NoError(t, err)
+
+	messages, err := repo.Claim(ctx, now, 10)
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	assert.Equal(t, first, messages[0].ID)
+	assert.Equal(t, "test.first", messages[0].Kind)
+	assert.JSONEq(t, `{"user_id":1}`, string(messages[0].Payload))
+	assert.Equal(t, 1, messages[0].Attempts)
+	assert.Equal(t, second, messages[1].ID)
+
+	messages, err = repo.Claim(ctx, now, 10)
+	require.NoError(t, err)
+	assert.Empty(t, messages, "claimed messages are leased")
+
+	require.NoError(t, repo.Complete(ctx, first, now))
+	require.NoError(t, repo.Retry(ctx, second, now.Add(time.Minute), "boom"))
+
+	t.Run("retried messages are due again at their time", func(t *testing.T) {
+		messages, err := repo.Claim(ctx, now.Add(30*time.Second), 10)
+		require.NoError(t, err)
+		assert.Empty(t, messages)
+
+		messages, err = repo.Claim(ctx, now.Add(time.Minute), 10)
+		require.NoError(t, err)
+		require.Len(t, messages, 1)
+		assert.Equal(t, second, messages[0].ID)
+		assert.Equal(t, 2, messages[0].Attempts)
+	})
+
+	t.Run("failed messages are kept", func(t *testing.T) {
+		require.NoError(t, repo.Fail(ctx, second, now, "gave up"))
+
+		messages, err := repo.Claim(ctx, now.Add(time.Hour), 10)
+		require.NoError(t, err)
+		assert.Empty(t, messages)
+
+		var lastError string
+		require.NoError(t, pool.QueryRow(ctx, `SELECT last_error FROM outbox WHERE id = $1 AND failed_at IS NOT NULL`, second).Scan(&lastError))
+		assert.Equal(t, "gave up", lastError)
+	})
+
+	t.Run("claim by id", func(t *testing.T) {
+		a, err := repo.Enqueue(ctx, "test.a", nil)
+		require.NoError(t, err)
+		b, err := repo.Enqueue(ctx, "test.b", nil)
+		require.NoError(t, err)
+
+		messages, err := repo.Claim(ctx, now, 10, b)
+		require.NoError(t, err)
+		require.Len(t, messages, 1)
+		assert.Equal(t, b, messages[0].ID)
+
+		messages, err = repo.Claim(ctx, now, 10)
+		require.NoError(t, err)
+		require.Len(t, messages, 1)
+		assert.Equal(t, a, messages[0].ID)
+	})
+}
+
+func TestOutboxRepository_Enqueue_JoinsTransaction(t *testing.T) {
+	pool, cleanup := testhelpers.SetupTestDB(t)
+	defer cleanup()
+
+	testhelpers.ApplyMigrations(t, pool)
+
+	repo := NewOutboxRepository(pool)
+	ctx := context.Background()
+
+	err := WithTx(ctx, pool, func(ctx context.Context) error {
+		_, err := repo.Enqueue(ctx, "test.rolled_back", nil)
+		require.NoError(t, err)
+		return errors.New("abort")
+	})
+	require.Error(t, err)
+
+	messages, err := repo.Claim(ctx, time.Now().Add(time.Second), 10)
+	require.NoError(t, err)
+	assert.Empty(t, messages, "messages of a rolled back transaction are never delivered")
+}
+
+func TestOutboxRepository_Claim_Concurrent(t *testing.T) {
+	pool, cleanup := testhelpers.SetupTestDB(t)
+	defer cleanup()
+
+	testhelpers.ApplyMigrations(t, pool)
+
+	repo := NewOutboxRepository(pool)
+	ctx := context.Background()
+	now := time.Now().Add(time.Second)
+
+	const total = 50
+	for range total {
+		_, err := repo.Enqueue(ctx, "test.concurrent", nil)
+		require.NoError(t, err)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		claimed = make(map[int64]int)
+	)
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				messages, err := repo.Claim(ctx, now, 3)
+				if err != nil || len(messages) == 0 {
+					assert.NoError(t, err)
+					return
+				}
+				mu.Lock()
+				for _, msg := range messages {
+					claimed[msg.ID]++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, claimed, total)
+	for id, count := range claimed {
+		assert.Equal(t, 1, count, "message %d was claimed twice", id)
+	}
+}
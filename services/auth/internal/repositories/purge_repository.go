@@ -0,0 +1,113 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SoftDeletedTables lists every table with a deleted_at column; the purge
+// handler removes their rows for good once deleted for longer than the
+// retention period.
+var SoftDeletedTables = []string{
+	"users",
+	"email_allowlist",
+	"email_blocklist",
+}
+
+// PurgeRepository removes soft deleted and expired rows.
+type PurgeRepository struct {
+	db DB
+}
+
+func NewPurgeRepository(db DB) *PurgeRepository {
+	return &PurgeRepository{db: db}
+}
+
+// Purge deletes up to limit rows of table soft deleted before deletedBefore
+// and returns how many it deleted, so large backlogs are removed in several
+// short statements.
+func (r *PurgeRepository) Purge(ctx context.Context, table string, deletedBefore time.Time, limit int) (int, error) {
+	query := fmt.Sprintf(`
+		DELETE FROM %[1]s
+		WHERE id IN (
+			SELECT id FROM %[1]s
+			WHERE deleted_at < $1
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+	`, pgx.Identifier{table}.Sanitize())
+
+	tag, err := conn(ctx, r.db).Exec(ctx, query, deletedBefore, limit)
+	if err != nil {
+		return 0, fmt.Errorf("purge %s: %w", table, err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// PurgeOutbox deletes up to limit outbox messages processed or failed before
+// finishedBefore and returns how many it deleted. Pending messages are kept
+// whatever their age.
+func (r *PurgeRepository) PurgeOutbox(ctx context.Context, finishedBefore time.Time, limit int) (int, error) {
+	query := `
+		DELETE FROM outbox
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE COALESCE(processed_at, failed_at) < $1
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+	`
+
+	tag, err := conn(ctx, r.db).Exec(ctx, query, finishedBefore, limit)
+	if err != nil {
+		return 0, fmt.Errorf("purge outbox: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// PurgeRateLimitBuckets deletes up to limit rate limit buckets last updated
+// before updatedBefore and returns how many it deleted. Callers pass a time
+// by which every bucket has refilled, so the deleted buckets were full and
+// are recreated full on the next request.
+func (r *PurgeRepository) PurgeRateLimitBuckets(ctx context.Context, updatedBefore time.Time, limit int) (int, error) {
+	query := `
+		DELETE FROM rate_limit_buckets
+		WHERE key IN (
+			SELECT key FROM rate_limit_buckets
+			WHERE updated_at < $1
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+	`
+
+	tag, err := conn(ctx, r.db).Exec(ctx, query, updatedBefore, limit)
+	if err != nil {
+		return 0, fmt.Errorf("purge rate_limit_buckets: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// PurgeIdempotencyKeys deletes up to limit idempotency keys expired at now
+// and returns how many it deleted. Claim would take them over anyway, so
+// only keys nobody reuses stay until the purge; the range on expires_at is
+// served by idempotency_keys_expires_at_idx.
+func (r *PurgeRepository) PurgeIdempotencyKeys(ctx context.Context, now time.Time, limit int) (int, error) {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE key IN (
+			SELECT key FROM idempotency_keys
+			WHERE expires_at <= $1
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+	`
+
+	tag, err := conn(ctx, r.db).Exec(ctx, query, now, limit)
+	if err != nil {
+		return 0, fmt.Errorf("purge idempotency_keys: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
@@ -0,0 +1,163 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"services/auth/internal/idempotency"
+	"services/auth/internal/models"
+	"services/auth/internal/ratelimit"
+	"services/auth/internal/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurgeRepository_Purge(t *testing.T) {
+	pool, cleanup := testhelpers.SetupTestDB(t)
+	defer cleanup()
+
+	testhelpers.ApplyMigrations(t, pool)
+
+	users := NewUserRepository(pool, testKeyring)
+	repo := NewPurgeRepository(pool)
+	ctx := context.Background()
+
+	create := func(email string) *models.User {
+		user := &models.User{Name: "User", Email: email, NormalizedEmail: email}
+		require.NoError(t, users.Create(ctx, user))
+		return user
+	}
+	live := create("live@example.com")
+	old := create("old@example.com")
+	recent := create("recent@example.com")
+	require.NoError(t, users.Delete(ctx, old.ID))
+	require.NoError(t, users.Delete(ctx, recent.ID))
+	_, err := pool.Exec(ctx, `UPDATE users SET deleted_at = NOW() - INTERVAL '31 days' WHERE id = $1`, old.ID)
+	require.NoError(t, err)
+
+	purged, err := repo.Purge(ctx, "users", time.Now().Add(-30*24*time.Hour), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	assert.ErrorIs(t, users.Restore(ctx, old.ID), ErrNotFound, "purged users cannot be restored")
+	require.NoError(t, users.Restore(ctx, recent.ID))
+	_, err = users.FindByID(ctx, live.ID)
+	assert.NoError(t, err)
+}
+
+func TestPurgeRepository_PurgeOutbox(t *testing.T) {
+	pool, cleanup := testhelpers.SetupTestDB(t)
+	defer cleanup()
+
+	testhelpers.ApplyMigrations(t, pool)
+
+	outbox := NewOutboxRepository(pool)
+	repo := NewPurgeRepository(pool)
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Millisecond)
+	retention := 30 * 24 * time.Hour
+
+	enqueue := func() int64 {
+		id, err := outbox.Enqueue(ctx, "test.message", nil)
+		require.NoError(t, err)
+		return id
+	}
+	processed := enqueue()
+	require.NoError(t, outbox.Complete(ctx, processed, now.Add(-retention-time.Hour)))
+	failed := enqueue()
+	require.NoError(t, outbox.Fail(ctx, failed, now.Add(-retention-time.Hour), "boom"))
+	recent := enqueue()
+	require.NoError(t, outbox.Complete(ctx, recent, now))
+	pending := enqueue()
+	_, err := pool.Exec(ctx, `UPDATE outbox SET created_at = $2 WHERE id = $1`, pending, now.Add(-2*retention))
+	require.NoError(t, err)
+
+	purged, err := repo.PurgeOutbox(ctx, now.Add(-retention), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 2, purged)
+
+	var ids []int64
+	rows, err := pool.Query(ctx, `SELECT id FROM outbox ORDER BY id`)
+	require.NoError(t, err)
+	for rows.Next() {
+		var id int64
+		require.NoError(t, rows.Scan(&id))
+		ids = append(ids, id)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []int64{recent, pending}, ids, "recent and pending messages are kept")
+}
+
+func TestPurgeRepository_PurgeIdempotencyKeys(t *testing.T) {
+	pool, cleanup := testhelpers.SetupTestDB(t)
+	defer cleanup()
+
+	testhelpers.ApplyMigrations(t, pool)
+
+	keys := NewIdempotencyRepository(pool)
+	repo := NewPurgeRepository(pool)
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Millisecond)
+	hash := idempotency.RequestHash("POST", "/auth/sign-up", []byte(`{}`))
+
+	for _, key := range []string{"old-1", "old-2", "old-3"} {
+		_, err := keys.Claim(ctx, key, hash, now.Add(-idempotency.RecordTTL))
+		require.NoError(t, err)
+	}
+	_, err := keys.Claim(ctx, "live", hash, now)
+	require.NoError(t, err)
+
+	purged, err := repo.PurgeIdempotencyKeys(ctx, now, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, purged, "at most one batch is deleted")
+	purged, err = repo.PurgeIdempotencyKeys(ctx, now, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	var keysLeft []string
+	rows, err := pool.Query(ctx, `SELECT key FROM idempotency_keys`)
+	require.NoError(t, err)
+	for rows.Next() {
+		var key string
+		require.NoError(t, rows.Scan(&key))
+		keysLeft = append(keysLeft, key)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []string{"live"}, keysLeft)
+}
+
+func TestPurgeRepository_PurgeRateLimitBuckets(t *testing.T) {
+	pool, cleanup := testhelpers.SetupTestDB(t)
+	defer cleanup()
+
+	testhelpers.ApplyMigrations(t, pool)
+
+	buckets := NewRateLimitRepository(pool)
+	repo := NewPurgeRepository(pool)
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Millisecond)
+	limit := ratelimit.Limit{Burst: 2, Interval: time.Minute}
+
+	_, err := buckets.Take(ctx, "signup_ip:old", limit, now.Add(-time.Hour))
+	require.NoError(t, err)
+	_, err = buckets.Take(ctx, "signup_ip:recent", limit, now)
+	require.NoError(t, err)
+
+	refill, _ := limit.RefillTime()
+	purged, err := repo.PurgeRateLimitBuckets(ctx, now.Add(-refill), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	var keys []string
+	rows, err := pool.Query(ctx, `SELECT key FROM rate_limit_buckets`)
+	require.NoError(t, err)
+	for rows.Next() {
+		var key string
+		require.NoError(t, rows.Scan(&key))
+		keys = append(keys, key)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []string{"signup_ip:recent"}, keys)
+}
@@ -0,0 +1,164 @@
+package repositories
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultPageLimit is the number of rows of a page when the request
+	// does not say.
+	DefaultPageLimit = 50
+	// MaxPageLimit bounds the rows of a page, whatever the request asks.
+	MaxPageLimit = 200
+)
+
+// ErrInvalidCursor is returned for a page cursor that was not returned as
+// Page.Next.
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+// PageRequest asks for up to Limit rows following the row Cursor points at.
+// The zero value asks for the first DefaultPageLimit rows.
+type PageRequest struct {
+	// Cursor is the Next of the previous page, or "" for the first page.
+	Cursor string
+	Limit  int
+}
+
+func (r PageRequest) limit() int {
+	switch {
+	case r.Limit <= 0:
+		return DefaultPageLimit
+	case r.Limit > MaxPageLimit:
+		return MaxPageLimit
+	default:
+		return r.Limit
+	}
+}
+
+// Page is one page of rows. Pages are keyset paginated: they follow the
+// last row of the previous page rather than skipping an offset, so rows
+// inserted or deleted meanwhile neither repeat nor go missing.
+type Page[T any] struct {
+	Items []T
+	// Next is the cursor of the following page, or "" on the last page.
+	Next string
+}
+
+// Cursors are the ID of the last row of a page, kept opaque so clients do
+// not build their own.
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func decodeCursor(cursor string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || id < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return id, nil
+}
+
+// query builds a SELECT statement. Conditions reference their arguments
+// through arg, which numbers the placeholders:
+//
+//	q.where("normalized_email = " + q.arg(email))
+type query struct {
+	from    string
+	columns string
+	// live is the condition excluding soft deleted rows, if any.
+	live    string
+	conds   []string
+	args    []any
+	orderBy string
+	limit   int
+	lock    string
+	// stale lets the query run on the read replica of its table.
+	stale bool
+}
+
+// arg adds v to the arguments of the query and returns its placeholder.
+func (q *query) arg(v any) string {
+	q.args = append(q.args, v)
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+// where restricts the query to the rows matching cond, in addition to the
+// previous conditions.
+func (q *query) where(cond string) *query {
+	q.conds = append(q.conds, cond)
+	return q
+}
+
+// includeDeleted makes the query match soft deleted rows too.
+func (q *query) includeDeleted() *query {
+	q.live = ""
+	return q
+}
+
+// forUpdate locks the selected rows until the transaction ends.
+func (q *query) forUpdate() *query {
+	q.lock = "FOR UPDATE"
+	return q
+}
+
+// allowStale lets the query run on the read replica of its table, for reads
+// that tolerate replication lag. Locking queries and queries in a
+// transaction still run on the primary.
+func (q *query) allowStale() *query {
+	q.stale = true
+	return q
+}
+
+// keyset restricts the query to the page req asks for, fetching one more row
+// than the limit to tell whether another page follows.
+func (q *query) keyset(req PageRequest, newestFirst bool) error {
+	op, order := ">", "id"
+	if newestFirst {
+		op, order = "<", "id DESC"
+	}
+	if req.Cursor != "" {
+		after, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return err
+		}
+		q.where("id " + op + " " + q.arg(after))
+	}
+	q.orderBy = order
+	q.limit = req.limit() + 1
+	return nil
+}
+
+func (q *query) sql() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "SELECT %s FROM %s", q.columns, q.from)
+	conds := q.conds
+	if q.live != "" {
+		conds = append([]string{q.live}, conds...)
+	}
+	for i, cond := range conds {
+		if i == 0 {
+			b.WriteString(" WHERE ")
+		} else {
+			b.WriteString(" AND ")
+		}
+		b.WriteString("(" + cond + ")")
+	}
+	if q.orderBy != "" {
+		b.WriteString(" ORDER BY " + q.orderBy)
+	}
+	if q.limit > 0 {
+		fmt.Fprintf(&b, " LIMIT %d", q.limit)
+	}
+	if q.lock != "" {
+		b.WriteString(" " + q.lock)
+	}
+	return b.String()
+}
@@ -0,0 +1,51 @@
+package repositories
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuery_SQL(t *testing.T) {
+	q := &query{from: `"users"`, columns: `"id", "name"`}
+	q.where("normalized_email = " + q.arg("john@example.com"))
+	q.where("id = " + q.arg(7) + " OR id = " + q.arg(8)).forUpdate()
+	q.orderBy = "id"
+	q.limit = 10
+
+	assert.Equal(t, `SELECT "id", "name" FROM "users" WHERE (normalized_email = $1) AND (id = $2 OR id = $3) ORDER BY id LIMIT 10 FOR UPDATE`, q.sql())
+	assert.Equal(t, []any{"john@example.com", 7, 8}, q.args)
+}
+
+func TestQuery_Keyset(t *testing.T) {
+	t.Run("first page", func(t *testing.T) {
+		q := &query{from: "t", columns: "id"}
+		require.NoError(t, q.keyset(PageRequest{Limit: 20}, false))
+
+		assert.Equal(t, "SELECT id FROM t ORDER BY id LIMIT 21", q.sql())
+		assert.Empty(t, q.args)
+	})
+
+	t.Run("newest first after a cursor", func(t *testing.T) {
+		q := &query{from: "t", columns: "id"}
+		require.NoError(t, q.keyset(PageRequest{Cursor: encodeCursor(42)}, true))
+
+		assert.Equal(t, "SELECT id FROM t WHERE (id < $1) ORDER BY id DESC LIMIT 51", q.sql())
+		assert.Equal(t, []any{int64(42)}, q.args)
+	})
+
+	t.Run("invalid cursors", func(t *testing.T) {
+		for _, cursor := range []string{"not base64!", encodeCursor(-1), "YWJj"} {
+			q := &query{from: "t", columns: "id"}
+			assert.ErrorIs(t, q.keyset(PageRequest{Cursor: cursor}, false), ErrInvalidCursor, cursor)
+		}
+	})
+}
+
+func TestPageRequest_Limit(t *testing.T) {
+	assert.Equal(t, DefaultPageLimit, PageRequest{}.limit())
+	assert.Equal(t, DefaultPageLimit, PageRequest{Limit: -1}.limit())
+	assert.Equal(t, 5, PageRequest{Limit: 5}.limit())
+	assert.Equal(t, MaxPageLimit, PageRequest{Limit: MaxPageLimit + 1}.limit())
+}
@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"context"
+	"services/auth/internal/ratelimit"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RateLimitRepository stores the rate limiter's token buckets in
+// rate_limit_buckets so every Lambda instance shares them.
+type RateLimitRepository struct {
+	db DB
+}
+
+func NewRateLimitRepository(db DB) *RateLimitRepository {
+	return &RateLimitRepository{db: db}
+}
+
+// Take implements ratelimit.Store. The bucket row is locked for the duration
+// of the transaction, so concurrent requests for the same key are serialized.
+func (r *RateLimitRepository) Take(ctx context.Context, key string, limit ratelimit.Limit, now time.Time) (ratelimit.Decision, error) {
+	var decision ratelimit.Decision
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		full := limit.Full(now)
+		_, err := tx.Exec(ctx, `
+			INSERT INTO rate_limit_buckets (key, tokens, updated_at)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (key) DO NOTHING
+		`, key, full.Tokens, full.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		var bucket ratelimit.Bucket
+		err = tx.QueryRow(ctx, `
+			SELECT tokens, updated_at
+			FROM rate_limit_buckets
+			WHERE key = $1
+			FOR UPDATE
+		`, key).Scan(&bucket.Tokens, &bucket.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		bucket, decision = limit.Take(bucket, now)
+		_, err = tx.Exec(ctx, `
+			UPDATE rate_limit_buckets
+			SET tokens = $2, updated_at = $3
+			WHERE key = $1
+		`, key, bucket.Tokens, bucket.UpdatedAt)
+		return err
+	})
+	if err != nil {
+		return ratelimit.Decision{}, err
+	}
+	return decision, nil
+}
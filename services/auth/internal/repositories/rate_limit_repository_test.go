@@ -0,0 +1,77 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"services/auth/internal/ratelimit"
+	"services/auth/internal/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitRepository_Take(t *testing.T) {
+	pool, cleanup := testhelpers.SetupTestDB(t)
+	defer cleanup()
+
+	testhelpers.ApplyMigrations(t, pool)
+
+	repo := NewRateLimitRepository(pool)
+	ctx := context.Background()
+	limit := ratelimit.Limit{Burst: 2, Interval: time.Minute}
+	now := time.Now().Truncate(time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		decision, err := repo.Take(ctx, "signup_ip:a", limit, now)
+		require.NoError(t, err)
+		assert.True(t, decision.Allowed)
+	}
+
+	decision, err := repo.Take(ctx, "signup_ip:a", limit, now.Add(30*time.Second))
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, 30*time.Second, decision.RetryAfter)
+
+	decision, err = repo.Take(ctx, "signup_ip:b", limit, now)
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed, "buckets are independent")
+
+	decision, err = repo.Take(ctx, "signup_ip:a", limit, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed, "the bucket refills over time")
+}
+
+func TestRateLimitRepository_Take_Concurrent(t *testing.T) {
+	pool, cleanup := testhelpers.SetupTestDB(t)
+	defer cleanup()
+
+	testhelpers.ApplyMigrations(t, pool)
+
+	repo := NewRateLimitRepository(pool)
+	ctx := context.Background()
+	limit := ratelimit.Limit{Burst: 5, Interval: time.Hour}
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			decision, err := repo.Take(ctx, "signup_email:x", limit, now)
+			assert.NoError(t, err)
+			if decision.Allowed {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 5, allowed)
+}
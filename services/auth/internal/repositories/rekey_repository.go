@@ -0,0 +1,154 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"services/auth/internal/encryption"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RekeyFunc re-seals a stored value for the field it is bound to, reporting
+// whether it changed.
+type RekeyFunc func(ctx context.Context, ciphertext string, binding encryption.Binding) (string, bool, error)
+
+// RekeyBatch reports the progress of RekeyRepository.RekeyBatch and
+// ReindexBatch.
+type RekeyBatch struct {
+	// LastID is the highest row ID scanned, to resume from.
+	LastID  int64
+	Scanned int
+	Rekeyed int
+}
+
+type RekeyRepository struct {
+	db DB
+}
+
+func NewRekeyRepository(db DB) *RekeyRepository {
+	return &RekeyRepository{db: db}
+}
+
+// RekeyBatch passes the values of col in up to limit rows with an ID above
+// afterID to rekey, and stores those it changed. The batch runs in one
+// transaction holding its rows locked, so concurrent writes are not lost.
+func (r *RekeyRepository) RekeyBatch(ctx context.Context, col EncryptedColumn, afterID int64, limit int, rekey RekeyFunc) (RekeyBatch, error) {
+	table := pgx.Identifier{col.Table}.Sanitize()
+	column := pgx.Identifier{col.Column}.Sanitize()
+	selectQuery := fmt.Sprintf(`
+		SELECT id, %[2]s
+		FROM %[1]s
+		WHERE id > $1 AND %[2]s IS NOT NULL
+		ORDER BY id
+		LIMIT $2
+		FOR UPDATE
+	`, table, column)
+	updateQuery := fmt.Sprintf(`UPDATE %s SET %s = $2 WHERE id = $1`, table, column)
+
+	batch := RekeyBatch{LastID: afterID}
+	err := WithTx(ctx, r.db, func(ctx context.Context) error {
+		rows, err := conn(ctx, r.db).Query(ctx, selectQuery, afterID, limit)
+		if err != nil {
+			return err
+		}
+		type row struct {
+			id    int64
+			value string
+		}
+		values, err := pgx.CollectRows(rows, func(rows pgx.CollectableRow) (row, error) {
+			var v row
+			err := rows.Scan(&v.id, &v.value)
+			return v, err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, v := range values {
+			batch.LastID = v.id
+			batch.Scanned++
+
+			rekeyed, changed, err := rekey(ctx, v.value, col.Binding(v.id))
+			if err != nil {
+				return fmt.Errorf("%s of row %d: %w", col, v.id, err)
+			}
+			if !changed {
+				continue
+			}
+			if _, err := conn(ctx, r.db).Exec(ctx, updateQuery, v.id, rekeyed); err != nil {
+				return err
+			}
+			batch.Rekeyed++
+		}
+		return nil
+	})
+	if err != nil {
+		return RekeyBatch{LastID: afterID}, err
+	}
+	return batch, nil
+}
+
+// ReindexFunc recomputes the blind index of a sealed value bound to binding,
+// given its stored index (nil when missing), reporting whether it changed.
+type ReindexFunc func(ctx context.Context, sealed string, binding encryption.Binding, index *string) (string, bool, error)
+
+// ReindexBatch passes the source values and indexes of col in up to limit
+// rows with an ID above afterID to reindex, and stores the indexes it
+// changed, like RekeyBatch.
+func (r *RekeyRepository) ReindexBatch(ctx context.Context, col BlindIndexColumn, afterID int64, limit int, reindex ReindexFunc) (RekeyBatch, error) {
+	table := pgx.Identifier{col.Source.Table}.Sanitize()
+	source := pgx.Identifier{col.Source.Column}.Sanitize()
+	column := pgx.Identifier{col.Column}.Sanitize()
+	selectQuery := fmt.Sprintf(`
+		SELECT id, %[2]s, %[3]s
+		FROM %[1]s
+		WHERE id > $1 AND %[2]s IS NOT NULL
+		ORDER BY id
+		LIMIT $2
+		FOR UPDATE
+	`, table, source, column)
+	updateQuery := fmt.Sprintf(`UPDATE %s SET %s = $2 WHERE id = $1`, table, column)
+
+	batch := RekeyBatch{LastID: afterID}
+	err := WithTx(ctx, r.db, func(ctx context.Context) error {
+		rows, err := conn(ctx, r.db).Query(ctx, selectQuery, afterID, limit)
+		if err != nil {
+			return err
+		}
+		type row struct {
+			id     int64
+			sealed string
+			index  *string
+		}
+		values, err := pgx.CollectRows(rows, func(rows pgx.CollectableRow) (row, error) {
+			var v row
+			err := rows.Scan(&v.id, &v.sealed, &v.index)
+			return v, err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, v := range values {
+			batch.LastID = v.id
+			batch.Scanned++
+
+			index, changed, err := reindex(ctx, v.sealed, col.Source.Binding(v.id), v.index)
+			if err != nil {
+				return fmt.Errorf("%s of row %d: %w", col, v.id, err)
+			}
+			if !changed {
+				continue
+			}
+			if _, err := conn(ctx, r.db).Exec(ctx, updateQuery, v.id, index); err != nil {
+				return err
+			}
+			batch.Rekeyed++
+		}
+		return nil
+	})
+	if err != nil {
+		return RekeyBatch{LastID: afterID}, err
+	}
+	return batch, nil
+}
@@ -0,0 +1,90 @@
+package repositories
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"services/auth/internal/encryption"
+	"services/auth/internal/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRekeyRepository_RekeyBatch(t *testing.T) {
+	pool, cleanup := testhelpers.SetupTestDB(t)
+	defer cleanup()
+
+	testhelpers.ApplyMigrations(t, pool)
+
+	ctx := context.Background()
+	oldKey := encryption.Key{ID: "k1", Secret: "old-secret-key-123456789012345678"}
+	newKey := encryption.Key{ID: "k2", Secret: "new-secret-key-123456789012345678"}
+	before, err := encryption.NewKeyring(oldKey)
+	require.NoError(t, err)
+	after, err := encryption.NewKeyring(newKey, oldKey)
+	require.NoError(t, err)
+
+	col := UsersTemporaryPassword
+	legacy, err := encryption.Encrypt("first", oldKey.Secret)
+	require.NoError(t, err)
+	underOld, err := before.Encrypt(ctx, "second", col.Binding(2))
+	require.NoError(t, err)
+	current, err := after.Encrypt(ctx, "third", col.Binding(4))
+	require.NoError(t, err)
+
+	for i, password := range []*string{&legacy, &underOld, nil, &current} {
+		email := string(rune('a'+i)) + "@example.com"
+		_, err := pool.Exec(ctx, `INSERT INTO users (name, email, normalized_email, temporary_password, created_by, updated_by) VALUES ('User', $1, $1, $2, 'test', 'test')`, email, password)
+		require.NoError(t, err)
+	}
+
+	repo := NewRekeyRepository(pool)
+
+	batch, err := repo.RekeyBatch(ctx, col, 0, 2, after.Rekey)
+	require.NoError(t, err)
+	assert.Equal(t, RekeyBatch{LastID: 2, Scanned: 2, Rekeyed: 2}, batch)
+
+	batch, err = repo.RekeyBatch(ctx, col, batch.LastID, 2, after.Rekey)
+	require.NoError(t, err)
+	assert.Equal(t, RekeyBatch{LastID: 4, Scanned: 1, Rekeyed: 0}, batch, "NULL values are skipped")
+
+	batch, err = repo.RekeyBatch(ctx, col, batch.LastID, 2, after.Rekey)
+	require.NoError(t, err)
+	assert.Equal(t, RekeyBatch{LastID: 4}, batch)
+
+	rows, err := pool.Query(ctx, `SELECT id, temporary_password FROM users WHERE temporary_password IS NOT NULL ORDER BY id`)
+	require.NoError(t, err)
+	var plaintexts []string
+	for rows.Next() {
+		var id int64
+		var sealed string
+		require.NoError(t, rows.Scan(&id, &sealed))
+		assert.True(t, strings.HasPrefix(sealed, "v3:k2:"), sealed)
+
+		plaintext, err := after.Decrypt(ctx, sealed, col.Binding(id))
+		require.NoError(t, err)
+		plaintexts = append(plaintexts, plaintext)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []string{"first", "second", "third"}, plaintexts)
+}
+
+func TestRekeyRepository_RekeyBatch_RollsBackOnError(t *testing.T) {
+	pool, cleanup := testhelpers.SetupTestDB(t)
+	defer cleanup()
+
+	testhelpers.ApplyMigrations(t, pool)
+
+	ctx := context.Background()
+	_, err := pool.Exec(ctx, `INSERT INTO users (name, email, normalized_email, temporary_password, created_by, updated_by) VALUES ('User', 'a@example.com', 'a@example.com', 'v1:k0:AAAA', 'test', 'test')`)
+	require.NoError(t, err)
+
+	ring := encryption.SingleKey("test-secret-key-1234567890123456")
+	batch, err := NewRekeyRepository(pool).RekeyBatch(ctx, UsersTemporaryPassword, 0, 10, ring.Rekey)
+
+	require.ErrorIs(t, err, encryption.ErrUnknownKey)
+	assert.Contains(t, err.Error(), "users.temporary_password of row 1")
+	assert.Equal(t, RekeyBatch{}, batch)
+}
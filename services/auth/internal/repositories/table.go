@@ -0,0 +1,277 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"services/auth/internal/encryption"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var fieldType = reflect.TypeFor[encryption.Field]()
+
+// table maps the rows of a table to the model T through the db tags of its
+// fields, including those of embedded structs. Fields without a tag or
+// tagged "-" are not stored. Encrypted fields (encryption.Field) are sealed
+// and opened as the EncryptedColumn named by the table and their tag, bound
+// to the "id" of the row, which must then be an int field rather than an
+// int64.
+//
+// Tables with a "deleted_at" column are soft deleted: their queries skip
+// deleted rows unless asked not to, and delete and restore set and clear
+// the column instead of removing the row.
+//
+// Inserts through the table record the actor of the context as the creator
+// and updater of the row, so tables written this way cannot skip them.
+type table[T any] struct {
+	name string
+	db   DB
+	// replica serves the queries allowed to read stale rows, if set.
+	replica DB
+	keyring *encryption.Keyring
+	// columns starts with "id", when T has one, so the ID is scanned before
+	// the encrypted fields bound to it.
+	columns     []column
+	softDeleted bool
+	encrypted   bool
+}
+
+type column struct {
+	name      string
+	index     []int
+	encrypted bool
+}
+
+// newTable returns the mapping of T to the table name, queried through db
+// and sealing encrypted fields with keyring. It panics when T cannot be
+// mapped, which is a programming error.
+func newTable[T any](db DB, keyring *encryption.Keyring, name string) *table[T] {
+	t := &table[T]{name: name, db: db, keyring: keyring}
+	t.addFields(reflect.TypeFor[T](), nil)
+
+	idKind := reflect.Invalid
+	for i, c := range t.columns {
+		if c.name == "id" {
+			idKind = reflect.TypeFor[T]().FieldByIndex(c.index).Type.Kind()
+			if idKind != reflect.Int && idKind != reflect.Int64 {
+				panic(fmt.Sprintf("repositories: %s.id must be an integer", name))
+			}
+			copy(t.columns[1:i+1], t.columns[:i])
+			t.columns[0] = c
+		}
+		t.encrypted = t.encrypted || c.encrypted
+		t.softDeleted = t.softDeleted || c.name == "deleted_at"
+	}
+	if t.encrypted && idKind != reflect.Int {
+		panic(fmt.Sprintf("repositories: %s has encrypted columns but no int id", name))
+	}
+	return t
+}
+
+func (t *table[T]) addFields(typ reflect.Type, index []int) {
+	for i := range typ.NumField() {
+		f := typ.Field(i)
+		fieldIndex := append(append([]int(nil), index...), i)
+		tag, tagged := f.Tag.Lookup("db")
+		if f.Anonymous && !tagged && f.Type.Kind() == reflect.Struct {
+			t.addFields(f.Type, fieldIndex)
+			continue
+		}
+		if !f.IsExported() || !tagged || tag == "-" {
+			continue
+		}
+		t.columns = append(t.columns, column{name: tag, index: fieldIndex, encrypted: f.Type == fieldType})
+	}
+}
+
+// hasID reports whether the rows of the table have an "id".
+func (t *table[T]) hasID() bool {
+	return len(t.columns) > 0 && t.columns[0].name == "id"
+}
+
+// hasColumn reports whether T maps the column name.
+func (t *table[T]) hasColumn(name string) bool {
+	for _, c := range t.columns {
+		if c.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// selectQuery returns a query of every column of the table, skipping soft
+// deleted rows.
+func (t *table[T]) selectQuery() *query {
+	names := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		names[i] = pgx.Identifier{c.name}.Sanitize()
+	}
+	q := &query{from: pgx.Identifier{t.name}.Sanitize(), columns: strings.Join(names, ", ")}
+	if t.softDeleted {
+		q.live = "deleted_at IS NULL"
+	}
+	return q
+}
+
+// scanTargets returns the scan targets of the columns of the table in dst,
+// opening encrypted columns under ctx.
+func (t *table[T]) scanTargets(ctx context.Context, dst *T) []any {
+	v := reflect.ValueOf(dst).Elem()
+	targets := make([]any, len(t.columns))
+	var id *int
+	for i, c := range t.columns {
+		target := v.FieldByIndex(c.index).Addr().Interface()
+		switch {
+		case c.name == "id":
+			id, _ = target.(*int)
+		case c.encrypted:
+			col := EncryptedColumn{Table: t.name, Column: c.name}
+			target = col.bind(ctx, t.keyring, target.(*encryption.Field), id)
+		}
+		targets[i] = target
+	}
+	return targets
+}
+
+// id returns the ID of row.
+func (t *table[T]) id(row *T) int64 {
+	return reflect.ValueOf(row).Elem().FieldByIndex(t.columns[0].index).Int()
+}
+
+// conn returns what q runs on: the transaction carried by ctx, else the
+// replica when q allows stale reads and does not lock, else the primary.
+func (t *table[T]) conn(ctx context.Context, q *query) DB {
+	if q.stale && q.lock == "" && t.replica != nil {
+		return conn(ctx, t.replica)
+	}
+	return conn(ctx, t.db)
+}
+
+// get returns the row matched by q. When there is none, it returns a
+// NotFoundError naming by, the column q looks the row up by.
+func (t *table[T]) get(ctx context.Context, q *query, by string) (*T, error) {
+	var row T
+	err := t.conn(ctx, q).QueryRow(ctx, q.sql(), q.args...).Scan(t.scanTargets(ctx, &row)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, &NotFoundError{Table: t.name, Column: by}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// list returns the rows matched by q.
+func (t *table[T]) list(ctx context.Context, q *query) ([]T, error) {
+	rows, err := t.conn(ctx, q).Query(ctx, q.sql(), q.args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(rows pgx.CollectableRow) (T, error) {
+		var row T
+		err := rows.Scan(t.scanTargets(ctx, &row)...)
+		return row, err
+	})
+}
+
+// page returns the page of the rows matched by q that req asks for, in the
+// order of their IDs, newest first when newestFirst is set. It replaces the
+// order and limit of q.
+func (t *table[T]) page(ctx context.Context, q *query, req PageRequest, newestFirst bool) (Page[T], error) {
+	if !t.hasID() {
+		return Page[T]{}, fmt.Errorf("%s has no id to paginate by", t.name)
+	}
+	if err := q.keyset(req, newestFirst); err != nil {
+		return Page[T]{}, err
+	}
+	rows, err := t.list(ctx, q)
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	page := Page[T]{Items: rows}
+	if limit := req.limit(); len(rows) > limit {
+		page.Items = rows[:limit]
+		page.Next = encodeCursor(t.id(&page.Items[limit-1]))
+	}
+	return page, nil
+}
+
+// insert stores row, recording the actor of ctx as its creator and
+// updater, and scans the stored row back into it with the ID and timestamps
+// filled by the database. It returns a DuplicateError when a unique value
+// is taken. Tables with encrypted columns insert by hand, since their
+// values are bound to an ID reserved first.
+func (t *table[T]) insert(ctx context.Context, row *T) error {
+	query, args, err := t.insertQuery(ctx, row)
+	if err != nil {
+		return err
+	}
+	err = conn(ctx, t.db).QueryRow(ctx, query, args...).Scan(t.scanTargets(ctx, row)...)
+	return duplicateError(t.name, err)
+}
+
+func (t *table[T]) insertQuery(ctx context.Context, row *T) (string, []any, error) {
+	if t.encrypted {
+		return "", nil, fmt.Errorf("%s has encrypted columns and cannot be inserted generically", t.name)
+	}
+	v := reflect.ValueOf(row).Elem()
+	var columns, values, returning []string
+	var args []any
+	for _, c := range t.columns {
+		name := pgx.Identifier{c.name}.Sanitize()
+		returning = append(returning, name)
+		switch c.name {
+		case "id", "created_at", "updated_at", "deleted_at":
+			continue
+		case "created_by", "updated_by":
+			args = append(args, ActorFrom(ctx))
+		default:
+			args = append(args, v.FieldByIndex(c.index).Interface())
+		}
+		columns = append(columns, name)
+		values = append(values, fmt.Sprintf("$%d", len(args)))
+	}
+	query := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s) RETURNING %s`, pgx.Identifier{t.name}.Sanitize(),
+		strings.Join(columns, ", "), strings.Join(values, ", "), strings.Join(returning, ", "))
+	return query, args, nil
+}
+
+// softDelete marks the row with id deleted by the actor of ctx. It returns a
+// NotFoundError when no live row has id.
+func (t *table[T]) softDelete(ctx context.Context, id int) error {
+	return t.setDeleted(ctx, id, true)
+}
+
+// restore clears the deletion of the row with id, recording the actor of
+// ctx. It returns a NotFoundError when no deleted row has id, e.g. because
+// it was purged.
+func (t *table[T]) restore(ctx context.Context, id int) error {
+	return t.setDeleted(ctx, id, false)
+}
+
+func (t *table[T]) setDeleted(ctx context.Context, id int, deleted bool) error {
+	if !t.softDeleted {
+		return fmt.Errorf("%s is not soft deleted", t.name)
+	}
+	set, match := "deleted_at = NOW()", "deleted_at IS NULL"
+	if !deleted {
+		set, match = "deleted_at = NULL", "deleted_at IS NOT NULL"
+	}
+	if t.hasColumn("updated_at") {
+		set += ", updated_at = NOW()"
+	}
+	query := fmt.Sprintf(`UPDATE %s SET %s, updated_by = $2 WHERE id = $1 AND %s`, pgx.Identifier{t.name}.Sanitize(), set, match)
+
+	tag, err := conn(ctx, t.db).Exec(ctx, query, id, ActorFrom(ctx))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return &NotFoundError{Table: t.name, Column: "id"}
+	}
+	return nil
+}
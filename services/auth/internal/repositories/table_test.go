@@ -0,0 +1,152 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"services/auth/internal/encryption"
+	"services/auth/internal/models"
+	"services/auth/internal/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type timestamps struct {
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type note struct {
+	Title string           `db:"title"`
+	Body  encryption.Field `db:"body"`
+	ID    int              `db:"id"`
+	timestamps
+	Draft   bool `db:"-"`
+	Comment string
+}
+
+func TestNewTable_Columns(t *testing.T) {
+	notes := newTable[note](nil, testKeyring, "notes")
+
+	assert.Equal(t, `SELECT "id", "title", "body", "created_at" FROM "notes"`, notes.selectQuery().sql())
+	assert.True(t, notes.hasID())
+
+	assert.PanicsWithValue(t, "repositories: bodies has encrypted columns but no int id", func() {
+		newTable[struct {
+			Body encryption.Field `db:"body"`
+		}](nil, testKeyring, "bodies")
+	})
+	assert.PanicsWithValue(t, "repositories: bodies has encrypted columns but no int id", func() {
+		newTable[struct {
+			ID   int64            `db:"id"`
+			Body encryption.Field `db:"body"`
+		}](nil, testKeyring, "bodies")
+	})
+	assert.PanicsWithValue(t, "repositories: keys.id must be an integer", func() {
+		newTable[struct {
+			ID string `db:"id"`
+		}](nil, testKeyring, "keys")
+	})
+}
+
+func TestTable_InsertQuery(t *testing.T) {
+	entries := newTable[models.EmailListEntry](nil, nil, "email_blocklist")
+	ctx := WithActor(context.Background(), "admin")
+
+	query, args, err := entries.insertQuery(ctx, &models.EmailListEntry{Pattern: "spammer.com"})
+	require.NoError(t, err)
+	assert.Equal(t, `INSERT INTO "email_blocklist" ("pattern", "note", "created_by", "updated_by") VALUES ($1, $2, $3, $4) `+
+		`RETURNING "id", "pattern", "note", "created_at", "updated_at", "created_by", "updated_by", "deleted_at"`, query)
+	assert.Equal(t, []any{"spammer.com", (*string)(nil), "admin", "admin"}, args, "the actor is recorded")
+
+	notes := newTable[note](nil, testKeyring, "notes")
+	_, _, err = notes.insertQuery(ctx, &note{})
+	assert.Error(t, err, "encrypted values need their ID first")
+}
+
+// namedDB is a DB that is told apart by its name; it cannot run queries.
+type namedDB struct {
+	DB
+	name string
+}
+
+func TestTable_Conn(t *testing.T) {
+	primary, replica := &namedDB{name: "primary"}, &namedDB{name: "replica"}
+	notes := newTable[note](primary, testKeyring, "notes")
+	ctx := context.Background()
+
+	assert.Same(t, primary, notes.conn(ctx, notes.selectQuery().allowStale()), "without a replica")
+
+	notes.replica = replica
+	assert.Same(t, primary, notes.conn(ctx, notes.selectQuery()))
+	assert.Same(t, replica, notes.conn(ctx, notes.selectQuery().allowStale()))
+	assert.Same(t, primary, notes.conn(ctx, notes.selectQuery().allowStale().forUpdate()), "locking reads")
+}
+
+func TestTable_GetAndPage(t *testing.T) {
+	pool, cleanup := testhelpers.SetupTestDB(t)
+	defer cleanup()
+
+	testhelpers.ApplyMigrations(t, pool)
+
+	repo := NewUserRepository(pool, testKeyring)
+	ctx := context.Background()
+	for i := range 5 {
+		email := fmt.Sprintf("user%d@example.com", i)
+		user := &models.User{Name: "User", Email: email, NormalizedEmail: email, TemporaryPassword: encryption.NewField(fmt.Sprintf("secret-%d", i))}
+		require.NoError(t, repo.Create(ctx, user))
+	}
+	users := newTable[models.User](pool, testKeyring, "users")
+
+	t.Run("get opens encrypted fields", func(t *testing.T) {
+		q := users.selectQuery()
+		user, err := users.get(ctx, q.where("normalized_email = "+q.arg("user3@example.com")), "normalized_email")
+		require.NoError(t, err)
+
+		assert.Equal(t, "secret-3", user.TemporaryPassword.Plaintext())
+	})
+
+	t.Run("get reports missing rows", func(t *testing.T) {
+		q := users.selectQuery()
+		_, err := users.get(ctx, q.where("id = "+q.arg(-1)), "id")
+
+		assert.EqualError(t, err, "users: no row with that id")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("pages follow each other", func(t *testing.T) {
+		var emails []string
+		req := PageRequest{Limit: 2}
+		for pages := 0; ; pages++ {
+			require.Less(t, pages, 3)
+			page, err := users.page(ctx, users.selectQuery(), req, true)
+			require.NoError(t, err)
+			for _, user := range page.Items {
+				emails = append(emails, user.Email)
+			}
+			if page.Next == "" {
+				break
+			}
+			req.Cursor = page.Next
+		}
+
+		assert.Equal(t, []string{"user4@example.com", "user3@example.com", "user2@example.com", "user1@example.com", "user0@example.com"}, emails)
+	})
+
+	t.Run("repositories run in a transaction they are given", func(t *testing.T) {
+		tx, err := pool.Begin(ctx)
+		require.NoError(t, err)
+		defer tx.Rollback(ctx)
+
+		txRepo := NewUserRepository(tx, testKeyring)
+		require.NoError(t, txRepo.Create(ctx, &models.User{Name: "Tx", Email: "tx@example.com", NormalizedEmail: "tx@example.com"}))
+		_, err = txRepo.FindByEmail(ctx, "tx@example.com")
+		require.NoError(t, err)
+		require.NoError(t, tx.Rollback(ctx))
+
+		_, err = repo.FindByEmail(ctx, "tx@example.com")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
@@ -0,0 +1,65 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// DB is the interface repositories query, satisfied by both *pgxpool.Pool and
+// pgx.Tx. A repository built on a pgx.Tx runs every call in that transaction,
+// and WithTx nests a savepoint in it.
+type DB interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+type txKey struct{}
+
+// WithTx runs fn in a transaction carried by the context it receives:
+// repository calls made with that context join the transaction. The
+// transaction commits when fn returns nil and rolls back otherwise. When ctx
+// already carries a transaction, fn joins it instead of starting a new one.
+func WithTx(ctx context.Context, db DB, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return fn(ctx)
+	}
+	return pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
+
+// conn returns the transaction carried by ctx, or db outside one.
+func conn(ctx context.Context, db DB) DB {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return db
+}
+
+// Option configures a repository.
+type Option func(*options)
+
+type options struct {
+	replica DB
+}
+
+// WithReadReplica sends the reads of a repository that tolerate replication
+// lag, such as listing account activity, to replica. Reads that must see a
+// preceding write, and every query of a transaction, stay on the primary.
+func WithReadReplica(replica DB) Option {
+	return func(o *options) {
+		o.replica = replica
+	}
+}
+
+func applyOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
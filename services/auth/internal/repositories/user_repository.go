@@ -3,80 +3,188 @@ package repositories
 import (
 	"context"
 	"errors"
+	"fmt"
+	"services/auth/internal/encryption"
 	"services/auth/internal/models"
 
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type UserRepository struct {
-	db *pgxpool.Pool
+	db      DB
+	keyring *encryption.Keyring
+	users   *table[models.User]
 }
 
-func NewUserRepository(db *pgxpool.Pool) *UserRepository {
-	return &UserRepository{db: db}
+// NewUserRepository returns a repository sealing and opening the encrypted
+// columns of users with keyring.
+func NewUserRepository(db DB, keyring *encryption.Keyring, opts ...Option) *UserRepository {
+	users := newTable[models.User](db, keyring, "users")
+	users.replica = applyOptions(opts).replica
+	return &UserRepository{db: db, keyring: keyring, users: users}
 }
 
-func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
-	query := `
-		SELECT id, name, email, temporary_password, cognito_id, created_at, updated_at
-		FROM users
-		WHERE email = $1
-		LIMIT 1
+// FindByEmail looks a user up by the canonical identity of their address, as
+// produced by emailaddr.Normalizer.Canonical. It returns a NotFoundError
+// when there is none.
+func (r *UserRepository) FindByEmail(ctx context.Context, normalizedEmail string) (*models.User, error) {
+	q := r.users.selectQuery()
+	return r.users.get(ctx, q.where("normalized_email = "+q.arg(normalizedEmail)), "normalized_email")
+}
+
+// FindByID returns the user with id, or a NotFoundError when there is none.
+func (r *UserRepository) FindByID(ctx context.Context, id int) (*models.User, error) {
+	q := r.users.selectQuery()
+	return r.users.get(ctx, q.where("id = "+q.arg(id)), "id")
+}
+
+// FindByCognitoID returns the user linked to the identity provider account
+// with cognitoID, or a NotFoundError when there is none. It reads from the
+// replica, if any: an account is linked long before its user signs in.
+func (r *UserRepository) FindByCognitoID(ctx context.Context, cognitoID string) (*models.User, error) {
+	q := r.users.selectQuery().allowStale()
+	return r.users.get(ctx, q.where("cognito_id = "+q.arg(cognitoID)), "cognito_id")
+}
+
+// WithTx runs fn in a transaction; calls made with the context passed to fn
+// join it (see WithTx).
+func (r *UserRepository) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return WithTx(ctx, r.db, fn)
+}
+
+// LockOrCreate inserts user unless a row with its normalized email exists,
+// then locks that row until the transaction carried by ctx ends. It reports
+// whether the row was created; otherwise the existing row is returned, or
+// ErrDeleted when it is soft deleted. Concurrent callers for the same address
+// wait for the first transaction and then see its outcome, so it must run
+// inside WithTx.
+func (r *UserRepository) LockOrCreate(ctx context.Context, user *models.User) (*models.User, bool, error) {
+	insert := `
+		INSERT INTO users (id, name, email, normalized_email, temporary_password, cognito_id, created_at, updated_at, created_by, updated_by)
+		VALUES (COALESCE($1, nextval(pg_get_serial_sequence('users', 'id'))), $2, $3, $4, $5, $6, NOW(), NOW(), $7, $7)
+		ON CONFLICT DO NOTHING
+		RETURNING id, created_at, updated_at, created_by, updated_by
 	`
 
-	var user models.User
-	err := r.db.QueryRow(ctx, query, email).Scan(
-		&user.ID,
-		&user.Name,
-		&user.Email,
-		&user.TemporaryPassword,
-		&user.CognitoID,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	id, err := r.insertID(ctx, user)
+	if err != nil {
+		return nil, false, err
+	}
+	created := *user
+	err = conn(ctx, r.db).QueryRow(
+		ctx,
+		insert,
+		id,
+		user.Name,
+		user.Email,
+		user.NormalizedEmail,
+		UsersTemporaryPassword.bind(ctx, r.keyring, &user.TemporaryPassword, id),
+		user.CognitoID,
+		ActorFrom(ctx),
+	).Scan(&created.ID, &created.CreatedAt, &created.UpdatedAt, &created.CreatedBy, &created.UpdatedBy)
+	if err == nil {
+		return &created, true, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, err
+	}
 
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, nil
+	q := r.users.selectQuery()
+	q.where("normalized_email = " + q.arg(user.NormalizedEmail)).includeDeleted().forUpdate()
+	existing, err := r.users.get(ctx, q, "normalized_email")
+	if errors.Is(err, ErrNotFound) {
+		// The insert conflicted on the raw email of a row whose normalized
+		// email differs, e.g. after EMAIL_FOLD_GMAIL was changed.
+		return nil, false, fmt.Errorf("email %s conflicts with a user stored under another identity", user.Email)
 	}
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
-
-	return &user, nil
+	if existing.DeletedAt != nil {
+		// The address stays taken until the row is purged, so the user can
+		// still be restored
+		return nil, false, ErrDeleted
+	}
+	return existing, false, nil
 }
 
+// Create inserts user, recording the actor of ctx. It returns a
+// DuplicateError when its email or normalized email is taken, including by
+// a soft deleted user.
 func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 	query := `
-		INSERT INTO users (name, email, temporary_password, cognito_id, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, NOW(), NOW())
-		RETURNING id, created_at, updated_at
+		INSERT INTO users (id, name, email, normalized_email, temporary_password, cognito_id, created_at, updated_at, created_by, updated_by)
+		VALUES (COALESCE($1, nextval(pg_get_serial_sequence('users', 'id'))), $2, $3, $4, $5, $6, NOW(), NOW(), $7, $7)
+		RETURNING id, created_at, updated_at, created_by, updated_by
 	`
 
-	return r.db.QueryRow(
+	id, err := r.insertID(ctx, user)
+	if err != nil {
+		return err
+	}
+	err = conn(ctx, r.db).QueryRow(
 		ctx,
 		query,
+		id,
 		user.Name,
 		user.Email,
-		user.TemporaryPassword,
+		user.NormalizedEmail,
+		UsersTemporaryPassword.bind(ctx, r.keyring, &user.TemporaryPassword, id),
 		user.CognitoID,
-	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+		ActorFrom(ctx),
+	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt, &user.CreatedBy, &user.UpdatedBy)
+	return duplicateError("users", err)
 }
 
+// insertID returns the ID to insert user under. Encrypted values are bound
+// to the ID of their row, so a user holding one gets an ID reserved from the
+// sequence before the insert; otherwise it is nil and the insert takes the
+// next one.
+func (r *UserRepository) insertID(ctx context.Context, user *models.User) (*int, error) {
+	if !user.TemporaryPassword.Valid() {
+		return nil, nil
+	}
+	var id int
+	err := conn(ctx, r.db).QueryRow(ctx, `SELECT nextval(pg_get_serial_sequence('users', 'id'))`).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve user id: %w", err)
+	}
+	return &id, nil
+}
+
+// Update stores the name, temporary password and identity provider ID of
+// user, recording the actor of ctx. It returns a NotFoundError when the user
+// does not exist or is soft deleted.
 func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
 	query := `
 		UPDATE users
-		SET name = $1, temporary_password = $2, cognito_id = $3, updated_at = NOW()
-		WHERE id = $4
-		RETURNING updated_at
+		SET name = $1, temporary_password = $2, cognito_id = $3, updated_at = NOW(), updated_by = $5
+		WHERE id = $4 AND deleted_at IS NULL
+		RETURNING updated_at, updated_by
 	`
 
-	return r.db.QueryRow(
+	err := conn(ctx, r.db).QueryRow(
 		ctx,
 		query,
 		user.Name,
-		user.TemporaryPassword,
+		UsersTemporaryPassword.bind(ctx, r.keyring, &user.TemporaryPassword, &user.ID),
 		user.CognitoID,
 		user.ID,
-	).Scan(&user.UpdatedAt)
+		ActorFrom(ctx),
+	).Scan(&user.UpdatedAt, &user.UpdatedBy)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &NotFoundError{Table: "users", Column: "id"}
+	}
+	return err
+}
+
+// Delete soft deletes the user with id: lookups skip it until it is
+// restored, and it is removed for good once purged (see PurgeRepository).
+func (r *UserRepository) Delete(ctx context.Context, id int) error {
+	return r.users.softDelete(ctx, id)
+}
+
+// Restore undoes Delete, unless the user was purged meanwhile.
+func (r *UserRepository) Restore(ctx context.Context, id int) error {
+	return r.users.restore(ctx, id)
 }
@@ -2,9 +2,13 @@ package repositories
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"testing"
 	"time"
 
+	"services/auth/internal/audit"
+	"services/auth/internal/encryption"
 	"services/auth/internal/models"
 	"services/auth/internal/testhelpers"
 
@@ -12,27 +16,33 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+var testKeyring = encryption.SingleKey("test-secret-key-1234567890123456")
+
 func TestUserRepository_FindByEmail(t *testing.T) {
 	pool, cleanup := testhelpers.SetupTestDB(t)
 	defer cleanup()
 
-	testhelpers.CreateUsersTable(t, pool)
+	testhelpers.ApplyMigrations(t, pool)
 
-	repo := NewUserRepository(pool)
+	repo := NewUserRepository(pool, testKeyring)
 	ctx := context.Background()
 
 	t.Run("user not found", func(t *testing.T) {
 		user, err := repo.FindByEmail(ctx, "nonexistent@example.com")
-		assert.NoError(t, err)
+		assert.ErrorIs(t, err, ErrNotFound)
+		var notFound *NotFoundError
+		require.ErrorAs(t, err, &notFound)
+		assert.Equal(t, "normalized_email", notFound.Column)
 		assert.Nil(t, user)
 	})
 
 	t.Run("user found", func(t *testing.T) {
 		// Create a user first
 		user := &models.User{
-			Name:      "John Doe",
-			Email:     "john@example.com",
-			CognitoID: stringPtr("cognito-123"),
+			Name:            "John Doe",
+			Email:           "john@example.com",
+			NormalizedEmail: "john@example.com",
+			CognitoID:       stringPtr("cognito-123"),
 		}
 		err := repo.Create(ctx, user)
 		require.NoError(t, err)
@@ -45,6 +55,7 @@ func TestUserRepository_FindByEmail(t *testing.T) {
 		assert.Equal(t, user.ID, found.ID)
 		assert.Equal(t, user.Name, found.Name)
 		assert.Equal(t, user.Email, found.Email)
+		assert.Equal(t, user.NormalizedEmail, found.NormalizedEmail)
 		assert.Equal(t, user.CognitoID, found.CognitoID)
 		assert.False(t, found.CreatedAt.IsZero())
 		assert.False(t, found.UpdatedAt.IsZero())
@@ -55,16 +66,17 @@ func TestUserRepository_Create(t *testing.T) {
 	pool, cleanup := testhelpers.SetupTestDB(t)
 	defer cleanup()
 
-	testhelpers.CreateUsersTable(t, pool)
+	testhelpers.ApplyMigrations(t, pool)
 
-	repo := NewUserRepository(pool)
+	repo := NewUserRepository(pool, testKeyring)
 	ctx := context.Background()
 
 	t.Run("create new user", func(t *testing.T) {
 		user := &models.User{
 			Name:              "Jane Doe",
 			Email:             "jane@example.com",
-			TemporaryPassword: stringPtr("encrypted-password"),
+			NormalizedEmail:   "jane@example.com",
+			TemporaryPassword: encryption.NewField("temporary-password"),
 			CognitoID:         stringPtr("cognito-456"),
 		}
 
@@ -80,12 +92,14 @@ func TestUserRepository_Create(t *testing.T) {
 		require.NotNil(t, found)
 		assert.Equal(t, user.Name, found.Name)
 		assert.Equal(t, user.Email, found.Email)
+		assert.Equal(t, "temporary-password", found.TemporaryPassword.Plaintext())
 	})
 
 	t.Run("create user with nil fields", func(t *testing.T) {
 		user := &models.User{
-			Name:  "Bob Smith",
-			Email: "bob@example.com",
+			Name:            "Bob Smith",
+			Email:           "bob@example.com",
+			NormalizedEmail: "bob@example.com",
 			// TemporaryPassword and CognitoID are nil
 		}
 
@@ -96,18 +110,41 @@ func TestUserRepository_Create(t *testing.T) {
 
 	t.Run("duplicate email", func(t *testing.T) {
 		user1 := &models.User{
-			Name:  "User One",
-			Email: "duplicate@example.com",
+			Name:            "User One",
+			Email:           "duplicate@example.com",
+			NormalizedEmail: "duplicate@example.com",
+		}
+		err := repo.Create(ctx, user1)
+		require.NoError(t, err)
+
+		user2 := &models.User{
+			Name:            "User Two",
+			Email:           "duplicate@example.com",
+			NormalizedEmail: "duplicate@example.com",
+		}
+		err = repo.Create(ctx, user2)
+		assert.ErrorIs(t, err, ErrDuplicate, "Should fail on duplicate email")
+	})
+
+	t.Run("duplicate normalized email", func(t *testing.T) {
+		user1 := &models.User{
+			Name:            "Folded One",
+			Email:           "j.doe@gmail.com",
+			NormalizedEmail: "jdoe@gmail.com",
 		}
 		err := repo.Create(ctx, user1)
 		require.NoError(t, err)
 
 		user2 := &models.User{
-			Name:  "User Two",
-			Email: "duplicate@example.com",
+			Name:            "Folded Two",
+			Email:           "jdoe+promo@gmail.com",
+			NormalizedEmail: "jdoe@gmail.com",
 		}
 		err = repo.Create(ctx, user2)
-		assert.Error(t, err, "Should fail on duplicate email")
+		assert.ErrorIs(t, err, ErrDuplicate, "Should fail on duplicate normalized email")
+		var dup *DuplicateError
+		require.ErrorAs(t, err, &dup)
+		assert.Equal(t, "users_normalized_email_key", dup.Index)
 	})
 }
 
@@ -115,17 +152,18 @@ func TestUserRepository_Update(t *testing.T) {
 	pool, cleanup := testhelpers.SetupTestDB(t)
 	defer cleanup()
 
-	testhelpers.CreateUsersTable(t, pool)
+	testhelpers.ApplyMigrations(t, pool)
 
-	repo := NewUserRepository(pool)
+	repo := NewUserRepository(pool, testKeyring)
 	ctx := context.Background()
 
 	t.Run("update existing user", func(t *testing.T) {
 		// Create a user
 		user := &models.User{
-			Name:      "Original Name",
-			Email:     "update@example.com",
-			CognitoID: stringPtr("cognito-original"),
+			Name:            "Original Name",
+			Email:           "update@example.com",
+			NormalizedEmail: "update@example.com",
+			CognitoID:       stringPtr("cognito-original"),
 		}
 		err := repo.Create(ctx, user)
 		require.NoError(t, err)
@@ -137,7 +175,7 @@ func TestUserRepository_Update(t *testing.T) {
 
 		// Update the user
 		user.Name = "Updated Name"
-		user.TemporaryPassword = stringPtr("new-encrypted-password")
+		user.TemporaryPassword = encryption.NewField("new-temporary-password")
 		user.CognitoID = stringPtr("cognito-updated")
 
 		err = repo.Update(ctx, user)
@@ -149,21 +187,253 @@ func TestUserRepository_Update(t *testing.T) {
 		require.NoError(t, err)
 		require.NotNil(t, found)
 		assert.Equal(t, "Updated Name", found.Name)
-		assert.Equal(t, "new-encrypted-password", *found.TemporaryPassword)
+		assert.Equal(t, "new-temporary-password", found.TemporaryPassword.Plaintext())
 		assert.Equal(t, "cognito-updated", *found.CognitoID)
 	})
 
 	t.Run("update non-existent user", func(t *testing.T) {
 		user := &models.User{
-			ID:    99999,
-			Name:  "Non-existent",
-			Email: "nonexistent@example.com",
+			ID:              99999,
+			Name:            "Non-existent",
+			Email:           "nonexistent@example.com",
+			NormalizedEmail: "nonexistent@example.com",
 		}
 		err := repo.Update(ctx, user)
-		assert.Error(t, err, "Should fail when updating non-existent user")
+		assert.ErrorIs(t, err, ErrNotFound, "Should fail when updating non-existent user")
+	})
+
+	t.Run("writes record their actor", func(t *testing.T) {
+		user := &models.User{Name: "Actor", Email: "actor@example.com", NormalizedEmail: "actor@example.com"}
+		require.NoError(t, repo.Create(WithActor(ctx, audit.ActorAnonymous), user))
+		assert.Equal(t, audit.ActorAnonymous, user.CreatedBy)
+		assert.Equal(t, audit.ActorAnonymous, user.UpdatedBy)
+
+		user.Name = "Renamed"
+		require.NoError(t, repo.Update(ctx, user))
+
+		found, err := repo.FindByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, audit.ActorAnonymous, found.CreatedBy)
+		assert.Equal(t, audit.ActorSystem, found.UpdatedBy)
+	})
+}
+
+func TestUserRepository_SoftDelete(t *testing.T) {
+	pool, cleanup := testhelpers.SetupTestDB(t)
+	defer cleanup()
+
+	testhelpers.ApplyMigrations(t, pool)
+
+	repo := NewUserRepository(pool, testKeyring)
+	ctx := WithActor(context.Background(), "admin")
+
+	user := &models.User{Name: "Deleted", Email: "deleted@example.com", NormalizedEmail: "deleted@example.com"}
+	require.NoError(t, repo.Create(ctx, user))
+	require.NoError(t, repo.Delete(ctx, user.ID))
+
+	t.Run("deleted users are hidden", func(t *testing.T) {
+		_, err := repo.FindByID(ctx, user.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = repo.FindByEmail(ctx, "deleted@example.com")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, repo.Update(ctx, user), ErrNotFound)
+		assert.ErrorIs(t, repo.Delete(ctx, user.ID), ErrNotFound)
+	})
+
+	t.Run("deleted users keep their address", func(t *testing.T) {
+		err := repo.WithTx(ctx, func(ctx context.Context) error {
+			_, _, err := repo.LockOrCreate(ctx, &models.User{Name: "Again", Email: "deleted@example.com", NormalizedEmail: "deleted@example.com"})
+			return err
+		})
+		assert.ErrorIs(t, err, ErrDeleted)
+	})
+
+	t.Run("restored users are found again", func(t *testing.T) {
+		require.NoError(t, repo.Restore(ctx, user.ID))
+
+		found, err := repo.FindByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Nil(t, found.DeletedAt)
+		assert.Equal(t, "admin", found.UpdatedBy)
+		assert.ErrorIs(t, repo.Restore(ctx, user.ID), ErrNotFound)
 	})
 }
 
 func stringPtr(s string) *string {
 	return &s
 }
+
+func TestUserRepository_LockOrCreate(t *testing.T) {
+	pool, cleanup := testhelpers.SetupTestDB(t)
+	defer cleanup()
+
+	testhelpers.ApplyMigrations(t, pool)
+
+	repo := NewUserRepository(pool, testKeyring)
+	ctx := context.Background()
+	placeholder := &models.User{Name: "Lock Doe", Email: "Lock@example.com", NormalizedEmail: "lock@example.com"}
+
+	var first *models.User
+	err := repo.WithTx(ctx, func(ctx context.Context) error {
+		user, created, err := repo.LockOrCreate(ctx, placeholder)
+		require.NoError(t, err)
+		assert.True(t, created)
+		assert.NotZero(t, user.ID)
+		assert.Zero(t, placeholder.ID, "the argument is not modified")
+		first = user
+		return nil
+	})
+	require.NoError(t, err)
+
+	err = repo.WithTx(ctx, func(ctx context.Context) error {
+		user, created, err := repo.LockOrCreate(ctx, &models.User{Name: "Other", Email: "lock@example.com", NormalizedEmail: "lock@example.com"})
+		require.NoError(t, err)
+		assert.False(t, created)
+		assert.Equal(t, first.ID, user.ID)
+		assert.Equal(t, "Lock@example.com", user.Email, "the stored row is returned")
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestUserRepository_LockOrCreate_WaitsForLock(t *testing.T) {
+	pool, cleanup := testhelpers.SetupTestDB(t)
+	defer cleanup()
+
+	testhelpers.ApplyMigrations(t, pool)
+
+	repo := NewUserRepository(pool, testKeyring)
+	ctx := context.Background()
+	placeholder := &models.User{Name: "Wait Doe", Email: "wait@example.com", NormalizedEmail: "wait@example.com"}
+
+	locked := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- repo.WithTx(ctx, func(ctx context.Context) error {
+			user, _, err := repo.LockOrCreate(ctx, placeholder)
+			if err != nil {
+				return err
+			}
+			close(locked)
+			<-release
+			user.CognitoID = stringPtr("cognito-first")
+			return repo.Update(ctx, user)
+		})
+	}()
+	<-locked
+
+	second := make(chan *models.User, 1)
+	go func() {
+		_ = repo.WithTx(ctx, func(ctx context.Context) error {
+			user, created, err := repo.LockOrCreate(ctx, placeholder)
+			if err == nil && !created {
+				second <- user
+			}
+			close(second)
+			return err
+		})
+	}()
+
+	select {
+	case <-second:
+		t.Fatal("LockOrCreate returned while the row was locked")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	close(release)
+	require.NoError(t, <-done)
+	user := <-second
+	require.NotNil(t, user)
+	assert.Equal(t, stringPtr("cognito-first"), user.CognitoID, "the waiter sees the committed row")
+}
+
+func TestUserRepository_WithTx_RollsBack(t *testing.T) {
+	pool, cleanup := testhelpers.SetupTestDB(t)
+	defer cleanup()
+
+	testhelpers.ApplyMigrations(t, pool)
+
+	repo := NewUserRepository(pool, testKeyring)
+	ctx := context.Background()
+
+	err := repo.WithTx(ctx, func(ctx context.Context) error {
+		_, _, err := repo.LockOrCreate(ctx, &models.User{Name: "Gone", Email: "gone@example.com", NormalizedEmail: "gone@example.com"})
+		require.NoError(t, err)
+		return errors.New("abort")
+	})
+	require.EqualError(t, err, "abort")
+
+	_, err = repo.FindByEmail(ctx, "gone@example.com")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestUserRepository_EncryptedPassword(t *testing.T) {
+	pool, cleanup := testhelpers.SetupTestDB(t)
+	defer cleanup()
+
+	testhelpers.ApplyMigrations(t, pool)
+
+	repo := NewUserRepository(pool, testKeyring)
+	ctx := context.Background()
+	stored := func(t *testing.T, id int) *string {
+		t.Helper()
+		var value *string
+		require.NoError(t, pool.QueryRow(ctx, `SELECT temporary_password FROM users WHERE id = $1`, id).Scan(&value))
+		return value
+	}
+
+	first := &models.User{Name: "First", Email: "first@example.com", NormalizedEmail: "first@example.com", TemporaryPassword: encryption.NewField("first-password")}
+	require.NoError(t, repo.Create(ctx, first))
+	second := &models.User{Name: "Second", Email: "second@example.com", NormalizedEmail: "second@example.com"}
+	require.NoError(t, repo.Create(ctx, second))
+
+	t.Run("sealed on write and opened on read", func(t *testing.T) {
+		sealed := stored(t, first.ID)
+		require.NotNil(t, sealed)
+		assert.True(t, strings.HasPrefix(*sealed, "v3:k1:"), *sealed)
+		assert.NotContains(t, *sealed, "first-password")
+
+		plaintext, err := testKeyring.Decrypt(ctx, *sealed, UsersTemporaryPassword.Binding(int64(first.ID)))
+		require.NoError(t, err)
+		assert.Equal(t, "first-password", plaintext)
+
+		found, err := repo.FindByID(ctx, first.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "first-password", found.TemporaryPassword.Plaintext())
+	})
+
+	t.Run("NULL stays NULL", func(t *testing.T) {
+		assert.Nil(t, stored(t, second.ID))
+
+		found, err := repo.FindByID(ctx, second.ID)
+		require.NoError(t, err)
+		assert.False(t, found.TemporaryPassword.Valid())
+	})
+
+	t.Run("bound to the row", func(t *testing.T) {
+		placeholder := &models.User{Name: "Third", Email: "third@example.com", NormalizedEmail: "third@example.com", TemporaryPassword: encryption.NewField("third-password")}
+		err := repo.WithTx(ctx, func(ctx context.Context) error {
+			user, created, err := repo.LockOrCreate(ctx, placeholder)
+			require.True(t, created)
+			placeholder = user
+			return err
+		})
+		require.NoError(t, err)
+		found, err := repo.FindByEmail(ctx, "third@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "third-password", found.TemporaryPassword.Plaintext())
+
+		// Copy the password of the first user into the row of the third
+		_, err = pool.Exec(ctx, `UPDATE users SET temporary_password = $1 WHERE id = $2`, stored(t, first.ID), placeholder.ID)
+		require.NoError(t, err)
+
+		_, err = repo.FindByID(ctx, placeholder.ID)
+		assert.ErrorIs(t, err, encryption.ErrUnreadableField)
+	})
+
+	t.Run("unbound repository", func(t *testing.T) {
+		_, err := NewUserRepository(pool, nil).FindByID(ctx, first.ID)
+		assert.ErrorIs(t, err, encryption.ErrUnboundField)
+	})
+}
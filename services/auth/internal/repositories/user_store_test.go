@@ -0,0 +1,190 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"services/auth/internal/encryption"
+	"services/auth/internal/models"
+	"services/auth/internal/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// userStore is what UserRepository and MemoryUserRepository have in common.
+type userStore interface {
+	testhelpers.UserRepositoryInterface
+	Delete(ctx context.Context, id int) error
+	Restore(ctx context.Context, id int) error
+}
+
+var (
+	_ userStore = (*UserRepository)(nil)
+	_ userStore = (*MemoryUserRepository)(nil)
+)
+
+func TestMemoryUserRepository_Conformance(t *testing.T) {
+	testUserStore(t, func(t *testing.T) userStore {
+		return NewMemoryUserRepository()
+	})
+}
+
+func TestUserRepository_Conformance(t *testing.T) {
+	testUserStore(t, func(t *testing.T) userStore {
+		pool, cleanup := testhelpers.SetupTestDB(t)
+		t.Cleanup(cleanup)
+		testhelpers.ApplyMigrations(t, pool)
+		return NewUserRepository(pool, testKeyring)
+	})
+}
+
+// testUserStore checks the behaviour services rely on, so that tests using
+// the memory store hold against the database.
+func testUserStore(t *testing.T, newStore func(t *testing.T) userStore) {
+	ctx := WithActor(context.Background(), "tester")
+
+	t.Run("create and find", func(t *testing.T) {
+		store := newStore(t)
+		user := &models.User{
+			Name:              "Ada",
+			Email:             "Ada@example.com",
+			NormalizedEmail:   "ada@example.com",
+			TemporaryPassword: encryption.NewField("temporary-password"),
+			CognitoID:         stringPtr("cognito-ada"),
+		}
+		require.NoError(t, store.Create(ctx, user))
+		assert.NotZero(t, user.ID)
+		assert.False(t, user.CreatedAt.IsZero())
+		assert.Equal(t, "tester", user.CreatedBy)
+
+		for name, find := range map[string]func() (*models.User, error){
+			"by email":      func() (*models.User, error) { return store.FindByEmail(ctx, "ada@example.com") },
+			"by id":         func() (*models.User, error) { return store.FindByID(ctx, user.ID) },
+			"by cognito id": func() (*models.User, error) { return store.FindByCognitoID(ctx, "cognito-ada") },
+		} {
+			found, err := find()
+			require.NoError(t, err, name)
+			assert.Equal(t, user.ID, found.ID, name)
+			assert.Equal(t, "Ada@example.com", found.Email, name)
+			assert.Equal(t, "temporary-password", found.TemporaryPassword.Plaintext(), name)
+			assert.Equal(t, "tester", found.UpdatedBy, name)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		store := newStore(t)
+		_, err := store.FindByEmail(ctx, "nobody@example.com")
+		var notFound *NotFoundError
+		require.ErrorAs(t, err, &notFound)
+		assert.Equal(t, "normalized_email", notFound.Column)
+
+		_, err = store.FindByID(ctx, 42)
+		require.ErrorAs(t, err, &notFound)
+		assert.Equal(t, "id", notFound.Column)
+
+		_, err = store.FindByCognitoID(ctx, "nobody")
+		require.ErrorAs(t, err, &notFound)
+		assert.Equal(t, "cognito_id", notFound.Column)
+
+		assert.ErrorIs(t, store.Update(ctx, &models.User{ID: 42}), ErrNotFound)
+	})
+
+	t.Run("duplicates", func(t *testing.T) {
+		store := newStore(t)
+		require.NoError(t, store.Create(ctx, &models.User{Name: "One", Email: "dup@example.com", NormalizedEmail: "dup@example.com"}))
+
+		var dup *DuplicateError
+		err := store.Create(ctx, &models.User{Name: "Two", Email: "dup@example.com", NormalizedEmail: "other@example.com"})
+		require.ErrorAs(t, err, &dup)
+		assert.Equal(t, "users_email_key", dup.Index)
+
+		err = store.Create(ctx, &models.User{Name: "Three", Email: "DUP@example.com", NormalizedEmail: "dup@example.com"})
+		require.ErrorAs(t, err, &dup)
+		assert.Equal(t, "users_normalized_email_key", dup.Index)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		store := newStore(t)
+		user := &models.User{Name: "Before", Email: "update@example.com", NormalizedEmail: "update@example.com"}
+		require.NoError(t, store.Create(ctx, user))
+
+		user.Name = "After"
+		user.CognitoID = stringPtr("cognito-update")
+		user.TemporaryPassword = encryption.Field{}
+		require.NoError(t, store.Update(WithActor(ctx, "updater"), user))
+		assert.Equal(t, "updater", user.UpdatedBy)
+
+		found, err := store.FindByCognitoID(ctx, "cognito-update")
+		require.NoError(t, err)
+		assert.Equal(t, "After", found.Name)
+		assert.False(t, found.TemporaryPassword.Valid())
+		assert.Equal(t, "tester", found.CreatedBy)
+		assert.Equal(t, "updater", found.UpdatedBy)
+	})
+
+	t.Run("lock or create", func(t *testing.T) {
+		store := newStore(t)
+		placeholder := &models.User{Name: "Lock", Email: "Lock@example.com", NormalizedEmail: "lock@example.com"}
+
+		var first *models.User
+		require.NoError(t, store.WithTx(ctx, func(ctx context.Context) error {
+			user, created, err := store.LockOrCreate(ctx, placeholder)
+			require.NoError(t, err)
+			assert.True(t, created)
+			assert.Zero(t, placeholder.ID, "the argument is not modified")
+			first = user
+			return nil
+		}))
+
+		require.NoError(t, store.WithTx(ctx, func(ctx context.Context) error {
+			user, created, err := store.LockOrCreate(ctx, &models.User{Name: "Other", Email: "lock@example.com", NormalizedEmail: "lock@example.com"})
+			require.NoError(t, err)
+			assert.False(t, created)
+			assert.Equal(t, first.ID, user.ID)
+			assert.Equal(t, "Lock@example.com", user.Email, "the stored row is returned")
+			return nil
+		}))
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		store := newStore(t)
+		err := store.WithTx(ctx, func(ctx context.Context) error {
+			require.NoError(t, store.Create(ctx, &models.User{Name: "Gone", Email: "gone@example.com", NormalizedEmail: "gone@example.com"}))
+			return store.WithTx(ctx, func(ctx context.Context) error {
+				return errors.New("abort")
+			})
+		})
+		require.EqualError(t, err, "abort")
+
+		_, err = store.FindByEmail(ctx, "gone@example.com")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("soft delete", func(t *testing.T) {
+		store := newStore(t)
+		user := &models.User{Name: "Deleted", Email: "deleted@example.com", NormalizedEmail: "deleted@example.com"}
+		require.NoError(t, store.Create(ctx, user))
+		require.NoError(t, store.Delete(ctx, user.ID))
+
+		_, err := store.FindByID(ctx, user.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, store.Update(ctx, user), ErrNotFound)
+		assert.ErrorIs(t, store.Delete(ctx, user.ID), ErrNotFound)
+		assert.ErrorIs(t, store.Create(ctx, &models.User{Name: "Again", Email: "deleted@example.com", NormalizedEmail: "deleted@example.com"}), ErrDuplicate)
+
+		err = store.WithTx(ctx, func(ctx context.Context) error {
+			_, _, err := store.LockOrCreate(ctx, &models.User{Name: "Again", Email: "deleted@example.com", NormalizedEmail: "deleted@example.com"})
+			return err
+		})
+		assert.ErrorIs(t, err, ErrDeleted)
+
+		require.NoError(t, store.Restore(WithActor(ctx, "admin"), user.ID))
+		found, err := store.FindByEmail(ctx, "deleted@example.com")
+		require.NoError(t, err)
+		assert.Nil(t, found.DeletedAt)
+		assert.Equal(t, "admin", found.UpdatedBy)
+		assert.ErrorIs(t, store.Restore(ctx, user.ID), ErrNotFound)
+	})
+}
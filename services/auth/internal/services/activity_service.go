@@ -0,0 +1,36 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"services/auth/internal/audit"
+	"services/auth/internal/repositories"
+)
+
+// ErrUserNotFound is returned when the signed-in identity provider account
+// has no user, e.g. because it was deleted.
+var ErrUserNotFound = errors.New("user not found")
+
+// ActivityService lets users review the audit events of their account.
+type ActivityService struct {
+	userRepo UserRepositoryInterface
+	recorder *audit.Recorder
+}
+
+func NewActivityService(userRepo UserRepositoryInterface, recorder *audit.Recorder) *ActivityService {
+	return &ActivityService{userRepo: userRepo, recorder: recorder}
+}
+
+// Activity returns up to limit events of the user linked to cognitoID,
+// newest first, after cursor, with the cursor of the following page.
+func (s *ActivityService) Activity(ctx context.Context, cognitoID, cursor string, limit int) ([]audit.Event, string, error) {
+	user, err := s.userRepo.FindByCognitoID(ctx, cognitoID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, "", ErrUserNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load user: %w", err)
+	}
+	return s.recorder.Activity(ctx, user.ID, cursor, limit)
+}
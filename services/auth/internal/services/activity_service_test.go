@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"services/auth/internal/audit"
+	"services/auth/internal/models"
+	"services/auth/internal/repositories"
+	"services/auth/internal/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActivityService_Activity(t *testing.T) {
+	ctx := context.Background()
+	store := audit.NewMemoryStore()
+	recorder := audit.NewRecorder(store)
+	userID, otherID := 7, 8
+	for _, id := range []*int{&userID, &otherID, &userID, nil} {
+		recorder.Record(ctx, audit.Event{Type: audit.TypeSignup, Outcome: audit.OutcomeSuccess, UserID: id})
+	}
+
+	mockRepo := new(testhelpers.MockUserRepository)
+	mockRepo.On("FindByCognitoID", ctx, testCognitoID).Return(&models.User{ID: userID}, nil)
+	service := NewActivityService(mockRepo, recorder)
+
+	events, next, err := service.Activity(ctx, testCognitoID, "", 1)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, int64(3), events[0].ID)
+
+	events, next, err = service.Activity(ctx, testCognitoID, next, 1)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, int64(1), events[0].ID)
+	assert.Empty(t, next)
+}
+
+func TestActivityService_Activity_UserNotFound(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(testhelpers.MockUserRepository)
+	mockRepo.On("FindByCognitoID", ctx, testCognitoID).Return(nil, &repositories.NotFoundError{Table: "users", Column: "cognito_id"})
+	service := NewActivityService(mockRepo, audit.NewRecorder(audit.NewMemoryStore()))
+
+	_, _, err := service.Activity(ctx, testCognitoID, "", 20)
+
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestActivityService_Activity_RepositoryError(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(testhelpers.MockUserRepository)
+	mockRepo.On("FindByCognitoID", ctx, testCognitoID).Return(nil, errors.New("database error"))
+	service := NewActivityService(mockRepo, audit.NewRecorder(audit.NewMemoryStore()))
+
+	_, _, err := service.Activity(ctx, testCognitoID, "", 20)
+
+	assert.ErrorContains(t, err, "database error")
+	assert.NotErrorIs(t, err, ErrUserNotFound)
+}
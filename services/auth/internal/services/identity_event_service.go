@@ -0,0 +1,43 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"services/auth/internal/audit"
+	"services/auth/internal/repositories"
+)
+
+// IdentityEventService records in the audit log the steps users take with
+// the identity provider directly, without calling this service: confirming
+// their email, logging in and refreshing their tokens. The identity provider
+// reports them through its triggers (see handlers.CognitoTriggerHandler).
+type IdentityEventService struct {
+	userRepo UserRepositoryInterface
+	recorder *audit.Recorder
+}
+
+func NewIdentityEventService(userRepo UserRepositoryInterface, recorder *audit.Recorder) *IdentityEventService {
+	return &IdentityEventService{userRepo: userRepo, recorder: recorder}
+}
+
+// Record records a successful event of eventType made by the user linked to
+// cognitoID. Accounts without a user, e.g. created by hand in the pool, are
+// recorded without one, as the anonymous actor.
+func (s *IdentityEventService) Record(ctx context.Context, eventType, cognitoID string) error {
+	event := audit.Event{Type: eventType, Outcome: audit.OutcomeSuccess, Actor: audit.ActorAnonymous}
+	user, err := s.userRepo.FindByCognitoID(ctx, cognitoID)
+	switch {
+	case errors.Is(err, repositories.ErrNotFound):
+		event.Reason = "user_not_found"
+	case err != nil:
+		return fmt.Errorf("failed to load user: %w", err)
+	default:
+		event.UserID = &user.ID
+		event.Actor = "user:" + strconv.Itoa(user.ID)
+	}
+	s.recorder.Record(ctx, event)
+	return nil
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"services/auth/internal/audit"
+	"services/auth/internal/models"
+	"services/auth/internal/repositories"
+	"services/auth/internal/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentityEventService_Record(t *testing.T) {
+	ctx := context.Background()
+	store := audit.NewMemoryStore()
+	mockRepo := new(testhelpers.MockUserRepository)
+	mockRepo.On("FindByCognitoID", ctx, testCognitoID).Return(&models.User{ID: 7}, nil)
+	mockRepo.On("FindByCognitoID", ctx, "unknown").Return(nil, &repositories.NotFoundError{Table: "users", Column: "cognito_id"})
+	service := NewIdentityEventService(mockRepo, audit.NewRecorder(store))
+
+	require.NoError(t, service.Record(ctx, audit.TypeLogin, testCognitoID))
+	require.NoError(t, service.Record(ctx, audit.TypeConfirmation, "unknown"))
+
+	events := store.Events()
+	require.Len(t, events, 2)
+	assert.Equal(t, audit.TypeLogin, events[0].Type)
+	assert.Equal(t, audit.OutcomeSuccess, events[0].Outcome)
+	require.NotNil(t, events[0].UserID)
+	assert.Equal(t, 7, *events[0].UserID)
+	assert.Equal(t, "user:7", events[0].Actor)
+
+	assert.Nil(t, events[1].UserID, "accounts without a user are recorded without one")
+	assert.Equal(t, audit.ActorAnonymous, events[1].Actor)
+	assert.Equal(t, "user_not_found", events[1].Reason)
+}
+
+func TestIdentityEventService_Record_RepositoryError(t *testing.T) {
+	ctx := context.Background()
+	store := audit.NewMemoryStore()
+	mockRepo := new(testhelpers.MockUserRepository)
+	mockRepo.On("FindByCognitoID", ctx, testCognitoID).Return(nil, errors.New("database error"))
+	service := NewIdentityEventService(mockRepo, audit.NewRecorder(store))
+
+	err := service.Record(ctx, audit.TypeTokenRefresh, testCognitoID)
+
+	assert.ErrorContains(t, err, "database error")
+	assert.Empty(t, store.Events())
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"services/auth/internal/cognito"
+	"services/auth/internal/models"
+	"services/auth/internal/outbox"
+	"services/auth/internal/repositories"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSignupService_Flow runs sign-ups end to end against the in-memory
+// user store and identity provider instead of scripted mocks.
+func TestSignupService_Flow(t *testing.T) {
+	users := repositories.NewMemoryUserRepository()
+	idp := cognito.NewFakeClient()
+	store := outbox.NewMemoryStore()
+	dispatcher := outbox.NewDispatcher(store, outbox.Options{})
+	service := NewSignupServiceWithInterfaces(users, store, idp, WithDispatcher(dispatcher))
+	service.RegisterOutboxHandlers(dispatcher)
+	ctx := context.Background()
+
+	result, err := service.Signup(ctx, testUserName, testUserEmail)
+	require.NoError(t, err)
+	assert.Equal(t, models.SignupStatusPendingConfirmation, result.Status)
+	require.NotNil(t, result.User.CognitoID, "the account is created on dispatch")
+
+	confirmed, username, sub, err := idp.IsUserConfirmed(ctx, result.User.ID, testUserEmail)
+	require.NoError(t, err)
+	assert.False(t, confirmed)
+	assert.Equal(t, sub, *result.User.CognitoID)
+	_, sent := idp.ConfirmationCode(testUserEmail)
+	require.True(t, sent, "a confirmation code is sent")
+
+	t.Run("sign-up again before confirming resends the code", func(t *testing.T) {
+		again, err := service.Signup(ctx, "Renamed", testUserEmail)
+		require.NoError(t, err)
+		assert.Equal(t, result.User.ID, again.User.ID)
+		assert.Equal(t, models.SignupStatusPendingConfirmation, again.Status)
+
+		messages := store.Messages()
+		require.Len(t, messages, 2)
+		assert.Equal(t, OutboxResendConfirmationCode, messages[1].Kind)
+		assert.NotNil(t, messages[1].ProcessedAt)
+	})
+
+	t.Run("sign-up after confirming is refused", func(t *testing.T) {
+		code, _ := idp.ConfirmationCode(testUserEmail)
+		require.NoError(t, idp.ConfirmSignUp(ctx, username, code))
+
+		_, err := service.Signup(ctx, testUserName, testUserEmail)
+		assert.ErrorIs(t, err, ErrUserAlreadyExists)
+		assert.Len(t, store.Messages(), 2, "nothing is enqueued")
+	})
+
+	t.Run("deleted users keep their address", func(t *testing.T) {
+		require.NoError(t, users.Delete(ctx, result.User.ID))
+
+		_, err := service.Signup(ctx, testUserName, testUserEmail)
+		assert.ErrorIs(t, err, ErrUserAlreadyExists)
+	})
+}
+
+// TestSignupService_Flow_Redelivered delivers a sign-up again after its
+// update was lost, against a fake using the usernames of AWS mode, where
+// the email is only an alias and cannot prevent a second account.
+func TestSignupService_Flow_Redelivered(t *testing.T) {
+	users := repositories.NewMemoryUserRepository()
+	idp := cognito.NewFakeClientFor(cognito.ModeAWS)
+	store := outbox.NewMemoryStore()
+	dispatcher := outbox.NewDispatcher(store, outbox.Options{})
+	service := NewSignupServiceWithInterfaces(users, store, idp, WithDispatcher(dispatcher))
+	service.RegisterOutboxHandlers(dispatcher)
+	ctx := context.Background()
+
+	result, err := service.Signup(ctx, testUserName, testUserEmail)
+	require.NoError(t, err)
+	require.NotNil(t, result.User.CognitoID)
+	sub := *result.User.CognitoID
+
+	// Lose the link, as when the process dies before the update commits
+	user, err := users.FindByID(ctx, result.User.ID)
+	require.NoError(t, err)
+	user.CognitoID = nil
+	require.NoError(t, users.Update(ctx, user))
+
+	msg := store.Messages()[0].Message
+	require.NoError(t, service.deliverCognitoSignUp(ctx, msg))
+
+	assert.Equal(t, 1, idp.Accounts(testUserEmail), "no second account is created")
+	user, err = users.FindByID(ctx, result.User.ID)
+	require.NoError(t, err)
+	require.NotNil(t, user.CognitoID)
+	assert.Equal(t, sub, *user.CognitoID)
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"services/auth/internal/encryption"
+	"services/auth/internal/models"
+	"services/auth/internal/outbox"
+	"services/auth/internal/repositories"
+
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+)
+
+// Outbox message kinds enqueued by SignupService.
+const (
+	// OutboxCognitoSignUp creates the identity provider account of a user.
+	OutboxCognitoSignUp = "cognito.sign_up"
+	// OutboxResendConfirmationCode resends the code of an unconfirmed account.
+	OutboxResendConfirmationCode = "cognito.resend_confirmation_code"
+)
+
+type cognitoSignUpPayload struct {
+	UserID int `json:"user_id"`
+}
+
+type resendConfirmationCodePayload struct {
+	Username string `json:"username"`
+}
+
+// RegisterOutboxHandlers registers the handlers of the messages enqueued by
+// the service in d.
+func (s *SignupService) RegisterOutboxHandlers(d *outbox.Dispatcher) {
+	d.Handle(OutboxCognitoSignUp, s.deliverCognitoSignUp)
+	d.Handle(OutboxResendConfirmationCode, s.deliverResendConfirmationCode)
+}
+
+// deliverCognitoSignUp creates the identity provider account of a user
+// stored by Signup and links it to the row. It does nothing once the row is
+// linked, so duplicate messages are harmless.
+func (s *SignupService) deliverCognitoSignUp(ctx context.Context, msg outbox.Message) error {
+	var payload cognitoSignUpPayload
+	if err := msg.Decode(&payload); err != nil {
+		return outbox.Permanent(err)
+	}
+
+	user, err := s.userRepo.FindByID(ctx, payload.UserID)
+	if errors.Is(err, encryption.ErrUnreadableField) {
+		return outbox.Permanent(fmt.Errorf("failed to decrypt temporary password: %w", err))
+	}
+	if errors.Is(err, repositories.ErrNotFound) {
+		return outbox.Permanent(fmt.Errorf("user %d not found", payload.UserID))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load user: %w", err)
+	}
+	if user.CognitoID != nil {
+		return nil
+	}
+	if !user.TemporaryPassword.Valid() {
+		return outbox.Permanent(fmt.Errorf("user %d has no temporary password", user.ID))
+	}
+
+	cognitoID, err := s.cognitoClient.SignUp(ctx, user.ID, user.Email, user.TemporaryPassword.Plaintext(), user.Name)
+	var usernameExistsErr *types.UsernameExistsException
+	if errors.As(err, &usernameExistsErr) {
+		cognitoID, err = s.adoptExistingAccount(ctx, user)
+	}
+	if err != nil {
+		return err
+	}
+
+	user.CognitoID = &cognitoID
+	return s.saveUser(ctx, user)
+}
+
+// adoptExistingAccount returns the identity provider account already
+// registered for user, e.g. by an earlier delivery whose update was lost,
+// and resends its code while it is unconfirmed.
+func (s *SignupService) adoptExistingAccount(ctx context.Context, user *models.User) (string, error) {
+	isConfirmed, username, userSub, err := s.cognitoClient.IsUserConfirmed(ctx, user.ID, user.Email)
+	if err != nil {
+		return "", fmt.Errorf("failed to check existing account: %w", err)
+	}
+
+	if !isConfirmed {
+		if err := s.cognitoClient.ResendConfirmationCode(ctx, username); err != nil {
+			return "", fmt.Errorf("failed to resend confirmation code: %w", err)
+		}
+	}
+
+	return userSub, nil
+}
+
+func (s *SignupService) deliverResendConfirmationCode(ctx context.Context, msg outbox.Message) error {
+	var payload resendConfirmationCodePayload
+	if err := msg.Decode(&payload); err != nil {
+		return outbox.Permanent(err)
+	}
+
+	if err := s.cognitoClient.ResendConfirmationCode(ctx, payload.Username); err != nil {
+		return fmt.Errorf("failed to resend confirmation code: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"services/auth/internal/encryption"
+	"services/auth/internal/models"
+	"services/auth/internal/outbox"
+	"services/auth/internal/repositories"
+	"services/auth/internal/testhelpers"
+
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newMessage(t *testing.T, kind string, payload any) outbox.Message {
+	t.Helper()
+	data, err := json.Marshal(payload)
+	require.NoError(t, err)
+	return outbox.Message{ID: 1, Kind: kind, Payload: data, Attempts: 1}
+}
+
+// pendingUser is a user stored by Signup whose account is not created yet.
+func pendingUser() *models.User {
+	return &models.User{ID: 1, Name: testUserName, Email: testUserEmail, NormalizedEmail: testUserEmail, TemporaryPassword: encryption.NewField("temporary-password")}
+}
+
+func linkedTo(cognitoID string) any {
+	return mock.MatchedBy(func(user *models.User) bool {
+		return user.ID == 1 && user.CognitoID != nil && *user.CognitoID == cognitoID
+	})
+}
+
+func TestDeliverCognitoSignUp(t *testing.T) {
+	mockRepo := new(testhelpers.MockUserRepository)
+	mockCognito := new(testhelpers.MockCognitoClient)
+	service := NewSignupServiceWithInterfaces(mockRepo, outbox.NewMemoryStore(), mockCognito)
+	ctx := context.Background()
+
+	mockRepo.On("FindByID", ctx, 1).Return(pendingUser(), nil)
+	mockCognito.On("SignUp", ctx, 1, testUserEmail, "temporary-password", testUserName).Return(testCognitoID, nil)
+	mockRepo.On("Update", ctx, linkedTo(testCognitoID)).Return(nil)
+
+	err := service.deliverCognitoSignUp(ctx, newMessage(t, OutboxCognitoSignUp, cognitoSignUpPayload{UserID: 1}))
+
+	require.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+	mockCognito.AssertExpectations(t)
+}
+
+func TestDeliverCognitoSignUp_UnreadablePassword(t *testing.T) {
+	mockRepo := new(testhelpers.MockUserRepository)
+	mockCognito := new(testhelpers.MockCognitoClient)
+	service := NewSignupServiceWithInterfaces(mockRepo, outbox.NewMemoryStore(), mockCognito)
+	ctx := context.Background()
+
+	// e.g. a password copied from another row, which no longer opens
+	scanErr := fmt.Errorf("can't scan into dest[4]: %w", encryption.ErrUnreadableField)
+	mockRepo.On("FindByID", ctx, 1).Return(nil, scanErr)
+
+	err := service.deliverCognitoSignUp(ctx, newMessage(t, OutboxCognitoSignUp, cognitoSignUpPayload{UserID: 1}))
+
+	require.Error(t, err)
+	assert.True(t, outbox.IsPermanent(err), "retrying cannot open the password")
+	assert.Contains(t, err.Error(), "failed to decrypt temporary password")
+	mockCognito.AssertNotCalled(t, "SignUp", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDeliverCognitoSignUp_AlreadyLinked(t *testing.T) {
+	mockRepo := new(testhelpers.MockUserRepository)
+	mockCognito := new(testhelpers.MockCognitoClient)
+	service := NewSignupServiceWithInterfaces(mockRepo, outbox.NewMemoryStore(), mockCognito)
+	ctx := context.Background()
+
+	user := pendingUser()
+	cognitoID := testCognitoID
+	user.CognitoID = &cognitoID
+	mockRepo.On("FindByID", ctx, 1).Return(user, nil)
+
+	err := service.deliverCognitoSignUp(ctx, newMessage(t, OutboxCognitoSignUp, cognitoSignUpPayload{UserID: 1}))
+
+	require.NoError(t, err, "duplicate deliveries are harmless")
+	mockCognito.AssertNotCalled(t, "SignUp", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDeliverCognitoSignUp_AdoptsExistingAccount(t *testing.T) {
+	tests := []struct {
+		name      string
+		confirmed bool
+	}{
+		{"unconfirmed account gets a new code", false},
+		{"confirmed account is linked", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(testhelpers.MockUserRepository)
+			mockCognito := new(testhelpers.MockCognitoClient)
+			service := NewSignupServiceWithInterfaces(mockRepo, outbox.NewMemoryStore(), mockCognito)
+			ctx := context.Background()
+
+			mockRepo.On("FindByID", ctx, 1).Return(pendingUser(), nil)
+			mockCognito.On("SignUp", ctx, 1, testUserEmail, "temporary-password", testUserName).
+				Return("", &types.UsernameExistsException{})
+			mockCognito.On("IsUserConfirmed", ctx, 1, testUserEmail).Return(tt.confirmed, testCognitoUser, "existing-sub", nil)
+			if !tt.confirmed {
+				mockCognito.On("ResendConfirmationCode", ctx, testCognitoUser).Return(nil)
+			}
+			mockRepo.On("Update", ctx, linkedTo("existing-sub")).Return(nil)
+
+			err := service.deliverCognitoSignUp(ctx, newMessage(t, OutboxCognitoSignUp, cognitoSignUpPayload{UserID: 1}))
+
+			require.NoError(t, err)
+			mockRepo.AssertExpectations(t)
+			mockCognito.AssertExpectations(t)
+		})
+	}
+}
+
+// A message is redelivered when linking the account fails after SignUp
+// succeeded. SignUp derives the username from the user ID, so the second
+// attempt finds the account of the first instead of creating another.
+func TestDeliverCognitoSignUp_Redelivered(t *testing.T) {
+	mockRepo := new(testhelpers.MockUserRepository)
+	mockCognito := new(testhelpers.MockCognitoClient)
+	service := NewSignupServiceWithInterfaces(mockRepo, outbox.NewMemoryStore(), mockCognito)
+	ctx := context.Background()
+	msg := newMessage(t, OutboxCognitoSignUp, cognitoSignUpPayload{UserID: 1})
+
+	mockRepo.On("FindByID", ctx, 1).Return(pendingUser(), nil).Once()
+	mockCognito.On("SignUp", ctx, 1, testUserEmail, "temporary-password", testUserName).Return(testCognitoID, nil).Once()
+	mockRepo.On("Update", ctx, linkedTo(testCognitoID)).Return(errors.New("database error")).Once()
+	require.Error(t, service.deliverCognitoSignUp(ctx, msg))
+
+	mockRepo.On("FindByID", ctx, 1).Return(pendingUser(), nil).Once()
+	mockCognito.On("SignUp", ctx, 1, testUserEmail, "temporary-password", testUserName).
+		Return("", &types.UsernameExistsException{}).Once()
+	mockCognito.On("IsUserConfirmed", ctx, 1, testUserEmail).Return(false, testCognitoUser, testCognitoID, nil)
+	mockCognito.On("ResendConfirmationCode", ctx, testCognitoUser).Return(nil)
+	mockRepo.On("Update", ctx, linkedTo(testCognitoID)).Return(nil).Once()
+	require.NoError(t, service.deliverCognitoSignUp(ctx, msg))
+
+	mockRepo.AssertExpectations(t)
+	mockCognito.AssertExpectations(t)
+}
+
+func TestDeliverCognitoSignUp_Errors(t *testing.T) {
+	t.Run("provider errors are retried", func(t *testing.T) {
+		mockRepo := new(testhelpers.MockUserRepository)
+		mockCognito := new(testhelpers.MockCognitoClient)
+		service := NewSignupServiceWithInterfaces(mockRepo, outbox.NewMemoryStore(), mockCognito)
+		ctx := context.Background()
+
+		mockRepo.On("FindByID", ctx, 1).Return(pendingUser(), nil)
+		mockCognito.On("SignUp", ctx, 1, testUserEmail, "temporary-password", testUserName).
+			Return("", errors.New("cognito error"))
+
+		err := service.deliverCognitoSignUp(ctx, newMessage(t, OutboxCognitoSignUp, cognitoSignUpPayload{UserID: 1}))
+
+		require.Error(t, err)
+		assert.False(t, outbox.IsPermanent(err))
+	})
+
+	t.Run("a lost update is retried", func(t *testing.T) {
+		mockRepo := new(testhelpers.MockUserRepository)
+		mockCognito := new(testhelpers.MockCognitoClient)
+		service := NewSignupServiceWithInterfaces(mockRepo, outbox.NewMemoryStore(), mockCognito)
+		ctx := context.Background()
+
+		mockRepo.On("FindByID", ctx, 1).Return(pendingUser(), nil)
+		mockCognito.On("SignUp", ctx, 1, testUserEmail, "temporary-password", testUserName).Return(testCognitoID, nil)
+		mockRepo.On("Update", ctx, linkedTo(testCognitoID)).Return(errors.New("database error"))
+
+		err := service.deliverCognitoSignUp(ctx, newMessage(t, OutboxCognitoSignUp, cognitoSignUpPayload{UserID: 1}))
+
+		require.Error(t, err)
+		assert.False(t, outbox.IsPermanent(err))
+	})
+
+	t.Run("missing users are permanent failures", func(t *testing.T) {
+		mockRepo := new(testhelpers.MockUserRepository)
+		service := NewSignupServiceWithInterfaces(mockRepo, outbox.NewMemoryStore(), new(testhelpers.MockCognitoClient))
+		ctx := context.Background()
+
+		mockRepo.On("FindByID", ctx, 1).Return(nil, &repositories.NotFoundError{Table: "users", Column: "id"})
+
+		err := service.deliverCognitoSignUp(ctx, newMessage(t, OutboxCognitoSignUp, cognitoSignUpPayload{UserID: 1}))
+
+		assert.True(t, outbox.IsPermanent(err))
+	})
+
+	t.Run("invalid payloads are permanent failures", func(t *testing.T) {
+		service := NewSignupServiceWithInterfaces(new(testhelpers.MockUserRepository), outbox.NewMemoryStore(), new(testhelpers.MockCognitoClient))
+
+		err := service.deliverCognitoSignUp(context.Background(), newMessage(t, OutboxCognitoSignUp, "not an object"))
+
+		assert.True(t, outbox.IsPermanent(err))
+	})
+}
+
+func TestDeliverResendConfirmationCode(t *testing.T) {
+	mockCognito := new(testhelpers.MockCognitoClient)
+	service := NewSignupServiceWithInterfaces(new(testhelpers.MockUserRepository), outbox.NewMemoryStore(), mockCognito)
+	ctx := context.Background()
+	msg := newMessage(t, OutboxResendConfirmationCode, resendConfirmationCodePayload{Username: testCognitoUser})
+
+	mockCognito.On("ResendConfirmationCode", ctx, testCognitoUser).Return(nil).Once()
+	require.NoError(t, service.deliverResendConfirmationCode(ctx, msg))
+
+	mockCognito.On("ResendConfirmationCode", ctx, testCognitoUser).Return(errors.New("resend error")).Once()
+	err := service.deliverResendConfirmationCode(ctx, msg)
+	assert.ErrorContains(t, err, "failed to resend confirmation code")
+	assert.False(t, outbox.IsPermanent(err))
+}
@@ -5,13 +5,16 @@ import (
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"log"
+	"services/auth/internal/audit"
 	"services/auth/internal/cognito"
+	"services/auth/internal/emailaddr"
 	"services/auth/internal/encryption"
+	"services/auth/internal/metrics"
 	"services/auth/internal/models"
 	"services/auth/internal/repositories"
+	"services/auth/internal/signuppolicy"
 	"services/auth/internal/testhelpers"
-
-	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
 )
 
 // UserRepositoryInterface defines repository operations (aliased for convenience).
@@ -20,37 +23,87 @@ type UserRepositoryInterface = testhelpers.UserRepositoryInterface
 // CognitoClientInterface defines Cognito client operations (aliased for convenience).
 type CognitoClientInterface = testhelpers.CognitoClientInterface
 
+// SignupPolicyInterface decides whether an email may sign up (aliased for convenience).
+type SignupPolicyInterface = testhelpers.SignupPolicyInterface
+
+// OutboxInterface enqueues side effects in the sign-up transaction (aliased for convenience).
+type OutboxInterface = testhelpers.OutboxInterface
+
+// OutboxDispatcherInterface delivers enqueued side effects (aliased for convenience).
+type OutboxDispatcherInterface = testhelpers.OutboxDispatcherInterface
+
 type SignupService struct {
-	userRepo         UserRepositoryInterface
-	cognitoClient    CognitoClientInterface
-	encryptFunc      func(string, string) (string, error)
-	decryptFunc      func(string, string) (string, error)
-	encryptionSecret string
+	userRepo        UserRepositoryInterface
+	outbox          OutboxInterface
+	cognitoClient   CognitoClientInterface
+	emailNormalizer *emailaddr.Normalizer
+	policy          SignupPolicyInterface
+	dispatcher      OutboxDispatcherInterface
+	recorder        *audit.Recorder
+}
+
+// Option configures optional SignupService dependencies.
+type Option func(*SignupService)
+
+// WithEmailNormalizer sets how sign-up emails are mapped to a canonical
+// identity. The default only trims, lowercases and punycodes the address.
+func WithEmailNormalizer(normalizer *emailaddr.Normalizer) Option {
+	return func(s *SignupService) {
+		s.emailNormalizer = normalizer
+	}
+}
+
+// WithPolicy sets the sign-up policy consulted before the identity provider
+// is called. Without one every address is accepted.
+func WithPolicy(policy SignupPolicyInterface) Option {
+	return func(s *SignupService) {
+		s.policy = policy
+	}
+}
+
+// WithDispatcher delivers the messages of each sign-up as soon as it
+// commits. Without one they wait for the outbox dispatcher to poll.
+func WithDispatcher(dispatcher OutboxDispatcherInterface) Option {
+	return func(s *SignupService) {
+		s.dispatcher = dispatcher
+	}
+}
+
+// WithRecorder records every sign-up attempt in the audit log.
+func WithRecorder(recorder *audit.Recorder) Option {
+	return func(s *SignupService) {
+		s.recorder = recorder
+	}
 }
 
 // NewSignupService creates a new SignupService with concrete implementations.
 func NewSignupService(
 	userRepo *repositories.UserRepository,
+	outboxRepo *repositories.OutboxRepository,
 	cognitoClient *cognito.Client,
-	encryptionSecret string,
+	opts ...Option,
 ) *SignupService {
-	return NewSignupServiceWithInterfaces(userRepo, cognitoClient, encryptionSecret)
+	return NewSignupServiceWithInterfaces(userRepo, outboxRepo, cognitoClient, opts...)
 }
 
 // NewSignupServiceWithInterfaces creates a new SignupService with interface-based dependencies
 // This allows for easier testing with mocks.
 func NewSignupServiceWithInterfaces(
 	userRepo UserRepositoryInterface,
+	outbox OutboxInterface,
 	cognitoClient CognitoClientInterface,
-	encryptionSecret string,
+	opts ...Option,
 ) *SignupService {
-	return &SignupService{
-		userRepo:         userRepo,
-		cognitoClient:    cognitoClient,
-		encryptFunc:      encryption.Encrypt,
-		decryptFunc:      encryption.Decrypt,
-		encryptionSecret: encryptionSecret,
+	s := &SignupService{
+		userRepo:        userRepo,
+		outbox:          outbox,
+		cognitoClient:   cognitoClient,
+		emailNormalizer: emailaddr.NewNormalizer(false),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 func generateTemporaryPassword(length int) (string, error) {
@@ -122,167 +175,270 @@ func generateTemporaryPassword(length int) (string, error) {
 	return string(password), nil
 }
 
+// Signup registers the user and records the outcome in the sign-up funnel
+// metrics and the audit log.
 func (s *SignupService) Signup(ctx context.Context, name, email string) (*SignupResult, error) {
-	// Check if user already exists
-	existingUser, err := s.userRepo.FindByEmail(ctx, email)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check existing user: %w", err)
+	result, err := s.signup(ctx, name, email)
+	metrics.Auth.RecordSignup(signupOutcome(result, err))
+	s.recorder.Record(ctx, signupEvent(result, err))
+	return result, err
+}
+
+// signupEvent describes a sign-up attempt for the audit log. Attempts for an
+// address that is taken are not attributed to its user, since the address
+// may not belong to whoever made them.
+func signupEvent(result *SignupResult, err error) audit.Event {
+	event := audit.Event{Type: audit.TypeSignup, Actor: audit.ActorAnonymous, Outcome: audit.OutcomeDenied}
+	switch {
+	case errors.Is(err, ErrInvalidEmail):
+		event.Reason = "invalid_email"
+	case errors.Is(err, ErrUserAlreadyExists), errors.Is(err, ErrEmailNotAllowed):
+		event.Reason = signupOutcome(result, err)
+	case err != nil || result == nil:
+		event.Outcome, event.Reason = audit.OutcomeFailure, signupOutcome(result, err)
+	default:
+		event.Outcome, event.Reason = audit.OutcomeSuccess, string(result.Status)
+		event.UserID = &result.User.ID
 	}
+	return event
+}
 
-	if existingUser != nil && existingUser.CognitoID != nil {
-		result, existingErr := s.handleExistingConfirmedUser(ctx, existingUser, email)
-		if result != nil || existingErr != nil {
-			if existingErr != nil {
-				return nil, existingErr
-			}
-			return result, nil
-		}
+func signupOutcome(result *SignupResult, err error) string {
+	switch {
+	case errors.Is(err, ErrUserAlreadyExists):
+		return metrics.SignupOutcomeUserExists
+	case errors.Is(err, ErrSignupProviderUnavailable):
+		return metrics.SignupOutcomeProviderUnavailable
+	case errors.Is(err, ErrEmailNotAllowed):
+		return metrics.SignupOutcomeEmailNotAllowed
+	case err != nil || result == nil:
+		return metrics.SignupOutcomeError
+	default:
+		return string(result.Status)
 	}
+}
 
-	temporaryPassword, encryptedPassword, err := s.generateProtectedPassword()
+func (s *SignupService) signup(ctx context.Context, name, rawEmail string) (*SignupResult, error) {
+	email, err := emailaddr.Normalize(rawEmail)
 	if err != nil {
-		return nil, err
+		return nil, ErrInvalidEmail
 	}
-
-	cognitoID, err := s.cognitoClient.SignUp(ctx, email, temporaryPassword, name)
+	normalizedEmail, err := s.emailNormalizer.Canonical(email)
 	if err != nil {
-		result, handledErr := s.handleCognitoSignUpError(ctx, err, existingUser, name, email, encryptedPassword)
-		if handledErr != nil {
-			return nil, handledErr
-		}
-		if result != nil {
-			return result, nil
-		}
-		return nil, ErrSignupProviderUnavailable
+		return nil, ErrInvalidEmail
 	}
 
-	user := s.buildUser(existingUser, name, email, &cognitoID, &encryptedPassword)
-	if err := s.saveUser(ctx, user, existingUser != nil); err != nil {
+	if err := s.checkPolicy(ctx, normalizedEmail); err != nil {
 		return nil, err
 	}
 
-	// New users in Cognito always start as UNCONFIRMED and need email confirmation
-	return &SignupResult{
-		User:   user,
-		Status: models.SignupStatusPendingConfirmation,
-	}, nil
-}
-
-func (s *SignupService) handleExistingConfirmedUser(ctx context.Context, existingUser *models.User, email string) (*SignupResult, error) {
-	isConfirmed, username, userSub, checkErr := s.cognitoClient.IsUserConfirmed(ctx, email)
-	if checkErr != nil {
-		return nil, ErrUserAlreadyExists
+	var (
+		result   *SignupResult
+		pending  []int64
+		existing *models.User
+	)
+	// Sign-ups are unauthenticated, so the rows they write are attributed to
+	// an anonymous actor; deliveries of the outbox write as the system
+	anonymous := repositories.WithActor(ctx, audit.ActorAnonymous)
+	err = s.userRepo.WithTx(anonymous, func(ctx context.Context) error {
+		var err error
+		result, pending, existing, err = s.signupLocked(ctx, name, email, normalizedEmail)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if !isConfirmed {
-		if resendErr := s.cognitoClient.ResendConfirmationCode(ctx, username); resendErr != nil {
-			return nil, fmt.Errorf("failed to resend confirmation code: %w", resendErr)
+	if existing != nil {
+		// Asked after commit: with its retries Cognito can take seconds,
+		// which must not hold the row lock and a pooled connection
+		if result, pending, err = s.handleExistingUser(anonymous, existing); err != nil {
+			return nil, err
 		}
-
-		if userSub != "" && existingUser.CognitoID == nil {
-			existingUser.CognitoID = &userSub
-			if err := s.userRepo.Update(ctx, existingUser); err != nil {
-				return nil, fmt.Errorf("failed to update user: %w", err)
-			}
-		}
-
-		return &SignupResult{
-			User:   existingUser,
-			Status: models.SignupStatusPendingConfirmation,
-		}, nil
 	}
 
-	return nil, ErrUserAlreadyExists
+	s.dispatch(ctx, result, pending)
+	return result, nil
 }
 
-func (s *SignupService) generateProtectedPassword() (string, string, error) {
-	temporaryPassword, err := generateTemporaryPassword(32)
+// signupLocked stores the sign-up while holding the row of normalizedEmail,
+// inserting a placeholder when the address is new, and enqueues the identity
+// provider calls in the same transaction. It returns the enqueued message
+// ids, or the user when their account already exists, which is left to
+// handleExistingUser once the lock is released. Concurrent sign-ups for the
+// same address wait on the lock and then find the row the first one stored,
+// so they converge on one user.
+func (s *SignupService) signupLocked(ctx context.Context, name, email, normalizedEmail string) (*SignupResult, []int64, *models.User, error) {
+	user, created, err := s.userRepo.LockOrCreate(ctx, &models.User{
+		Name:            name,
+		Email:           email,
+		NormalizedEmail: normalizedEmail,
+	})
+	if errors.Is(err, repositories.ErrDeleted) {
+		// The address belongs to a deleted account that can still be restored
+		return nil, nil, nil, ErrUserAlreadyExists
+	}
 	if err != nil {
-		return "", "", fmt.Errorf("failed to generate temporary password: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to lock user: %w", err)
+	}
+
+	if !created && user.CognitoID != nil {
+		return nil, nil, user, nil
+	}
+
+	// The user is new, or the account of an earlier sign-up is not created
+	// yet. Its temporary password is kept: a pending delivery may use it.
+	// The repository stores it encrypted.
+	if !user.TemporaryPassword.Valid() {
+		temporaryPassword, err := generateTemporaryPassword(32)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to generate temporary password: %w", err)
+		}
+		user.TemporaryPassword = encryption.NewField(temporaryPassword)
+	}
+	user.Name = name
+	if err := s.saveUser(ctx, user); err != nil {
+		return nil, nil, nil, err
 	}
 
-	encryptedPassword, err := s.encryptFunc(temporaryPassword, s.encryptionSecret)
+	id, err := s.outbox.Enqueue(ctx, OutboxCognitoSignUp, cognitoSignUpPayload{UserID: user.ID})
 	if err != nil {
-		return "", "", fmt.Errorf("failed to encrypt password: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to enqueue sign-up: %w", err)
 	}
 
-	return temporaryPassword, encryptedPassword, nil
+	// New users in Cognito always start as UNCONFIRMED and need email confirmation
+	return &SignupResult{
+		User:   user,
+		Status: models.SignupStatusPendingConfirmation,
+	}, []int64{id}, nil, nil
 }
 
-func (s *SignupService) handleCognitoSignUpError(
-	ctx context.Context,
-	signupErr error,
-	existingUser *models.User,
-	name,
-	email,
-	encryptedPassword string,
-) (*SignupResult, error) {
-	var usernameExistsErr *types.UsernameExistsException
-	if !errors.As(signupErr, &usernameExistsErr) {
-		return nil, ErrSignupProviderUnavailable
+// dispatch delivers the messages of a committed sign-up right away so the
+// confirmation email does not wait for the next outbox poll. Failed
+// deliveries stay in the outbox and are retried by the dispatcher.
+func (s *SignupService) dispatch(ctx context.Context, result *SignupResult, ids []int64) {
+	if s.dispatcher == nil || len(ids) == 0 {
+		return
 	}
-
-	isConfirmed, username, userSub, checkErr := s.cognitoClient.IsUserConfirmed(ctx, email)
-	if checkErr != nil {
-		return nil, ErrUserAlreadyExists
+	if err := s.dispatcher.Dispatch(ctx, ids...); err != nil {
+		log.Printf("Failed to dispatch sign-up of user %d: %v", result.User.ID, err)
+		return
 	}
 
-	if isConfirmed {
-		return nil, ErrUserAlreadyExists
+	user, err := s.userRepo.FindByID(ctx, result.User.ID)
+	if err != nil {
+		return
 	}
+	result.User = user
+}
 
-	if resendErr := s.cognitoClient.ResendConfirmationCode(ctx, username); resendErr != nil {
-		return nil, fmt.Errorf("failed to resend confirmation code: %w", resendErr)
+// checkPolicy rejects addresses refused by the sign-up policy before the
+// identity provider spends an email on them. email is the canonical address.
+func (s *SignupService) checkPolicy(ctx context.Context, email string) error {
+	if s.policy == nil {
+		return nil
 	}
 
-	user := existingUser
-	if user == nil {
-		user = &models.User{}
+	err := s.policy.Check(ctx, email)
+	var rejection *signuppolicy.Rejection
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &rejection):
+		metrics.Auth.RecordSignupRejection(rejection.Reason)
+		return fmt.Errorf("%w: %s", ErrEmailNotAllowed, rejection.Reason)
+	default:
+		return fmt.Errorf("failed to check sign-up policy: %w", err)
 	}
+}
 
-	user.Name = name
-	user.Email = email
-	user.CognitoID = &userSub
-	if encryptedPassword != "" {
-		user.TemporaryPassword = &encryptedPassword
+// handleExistingUser answers a sign-up for an address whose account exists:
+// confirmed accounts are refused, unconfirmed ones get a new code, and an
+// account deleted from the identity provider is created again. When Cognito
+// cannot tell, the sign-up fails as retryable rather than refused. It runs
+// outside the sign-up transaction. The account is looked up by the user's
+// ID and first address, from which its username was derived; the address
+// may differ from the one of this sign-up by case or Gmail folding.
+func (s *SignupService) handleExistingUser(ctx context.Context, existingUser *models.User) (*SignupResult, []int64, error) {
+	isConfirmed, username, _, checkErr := s.cognitoClient.IsUserConfirmed(ctx, existingUser.ID, existingUser.Email)
+	switch {
+	case errors.Is(checkErr, cognito.ErrUnavailable):
+		return nil, nil, fmt.Errorf("%w: %w", ErrSignupProviderUnavailable, checkErr)
+	case errors.Is(checkErr, cognito.ErrUserNotFound):
+		return s.relinkUser(ctx, existingUser)
+	case checkErr != nil:
+		return nil, nil, fmt.Errorf("failed to check existing account: %w", checkErr)
+	case isConfirmed:
+		return nil, nil, ErrUserAlreadyExists
 	}
 
-	if err := s.saveUser(ctx, user, existingUser != nil); err != nil {
-		return nil, err
+	id, err := s.outbox.Enqueue(ctx, OutboxResendConfirmationCode, resendConfirmationCodePayload{Username: username})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to enqueue confirmation code: %w", err)
 	}
 
 	return &SignupResult{
-		User:   user,
+		User:   existingUser,
 		Status: models.SignupStatusPendingConfirmation,
-	}, nil
+	}, []int64{id}, nil
 }
 
-func (s *SignupService) buildUser(existingUser *models.User, name, email string, cognitoID, encryptedPassword *string) *models.User {
-	user := &models.User{
-		Name:              name,
-		Email:             email,
-		TemporaryPassword: encryptedPassword,
-		CognitoID:         cognitoID,
-	}
-
-	if existingUser != nil {
-		user.ID = existingUser.ID
-	}
-
-	return user
-}
+// relinkUser clears the link of a user whose identity provider account no
+// longer exists, e.g. because it was deleted from the pool, and enqueues
+// the creation of a new one, as for a new sign-up. Nobody could confirm the
+// old account, so refusing the sign-up would lock the address out. The row
+// is locked again first, so that concurrent sign-ups relink it once.
+func (s *SignupService) relinkUser(ctx context.Context, existingUser *models.User) (*SignupResult, []int64, error) {
+	var (
+		result  *SignupResult
+		pending []int64
+	)
+	err := s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		user, _, err := s.userRepo.LockOrCreate(ctx, &models.User{
+			Name:            existingUser.Name,
+			Email:           existingUser.Email,
+			NormalizedEmail: existingUser.NormalizedEmail,
+		})
+		if errors.Is(err, repositories.ErrDeleted) {
+			return ErrUserAlreadyExists
+		}
+		if err != nil {
+			return fmt.Errorf("failed to lock user: %w", err)
+		}
+		result = &SignupResult{User: user, Status: models.SignupStatusPendingConfirmation}
+		if user.CognitoID == nil || existingUser.CognitoID == nil || *user.CognitoID != *existingUser.CognitoID {
+			// Relinked by a concurrent sign-up since it was read
+			return nil
+		}
 
-func (s *SignupService) saveUser(ctx context.Context, user *models.User, update bool) error {
-	if update {
-		if err := s.userRepo.Update(ctx, user); err != nil {
-			return fmt.Errorf("failed to update user: %w", err)
+		user.CognitoID = nil
+		if !user.TemporaryPassword.Valid() {
+			temporaryPassword, err := generateTemporaryPassword(32)
+			if err != nil {
+				return fmt.Errorf("failed to generate temporary password: %w", err)
+			}
+			user.TemporaryPassword = encryption.NewField(temporaryPassword)
+		}
+		if err := s.saveUser(ctx, user); err != nil {
+			return err
 		}
+		id, err := s.outbox.Enqueue(ctx, OutboxCognitoSignUp, cognitoSignUpPayload{UserID: user.ID})
+		if err != nil {
+			return fmt.Errorf("failed to enqueue sign-up: %w", err)
+		}
+		pending = []int64{id}
 		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
+	return result, pending, nil
+}
 
-	if err := s.userRepo.Create(ctx, user); err != nil {
-		return fmt.Errorf("failed to create user: %w", err)
+// saveUser stores the sign-up on the row created by LockOrCreate.
+func (s *SignupService) saveUser(ctx context.Context, user *models.User) error {
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
 	}
-
 	return nil
 }
@@ -3,12 +3,21 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
+	"time"
 
+	"services/auth/internal/audit"
+	"services/auth/internal/cognito"
+	"services/auth/internal/emailaddr"
+	"services/auth/internal/encryption"
+	"services/auth/internal/metrics"
 	"services/auth/internal/models"
+	"services/auth/internal/outbox"
+	"services/auth/internal/repositories"
+	"services/auth/internal/signuppolicy"
 	"services/auth/internal/testhelpers"
 
-	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -21,30 +30,63 @@ const (
 	testCognitoUser = "john@example.com"
 )
 
+// inTx is the context the service passes to the calls of its sign-up
+// transaction, which write as an anonymous actor.
+func inTx(ctx context.Context) context.Context {
+	return repositories.WithActor(ctx, audit.ActorAnonymous)
+}
+
+// placeholder matches the row LockOrCreate is asked to insert for
+// normalizedEmail.
+func placeholder(normalizedEmail string) any {
+	return mock.MatchedBy(func(user *models.User) bool {
+		return user.NormalizedEmail == normalizedEmail && user.CognitoID == nil
+	})
+}
+
+// newRow is the placeholder row LockOrCreate returns when it inserted one.
+func newRow(normalizedEmail string) *models.User {
+	return &models.User{ID: 1, Email: normalizedEmail, NormalizedEmail: normalizedEmail}
+}
+
+// enqueued returns the kind and decoded payload of every message in store.
+func enqueued(t *testing.T, store *outbox.MemoryStore) map[string]map[string]any {
+	t.Helper()
+	messages := make(map[string]map[string]any)
+	for _, msg := range store.Messages() {
+		var payload map[string]any
+		require.NoError(t, msg.Decode(&payload))
+		messages[msg.Kind] = payload
+	}
+	return messages
+}
+
+type failingOutbox struct{}
+
+func (failingOutbox) Enqueue(context.Context, string, any) (int64, error) {
+	return 0, errors.New("outbox unavailable")
+}
+
 func TestSignupService_Signup_NewUser(t *testing.T) {
 	mockRepo := new(testhelpers.MockUserRepository)
 	mockCognito := new(testhelpers.MockCognitoClient)
+	store := outbox.NewMemoryStore()
 
 	service := NewSignupServiceWithInterfaces(
 		mockRepo,
+		store,
 		mockCognito,
-		"test-secret-key-1234567890123456",
 	)
 
 	ctx := context.Background()
 	name := testUserName
 	email := testUserEmail
-	cognitoID := testCognitoID
 
 	// Setup mocks
-	mockRepo.On("FindByEmail", ctx, email).Return(nil, nil)
-	mockCognito.On("SignUp", ctx, email, mock.AnythingOfType("string"), name).Return(cognitoID, nil)
-	mockRepo.On("Create", ctx, mock.MatchedBy(func(user *models.User) bool {
-		return user.Name == name && user.Email == email && user.CognitoID != nil && *user.CognitoID == cognitoID
-	})).Return(nil).Run(func(args mock.Arguments) {
-		user := args.Get(1).(*models.User)
-		user.ID = 1
-	})
+	mockRepo.On("LockOrCreate", inTx(ctx), placeholder(email)).Return(newRow(email), true, nil)
+	mockRepo.On("Update", inTx(ctx), mock.MatchedBy(func(user *models.User) bool {
+		return user.ID == 1 && user.Name == name && user.TemporaryPassword.Valid() && user.CognitoID == nil
+	})).Return(nil)
 
 	// Execute
 	result, err := service.Signup(ctx, name, email)
@@ -56,22 +98,27 @@ func TestSignupService_Signup_NewUser(t *testing.T) {
 	assert.NotNil(t, result.User)
 	assert.Equal(t, name, result.User.Name)
 	assert.Equal(t, email, result.User.Email)
-	assert.NotNil(t, result.User.CognitoID)
-	assert.Equal(t, cognitoID, *result.User.CognitoID)
-	assert.NotNil(t, result.User.TemporaryPassword)
+	assert.Nil(t, result.User.CognitoID, "the account is created by the outbox dispatcher")
+	require.True(t, result.User.TemporaryPassword.Valid())
+	assert.Equal(t, map[string]map[string]any{
+		OutboxCognitoSignUp: {"user_id": float64(1)},
+	}, enqueued(t, store))
+
+	assert.Len(t, result.User.TemporaryPassword.Plaintext(), 32)
 
 	mockRepo.AssertExpectations(t)
-	mockCognito.AssertExpectations(t)
+	mockCognito.AssertNotCalled(t, "SignUp", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 }
 
 func TestSignupService_Signup_UserAlreadyExists_Confirmed(t *testing.T) {
 	mockRepo := new(testhelpers.MockUserRepository)
 	mockCognito := new(testhelpers.MockCognitoClient)
+	store := outbox.NewMemoryStore()
 
 	service := NewSignupServiceWithInterfaces(
 		mockRepo,
+		store,
 		mockCognito,
-		"test-secret-key-1234567890123456",
 	)
 
 	ctx := context.Background()
@@ -87,8 +134,8 @@ func TestSignupService_Signup_UserAlreadyExists_Confirmed(t *testing.T) {
 	}
 
 	// Setup mocks
-	mockRepo.On("FindByEmail", ctx, email).Return(existingUser, nil)
-	mockCognito.On("IsUserConfirmed", ctx, email).Return(true, "username", cognitoID, nil)
+	mockRepo.On("LockOrCreate", inTx(ctx), placeholder(email)).Return(existingUser, false, nil)
+	mockCognito.On("IsUserConfirmed", inTx(ctx), 1, email).Return(true, "username", cognitoID, nil)
 
 	// Execute
 	result, err := service.Signup(ctx, name, email)
@@ -97,61 +144,105 @@ func TestSignupService_Signup_UserAlreadyExists_Confirmed(t *testing.T) {
 	assert.Error(t, err)
 	assert.True(t, errors.Is(err, ErrUserAlreadyExists))
 	assert.Nil(t, result)
+	assert.Empty(t, store.Messages())
 
 	mockRepo.AssertExpectations(t)
 	mockCognito.AssertExpectations(t)
 }
 
-func TestSignupService_Signup_UserExistsButUnconfirmed(t *testing.T) {
+func TestSignupService_Signup_UserExists_ProviderUnavailable(t *testing.T) {
 	mockRepo := new(testhelpers.MockUserRepository)
 	mockCognito := new(testhelpers.MockCognitoClient)
+	store := outbox.NewMemoryStore()
 
 	service := NewSignupServiceWithInterfaces(
 		mockRepo,
+		store,
 		mockCognito,
-		"test-secret-key-1234567890123456",
 	)
 
 	ctx := context.Background()
-	name := testUserName
-	email := testUserEmail
 	cognitoID := testCognitoID
-	username := testCognitoUser
+	existingUser := &models.User{ID: 1, Name: testUserName, Email: testUserEmail, CognitoID: &cognitoID}
+	unavailable := fmt.Errorf("failed to list users: %w", fmt.Errorf("%w: circuit breaker open", cognito.ErrUnavailable))
 
-	existingUser := &models.User{
-		ID:        1,
-		Name:      name,
-		Email:     email,
-		CognitoID: &cognitoID,
-	}
+	mockRepo.On("LockOrCreate", inTx(ctx), placeholder(testUserEmail)).Return(existingUser, false, nil)
+	mockCognito.On("IsUserConfirmed", inTx(ctx), 1, testUserEmail).Return(false, "", "", unavailable)
 
-	// Setup mocks
-	mockRepo.On("FindByEmail", ctx, email).Return(existingUser, nil)
-	mockCognito.On("IsUserConfirmed", ctx, email).Return(false, username, cognitoID, nil)
-	mockCognito.On("ResendConfirmationCode", ctx, username).Return(nil)
+	result, err := service.Signup(ctx, testUserName, testUserEmail)
 
-	// Execute
-	result, err := service.Signup(ctx, name, email)
+	require.ErrorIs(t, err, ErrSignupProviderUnavailable)
+	assert.NotErrorIs(t, err, ErrUserAlreadyExists)
+	assert.Nil(t, result)
+	assert.Empty(t, store.Messages())
 
-	// Assert
-	require.NoError(t, err)
-	require.NotNil(t, result)
+	mockRepo.AssertExpectations(t)
+	mockCognito.AssertExpectations(t)
+}
+
+func TestSignupService_Signup_UserExists_AccountDeletedFromProvider(t *testing.T) {
+	mockRepo := new(testhelpers.MockUserRepository)
+	mockCognito := new(testhelpers.MockCognitoClient)
+	store := outbox.NewMemoryStore()
+	service := NewSignupServiceWithInterfaces(mockRepo, store, mockCognito)
+
+	ctx := context.Background()
+	cognitoID := testCognitoID
+	existingUser := &models.User{ID: 1, Name: testUserName, Email: testUserEmail, NormalizedEmail: testUserEmail, CognitoID: &cognitoID}
+	locked := *existingUser
+
+	mockRepo.On("LockOrCreate", inTx(ctx), placeholder(testUserEmail)).Return(existingUser, false, nil).Once()
+	mockCognito.On("IsUserConfirmed", inTx(ctx), 1, testUserEmail).Return(false, "", "", cognito.ErrUserNotFound)
+	mockRepo.On("LockOrCreate", inTx(ctx), mock.Anything).Return(&locked, false, nil).Once()
+	mockRepo.On("Update", inTx(ctx), mock.MatchedBy(func(user *models.User) bool {
+		return user.ID == 1 && user.CognitoID == nil && user.TemporaryPassword.Valid()
+	})).Return(nil)
+
+	result, err := service.Signup(ctx, testUserName, testUserEmail)
+
+	require.NoError(t, err, "an account nobody can confirm does not hold the address")
 	assert.Equal(t, models.SignupStatusPendingConfirmation, result.Status)
-	assert.NotNil(t, result.User)
-	assert.Equal(t, existingUser.ID, result.User.ID)
+	assert.Nil(t, result.User.CognitoID, "the link is cleared")
+	assert.Equal(t, map[string]map[string]any{
+		OutboxCognitoSignUp: {"user_id": float64(1)},
+	}, enqueued(t, store))
 
 	mockRepo.AssertExpectations(t)
 	mockCognito.AssertExpectations(t)
 }
 
-func TestSignupService_Signup_UserInCognitoButNotDB(t *testing.T) {
+func TestSignupService_Signup_UserExists_ProviderError(t *testing.T) {
+	mockRepo := new(testhelpers.MockUserRepository)
+	mockCognito := new(testhelpers.MockCognitoClient)
+	store := outbox.NewMemoryStore()
+	service := NewSignupServiceWithInterfaces(mockRepo, store, mockCognito)
+
+	ctx := context.Background()
+	cognitoID := testCognitoID
+	existingUser := &models.User{ID: 1, Name: testUserName, Email: testUserEmail, CognitoID: &cognitoID}
+
+	mockRepo.On("LockOrCreate", inTx(ctx), placeholder(testUserEmail)).Return(existingUser, false, nil)
+	mockCognito.On("IsUserConfirmed", inTx(ctx), 1, testUserEmail).Return(false, "", "", errors.New("AccessDeniedException"))
+
+	result, err := service.Signup(ctx, testUserName, testUserEmail)
+
+	require.ErrorContains(t, err, "AccessDeniedException")
+	assert.NotErrorIs(t, err, ErrUserAlreadyExists, "an error is not a conflict")
+	assert.NotErrorIs(t, err, ErrSignupProviderUnavailable)
+	assert.Nil(t, result)
+	assert.Empty(t, store.Messages())
+	mockRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+}
+
+func TestSignupService_Signup_UserExistsButUnconfirmed(t *testing.T) {
 	mockRepo := new(testhelpers.MockUserRepository)
 	mockCognito := new(testhelpers.MockCognitoClient)
+	store := outbox.NewMemoryStore()
 
 	service := NewSignupServiceWithInterfaces(
 		mockRepo,
+		store,
 		mockCognito,
-		"test-secret-key-1234567890123456",
 	)
 
 	ctx := context.Background()
@@ -160,18 +251,16 @@ func TestSignupService_Signup_UserInCognitoButNotDB(t *testing.T) {
 	cognitoID := testCognitoID
 	username := testCognitoUser
 
-	// Setup mocks - user not in DB, but exists in Cognito (UsernameExistsException)
-	mockRepo.On("FindByEmail", ctx, email).Return(nil, nil)
-	mockCognito.On("SignUp", ctx, email, mock.AnythingOfType("string"), name).
-		Return("", &types.UsernameExistsException{})
-	mockCognito.On("IsUserConfirmed", ctx, email).Return(false, username, cognitoID, nil)
-	mockCognito.On("ResendConfirmationCode", ctx, username).Return(nil)
-	mockRepo.On("Create", ctx, mock.MatchedBy(func(user *models.User) bool {
-		return user.Name == name && user.Email == email && user.CognitoID != nil && *user.CognitoID == cognitoID
-	})).Return(nil).Run(func(args mock.Arguments) {
-		user := args.Get(1).(*models.User)
-		user.ID = 1
-	})
+	existingUser := &models.User{
+		ID:        1,
+		Name:      name,
+		Email:     email,
+		CognitoID: &cognitoID,
+	}
+
+	// Setup mocks
+	mockRepo.On("LockOrCreate", inTx(ctx), placeholder(email)).Return(existingUser, false, nil)
+	mockCognito.On("IsUserConfirmed", inTx(ctx), 1, email).Return(false, username, cognitoID, nil)
 
 	// Execute
 	result, err := service.Signup(ctx, name, email)
@@ -181,43 +270,44 @@ func TestSignupService_Signup_UserInCognitoButNotDB(t *testing.T) {
 	require.NotNil(t, result)
 	assert.Equal(t, models.SignupStatusPendingConfirmation, result.Status)
 	assert.NotNil(t, result.User)
-	assert.Equal(t, name, result.User.Name)
-	assert.Equal(t, email, result.User.Email)
-	assert.NotNil(t, result.User.CognitoID)
-	assert.Equal(t, cognitoID, *result.User.CognitoID)
-	assert.NotNil(t, result.User.TemporaryPassword)
+	assert.Equal(t, existingUser.ID, result.User.ID)
+	assert.Equal(t, map[string]map[string]any{
+		OutboxResendConfirmationCode: {"username": username},
+	}, enqueued(t, store))
 
 	mockRepo.AssertExpectations(t)
 	mockCognito.AssertExpectations(t)
+	mockCognito.AssertNotCalled(t, "ResendConfirmationCode", mock.Anything, mock.Anything)
 }
 
 func TestSignupService_Signup_UserInDBButNotCognito(t *testing.T) {
 	mockRepo := new(testhelpers.MockUserRepository)
 	mockCognito := new(testhelpers.MockCognitoClient)
+	store := outbox.NewMemoryStore()
 
 	service := NewSignupServiceWithInterfaces(
 		mockRepo,
+		store,
 		mockCognito,
-		"test-secret-key-1234567890123456",
 	)
 
 	ctx := context.Background()
 	name := testUserName
 	email := testUserEmail
-	cognitoID := testCognitoID
+	pendingPassword := encryption.NewField("pending-password")
 
 	existingUser := &models.User{
-		ID:        1,
-		Name:      name,
-		Email:     email,
-		CognitoID: nil, // No Cognito ID yet
+		ID:                1,
+		Name:              "Earlier Name",
+		Email:             email,
+		TemporaryPassword: pendingPassword,
+		CognitoID:         nil, // The first delivery has not run yet
 	}
 
 	// Setup mocks
-	mockRepo.On("FindByEmail", ctx, email).Return(existingUser, nil)
-	mockCognito.On("SignUp", ctx, email, mock.AnythingOfType("string"), name).Return(cognitoID, nil)
-	mockRepo.On("Update", ctx, mock.MatchedBy(func(user *models.User) bool {
-		return user.ID == existingUser.ID && user.CognitoID != nil && *user.CognitoID == cognitoID
+	mockRepo.On("LockOrCreate", inTx(ctx), placeholder(email)).Return(existingUser, false, nil)
+	mockRepo.On("Update", inTx(ctx), mock.MatchedBy(func(user *models.User) bool {
+		return user.ID == existingUser.ID && user.Name == name && user.TemporaryPassword == pendingPassword
 	})).Return(nil)
 
 	// Execute
@@ -227,13 +317,11 @@ func TestSignupService_Signup_UserInDBButNotCognito(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, result)
 	assert.Equal(t, models.SignupStatusPendingConfirmation, result.Status)
-	assert.NotNil(t, result.User)
 	assert.Equal(t, existingUser.ID, result.User.ID)
-	assert.NotNil(t, result.User.CognitoID)
-	assert.Equal(t, cognitoID, *result.User.CognitoID)
+	assert.Contains(t, enqueued(t, store), OutboxCognitoSignUp)
 
 	mockRepo.AssertExpectations(t)
-	mockCognito.AssertExpectations(t)
+	mockCognito.AssertNotCalled(t, "IsUserConfirmed", mock.Anything, mock.Anything, mock.Anything)
 }
 
 func TestSignupService_Signup_RepositoryError(t *testing.T) {
@@ -242,8 +330,8 @@ func TestSignupService_Signup_RepositoryError(t *testing.T) {
 
 	service := NewSignupServiceWithInterfaces(
 		mockRepo,
+		outbox.NewMemoryStore(),
 		mockCognito,
-		"test-secret-key-1234567890123456",
 	)
 
 	ctx := context.Background()
@@ -251,123 +339,393 @@ func TestSignupService_Signup_RepositoryError(t *testing.T) {
 	email := testUserEmail
 
 	// Setup mocks - repository error
-	mockRepo.On("FindByEmail", ctx, email).Return(nil, errors.New("database error"))
+	mockRepo.On("LockOrCreate", inTx(ctx), placeholder(email)).Return(nil, false, errors.New("database error"))
 
 	// Execute
 	result, err := service.Signup(ctx, name, email)
 
 	// Assert
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "failed to check existing user")
+	assert.Contains(t, err.Error(), "failed to lock user")
 	assert.Nil(t, result)
 
 	mockRepo.AssertExpectations(t)
 }
 
-func TestSignupService_Signup_CognitoError(t *testing.T) {
+func TestSignupService_Signup_DeletedUser(t *testing.T) {
 	mockRepo := new(testhelpers.MockUserRepository)
 	mockCognito := new(testhelpers.MockCognitoClient)
 
 	service := NewSignupServiceWithInterfaces(
 		mockRepo,
+		outbox.NewMemoryStore(),
 		mockCognito,
-		"test-secret-key-1234567890123456",
 	)
 
 	ctx := context.Background()
-	name := testUserName
-	email := testUserEmail
 
-	// Setup mocks
-	mockRepo.On("FindByEmail", ctx, email).Return(nil, nil)
-	mockCognito.On("SignUp", ctx, email, mock.AnythingOfType("string"), name).
-		Return("", errors.New("cognito error"))
+	mockRepo.On("LockOrCreate", inTx(ctx), placeholder(testUserEmail)).Return(nil, false, repositories.ErrDeleted)
 
-	// Execute
-	result, err := service.Signup(ctx, name, email)
+	result, err := service.Signup(ctx, testUserName, testUserEmail)
 
-	// Assert
-	assert.Error(t, err)
-	assert.ErrorIs(t, err, ErrSignupProviderUnavailable)
+	assert.ErrorIs(t, err, ErrUserAlreadyExists)
 	assert.Nil(t, result)
+	mockCognito.AssertNotCalled(t, "IsUserConfirmed", mock.Anything, mock.Anything, mock.Anything)
+}
 
-	mockRepo.AssertExpectations(t)
-	mockCognito.AssertExpectations(t)
+func TestSignupService_Signup_RecordsAuditEvents(t *testing.T) {
+	tests := []struct {
+		name        string
+		email       string
+		setup       func(m *testhelpers.MockUserRepository)
+		wantOutcome string
+		wantReason  string
+		wantUser    bool
+	}{
+		{
+			name:  "success",
+			email: testUserEmail,
+			setup: func(m *testhelpers.MockUserRepository) {
+				m.On("LockOrCreate", mock.Anything, placeholder(testUserEmail)).Return(newRow(testUserEmail), true, nil)
+				m.On("Update", mock.Anything, mock.AnythingOfType("*models.User")).Return(nil)
+			},
+			wantOutcome: audit.OutcomeSuccess,
+			wantReason:  string(models.SignupStatusPendingConfirmation),
+			wantUser:    true,
+		},
+		{
+			name:  "existing user",
+			email: testUserEmail,
+			setup: func(m *testhelpers.MockUserRepository) {
+				m.On("LockOrCreate", mock.Anything, placeholder(testUserEmail)).Return(nil, false, repositories.ErrDeleted)
+			},
+			wantOutcome: audit.OutcomeDenied,
+			wantReason:  metrics.SignupOutcomeUserExists,
+		},
+		{
+			name:        "invalid email",
+			email:       "not-an-email",
+			setup:       func(*testhelpers.MockUserRepository) {},
+			wantOutcome: audit.OutcomeDenied,
+			wantReason:  "invalid_email",
+		},
+		{
+			name:  "repository error",
+			email: testUserEmail,
+			setup: func(m *testhelpers.MockUserRepository) {
+				m.On("LockOrCreate", mock.Anything, placeholder(testUserEmail)).Return(nil, false, errors.New("database error"))
+			},
+			wantOutcome: audit.OutcomeFailure,
+			wantReason:  metrics.SignupOutcomeError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(testhelpers.MockUserRepository)
+			tt.setup(mockRepo)
+			store := audit.NewMemoryStore()
+			service := NewSignupServiceWithInterfaces(
+				mockRepo,
+				outbox.NewMemoryStore(),
+				new(testhelpers.MockCognitoClient),
+				WithRecorder(audit.NewRecorder(store)),
+			)
+			ctx := audit.WithClient(context.Background(), audit.Client{IP: "203.0.113.7", UserAgent: "curl/8.0"})
+
+			_, _ = service.Signup(ctx, testUserName, tt.email)
+
+			recorded := store.Events()
+			require.Len(t, recorded, 1)
+			assert.Equal(t, audit.TypeSignup, recorded[0].Type)
+			assert.Equal(t, tt.wantOutcome, recorded[0].Outcome)
+			assert.Equal(t, tt.wantReason, recorded[0].Reason)
+			assert.Equal(t, audit.ActorAnonymous, recorded[0].Actor)
+			assert.Equal(t, "203.0.113.7", recorded[0].IP)
+			assert.Equal(t, "curl/8.0", recorded[0].UserAgent)
+			if tt.wantUser {
+				require.NotNil(t, recorded[0].UserID)
+				assert.Equal(t, 1, *recorded[0].UserID)
+			} else {
+				// Attempts are not attributed to the owner of a taken address.
+				assert.Nil(t, recorded[0].UserID)
+			}
+		})
+	}
 }
 
-func TestSignupService_Signup_EncryptionError(t *testing.T) {
+func TestSignupService_Signup_OutboxError(t *testing.T) {
 	mockRepo := new(testhelpers.MockUserRepository)
 	mockCognito := new(testhelpers.MockCognitoClient)
 
 	service := NewSignupServiceWithInterfaces(
 		mockRepo,
+		failingOutbox{},
 		mockCognito,
-		"test-secret-key-1234567890123456",
 	)
 
-	// Override encrypt function to return error
-	service.encryptFunc = func(plaintext, secret string) (string, error) {
-		return "", errors.New("encryption error")
-	}
-
 	ctx := context.Background()
-	name := testUserName
-	email := testUserEmail
 
-	// Setup mocks
-	mockRepo.On("FindByEmail", ctx, email).Return(nil, nil)
+	mockRepo.On("LockOrCreate", inTx(ctx), placeholder(testUserEmail)).Return(newRow(testUserEmail), true, nil)
+	mockRepo.On("Update", inTx(ctx), mock.AnythingOfType("*models.User")).Return(nil)
 
-	// Execute
-	result, err := service.Signup(ctx, name, email)
+	result, err := service.Signup(ctx, testUserName, testUserEmail)
 
-	// Assert
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "failed to encrypt password")
+	// The error rolls back the transaction, so the user is not stored either.
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to enqueue sign-up")
 	assert.Nil(t, result)
+}
+
+func TestSignupService_Signup_NormalizesEmail(t *testing.T) {
+	mockRepo := new(testhelpers.MockUserRepository)
+	mockCognito := new(testhelpers.MockCognitoClient)
+
+	service := NewSignupServiceWithInterfaces(
+		mockRepo,
+		outbox.NewMemoryStore(),
+		mockCognito,
+	)
+
+	ctx := context.Background()
+
+	mockRepo.On("LockOrCreate", inTx(ctx), mock.MatchedBy(func(user *models.User) bool {
+		return user.Email == testUserEmail && user.NormalizedEmail == testUserEmail
+	})).Return(newRow(testUserEmail), true, nil)
+	mockRepo.On("Update", inTx(ctx), mock.AnythingOfType("*models.User")).Return(nil)
+
+	result, err := service.Signup(ctx, testUserName, "  John@Example.COM ")
+
+	require.NoError(t, err)
+	assert.Equal(t, testUserEmail, result.User.Email)
 
 	mockRepo.AssertExpectations(t)
 }
 
-func TestSignupService_Signup_ResendConfirmationCodeError(t *testing.T) {
+func TestSignupService_Signup_FoldedGmailMatchesExistingUser(t *testing.T) {
 	mockRepo := new(testhelpers.MockUserRepository)
 	mockCognito := new(testhelpers.MockCognitoClient)
 
 	service := NewSignupServiceWithInterfaces(
 		mockRepo,
+		outbox.NewMemoryStore(),
 		mockCognito,
-		"test-secret-key-1234567890123456",
+		WithEmailNormalizer(emailaddr.NewNormalizer(true)),
 	)
 
 	ctx := context.Background()
-	name := testUserName
-	email := testUserEmail
 	cognitoID := testCognitoID
-	username := testCognitoUser
-
 	existingUser := &models.User{
-		ID:        1,
-		Name:      name,
-		Email:     email,
-		CognitoID: &cognitoID,
+		ID:              1,
+		Name:            testUserName,
+		Email:           "jdoe@gmail.com",
+		NormalizedEmail: "jdoe@gmail.com",
+		CognitoID:       &cognitoID,
 	}
 
-	// Setup mocks
-	mockRepo.On("FindByEmail", ctx, email).Return(existingUser, nil)
-	mockCognito.On("IsUserConfirmed", ctx, email).Return(false, username, cognitoID, nil)
-	mockCognito.On("ResendConfirmationCode", ctx, username).Return(errors.New("resend error"))
+	// The identity provider is queried with the address the user signed up with.
+	mockRepo.On("LockOrCreate", inTx(ctx), placeholder("jdoe@gmail.com")).Return(existingUser, false, nil)
+	mockCognito.On("IsUserConfirmed", inTx(ctx), 1, "jdoe@gmail.com").Return(true, "jdoe@gmail.com", cognitoID, nil)
 
-	// Execute
-	result, err := service.Signup(ctx, name, email)
+	result, err := service.Signup(ctx, testUserName, "J.Doe+promo@Gmail.com")
 
-	// Assert
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "failed to resend confirmation code")
+	assert.ErrorIs(t, err, ErrUserAlreadyExists)
+	assert.Nil(t, result)
+
+	mockRepo.AssertExpectations(t)
+	mockCognito.AssertExpectations(t)
+}
+
+func TestSignupService_Signup_InvalidEmail(t *testing.T) {
+	mockRepo := new(testhelpers.MockUserRepository)
+	mockCognito := new(testhelpers.MockCognitoClient)
+
+	service := NewSignupServiceWithInterfaces(
+		mockRepo,
+		outbox.NewMemoryStore(),
+		mockCognito,
+	)
+
+	result, err := service.Signup(context.Background(), testUserName, "not-an-email")
+
+	assert.ErrorIs(t, err, ErrInvalidEmail)
+	assert.Nil(t, result)
+	mockRepo.AssertNotCalled(t, "LockOrCreate", mock.Anything, mock.Anything)
+}
+
+func TestSignupService_Signup_PolicyRejects(t *testing.T) {
+	mockRepo := new(testhelpers.MockUserRepository)
+	mockCognito := new(testhelpers.MockCognitoClient)
+	mockPolicy := new(testhelpers.MockSignupPolicy)
+
+	service := NewSignupServiceWithInterfaces(
+		mockRepo,
+		outbox.NewMemoryStore(),
+		mockCognito,
+		WithPolicy(mockPolicy),
+	)
+
+	ctx := context.Background()
+	email := "throwaway@mailinator.com"
+
+	mockPolicy.On("Check", ctx, email).Return(&signuppolicy.Rejection{Reason: signuppolicy.ReasonDisposable})
+
+	before := metrics.Auth.SignupRejectionCount(signuppolicy.ReasonDisposable)
+
+	result, err := service.Signup(ctx, testUserName, "Throwaway@Mailinator.com")
+
+	assert.ErrorIs(t, err, ErrEmailNotAllowed)
 	assert.Nil(t, result)
+	assert.InDelta(t, before+1, metrics.Auth.SignupRejectionCount(signuppolicy.ReasonDisposable), 0)
+	mockPolicy.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "LockOrCreate", mock.Anything, mock.Anything)
+}
+
+// The lists hold canonical addresses, so a blocked Gmail mailbox stays
+// blocked under its dotted and tagged variants.
+func TestSignupService_Signup_PolicyChecksCanonicalEmail(t *testing.T) {
+	mockRepo := new(testhelpers.MockUserRepository)
+	mockCognito := new(testhelpers.MockCognitoClient)
+	mockPolicy := new(testhelpers.MockSignupPolicy)
+
+	service := NewSignupServiceWithInterfaces(
+		mockRepo,
+		outbox.NewMemoryStore(),
+		mockCognito,
+		WithEmailNormalizer(emailaddr.NewNormalizer(true)),
+		WithPolicy(mockPolicy),
+	)
+
+	ctx := context.Background()
+	mockPolicy.On("Check", ctx, "ab@gmail.com").Return(&signuppolicy.Rejection{Reason: signuppolicy.ReasonBlocked})
+
+	result, err := service.Signup(ctx, testUserName, "A.B+x@googlemail.com")
+
+	assert.ErrorIs(t, err, ErrEmailNotAllowed)
+	assert.Nil(t, result)
+	mockPolicy.AssertExpectations(t)
+}
+
+func TestSignupService_Signup_PolicyError(t *testing.T) {
+	mockRepo := new(testhelpers.MockUserRepository)
+	mockCognito := new(testhelpers.MockCognitoClient)
+	mockPolicy := new(testhelpers.MockSignupPolicy)
+
+	service := NewSignupServiceWithInterfaces(
+		mockRepo,
+		outbox.NewMemoryStore(),
+		mockCognito,
+		WithPolicy(mockPolicy),
+	)
+
+	ctx := context.Background()
+	mockPolicy.On("Check", ctx, testUserEmail).Return(errors.New("connection refused"))
+
+	result, err := service.Signup(ctx, testUserName, testUserEmail)
+
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrEmailNotAllowed)
+	assert.Nil(t, result)
+	mockRepo.AssertNotCalled(t, "LockOrCreate", mock.Anything, mock.Anything)
+}
+
+func TestSignupService_Signup_PolicyAllows(t *testing.T) {
+	mockRepo := new(testhelpers.MockUserRepository)
+	mockCognito := new(testhelpers.MockCognitoClient)
+	mockPolicy := new(testhelpers.MockSignupPolicy)
+
+	service := NewSignupServiceWithInterfaces(
+		mockRepo,
+		outbox.NewMemoryStore(),
+		mockCognito,
+		WithPolicy(mockPolicy),
+	)
+
+	ctx := context.Background()
+	mockPolicy.On("Check", ctx, testUserEmail).Return(nil)
+	mockRepo.On("LockOrCreate", inTx(ctx), placeholder(testUserEmail)).Return(newRow(testUserEmail), true, nil)
+	mockRepo.On("Update", inTx(ctx), mock.AnythingOfType("*models.User")).Return(nil)
+
+	result, err := service.Signup(ctx, testUserName, testUserEmail)
+
+	require.NoError(t, err)
+	assert.Equal(t, models.SignupStatusPendingConfirmation, result.Status)
+	mockPolicy.AssertExpectations(t)
+}
+
+func TestSignupService_Signup_DispatchesAfterCommit(t *testing.T) {
+	mockRepo := new(testhelpers.MockUserRepository)
+	mockCognito := new(testhelpers.MockCognitoClient)
+	store := outbox.NewMemoryStore()
+	dispatcher := outbox.NewDispatcher(store, outbox.Options{})
+
+	service := NewSignupServiceWithInterfaces(
+		mockRepo,
+		store,
+		mockCognito,
+		WithDispatcher(dispatcher),
+	)
+	service.RegisterOutboxHandlers(dispatcher)
+
+	ctx := context.Background()
+	cognitoID := testCognitoID
+	password := encryption.NewField("temporary-password")
+	pending := &models.User{ID: 1, Name: testUserName, Email: testUserEmail, TemporaryPassword: password}
+	linked := &models.User{ID: 1, Name: testUserName, Email: testUserEmail, TemporaryPassword: password, CognitoID: &cognitoID}
+
+	mockRepo.On("LockOrCreate", inTx(ctx), placeholder(testUserEmail)).Return(newRow(testUserEmail), true, nil)
+	mockRepo.On("Update", inTx(ctx), mock.AnythingOfType("*models.User")).Return(nil)
+	mockRepo.On("FindByID", ctx, 1).Return(pending, nil).Once()
+	mockCognito.On("SignUp", ctx, 1, testUserEmail, "temporary-password", testUserName).Return(cognitoID, nil)
+	mockRepo.On("Update", ctx, mock.AnythingOfType("*models.User")).Return(nil)
+	mockRepo.On("FindByID", ctx, 1).Return(linked, nil).Once()
+
+	result, err := service.Signup(ctx, testUserName, testUserEmail)
+
+	require.NoError(t, err)
+	require.NotNil(t, result.User.CognitoID, "the result reflects the delivered sign-up")
+	assert.Equal(t, cognitoID, *result.User.CognitoID)
+	require.Len(t, store.Messages(), 1)
+	assert.NotNil(t, store.Messages()[0].ProcessedAt)
 
 	mockRepo.AssertExpectations(t)
 	mockCognito.AssertExpectations(t)
 }
 
+func TestSignupService_Signup_DispatchFailureKeepsMessage(t *testing.T) {
+	mockRepo := new(testhelpers.MockUserRepository)
+	mockCognito := new(testhelpers.MockCognitoClient)
+	store := outbox.NewMemoryStore()
+	dispatcher := outbox.NewDispatcher(store, outbox.Options{})
+
+	service := NewSignupServiceWithInterfaces(
+		mockRepo,
+		store,
+		mockCognito,
+		WithDispatcher(dispatcher),
+	)
+	service.RegisterOutboxHandlers(dispatcher)
+
+	ctx := context.Background()
+	pending := &models.User{ID: 1, Name: testUserName, Email: testUserEmail, TemporaryPassword: encryption.NewField("temporary-password")}
+
+	mockRepo.On("LockOrCreate", inTx(ctx), placeholder(testUserEmail)).Return(newRow(testUserEmail), true, nil)
+	mockRepo.On("Update", inTx(ctx), mock.AnythingOfType("*models.User")).Return(nil)
+	mockRepo.On("FindByID", ctx, 1).Return(pending, nil)
+	mockCognito.On("SignUp", ctx, 1, testUserEmail, "temporary-password", testUserName).
+		Return("", errors.New("cognito error"))
+
+	result, err := service.Signup(ctx, testUserName, testUserEmail)
+
+	require.NoError(t, err, "the sign-up is stored and retried later")
+	assert.Equal(t, models.SignupStatusPendingConfirmation, result.Status)
+	assert.Nil(t, result.User.CognitoID)
+	messages := store.Messages()
+	require.Len(t, messages, 1)
+	assert.Nil(t, messages[0].ProcessedAt)
+	assert.Equal(t, "cognito error", messages[0].LastError)
+}
+
 func TestGenerateTemporaryPassword(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -433,3 +791,69 @@ func TestGenerateTemporaryPassword_Error(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotEmpty(t, password)
 }
+
+func TestSignupOutcome(t *testing.T) {
+	pending := &SignupResult{Status: models.SignupStatusPendingConfirmation}
+
+	assert.Equal(t, metrics.SignupOutcomePendingConfirmation, signupOutcome(pending, nil))
+	assert.Equal(t, metrics.SignupOutcomeUserExists, signupOutcome(nil, ErrUserAlreadyExists))
+	assert.Equal(t, metrics.SignupOutcomeProviderUnavailable, signupOutcome(nil, ErrSignupProviderUnavailable))
+	assert.Equal(t, metrics.SignupOutcomeEmailNotAllowed, signupOutcome(nil, fmt.Errorf("%w: disposable", ErrEmailNotAllowed)))
+	assert.Equal(t, metrics.SignupOutcomeError, signupOutcome(nil, errors.New("database error")))
+}
+
+func TestSignupService_Signup_RecordsOutcome(t *testing.T) {
+	mockRepo := new(testhelpers.MockUserRepository)
+	mockCognito := new(testhelpers.MockCognitoClient)
+
+	service := NewSignupServiceWithInterfaces(
+		mockRepo,
+		outbox.NewMemoryStore(),
+		mockCognito,
+	)
+
+	ctx := context.Background()
+	cognitoID := testCognitoID
+	existingUser := &models.User{ID: 1, Name: testUserName, Email: testUserEmail, CognitoID: &cognitoID}
+
+	mockRepo.On("LockOrCreate", inTx(ctx), placeholder(testUserEmail)).Return(existingUser, false, nil)
+	mockCognito.On("IsUserConfirmed", inTx(ctx), 1, testUserEmail).Return(true, "username", cognitoID, nil)
+
+	before := metrics.Auth.SignupCount(metrics.SignupOutcomeUserExists)
+
+	_, err := service.Signup(ctx, testUserName, testUserEmail)
+	require.ErrorIs(t, err, ErrUserAlreadyExists)
+
+	assert.InDelta(t, before+1, metrics.Auth.SignupCount(metrics.SignupOutcomeUserExists), 0)
+}
+
+func TestSignupService_Signup_ChecksExistingUserAfterCommit(t *testing.T) {
+	users := repositories.NewMemoryUserRepository()
+	mockCognito := new(testhelpers.MockCognitoClient)
+	service := NewSignupServiceWithInterfaces(users, outbox.NewMemoryStore(), mockCognito)
+	ctx := context.Background()
+
+	cognitoID := testCognitoID
+	existing := &models.User{Name: testUserName, Email: testUserEmail, NormalizedEmail: testUserEmail, CognitoID: &cognitoID}
+	require.NoError(t, users.Create(ctx, existing))
+
+	// A concurrent sign-up for the address must not wait for Cognito
+	unlocked := make(chan error, 1)
+	mockCognito.On("IsUserConfirmed", mock.Anything, existing.ID, testUserEmail).Run(func(mock.Arguments) {
+		go func() {
+			_, err := users.FindByEmail(ctx, testUserEmail)
+			unlocked <- err
+		}()
+		select {
+		case err := <-unlocked:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Error("the user store is locked while Cognito is called")
+		}
+	}).Return(true, testCognitoUser, cognitoID, nil)
+
+	_, err := service.Signup(ctx, testUserName, testUserEmail)
+
+	require.ErrorIs(t, err, ErrUserAlreadyExists)
+	mockCognito.AssertExpectations(t)
+}
@@ -11,6 +11,10 @@ var (
 	ErrUserAlreadyExists = errors.New("user with this email already exists")
 	// ErrSignupProviderUnavailable indicates that the external identity provider is unavailable.
 	ErrSignupProviderUnavailable = errors.New("signup provider unavailable")
+	// ErrInvalidEmail indicates that the email address cannot be normalized.
+	ErrInvalidEmail = errors.New("invalid email address")
+	// ErrEmailNotAllowed indicates that the sign-up policy rejected the address.
+	ErrEmailNotAllowed = errors.New("email not allowed")
 )
 
 // SignupResult contains the outcome of a signup operation.
@@ -0,0 +1,85 @@
+package signuppolicy
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+//go:embed disposable_domains.txt
+var bundledDisposableDomains string
+
+// DomainList is a set of domains that also matches their subdomains.
+type DomainList struct {
+	domains map[string]bool
+}
+
+// ParseDomainList reads one domain per line, ignoring blank lines and
+// comments starting with '#'.
+func ParseDomainList(r io.Reader) (*DomainList, error) {
+	list := &DomainList{domains: make(map[string]bool)}
+	if err := list.add(r); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// LoadDisposableDomains returns the bundled disposable domain list, extended
+// with the domains in path when it is not empty.
+func LoadDisposableDomains(path string) (*DomainList, error) {
+	list, err := ParseDomainList(strings.NewReader(bundledDisposableDomains))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse bundled disposable domains: %w", err)
+	}
+	if path == "" {
+		return list, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open disposable domains file: %w", err)
+	}
+	defer f.Close()
+
+	if err := list.add(f); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return list, nil
+}
+
+func (l *DomainList) add(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		l.domains[strings.ToLower(strings.TrimSuffix(line, "."))] = true
+	}
+	return scanner.Err()
+}
+
+// Len returns the number of domains in the list.
+func (l *DomainList) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.domains)
+}
+
+// Contains reports whether domain or one of its parents is in the list. A nil
+// list contains nothing.
+func (l *DomainList) Contains(domain string) bool {
+	if l == nil {
+		return false
+	}
+	for _, d := range parentDomains(domain) {
+		if l.domains[d] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package signuppolicy
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"time"
+)
+
+// mxTimeout bounds the DNS lookup so a slow resolver cannot stall sign-ups.
+const mxTimeout = 2 * time.Second
+
+// MXResolver looks up mail exchangers; *net.Resolver implements it.
+type MXResolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+}
+
+// hasMailServer reports whether domain publishes a usable MX record. A
+// domain that does not exist, has no MX records or publishes a null MX
+// (RFC 7505) cannot receive mail. Other DNS failures are treated as success
+// so an unhealthy resolver does not block every sign-up.
+func hasMailServer(ctx context.Context, resolver MXResolver, domain string) bool {
+	ctx, cancel := context.WithTimeout(ctx, mxTimeout)
+	defer cancel()
+
+	records, err := resolver.LookupMX(ctx, domain)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return false
+		}
+		log.Printf("MX lookup for %s failed, allowing sign-up: %v", domain, err)
+		return true
+	}
+
+	for _, record := range records {
+		if record.Host != "." && record.Host != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+// Package signuppolicy decides whether an email address may sign up, before
+// the identity provider spends an email on it.
+package signuppolicy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotAllowed is matched by every *Rejection.
+var ErrNotAllowed = errors.New("email not allowed")
+
+// Rejection reasons.
+const (
+	ReasonBlocked      = "blocked"
+	ReasonInviteOnly   = "invite_only"
+	ReasonDisposable   = "disposable"
+	ReasonNoMailServer = "no_mail_server"
+)
+
+// Rejection is returned by Engine.Check when the policy refuses an address.
+type Rejection struct {
+	Reason string
+}
+
+func (r *Rejection) Error() string {
+	return "email not allowed: " + r.Reason
+}
+
+// Is makes errors.Is(err, ErrNotAllowed) hold for every rejection.
+func (r *Rejection) Is(target error) bool {
+	return target == ErrNotAllowed
+}
+
+// ListStore holds the admin-managed allowlist and blocklist. Entries are
+// either a full address or a domain, which also covers its subdomains.
+type ListStore interface {
+	// Match reports whether email or one of domains is allowlisted and
+	// whether one of them is blocklisted.
+	Match(ctx context.Context, email string, domains []string) (allowed, blocked bool, err error)
+}
+
+// Options selects the rules enforced by an Engine; nil dependencies disable
+// the matching rule.
+type Options struct {
+	Lists      ListStore
+	Disposable *DomainList
+	MX         MXResolver
+	// InviteOnly only admits allowlisted addresses and domains.
+	InviteOnly bool
+}
+
+// Engine evaluates the sign-up rules in order: an allowlisted address is
+// always admitted, then the blocklist, invite-only mode, the disposable
+// domain list and finally the MX check may reject it.
+type Engine struct {
+	opts Options
+}
+
+func New(opts Options) *Engine {
+	return &Engine{opts: opts}
+}
+
+// Check returns nil when email may sign up, a *Rejection when the policy
+// refuses it, or another error when a rule could not be evaluated. email
+// must be the canonical address (see emailaddr.Normalizer), as accounts and
+// list entries are, so a listed mailbox matches however it is written.
+func (e *Engine) Check(ctx context.Context, email string) error {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return fmt.Errorf("email %q is not normalized", email)
+	}
+	domain := email[at+1:]
+	domains := parentDomains(domain)
+
+	if e.opts.Lists != nil {
+		allowed, blocked, err := e.opts.Lists.Match(ctx, email, domains)
+		if err != nil {
+			return fmt.Errorf("failed to check email lists: %w", err)
+		}
+		if allowed {
+			return nil
+		}
+		if blocked {
+			return &Rejection{Reason: ReasonBlocked}
+		}
+	}
+
+	if e.opts.InviteOnly {
+		return &Rejection{Reason: ReasonInviteOnly}
+	}
+
+	if e.opts.Disposable.Contains(domain) {
+		return &Rejection{Reason: ReasonDisposable}
+	}
+
+	if e.opts.MX != nil && !hasMailServer(ctx, e.opts.MX, domain) {
+		return &Rejection{Reason: ReasonNoMailServer}
+	}
+
+	return nil
+}
+
+// parentDomains returns domain followed by each parent above the top-level
+// domain: "a.b.example.com" yields a.b.example.com, b.example.com, example.com.
+func parentDomains(domain string) []string {
+	domains := []string{domain}
+	for {
+		dot := strings.Index(domain, ".")
+		if dot < 0 {
+			break
+		}
+		domain = domain[dot+1:]
+		if !strings.Contains(domain, ".") {
+			break
+		}
+		domains = append(domains, domain)
+	}
+	return domains
+}
@@ -0,0 +1,180 @@
+package signuppolicy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLists matches entries exactly against the address and its domains.
+type fakeLists struct {
+	allow, block map[string]bool
+	err          error
+}
+
+func (f fakeLists) Match(_ context.Context, email string, domains []string) (bool, bool, error) {
+	if f.err != nil {
+		return false, false, f.err
+	}
+	var allowed, blocked bool
+	for _, entry := range append([]string{email}, domains...) {
+		allowed = allowed || f.allow[entry]
+		blocked = blocked || f.block[entry]
+	}
+	return allowed, blocked, nil
+}
+
+// fakeMX answers from a fixed table; unknown domains do not exist.
+type fakeMX struct {
+	records map[string][]*net.MX
+	err     error
+}
+
+func (f fakeMX) LookupMX(_ context.Context, name string) ([]*net.MX, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	records, ok := f.records[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return records, nil
+}
+
+var mailServers = fakeMX{records: map[string][]*net.MX{
+	"example.com":    {{Host: "mx.example.com.", Pref: 10}},
+	"partner.com":    {{Host: "mx.partner.com.", Pref: 10}},
+	"mailinator.com": {{Host: "mx.mailinator.com.", Pref: 10}},
+	"null-mx.com":    {{Host: ".", Pref: 0}},
+	"no-records.com": {},
+}}
+
+func reasonOf(t *testing.T, err error) string {
+	t.Helper()
+	var rejection *Rejection
+	require.ErrorAs(t, err, &rejection)
+	assert.ErrorIs(t, err, ErrNotAllowed)
+	return rejection.Reason
+}
+
+func TestEngine_Check(t *testing.T) {
+	disposable, err := LoadDisposableDomains("")
+	require.NoError(t, err)
+
+	engine := New(Options{
+		Lists: fakeLists{
+			allow: map[string]bool{"vip@mailinator.com": true},
+			block: map[string]bool{"spammer.com": true, "bad@example.com": true},
+		},
+		Disposable: disposable,
+		MX:         mailServers,
+	})
+	ctx := context.Background()
+
+	tests := []struct {
+		email      string
+		wantReason string
+	}{
+		{"john@example.com", ""},
+		{"vip@mailinator.com", ""},
+		{"bad@example.com", ReasonBlocked},
+		{"anyone@spammer.com", ReasonBlocked},
+		{"anyone@eu.spammer.com", ReasonBlocked},
+		{"throwaway@mailinator.com", ReasonDisposable},
+		{"throwaway@sub.mailinator.com", ReasonDisposable},
+		{"john@unknown-domain.com", ReasonNoMailServer},
+		{"john@null-mx.com", ReasonNoMailServer},
+		{"john@no-records.com", ReasonNoMailServer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			err := engine.Check(ctx, tt.email)
+			if tt.wantReason == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Equal(t, tt.wantReason, reasonOf(t, err))
+		})
+	}
+}
+
+func TestEngine_Check_InviteOnly(t *testing.T) {
+	engine := New(Options{
+		Lists:      fakeLists{allow: map[string]bool{"partner.com": true, "guest@example.com": true}},
+		MX:         mailServers,
+		InviteOnly: true,
+	})
+	ctx := context.Background()
+
+	assert.NoError(t, engine.Check(ctx, "anyone@partner.com"))
+	assert.NoError(t, engine.Check(ctx, "guest@example.com"))
+	assert.Equal(t, ReasonInviteOnly, reasonOf(t, engine.Check(ctx, "john@example.com")))
+}
+
+func TestEngine_Check_ListStoreError(t *testing.T) {
+	engine := New(Options{Lists: fakeLists{err: errors.New("connection refused")}})
+
+	err := engine.Check(context.Background(), "john@example.com")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrNotAllowed)
+}
+
+func TestEngine_Check_MXLookupFailureAllows(t *testing.T) {
+	engine := New(Options{MX: fakeMX{err: &net.DNSError{Err: "i/o timeout", IsTimeout: true}}})
+	assert.NoError(t, engine.Check(context.Background(), "john@example.com"))
+}
+
+func TestEngine_Check_NoRules(t *testing.T) {
+	assert.NoError(t, New(Options{}).Check(context.Background(), "throwaway@mailinator.com"))
+}
+
+func TestEngine_Check_RequiresNormalizedEmail(t *testing.T) {
+	err := New(Options{}).Check(context.Background(), "not-an-email")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrNotAllowed)
+}
+
+func TestParentDomains(t *testing.T) {
+	assert.Equal(t, []string{"a.b.example.com", "b.example.com", "example.com"}, parentDomains("a.b.example.com"))
+	assert.Equal(t, []string{"example.com"}, parentDomains("example.com"))
+	assert.Equal(t, []string{"localhost"}, parentDomains("localhost"))
+}
+
+func TestParseDomainList(t *testing.T) {
+	list, err := ParseDomainList(strings.NewReader("# comment\n\nTrash.example.\nother.test\n"))
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, list.Len())
+	assert.True(t, list.Contains("trash.example"))
+	assert.True(t, list.Contains("inbox.trash.example"))
+	assert.False(t, list.Contains("example"))
+
+	var empty *DomainList
+	assert.False(t, empty.Contains("trash.example"))
+}
+
+func TestLoadDisposableDomains(t *testing.T) {
+	bundled, err := LoadDisposableDomains("")
+	require.NoError(t, err)
+	assert.True(t, bundled.Contains("mailinator.com"))
+
+	path := filepath.Join(t.TempDir(), "extra.txt")
+	require.NoError(t, os.WriteFile(path, []byte("junk.example\n"), 0o600))
+
+	extended, err := LoadDisposableDomains(path)
+	require.NoError(t, err)
+	assert.Equal(t, bundled.Len()+1, extended.Len())
+	assert.True(t, extended.Contains("junk.example"))
+	assert.True(t, extended.Contains("mailinator.com"))
+
+	_, err = LoadDisposableDomains(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
@@ -2,8 +2,8 @@ package testhelpers
 
 import (
 	"context"
+	"services/auth/migrations"
 	"testing"
-
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -46,21 +46,18 @@ func SetupTestDB(t *testing.T) (*pgxpool.Pool, func()) {
 	return pool, cleanup
 }
 
-// CreateUsersTable creates the users table in the test database.
-func CreateUsersTable(t *testing.T, pool *pgxpool.Pool) {
-	ctx := context.Background()
-	_, err := pool.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS users (
-			id SERIAL PRIMARY KEY,
-			name VARCHAR(255) NOT NULL,
-			email VARCHAR(255) NOT NULL UNIQUE,
-			temporary_password TEXT,
-			cognito_id VARCHAR(255),
-			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
-			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
-		)
-	`)
+// ApplyMigrations runs the embedded migrations against the test database, so
+// tests exercise the same schema as production.
+func ApplyMigrations(t *testing.T, pool *pgxpool.Pool) {
+	runner, err := migrations.NewRunner(pool.Config().ConnString())
 	require.NoError(t, err)
+	defer func() {
+		if err := runner.Close(); err != nil {
+			t.Logf("Failed to close migration runner: %v", err)
+		}
+	}()
+
+	require.NoError(t, runner.Up())
 }
 
 // CleanupUsersTable truncates the users table.
@@ -1,6 +1,7 @@
 package testhelpers
 
 import (
+	"services/auth/internal/encryption"
 	"services/auth/internal/models"
 	"time"
 )
@@ -8,12 +9,13 @@ import (
 // UserFixture creates a test user with default values.
 func UserFixture(overrides ...func(*models.User)) *models.User {
 	user := &models.User{
-		ID:        1,
-		Name:      "Test User",
-		Email:     "test@example.com",
-		CognitoID: stringPtr("cognito-test-123"),
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		ID:              1,
+		Name:            "Test User",
+		Email:           "test@example.com",
+		NormalizedEmail: "test@example.com",
+		CognitoID:       stringPtr("cognito-test-123"),
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
 	}
 
 	for _, override := range overrides {
@@ -26,7 +28,7 @@ func UserFixture(overrides ...func(*models.User)) *models.User {
 // UserWithPassword creates a test user with temporary password.
 func UserWithPassword(password string) *models.User {
 	return UserFixture(func(u *models.User) {
-		u.TemporaryPassword = &password
+		u.TemporaryPassword = encryption.NewField(password)
 	})
 }
 
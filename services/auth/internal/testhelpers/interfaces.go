@@ -7,14 +7,39 @@ import (
 
 // UserRepositoryInterface defines the interface for user repository operations.
 type UserRepositoryInterface interface {
-	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	// FindByEmail looks a user up by the canonical identity of their address.
+	FindByEmail(ctx context.Context, normalizedEmail string) (*models.User, error)
 	Create(ctx context.Context, user *models.User) error
 	Update(ctx context.Context, user *models.User) error
+	// FindByID returns a repositories.NotFoundError when no user has id.
+	FindByID(ctx context.Context, id int) (*models.User, error)
+	// FindByCognitoID returns the user linked to an identity provider account.
+	FindByCognitoID(ctx context.Context, cognitoID string) (*models.User, error)
+	// WithTx runs fn in a transaction joined by calls made with its context.
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+	// LockOrCreate inserts user unless its normalized email is taken and locks
+	// the row until the transaction ends, reporting whether it was created.
+	LockOrCreate(ctx context.Context, user *models.User) (*models.User, bool, error)
 }
 
 // CognitoClientInterface defines the interface for Cognito client operations.
 type CognitoClientInterface interface {
-	SignUp(ctx context.Context, email, password, name string) (string, error)
-	IsUserConfirmed(ctx context.Context, email string) (bool, string, string, error)
+	SignUp(ctx context.Context, userID int, email, password, name string) (string, error)
+	IsUserConfirmed(ctx context.Context, userID int, email string) (bool, string, string, error)
 	ResendConfirmationCode(ctx context.Context, username string) error
 }
+
+// SignupPolicyInterface decides whether an email address may sign up.
+type SignupPolicyInterface interface {
+	Check(ctx context.Context, email string) error
+}
+
+// OutboxInterface enqueues side effects delivered by the outbox dispatcher.
+type OutboxInterface interface {
+	Enqueue(ctx context.Context, kind string, payload any) (int64, error)
+}
+
+// OutboxDispatcherInterface delivers enqueued outbox messages.
+type OutboxDispatcherInterface interface {
+	Dispatch(ctx context.Context, ids ...int64) error
+}
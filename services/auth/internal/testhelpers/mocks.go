@@ -20,6 +20,22 @@ func (m *MockUserRepository) FindByEmail(ctx context.Context, email string) (*mo
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
+func (m *MockUserRepository) FindByID(ctx context.Context, id int) (*models.User, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockUserRepository) FindByCognitoID(ctx context.Context, cognitoID string) (*models.User, error) {
+	args := m.Called(ctx, cognitoID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
 func (m *MockUserRepository) Create(ctx context.Context, user *models.User) error {
 	args := m.Called(ctx, user)
 	return args.Error(0)
@@ -30,18 +46,31 @@ func (m *MockUserRepository) Update(ctx context.Context, user *models.User) erro
 	return args.Error(0)
 }
 
+// WithTx runs fn with ctx unchanged; the mock has no transaction to begin.
+func (m *MockUserRepository) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (m *MockUserRepository) LockOrCreate(ctx context.Context, user *models.User) (*models.User, bool, error) {
+	args := m.Called(ctx, user)
+	if args.Get(0) == nil {
+		return nil, args.Bool(1), args.Error(2)
+	}
+	return args.Get(0).(*models.User), args.Bool(1), args.Error(2)
+}
+
 // MockCognitoClient is a mock implementation of CognitoClientInterface.
 type MockCognitoClient struct {
 	mock.Mock
 }
 
-func (m *MockCognitoClient) SignUp(ctx context.Context, email, password, name string) (string, error) {
-	args := m.Called(ctx, email, password, name)
+func (m *MockCognitoClient) SignUp(ctx context.Context, userID int, email, password, name string) (string, error) {
+	args := m.Called(ctx, userID, email, password, name)
 	return args.String(0), args.Error(1)
 }
 
-func (m *MockCognitoClient) IsUserConfirmed(ctx context.Context, email string) (bool, string, string, error) {
-	args := m.Called(ctx, email)
+func (m *MockCognitoClient) IsUserConfirmed(ctx context.Context, userID int, email string) (bool, string, string, error) {
+	args := m.Called(ctx, userID, email)
 	return args.Bool(0), args.String(1), args.String(2), args.Error(3)
 }
 
@@ -49,3 +78,13 @@ func (m *MockCognitoClient) ResendConfirmationCode(ctx context.Context, username
 	args := m.Called(ctx, username)
 	return args.Error(0)
 }
+
+// MockSignupPolicy is a mock implementation of SignupPolicyInterface.
+type MockSignupPolicy struct {
+	mock.Mock
+}
+
+func (m *MockSignupPolicy) Check(ctx context.Context, email string) error {
+	args := m.Called(ctx, email)
+	return args.Error(0)
+}
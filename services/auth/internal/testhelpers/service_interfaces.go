@@ -2,6 +2,7 @@ package testhelpers
 
 import (
 	"context"
+	"services/auth/internal/audit"
 	"services/auth/internal/models"
 )
 
@@ -9,3 +10,14 @@ import (
 type SignupServiceInterface interface {
 	Signup(ctx context.Context, name, email string) (*models.SignupOutcome, error)
 }
+
+// ActivityServiceInterface lists the audit events of a signed-in user.
+type ActivityServiceInterface interface {
+	Activity(ctx context.Context, cognitoID, cursor string, limit int) ([]audit.Event, string, error)
+}
+
+// IdentityEventServiceInterface records the steps users take with the
+// identity provider directly, such as logins.
+type IdentityEventServiceInterface interface {
+	Record(ctx context.Context, eventType, cognitoID string) error
+}
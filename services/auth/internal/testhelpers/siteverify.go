@@ -0,0 +1,70 @@
+package testhelpers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// FakeSiteVerify is an HTTP server speaking the siteverify protocol of
+// Turnstile, hCaptcha and reCAPTCHA. It accepts ValidToken when called with
+// Secret and records every request it receives.
+type FakeSiteVerify struct {
+	URL        string
+	Secret     string
+	ValidToken string
+
+	mu       sync.Mutex
+	requests []FakeSiteVerifyRequest
+}
+
+// FakeSiteVerifyRequest is a request received by FakeSiteVerify.
+type FakeSiteVerifyRequest struct {
+	Secret, Token, RemoteIP string
+}
+
+// NewFakeSiteVerify starts a FakeSiteVerify closed when the test ends.
+func NewFakeSiteVerify(t *testing.T) *FakeSiteVerify {
+	t.Helper()
+	fake := &FakeSiteVerify{Secret: "test-secret", ValidToken: "valid-token"}
+
+	server := httptest.NewServer(http.HandlerFunc(fake.serve))
+	t.Cleanup(server.Close)
+	fake.URL = server.URL
+	return fake
+}
+
+// Requests returns the requests received so far.
+func (f *FakeSiteVerify) Requests() []FakeSiteVerifyRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeSiteVerifyRequest(nil), f.requests...)
+}
+
+func (f *FakeSiteVerify) serve(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := FakeSiteVerifyRequest{
+		Secret:   r.PostForm.Get("secret"),
+		Token:    r.PostForm.Get("response"),
+		RemoteIP: r.PostForm.Get("remoteip"),
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.mu.Unlock()
+
+	result := map[string]any{"success": true}
+	switch {
+	case req.Secret != f.Secret:
+		result = map[string]any{"success": false, "error-codes": []string{"invalid-input-secret"}}
+	case req.Token != f.ValidToken:
+		result = map[string]any{"success": false, "error-codes": []string{"invalid-input-response"}}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+}
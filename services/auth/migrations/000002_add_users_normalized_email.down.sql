@@ -0,0 +1,4 @@
+-- DropIndex
+DROP INDEX IF EXISTS "users_normalized_email_key";
+-- DropColumn
+ALTER TABLE "users" DROP COLUMN IF EXISTS "normalized_email";
@@ -0,0 +1,10 @@
+-- AddColumn
+-- normalized_email is the canonical identity of the address (see
+-- internal/emailaddr). Existing rows are backfilled with the trimmed,
+-- lowercased address; the index creation fails if that yields duplicates,
+-- which must then be merged by hand.
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "normalized_email" VARCHAR(255);
+UPDATE "users" SET "normalized_email" = LOWER(BTRIM("email")) WHERE "normalized_email" IS NULL;
+ALTER TABLE "users" ALTER COLUMN "normalized_email" SET NOT NULL;
+-- CreateIndex
+CREATE UNIQUE INDEX IF NOT EXISTS "users_normalized_email_key" ON "users"("normalized_email");
@@ -0,0 +1,4 @@
+-- DropTable
+DROP TABLE IF EXISTS "email_blocklist";
+-- DropTable
+DROP TABLE IF EXISTS "email_allowlist";
@@ -0,0 +1,26 @@
+-- CreateTable
+-- Admin-managed sign-up lists. "pattern" is a full address (user@example.com)
+-- or a domain (example.com), which also covers its subdomains. Patterns are
+-- stored in the normalized form: lowercase with punycode domains.
+CREATE TABLE IF NOT EXISTS "email_allowlist" (
+  "id" SERIAL NOT NULL,
+  "pattern" VARCHAR(255) NOT NULL,
+  "note" TEXT,
+  "created_at" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT "email_allowlist_pkey" PRIMARY KEY ("id"),
+  CONSTRAINT "email_allowlist_pattern_lowercase" CHECK ("pattern" = LOWER("pattern"))
+);
+-- CreateIndex
+CREATE UNIQUE INDEX IF NOT EXISTS "email_allowlist_pattern_key" ON "email_allowlist"("pattern");
+
+-- CreateTable
+CREATE TABLE IF NOT EXISTS "email_blocklist" (
+  "id" SERIAL NOT NULL,
+  "pattern" VARCHAR(255) NOT NULL,
+  "note" TEXT,
+  "created_at" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT "email_blocklist_pkey" PRIMARY KEY ("id"),
+  CONSTRAINT "email_blocklist_pattern_lowercase" CHECK ("pattern" = LOWER("pattern"))
+);
+-- CreateIndex
+CREATE UNIQUE INDEX IF NOT EXISTS "email_blocklist_pattern_key" ON "email_blocklist"("pattern");
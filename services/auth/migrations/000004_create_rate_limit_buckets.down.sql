@@ -0,0 +1,2 @@
+-- DropTable
+DROP TABLE IF EXISTS "rate_limit_buckets";
@@ -0,0 +1,10 @@
+-- CreateTable
+-- Token buckets shared by every API instance. "key" is the rule name
+-- followed by a hash of the limited value (IP address or email).
+-- TIMESTAMPTZ keeps refill arithmetic independent of the session time zone.
+CREATE TABLE IF NOT EXISTS "rate_limit_buckets" (
+  "key" VARCHAR(255) NOT NULL,
+  "tokens" DOUBLE PRECISION NOT NULL,
+  "updated_at" TIMESTAMPTZ(3) NOT NULL,
+  CONSTRAINT "rate_limit_buckets_pkey" PRIMARY KEY ("key")
+);
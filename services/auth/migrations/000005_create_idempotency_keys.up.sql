@@ -0,0 +1,15 @@
+-- CreateTable
+-- Responses of mutating requests by Idempotency-Key. A row without a
+-- status_code is a request still in progress since locked_at.
+CREATE TABLE IF NOT EXISTS "idempotency_keys" (
+  "key" VARCHAR(255) NOT NULL,
+  "request_hash" CHAR(64) NOT NULL,
+  "status_code" INTEGER,
+  "response_headers" JSONB,
+  "response_body" TEXT,
+  "locked_at" TIMESTAMPTZ(3) NOT NULL,
+  "expires_at" TIMESTAMPTZ(3) NOT NULL,
+  CONSTRAINT "idempotency_keys_pkey" PRIMARY KEY ("key")
+);
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "idempotency_keys_expires_at_idx" ON "idempotency_keys"("expires_at");
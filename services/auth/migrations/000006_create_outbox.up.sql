@@ -0,0 +1,19 @@
+-- CreateTable
+-- Side effects written in the same transaction as the change that caused
+-- them and delivered by the outbox dispatcher. A row is pending until
+-- processed_at or failed_at is set; available_at is when it is next due.
+CREATE TABLE IF NOT EXISTS "outbox" (
+  "id" BIGSERIAL NOT NULL,
+  "kind" VARCHAR(100) NOT NULL,
+  "payload" JSONB NOT NULL,
+  "attempts" INTEGER NOT NULL DEFAULT 0,
+  "available_at" TIMESTAMPTZ(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "last_error" TEXT,
+  "created_at" TIMESTAMPTZ(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "processed_at" TIMESTAMPTZ(3),
+  "failed_at" TIMESTAMPTZ(3),
+  CONSTRAINT "outbox_pkey" PRIMARY KEY ("id")
+);
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "outbox_pending_idx" ON "outbox"("available_at", "id")
+  WHERE "processed_at" IS NULL AND "failed_at" IS NULL;
@@ -0,0 +1,4 @@
+-- AlterColumn
+-- Fails while a value longer than 255 characters is stored; rekey those
+-- under a secret key first.
+ALTER TABLE "users" ALTER COLUMN "temporary_password" TYPE VARCHAR(255);
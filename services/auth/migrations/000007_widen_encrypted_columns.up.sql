@@ -0,0 +1,4 @@
+-- AlterColumn
+-- v2 envelopes carry the wrapped data key (a KMS blob is ~200 bytes), which
+-- no longer fits VARCHAR(255).
+ALTER TABLE "users" ALTER COLUMN "temporary_password" TYPE TEXT;
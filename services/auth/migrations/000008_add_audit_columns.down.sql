@@ -0,0 +1,6 @@
+-- DropIndex
+DROP INDEX IF EXISTS "users_deleted_at_idx";
+-- DropColumn
+ALTER TABLE "users" DROP COLUMN IF EXISTS "deleted_at";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "updated_by";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "created_by";
@@ -0,0 +1,13 @@
+-- AddColumn
+-- Every entity table records who created and last updated each row, and
+-- soft deletes rows by setting deleted_at (see internal/repositories). The
+-- repositories fill created_by and updated_by on every write, so they have
+-- no default once existing rows are backfilled.
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "created_by" VARCHAR(255) NOT NULL DEFAULT 'system';
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "updated_by" VARCHAR(255) NOT NULL DEFAULT 'system';
+ALTER TABLE "users" ALTER COLUMN "created_by" DROP DEFAULT;
+ALTER TABLE "users" ALTER COLUMN "updated_by" DROP DEFAULT;
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "deleted_at" TIMESTAMPTZ(3);
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "users_deleted_at_idx" ON "users"("deleted_at")
+  WHERE "deleted_at" IS NOT NULL;
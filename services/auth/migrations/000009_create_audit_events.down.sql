@@ -0,0 +1,4 @@
+-- DropTable
+DROP TABLE IF EXISTS "audit_events";
+-- DropFunction
+DROP FUNCTION IF EXISTS "audit_events_append_only"();
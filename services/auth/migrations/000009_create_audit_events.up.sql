@@ -0,0 +1,27 @@
+-- CreateTable
+-- Security-relevant events (see internal/audit). Rows are never changed or
+-- deleted, and have no foreign key, so a user's history outlives the user.
+CREATE TABLE IF NOT EXISTS "audit_events" (
+  "id" BIGSERIAL NOT NULL,
+  "occurred_at" TIMESTAMPTZ(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "type" VARCHAR(50) NOT NULL,
+  "outcome" VARCHAR(20) NOT NULL,
+  "reason" VARCHAR(100) NOT NULL DEFAULT '',
+  "user_id" INTEGER,
+  "actor" VARCHAR(255) NOT NULL,
+  "ip_address" VARCHAR(45) NOT NULL DEFAULT '',
+  "user_agent" TEXT NOT NULL DEFAULT '',
+  CONSTRAINT "audit_events_pkey" PRIMARY KEY ("id")
+);
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "audit_events_user_id_idx" ON "audit_events"("user_id", "id")
+  WHERE "user_id" IS NOT NULL;
+-- CreateTrigger
+CREATE OR REPLACE FUNCTION "audit_events_append_only"() RETURNS TRIGGER AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+CREATE OR REPLACE TRIGGER "audit_events_append_only"
+  BEFORE UPDATE OR DELETE ON "audit_events"
+  FOR EACH ROW EXECUTE FUNCTION "audit_events_append_only"();
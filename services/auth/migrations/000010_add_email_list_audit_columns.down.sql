@@ -0,0 +1,12 @@
+-- DropIndex
+DROP INDEX IF EXISTS "email_blocklist_deleted_at_idx";
+DROP INDEX IF EXISTS "email_allowlist_deleted_at_idx";
+-- DropColumn
+ALTER TABLE "email_blocklist" DROP COLUMN IF EXISTS "deleted_at";
+ALTER TABLE "email_blocklist" DROP COLUMN IF EXISTS "updated_by";
+ALTER TABLE "email_blocklist" DROP COLUMN IF EXISTS "created_by";
+ALTER TABLE "email_blocklist" DROP COLUMN IF EXISTS "updated_at";
+ALTER TABLE "email_allowlist" DROP COLUMN IF EXISTS "deleted_at";
+ALTER TABLE "email_allowlist" DROP COLUMN IF EXISTS "updated_by";
+ALTER TABLE "email_allowlist" DROP COLUMN IF EXISTS "created_by";
+ALTER TABLE "email_allowlist" DROP COLUMN IF EXISTS "updated_at";
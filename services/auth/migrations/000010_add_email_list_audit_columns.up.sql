@@ -0,0 +1,22 @@
+-- AddColumn
+-- The email lists are entity tables like users (see 000008): every write is
+-- attributed and deletes are soft. Existing entries were added by hand.
+ALTER TABLE "email_allowlist" ADD COLUMN IF NOT EXISTS "updated_at" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE "email_allowlist" ADD COLUMN IF NOT EXISTS "created_by" VARCHAR(255) NOT NULL DEFAULT 'system';
+ALTER TABLE "email_allowlist" ADD COLUMN IF NOT EXISTS "updated_by" VARCHAR(255) NOT NULL DEFAULT 'system';
+ALTER TABLE "email_allowlist" ALTER COLUMN "created_by" DROP DEFAULT;
+ALTER TABLE "email_allowlist" ALTER COLUMN "updated_by" DROP DEFAULT;
+ALTER TABLE "email_allowlist" ADD COLUMN IF NOT EXISTS "deleted_at" TIMESTAMPTZ(3);
+
+ALTER TABLE "email_blocklist" ADD COLUMN IF NOT EXISTS "updated_at" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE "email_blocklist" ADD COLUMN IF NOT EXISTS "created_by" VARCHAR(255) NOT NULL DEFAULT 'system';
+ALTER TABLE "email_blocklist" ADD COLUMN IF NOT EXISTS "updated_by" VARCHAR(255) NOT NULL DEFAULT 'system';
+ALTER TABLE "email_blocklist" ALTER COLUMN "created_by" DROP DEFAULT;
+ALTER TABLE "email_blocklist" ALTER COLUMN "updated_by" DROP DEFAULT;
+ALTER TABLE "email_blocklist" ADD COLUMN IF NOT EXISTS "deleted_at" TIMESTAMPTZ(3);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "email_allowlist_deleted_at_idx" ON "email_allowlist"("deleted_at")
+  WHERE "deleted_at" IS NOT NULL;
+CREATE INDEX IF NOT EXISTS "email_blocklist_deleted_at_idx" ON "email_blocklist"("deleted_at")
+  WHERE "deleted_at" IS NOT NULL;
@@ -0,0 +1,3 @@
+-- CreateIndex
+-- The purge deletes buckets untouched for long enough to be full again.
+CREATE INDEX IF NOT EXISTS "rate_limit_buckets_updated_at_idx" ON "rate_limit_buckets"("updated_at");
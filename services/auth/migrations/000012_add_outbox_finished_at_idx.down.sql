@@ -0,0 +1,2 @@
+-- DropIndex
+DROP INDEX IF EXISTS "outbox_finished_at_idx";
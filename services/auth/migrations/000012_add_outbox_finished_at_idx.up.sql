@@ -0,0 +1,3 @@
+-- CreateIndex
+-- The purge deletes messages processed or failed before the retention period.
+CREATE INDEX IF NOT EXISTS "outbox_finished_at_idx" ON "outbox"((COALESCE("processed_at", "failed_at")));
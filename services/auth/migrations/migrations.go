@@ -0,0 +1,71 @@
+// Package migrations embeds the SQL migrations of the auth database so the
+// binary can verify (and apply) the schema without the files on disk.
+package migrations
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// FS contains the golang-migrate style up/down SQL files.
+//
+//go:embed *.sql
+var FS embed.FS
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_.+\.(up|down)\.sql$`)
+
+// LatestVersion returns the highest migration version embedded in FS.
+func LatestVersion() (uint, error) {
+	entries, err := fs.ReadDir(FS, ".")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	var latest uint
+	for _, entry := range entries {
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+		}
+		if uint(version) > latest {
+			latest = uint(version)
+		}
+	}
+
+	if latest == 0 {
+		return 0, errors.New("no migrations found")
+	}
+	return latest, nil
+}
+
+// Querier is the subset of pgx used to read the migration state.
+type Querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// ErrNoSchemaVersion is returned when no migration has been applied yet.
+var ErrNoSchemaVersion = errors.New("no migration has been applied")
+
+// CurrentVersion reads the version recorded by golang-migrate in schema_migrations.
+func CurrentVersion(ctx context.Context, db Querier) (version uint, dirty bool, err error) {
+	var v int64
+	err = db.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&v, &dirty)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, ErrNoSchemaVersion
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return uint(v), dirty, nil
+}
@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatestVersion(t *testing.T) {
+	version, err := LatestVersion()
+	require.NoError(t, err)
+
+	upFiles, err := fs.Glob(FS, "*.up.sql")
+	require.NoError(t, err)
+	assert.Equal(t, uint(len(upFiles)), version, "migrations should be numbered sequentially")
+}
+
+func TestFS_HasMatchingDownMigrations(t *testing.T) {
+	upFiles, err := fs.Glob(FS, "*.up.sql")
+	require.NoError(t, err)
+	downFiles, err := fs.Glob(FS, "*.down.sql")
+	require.NoError(t, err)
+
+	assert.Len(t, downFiles, len(upFiles), "every up migration needs a down migration")
+}
@@ -0,0 +1,146 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/pgx/v5" // registers the pgx5 driver
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// Runner applies the embedded migrations to a PostgreSQL database. It is shared
+// by cmd/migrate and the test helpers so both run exactly the same SQL.
+type Runner struct {
+	m *migrate.Migrate
+}
+
+// Status describes the migration state of a database.
+type Status struct {
+	// Version is the applied version; zero when nothing has been applied.
+	Version uint
+	Dirty   bool
+	// Latest is the highest version embedded in the binary.
+	Latest uint
+}
+
+// Pending reports whether embedded migrations have not been applied yet.
+func (s Status) Pending() bool {
+	return s.Version < s.Latest
+}
+
+// NewRunner opens a runner for the database at databaseURL, a postgres:// or
+// postgresql:// connection string.
+func NewRunner(databaseURL string) (*Runner, error) {
+	migrateURL, err := driverURL(databaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := iofs.New(FS, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded migrations: %w", err)
+	}
+
+	m, err := migrate.NewWithSourceInstance("iofs", source, migrateURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open migration runner: %w", err)
+	}
+	return &Runner{m: m}, nil
+}
+
+// driverURL rewrites the connection string to the scheme of the pgx driver.
+func driverURL(databaseURL string) (string, error) {
+	u, err := url.Parse(databaseURL)
+	if err != nil {
+		return "", errors.New("invalid database URL")
+	}
+	switch u.Scheme {
+	case "postgres", "postgresql":
+		u.Scheme = "pgx5"
+		return u.String(), nil
+	default:
+		return "", fmt.Errorf("unsupported database URL scheme %q", u.Scheme)
+	}
+}
+
+// Up applies every pending migration. It is a no-op when the schema is current.
+func (r *Runner) Up() error {
+	if err := r.m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("failed to apply migrations: %w", err)
+	}
+	return nil
+}
+
+// Down rolls back the last steps migrations.
+func (r *Runner) Down(steps int) error {
+	if steps < 1 {
+		return fmt.Errorf("steps must be positive, got %d", steps)
+	}
+	if err := r.m.Steps(-steps); err != nil {
+		return fmt.Errorf("failed to roll back migrations: %w", err)
+	}
+	return nil
+}
+
+// Force records version as applied and clears the dirty flag without running
+// any SQL. It is meant for recovering from a failed migration by hand.
+func (r *Runner) Force(version int) error {
+	if err := r.m.Force(version); err != nil {
+		return fmt.Errorf("failed to force version %d: %w", version, err)
+	}
+	return nil
+}
+
+// Status reports the applied and embedded migration versions.
+func (r *Runner) Status() (Status, error) {
+	latest, err := LatestVersion()
+	if err != nil {
+		return Status{}, err
+	}
+
+	version, dirty, err := r.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return Status{Latest: latest}, nil
+	}
+	if err != nil {
+		return Status{}, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return Status{Version: version, Dirty: dirty, Latest: latest}, nil
+}
+
+// Close releases the database connection held by the runner.
+func (r *Runner) Close() error {
+	sourceErr, dbErr := r.m.Close()
+	return errors.Join(sourceErr, dbErr)
+}
+
+// ErrSchemaBehind is returned by CheckSchema when migrations are pending.
+var ErrSchemaBehind = errors.New("database schema is behind the embedded migrations")
+
+// CheckSchema verifies that every embedded migration has been applied and the
+// schema is not dirty. A schema ahead of the binary is accepted so an older
+// release keeps running while a newer one is rolled out.
+func CheckSchema(ctx context.Context, db Querier) error {
+	latest, err := LatestVersion()
+	if err != nil {
+		return err
+	}
+
+	version, dirty, err := CurrentVersion(ctx, db)
+	if errors.Is(err, ErrNoSchemaVersion) {
+		return fmt.Errorf("%w: no migration applied, expected version %d", ErrSchemaBehind, latest)
+	}
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("schema version %d is dirty", version)
+	}
+	if version < latest {
+		return fmt.Errorf("%w: at version %d, expected %d", ErrSchemaBehind, version, latest)
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+// Package auth holds the files at the root of the auth service that are
+// embedded into its binaries.
+package auth
+
+import _ "embed"
+
+// OpenAPISpec is the OpenAPI document describing the HTTP API. The web client
+// is generated from the same file.
+//
+//go:embed openapi.yaml
+var OpenAPISpec []byte
@@ -1,7 +1,7 @@
 import { browser } from "$app/environment";
 import { get } from "svelte/store";
 import { _ } from "$lib/i18n";
-import { translateApiError } from "$lib/i18n/helpers";
+import { translateApiError, translateFieldErrors } from "$lib/i18n/helpers";
 import { Configuration, AuthenticationApi, ResponseError, FetchError } from "./generated";
 
 /**
@@ -12,7 +12,9 @@ export class ApiError extends Error {
 		message: string,
 		public status: number,
 		public code?: string,
-		public originalMessage?: string
+		public originalMessage?: string,
+		/** Translated messages by field when code is "validation_failed" */
+		public fieldErrors: Record<string, string> = {}
 	) {
 		super(message);
 		this.name = "ApiError";
@@ -63,7 +65,8 @@ async function handleApiError(error: unknown): Promise<never> {
 				const data = await response.json();
 				if (data?.code) {
 					const translatedMessage = translateApiError(data.code, data.message);
-					throw new ApiError(translatedMessage, status, data.code, data.message);
+					const fieldErrors = Array.isArray(data.fields) ? translateFieldErrors(data.fields) : {};
+					throw new ApiError(translatedMessage, status, data.code, data.message, fieldErrors);
 				}
 			}
 			// If no JSON or no code, use generic error based on status
@@ -8,12 +8,53 @@ export const API_ERROR_CODES = {
 	// Erros de validação (400)
 	invalid_request: "errors.invalidRequest",
 	missing_fields: "errors.missingFields",
+	validation_failed: "errors.validationFailed",
+
+	// Erros de política de cadastro (403)
+	email_not_allowed: "auth.signup.errors.emailNotAllowed",
+	bot_check_failed: "auth.signup.errors.botCheckFailed",
 
 	// Erros de conflito (409)
 	user_exists: "auth.signup.errors.userExists",
+	idempotency_in_progress: "errors.requestInProgress",
+
+	// Chave de idempotência reutilizada (422)
+	idempotency_key_reused: "errors.requestConflict",
+
+	// Excesso de tentativas (429)
+	rate_limited: "errors.rateLimited",
 
 	// Erros de servidor (500)
 	internal_error: "errors.serverError",
+
+	// Serviço indisponível (503)
+	bot_check_unavailable: "auth.signup.errors.botCheckUnavailable",
 } as const;
 
 export type ApiErrorCode = keyof typeof API_ERROR_CODES;
+
+/**
+ * Mapeamento dos códigos de erro por campo (`fields[].code` em `validation_failed`)
+ * para chaves de tradução. Os `params` do erro (ex: `min`) são repassados à tradução.
+ */
+export const API_FIELD_ERROR_CODES = {
+	required: "validation.required",
+	too_short: "validation.minLength",
+	too_long: "validation.maxLength",
+	invalid_format: "validation.invalidFormat",
+	invalid_type: "validation.invalid",
+	invalid_value: "validation.invalid",
+	invalid: "validation.invalid",
+} as const;
+
+export type ApiFieldErrorCode = keyof typeof API_FIELD_ERROR_CODES;
+
+/**
+ * Erro de um campo retornado pela API quando `code` é `validation_failed`
+ */
+export interface ApiFieldError {
+	field: string;
+	code: string;
+	message: string;
+	params?: Record<string, unknown>;
+}
@@ -1,6 +1,12 @@
 import { get } from "svelte/store";
 import { _ } from "svelte-i18n";
-import { API_ERROR_CODES, type ApiErrorCode } from "./errorCodes";
+import {
+	API_ERROR_CODES,
+	API_FIELD_ERROR_CODES,
+	type ApiErrorCode,
+	type ApiFieldError,
+	type ApiFieldErrorCode,
+} from "./errorCodes";
 
 /**
  * Traduz um erro da API baseado no código retornado
@@ -27,3 +33,35 @@ export function translateApiError(errorCode: string, fallbackMessage?: string):
 
 	return get(_)("errors.unknown");
 }
+
+/**
+ * Traduz os erros de campo de uma resposta `validation_failed`
+ *
+ * @param fields - Lista `fields` retornada pela API
+ * @returns Mensagens traduzidas indexadas pelo nome do campo
+ */
+export function translateFieldErrors(fields: ApiFieldError[]): Record<string, string> {
+	const messages: Record<string, string> = {};
+
+	for (const fieldError of fields) {
+		// Formatos específicos (ex: email) têm mensagens próprias
+		const format = fieldError.params?.format;
+		const translationKey =
+			fieldError.code === "invalid_format" && format === "email"
+				? "validation.email"
+				: API_FIELD_ERROR_CODES[fieldError.code as ApiFieldErrorCode];
+
+		let message = fieldError.message;
+		if (translationKey) {
+			const values = (fieldError.params ?? {}) as Record<string, string | number>;
+			const translated = get(_)(translationKey, { values });
+			if (translated !== translationKey) {
+				message = translated;
+			}
+		}
+
+		messages[fieldError.field] = message;
+	}
+
+	return messages;
+}